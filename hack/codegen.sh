@@ -20,4 +20,4 @@ GO111MODULE=on ${scriptdir}/generate-groups.sh \
   deepcopy,defaulter \
   yunion.io/x/ocadm/pkg/client \
   yunion.io/x/ocadm/pkg \
-  "apis:v1"
+  "apis:v1,v1beta1"
@@ -32,6 +32,7 @@ const (
 	DefaultPromtailVersion            = DefaultLokiVersion
 	Grafana                           = "grafana"
 	DefaultGrafanaVersion             = "6.5.2"
+	Keepalived                        = "keepalived"
 	DefaultKeepalivedVersionTag       = "v2.0.25"
 	// mirror of kiwigrid/k8s-sidecar:0.1.20
 	K8sSidecar               = "k8s-sidecar"
@@ -40,6 +41,9 @@ const (
 	BusyboxVersion           = "1.28.0-glibc"
 	MetricsServer            = "metrics-server"
 	MetricsServerVersion     = "v0.3.6"
+	// RsyncSSH is used to migrate pv data to longhorn
+	RsyncSSH        = "rsync-ssh"
+	RsyncSSHVersion = "latest"
 
 	EndpointTypeInternal = "internal"
 	EndpointTypePublic   = "public"
@@ -114,6 +118,20 @@ const (
 	// OnecloudAdminConfigConfigMap specifies in what ConfigMap in the kube-system namespace the `ocadm init` configuration should be stored
 	OnecloudAdminConfigConfigMap = "ocadm-config"
 
+	// OnecloudAddonsConfigMap specifies in what ConfigMap in the kube-system namespace the installed addons are tracked
+	OnecloudAddonsConfigMap = "ocadm-addons"
+
+	// AddonNameLabel is the label set on the objects applied by an addon to its name
+	AddonNameLabel = "addons.ocadm.yunion.io/name"
+	// AddonVersionLabel is the label set on the objects applied by an addon to its version
+	AddonVersionLabel = "addons.ocadm.yunion.io/version"
+	// AddonFieldManager is the field manager of server-side applied addon objects
+	AddonFieldManager = "ocadm"
+
+	// MysqlOptionsAnnotation is the OnecloudCluster annotation holding the mysql TLS and socket options
+	// used by ocadm, which can't be expressed by spec.mysql and aren't applied to services
+	MysqlOptionsAnnotation = "ocadm.yunion.io/mysql-options"
+
 	// ClusterConfigurationConfigMapKey specifies in what ConfigMap key the cluster configuration should be stored
 	ClusterConfigurationConfigMapKey = "ClusterConfiguration"
 
@@ -144,6 +162,14 @@ const (
 	ClimcCertName                 = "climc.crt"
 	ClimcKeyName                  = "climc.key"
 
+	// ServiceCertAndKeyBaseName defines the base name of the certificate serving onecloud services
+	ServiceCertAndKeyBaseName = "service"
+	ServiceCertName           = "service.crt"
+	ServiceKeyName            = "service.key"
+	// IngressTLSCertName and IngressTLSKeyName are the keys of web ingress certificate in the onecloud operator certs Secret
+	IngressTLSCertName = "tls.crt"
+	IngressTLSKeyName  = "tls.key"
+
 	OcadmCertsSecret = "ocadm-certs"
 )
 
@@ -6,7 +6,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
 	"yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/apis/v1beta1"
 )
 
 // Scheme is the runtime.Scheme to which all deployer api types are registered.
@@ -23,4 +25,6 @@ func init() {
 // AddToScheme builds the deployer scheme using all knowns version of the deployer api.
 func AddToScheme(scheme *runtime.Scheme) {
 	utilruntime.Must(v1.AddtoScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+	utilruntime.Must(scheme.SetVersionPriority(v1beta1.SchemeGroupVersion, v1.SchemeGroupVersion))
 }
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
@@ -28,6 +29,8 @@ const (
 	DefaultMysqlUser                   = "root"
 	DefaultMysqlAddress                = "127.0.0.1"
 	DefaultMysqlPort                   = 3306
+	DefaultMysqlCharset                = "utf8"
+	DefaultMysqlConnectTimeout         = 10 * time.Second
 	DefaultKeystoneFernetKeyRepository = "/etc/yunion/keystone/fernet-keys"
 
 	// DefaultOnecloudCertificatesDir defines default onecloud certificate directory
@@ -39,6 +42,12 @@ const (
 
 	// default etcd version
 	DefaultEtcdVersion = "3.4.6"
+
+	// DefaultNodeCIDRMaskSize is the default node-cidr-mask-size of controller manager
+	DefaultNodeCIDRMaskSize = 24
+
+	// DefaultCalicoIPV4PoolBlockSize is the default block size of calico IPv4 pool
+	DefaultCalicoIPV4PoolBlockSize = 26
 )
 
 var (
@@ -67,6 +76,19 @@ func SetDefaults_MysqlConnection(obj *MysqlConnection) {
 	if obj.Port == 0 {
 		obj.Port = DefaultMysqlPort
 	}
+	setDefaults_MysqlConnectionOptions(&obj.MysqlConnectionOptions)
+}
+
+func setDefaults_MysqlConnectionOptions(obj *MysqlConnectionOptions) {
+	if obj.TLSMode == "" {
+		obj.TLSMode = MysqlTLSDisabled
+	}
+	if obj.Charset == "" {
+		obj.Charset = DefaultMysqlCharset
+	}
+	if obj.ConnectTimeout == 0 {
+		obj.ConnectTimeout = DefaultMysqlConnectTimeout
+	}
 }
 
 // SetDefaults_ClusterConfiguration assigns default values for the ClusterConfiguration
@@ -78,6 +100,22 @@ func SetDefaults_ClusterConfiguration(obj *ClusterConfiguration) {
 	if obj.Region == "" {
 		obj.Region = DefaultOnecloudRegion
 	}
+	if obj.OnecloudCertificatesDir == "" {
+		obj.OnecloudCertificatesDir = DefaultOnecloudCertificatesDir
+	}
+	if obj.OperatorVersion == "" {
+		obj.OperatorVersion = DefaultOperatorVersion
+	}
+	if obj.NodeCIDRMaskSize == 0 {
+		obj.NodeCIDRMaskSize = DefaultNodeCIDRMaskSize
+	}
+	SetDefaults_CalicoConfiguration(&obj.Calico)
+}
+
+func SetDefaults_CalicoConfiguration(obj *CalicoConfiguration) {
+	if obj.IPV4PoolBlockSize == 0 {
+		obj.IPV4PoolBlockSize = DefaultCalicoIPV4PoolBlockSize
+	}
 }
 
 // SetDefaults_JoinConfiguration assigns default values to a regular node
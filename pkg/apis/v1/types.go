@@ -3,6 +3,9 @@ package v1
 import (
 	"fmt"
 	"net"
+	"net/url"
+	"strconv"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
@@ -21,6 +24,9 @@ type InitConfiguration struct {
 
 	// HostLocalInfo holds the local node info
 	HostLocalInfo `json:"-"`
+
+	// Node holds the onecloud settings of the init node
+	Node NodeConfiguration
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -30,6 +36,18 @@ type JoinConfiguration struct {
 	metav1.TypeMeta
 
 	kubeadmapi.JoinConfiguration `json:"-"`
+
+	// Node holds the onecloud settings of the joining node
+	Node NodeConfiguration
+
+	// AsOnecloudController labels the node to run onecloud controller services
+	AsOnecloudController bool
+
+	// HighAvailabilityVIP is the keepalived VIP of control plane, only used by control plane node
+	HighAvailabilityVIP string
+
+	// KeepalivedVersionTag is the image tag of keepalived
+	KeepalivedVersionTag string
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -46,6 +64,88 @@ type ClusterConfiguration struct {
 
 	// Region specify keystone auth region
 	Region string
+
+	// OnecloudCertificatesDir specifies where to store or look for the onecloud certificates
+	OnecloudCertificatesDir string
+
+	// OperatorVersion is the version of onecloud operator
+	OperatorVersion string
+
+	// HighAvailabilityVIP is the keepalived VIP of control plane
+	HighAvailabilityVIP string
+
+	// KeepalivedVersionTag is the image tag of keepalived
+	KeepalivedVersionTag string
+
+	// NodeCIDRMaskSize is the mask size of node pod cidr allocated by controller manager
+	NodeCIDRMaskSize int
+
+	// Calico holds the calico addon options
+	Calico CalicoConfiguration
+
+	// Addons holds the addons toggles
+	Addons AddonsConfiguration
+}
+
+type CalicoConfiguration struct {
+	// IPAutodetectionMethod is the IP_AUTODETECTION_METHOD of calico node
+	IPAutodetectionMethod string
+
+	// FelixChainInsertMode is the FELIX_CHAININSERTMODE of calico node
+	FelixChainInsertMode string
+
+	// IPV4PoolBlockSize is the block size of default IPv4 pool
+	IPV4PoolBlockSize int
+}
+
+type AddonsConfiguration struct {
+	// Disabled are the names of addons not installed by init
+	Disabled []string
+}
+
+func (c AddonsConfiguration) IsDisabled(name string) bool {
+	for _, d := range c.Disabled {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeConfiguration holds the onecloud settings of a node
+type NodeConfiguration struct {
+	// NodeIP is the ip address used by kubelet
+	NodeIP string
+
+	// Host holds the host agent settings
+	Host HostConfiguration
+
+	// GlanceNode labels the node to run glance
+	GlanceNode bool
+
+	// BaremetalNode labels the node to run baremetal agent
+	BaremetalNode bool
+
+	// EsxiNode labels the node to run esxi agent
+	EsxiNode bool
+}
+
+// HostConfiguration holds the host agent settings of a node
+type HostConfiguration struct {
+	// Enabled labels the node to run host agent
+	Enabled bool
+
+	// LocalImagePath are the local image directories of host agent
+	LocalImagePath []string
+
+	// Networks are the host networks, e.g. eth0/br0/10.168.222.21
+	Networks []string
+
+	// Hostname is the name of host agent
+	Hostname string
+
+	// EnableHugepage enables hugepage of host agent
+	EnableHugepage bool
 }
 
 type HostLocalInfo struct {
@@ -77,11 +177,117 @@ func (iface NetInterface) IPAddress() string {
 	return iface.Address.String()
 }
 
+// MysqlTLSMode is the TLS mode of mysql connection, named after the --ssl-mode option of mysql client
+type MysqlTLSMode string
+
+const (
+	// MysqlTLSDisabled uses plain connection
+	MysqlTLSDisabled MysqlTLSMode = "disabled"
+	// MysqlTLSPreferred uses TLS if the server supports it, without verifying the server certificate
+	MysqlTLSPreferred MysqlTLSMode = "preferred"
+	// MysqlTLSRequired fails if the server doesn't support TLS, the server certificate isn't verified
+	MysqlTLSRequired MysqlTLSMode = "required"
+	// MysqlTLSVerifyCA verifies the server certificate is signed by the CA
+	MysqlTLSVerifyCA MysqlTLSMode = "verify-ca"
+	// MysqlTLSVerifyIdentity verifies the server certificate is signed by the CA and matches the server host name
+	MysqlTLSVerifyIdentity MysqlTLSMode = "verify-identity"
+)
+
+// MysqlTLSModes are all the supported TLS modes
+var MysqlTLSModes = []MysqlTLSMode{MysqlTLSDisabled, MysqlTLSPreferred, MysqlTLSRequired, MysqlTLSVerifyCA, MysqlTLSVerifyIdentity}
+
+// IsEnabled returns true if the connection may be encrypted
+func (m MysqlTLSMode) IsEnabled() bool {
+	return m != "" && m != MysqlTLSDisabled
+}
+
+// VerifyServer returns true if the server certificate is verified against the CA
+func (m MysqlTLSMode) VerifyServer() bool {
+	return m == MysqlTLSVerifyCA || m == MysqlTLSVerifyIdentity
+}
+
+// MysqlConnectionOptions holds the TLS and socket options shared by all connections to the mysql server
+type MysqlConnectionOptions struct {
+	// TLSMode is the TLS mode of connection, defaults to disabled. Services managed by onecloud-operator
+	// can't use TLS, so only disabled and preferred are accepted by cluster creation
+	TLSMode MysqlTLSMode
+	// CAFile is the CA certificate verifying the server, required by verify-ca and verify-identity
+	CAFile string
+	// CertFile and KeyFile are the client certificate and key, used if the server requires X509 authentication
+	CertFile string
+	KeyFile  string
+	// ConnectTimeout is the timeout of establishing connection
+	ConnectTimeout time.Duration
+	// ReadTimeout is the I/O read timeout, zero means no timeout
+	ReadTimeout time.Duration
+	// Charset is the connection character set of services, defaults to utf8,
+	// connections of ocadm always use utf8mb4
+	Charset string
+}
+
+func (o MysqlConnectionOptions) charset() string {
+	if o.Charset == "" {
+		return DefaultMysqlCharset
+	}
+	return o.Charset
+}
+
+// PyMySQLQuery returns the query of SQLAlchemy pymysql connection url
+func (o MysqlConnectionOptions) PyMySQLQuery() string {
+	query := url.Values{}
+	query.Set("charset", o.charset())
+	if o.ConnectTimeout > 0 {
+		query.Set("connect_timeout", strconv.Itoa(int(o.ConnectTimeout.Seconds())))
+	}
+	if o.ReadTimeout > 0 {
+		query.Set("read_timeout", strconv.Itoa(int(o.ReadTimeout.Seconds())))
+	}
+	if o.TLSMode.IsEnabled() {
+		if o.CAFile != "" {
+			query.Set("ssl_ca", o.CAFile)
+		}
+		if o.CertFile != "" && o.KeyFile != "" {
+			query.Set("ssl_cert", o.CertFile)
+			query.Set("ssl_key", o.KeyFile)
+		}
+		query.Set("ssl_check_hostname", strconv.FormatBool(o.TLSMode == MysqlTLSVerifyIdentity))
+	}
+	return query.Encode()
+}
+
+// JDBCQuery returns the query of MySQL Connector/J jdbc url. The server certificate is verified by
+// the truststore of JVM in the verify modes, because Connector/J can't load CA in PEM format.
+func (o MysqlConnectionOptions) JDBCQuery() string {
+	query := url.Values{}
+	query.Set("useUnicode", "true")
+	encoding := o.charset()
+	if encoding == "utf8mb4" {
+		// Connector/J negotiates utf8mb4 for UTF-8
+		encoding = "UTF-8"
+	}
+	query.Set("characterEncoding", encoding)
+	query.Set("zeroDateTimeBehavior", "convertToNull")
+	if o.ConnectTimeout > 0 {
+		query.Set("connectTimeout", strconv.FormatInt(int64(o.ConnectTimeout/time.Millisecond), 10))
+	}
+	if o.ReadTimeout > 0 {
+		query.Set("socketTimeout", strconv.FormatInt(int64(o.ReadTimeout/time.Millisecond), 10))
+	}
+	query.Set("useSSL", strconv.FormatBool(o.TLSMode.IsEnabled()))
+	if o.TLSMode.IsEnabled() {
+		query.Set("requireSSL", strconv.FormatBool(o.TLSMode != MysqlTLSPreferred))
+		query.Set("verifyServerCertificate", strconv.FormatBool(o.TLSMode.VerifyServer()))
+	}
+	return query.Encode()
+}
+
 type MysqlConnection struct {
 	Server   string
 	Port     int
 	Username string
 	Password string
+
+	MysqlConnectionOptions
 }
 
 type DBInfo struct {
@@ -90,8 +296,12 @@ type DBInfo struct {
 	Username string
 	Password string
 	Database string
+
+	MysqlConnectionOptions
 }
 
 func (info DBInfo) ToSQLConnection() string {
-	return fmt.Sprintf("mysql+pymysql://%s:%s@%s:%d/%s?charset=utf8", info.Username, info.Password, info.Host, info.Port, info.Database)
+	return fmt.Sprintf("mysql+pymysql://%s@%s/%s?%s",
+		url.UserPassword(info.Username, info.Password), net.JoinHostPort(info.Host, strconv.Itoa(info.Port)),
+		info.Database, info.PyMySQLQuery())
 }
@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+const (
+	// calico IPAM only supports IPv4 block size between 20 and 32
+	minCalicoIPV4PoolBlockSize = 20
+	maxCalicoIPV4PoolBlockSize = 32
+)
+
+var (
+	calicoFelixChainInsertModes = []string{"Insert", "Append"}
+
+	calicoIPAutodetectionMethodPrefixes = []string{"can-reach=", "interface=", "skip-interface="}
+
+	// mysqlCharsets are the connection charsets understood by both pymysql and jdbc
+	mysqlCharsets = []string{"utf8", "utf8mb4"}
+)
+
+// ValidateInitConfiguration validates the onecloud part of InitConfiguration and collects all encountered errors
+func ValidateInitConfiguration(c *apiv1.InitConfiguration) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, ValidateClusterConfiguration(&c.ClusterConfiguration)...)
+	allErrs = append(allErrs, ValidateHostLocalInfo(&c.HostLocalInfo)...)
+	allErrs = append(allErrs, ValidateNodeConfiguration(&c.Node, field.NewPath("node"))...)
+	allErrs = append(allErrs, ValidateHighAvailabilityVIP(c.ClusterConfiguration.HighAvailabilityVIP, c.HostLocalInfo.ManagementNetInterface, field.NewPath("highAvailabilityVIP"))...)
+	return allErrs
+}
+
+// ValidateClusterConfiguration validates the onecloud ClusterConfiguration and collects all encountered errors
+func ValidateClusterConfiguration(c *apiv1.ClusterConfiguration) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, ValidateMysqlConnection(&c.MysqlConnection, field.NewPath("mysqlConnection"))...)
+	if len(c.OnecloudVersion) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("onecloudVersion"), ""))
+	}
+	if len(c.Region) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("region"), ""))
+	}
+	if len(c.HighAvailabilityVIP) != 0 {
+		allErrs = append(allErrs, validateIPv4Address(c.HighAvailabilityVIP, field.NewPath("highAvailabilityVIP"))...)
+	}
+	allErrs = append(allErrs, ValidateCalicoConfiguration(&c.Calico, field.NewPath("calico"))...)
+	allErrs = append(allErrs, ValidateNodeCIDRMaskSize(c.NodeCIDRMaskSize, c.Calico.IPV4PoolBlockSize, field.NewPath("nodeCIDRMaskSize"))...)
+	allErrs = append(allErrs, ValidateAddonsConfiguration(&c.Addons, field.NewPath("addons"))...)
+	return allErrs
+}
+
+// ValidateMysqlConnection validates the mysql admin connection info
+func ValidateMysqlConnection(c *apiv1.MysqlConnection, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(c.Server) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("server"), ""))
+	} else if net.ParseIP(c.Server) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(c.Server) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("server"), c.Server, msg))
+		}
+	}
+	for _, msg := range validation.IsValidPortNum(c.Port) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("port"), c.Port, msg))
+	}
+	if len(c.Username) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("username"), ""))
+	}
+	allErrs = append(allErrs, ValidateMysqlConnectionOptions(&c.MysqlConnectionOptions, fldPath)...)
+	return allErrs
+}
+
+// ValidateMysqlConnectionOptions validates the TLS, timeout and charset options of mysql connection
+func ValidateMysqlConnectionOptions(o *apiv1.MysqlConnectionOptions, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(o.TLSMode) != 0 && !hasTLSMode(o.TLSMode) {
+		modes := make([]string, 0, len(apiv1.MysqlTLSModes))
+		for _, m := range apiv1.MysqlTLSModes {
+			modes = append(modes, string(m))
+		}
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("tlsMode"), o.TLSMode, modes))
+	}
+	if o.TLSMode.VerifyServer() && len(o.CAFile) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("caFile"), fmt.Sprintf("required by tls mode %s", o.TLSMode)))
+	}
+	if (len(o.CertFile) == 0) != (len(o.KeyFile) == 0) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("keyFile"), o.KeyFile, "certFile and keyFile must be specified together"))
+	}
+	if o.ConnectTimeout < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("connectTimeout"), o.ConnectTimeout.String(), "must not be negative"))
+	}
+	if o.ReadTimeout < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("readTimeout"), o.ReadTimeout.String(), "must not be negative"))
+	}
+	if len(o.Charset) != 0 && !hasString(mysqlCharsets, o.Charset) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("charset"), o.Charset, mysqlCharsets))
+	}
+	return allErrs
+}
+
+func hasTLSMode(mode apiv1.MysqlTLSMode) bool {
+	for _, m := range apiv1.MysqlTLSModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCalicoConfiguration validates the calico addon options
+func ValidateCalicoConfiguration(c *apiv1.CalicoConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if c.IPV4PoolBlockSize < minCalicoIPV4PoolBlockSize || c.IPV4PoolBlockSize > maxCalicoIPV4PoolBlockSize {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("ipv4PoolBlockSize"), c.IPV4PoolBlockSize,
+			fmt.Sprintf("must be between %d and %d, inclusive", minCalicoIPV4PoolBlockSize, maxCalicoIPV4PoolBlockSize)))
+	}
+	if len(c.FelixChainInsertMode) != 0 && !hasString(calicoFelixChainInsertModes, c.FelixChainInsertMode) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("felixChainInsertMode"), c.FelixChainInsertMode, calicoFelixChainInsertModes))
+	}
+	if method := c.IPAutodetectionMethod; len(method) != 0 && method != "first-found" {
+		valid := false
+		for _, prefix := range calicoIPAutodetectionMethodPrefixes {
+			if strings.HasPrefix(method, prefix) && len(method) > len(prefix) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ipAutodetectionMethod"), method,
+				fmt.Sprintf("must be 'first-found' or start with one of %v", calicoIPAutodetectionMethodPrefixes)))
+		}
+	}
+	return allErrs
+}
+
+// ValidateNodeCIDRMaskSize validates the node cidr mask size is able to hold at least one calico block
+func ValidateNodeCIDRMaskSize(maskSize int, calicoBlockSize int, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if maskSize < 1 || maskSize > 32 {
+		allErrs = append(allErrs, field.Invalid(fldPath, maskSize, "must be between 1 and 32, inclusive"))
+	} else if maskSize > calicoBlockSize {
+		allErrs = append(allErrs, field.Invalid(fldPath, maskSize, fmt.Sprintf("must be less than or equal to calico ipv4PoolBlockSize %d", calicoBlockSize)))
+	}
+	return allErrs
+}
+
+// ValidateAddonsConfiguration validates the addons toggles
+func ValidateAddonsConfiguration(c *apiv1.AddonsConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, name := range c.Disabled {
+		if len(name) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("disabled").Index(i), ""))
+		}
+	}
+	return allErrs
+}
+
+// ValidateHostLocalInfo validates the local node info, the management interface is only validated once it's detected
+func ValidateHostLocalInfo(info *apiv1.HostLocalInfo) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(info.Zone) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("zone"), ""))
+	}
+	iface := info.ManagementNetInterface
+	if iface.Address != nil && (iface.MaskLen < 0 || iface.MaskLen > 32) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("managementNetInterface", "maskLen"), iface.MaskLen, "must be between 0 and 32, inclusive"))
+	}
+	return allErrs
+}
+
+// ValidateHighAvailabilityVIP validates the VIP is inside the subnet of management interface
+func ValidateHighAvailabilityVIP(vip string, iface apiv1.NetInterface, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ip := net.ParseIP(vip)
+	if ip == nil || iface.Address == nil {
+		return allErrs
+	}
+	subnet := &net.IPNet{
+		IP:   iface.Address.Mask(net.CIDRMask(iface.MaskLen, 32)),
+		Mask: net.CIDRMask(iface.MaskLen, 32),
+	}
+	if !subnet.Contains(ip) {
+		allErrs = append(allErrs, field.Invalid(fldPath, vip, fmt.Sprintf("must be inside the management subnet %s of interface %s", subnet, iface.Interface)))
+	}
+	return allErrs
+}
+
+// ValidateNodeConfiguration validates the onecloud settings of a node
+func ValidateNodeConfiguration(c *apiv1.NodeConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(c.NodeIP) != 0 && net.ParseIP(c.NodeIP) == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("nodeIP"), c.NodeIP, "must be a valid IP address"))
+	}
+	allErrs = append(allErrs, ValidateHostConfiguration(&c.Host, fldPath.Child("host"))...)
+	return allErrs
+}
+
+// ValidateHostConfiguration validates the host agent settings, networks are in format of <interface>/<bridge>[/<ip>]
+func ValidateHostConfiguration(c *apiv1.HostConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, network := range c.Networks {
+		idxPath := fldPath.Child("networks").Index(i)
+		parts := strings.Split(network, "/")
+		if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			allErrs = append(allErrs, field.Invalid(idxPath, network, "must be in format of <interface>/<bridge>[/<ip>]"))
+			continue
+		}
+		if len(parts) > 2 && net.ParseIP(parts[2]) == nil {
+			allErrs = append(allErrs, field.Invalid(idxPath, network, fmt.Sprintf("%q is not a valid IP address", parts[2])))
+		}
+	}
+	for i, p := range c.LocalImagePath {
+		if !strings.HasPrefix(p, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("localImagePath").Index(i), p, "must be an absolute path"))
+		}
+	}
+	return allErrs
+}
+
+// ValidateJoinConfiguration validates the onecloud part of JoinConfiguration and collects all encountered errors
+func ValidateJoinConfiguration(c *apiv1.JoinConfiguration) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, ValidateNodeConfiguration(&c.Node, field.NewPath("node"))...)
+	if len(c.HighAvailabilityVIP) != 0 {
+		allErrs = append(allErrs, validateIPv4Address(c.HighAvailabilityVIP, field.NewPath("highAvailabilityVIP"))...)
+	}
+	return allErrs
+}
+
+func validateIPv4Address(address string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ip := net.ParseIP(address)
+	if ip == nil || ip.To4() == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, "must be a valid IPv4 address"))
+	}
+	return allErrs
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
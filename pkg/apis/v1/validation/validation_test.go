@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func newValidInitConfiguration() *apiv1.InitConfiguration {
+	cfg := &apiv1.InitConfiguration{}
+	cfg.MysqlConnection = apiv1.MysqlConnection{
+		Server:   "10.168.222.10",
+		Port:     3306,
+		Username: "root",
+		Password: "passwd",
+	}
+	cfg.OnecloudVersion = "v3.8.5"
+	cfg.Region = "region0"
+	cfg.NodeCIDRMaskSize = 24
+	cfg.Calico.IPV4PoolBlockSize = 26
+	cfg.ClusterConfiguration.HighAvailabilityVIP = "10.168.222.100"
+	cfg.HostLocalInfo.Zone = "zone0"
+	cfg.HostLocalInfo.ManagementNetInterface = apiv1.NetInterface{
+		Interface: "eth0",
+		Address:   net.ParseIP("10.168.222.11"),
+		MaskLen:   24,
+	}
+	return cfg
+}
+
+func TestValidateInitConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*apiv1.InitConfiguration)
+		wantPath string
+	}{
+		{"valid", func(*apiv1.InitConfiguration) {}, ""},
+		{"mysql port 0", func(c *apiv1.InitConfiguration) { c.MysqlConnection.Port = 0 }, "mysqlConnection.port"},
+		{"empty mysql server", func(c *apiv1.InitConfiguration) { c.MysqlConnection.Server = "" }, "mysqlConnection.server"},
+		{"invalid mysql server", func(c *apiv1.InitConfiguration) { c.MysqlConnection.Server = "mysql_server" }, "mysqlConnection.server"},
+		{"mysql tls verify-ca", func(c *apiv1.InitConfiguration) {
+			c.MysqlConnection.TLSMode = apiv1.MysqlTLSVerifyCA
+			c.MysqlConnection.CAFile = "/etc/mysql/ca.pem"
+		}, ""},
+		{"unsupported mysql tls mode", func(c *apiv1.InitConfiguration) { c.MysqlConnection.TLSMode = "verify" }, "mysqlConnection.tlsMode"},
+		{"mysql tls verify without ca", func(c *apiv1.InitConfiguration) { c.MysqlConnection.TLSMode = apiv1.MysqlTLSVerifyIdentity }, "mysqlConnection.caFile"},
+		{"mysql cert without key", func(c *apiv1.InitConfiguration) { c.MysqlConnection.CertFile = "/etc/mysql/client.pem" }, "mysqlConnection.keyFile"},
+		{"negative mysql read timeout", func(c *apiv1.InitConfiguration) { c.MysqlConnection.ReadTimeout = -time.Second }, "mysqlConnection.readTimeout"},
+		{"unsupported mysql charset", func(c *apiv1.InitConfiguration) { c.MysqlConnection.Charset = "latin1" }, "mysqlConnection.charset"},
+		{"empty region", func(c *apiv1.InitConfiguration) { c.Region = "" }, "region"},
+		{"empty zone", func(c *apiv1.InitConfiguration) { c.HostLocalInfo.Zone = "" }, "zone"},
+		{"node cidr larger than calico block", func(c *apiv1.InitConfiguration) { c.NodeCIDRMaskSize = 27 }, "nodeCIDRMaskSize"},
+		{"calico block size too small", func(c *apiv1.InitConfiguration) { c.Calico.IPV4PoolBlockSize = 16; c.NodeCIDRMaskSize = 16 }, "calico.ipv4PoolBlockSize"},
+		{"unsupported felix chain insert mode", func(c *apiv1.InitConfiguration) { c.Calico.FelixChainInsertMode = "insert" }, "calico.felixChainInsertMode"},
+		{"invalid ip autodetection method", func(c *apiv1.InitConfiguration) { c.Calico.IPAutodetectionMethod = "can-reach=" }, "calico.ipAutodetectionMethod"},
+		{"vip outside management subnet", func(c *apiv1.InitConfiguration) { c.ClusterConfiguration.HighAvailabilityVIP = "10.168.223.100" }, "highAvailabilityVIP"},
+		{"invalid vip", func(c *apiv1.InitConfiguration) { c.ClusterConfiguration.HighAvailabilityVIP = "10.168.222" }, "highAvailabilityVIP"},
+		{"vip without detected interface", func(c *apiv1.InitConfiguration) {
+			c.ClusterConfiguration.HighAvailabilityVIP = "10.168.223.100"
+			c.HostLocalInfo.ManagementNetInterface = apiv1.NetInterface{}
+		}, ""},
+		{"invalid node ip", func(c *apiv1.InitConfiguration) { c.Node.NodeIP = "node1" }, "node.nodeIP"},
+		{"invalid host network", func(c *apiv1.InitConfiguration) { c.Node.Host.Networks = []string{"eth0"} }, "node.host.networks[0]"},
+		{"invalid host network ip", func(c *apiv1.InitConfiguration) { c.Node.Host.Networks = []string{"eth0/br0/10.168.222"} }, "node.host.networks[0]"},
+		{"relative local image path", func(c *apiv1.InitConfiguration) { c.Node.Host.LocalImagePath = []string{"disks"} }, "node.host.localImagePath[0]"},
+		{"empty disabled addon", func(c *apiv1.InitConfiguration) { c.Addons.Disabled = []string{""} }, "addons.disabled[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newValidInitConfiguration()
+			tt.modify(cfg)
+			errs := ValidateInitConfiguration(cfg)
+			if tt.wantPath == "" {
+				if len(errs) != 0 {
+					t.Errorf("ValidateInitConfiguration() = %v, want no error", errs)
+				}
+				return
+			}
+			if !hasErrorOfField(errs, tt.wantPath) {
+				t.Errorf("ValidateInitConfiguration() = %v, want error of %s", errs, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestValidateJoinConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *apiv1.JoinConfiguration
+		wantPath string
+	}{
+		{"valid", &apiv1.JoinConfiguration{
+			Node:                apiv1.NodeConfiguration{NodeIP: "10.168.222.21", Host: apiv1.HostConfiguration{Networks: []string{"eth0/br0/10.168.222.21"}}},
+			HighAvailabilityVIP: "10.168.222.100",
+		}, ""},
+		{"invalid vip", &apiv1.JoinConfiguration{HighAvailabilityVIP: "fe80::1"}, "highAvailabilityVIP"},
+		{"invalid node ip", &apiv1.JoinConfiguration{Node: apiv1.NodeConfiguration{NodeIP: "10.168.222"}}, "node.nodeIP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateJoinConfiguration(tt.cfg)
+			if tt.wantPath == "" {
+				if len(errs) != 0 {
+					t.Errorf("ValidateJoinConfiguration() = %v, want no error", errs)
+				}
+				return
+			}
+			if !hasErrorOfField(errs, tt.wantPath) {
+				t.Errorf("ValidateJoinConfiguration() = %v, want error of %s", errs, tt.wantPath)
+			}
+		})
+	}
+}
+
+func hasErrorOfField(errs field.ErrorList, path string) bool {
+	for _, err := range errs {
+		if err.Field == path {
+			return true
+		}
+	}
+	return false
+}
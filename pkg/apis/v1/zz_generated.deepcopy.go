@@ -26,11 +26,50 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonsConfiguration) DeepCopyInto(out *AddonsConfiguration) {
+	*out = *in
+	if in.Disabled != nil {
+		in, out := &in.Disabled, &out.Disabled
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonsConfiguration.
+func (in *AddonsConfiguration) DeepCopy() *AddonsConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonsConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CalicoConfiguration) DeepCopyInto(out *CalicoConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalicoConfiguration.
+func (in *CalicoConfiguration) DeepCopy() *CalicoConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(CalicoConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterConfiguration) DeepCopyInto(out *ClusterConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	out.MysqlConnection = in.MysqlConnection
+	out.Calico = in.Calico
+	in.Addons.DeepCopyInto(&out.Addons)
 	return
 }
 
@@ -55,6 +94,7 @@ func (in *ClusterConfiguration) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DBInfo) DeepCopyInto(out *DBInfo) {
 	*out = *in
+	out.MysqlConnectionOptions = in.MysqlConnectionOptions
 	return
 }
 
@@ -68,6 +108,32 @@ func (in *DBInfo) DeepCopy() *DBInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostConfiguration) DeepCopyInto(out *HostConfiguration) {
+	*out = *in
+	if in.LocalImagePath != nil {
+		in, out := &in.LocalImagePath, &out.LocalImagePath
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostConfiguration.
+func (in *HostConfiguration) DeepCopy() *HostConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(HostConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HostLocalInfo) DeepCopyInto(out *HostLocalInfo) {
 	*out = *in
@@ -90,8 +156,9 @@ func (in *InitConfiguration) DeepCopyInto(out *InitConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.InitConfiguration.DeepCopyInto(&out.InitConfiguration)
-	out.ClusterConfiguration = in.ClusterConfiguration
+	in.ClusterConfiguration.DeepCopyInto(&out.ClusterConfiguration)
 	in.HostLocalInfo.DeepCopyInto(&out.HostLocalInfo)
+	in.Node.DeepCopyInto(&out.Node)
 	return
 }
 
@@ -118,6 +185,7 @@ func (in *JoinConfiguration) DeepCopyInto(out *JoinConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.JoinConfiguration.DeepCopyInto(&out.JoinConfiguration)
+	in.Node.DeepCopyInto(&out.Node)
 	return
 }
 
@@ -142,6 +210,7 @@ func (in *JoinConfiguration) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MysqlConnection) DeepCopyInto(out *MysqlConnection) {
 	*out = *in
+	out.MysqlConnectionOptions = in.MysqlConnectionOptions
 	return
 }
 
@@ -155,6 +224,22 @@ func (in *MysqlConnection) DeepCopy() *MysqlConnection {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlConnectionOptions) DeepCopyInto(out *MysqlConnectionOptions) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlConnectionOptions.
+func (in *MysqlConnectionOptions) DeepCopy() *MysqlConnectionOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlConnectionOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetInterface) DeepCopyInto(out *NetInterface) {
 	*out = *in
@@ -180,3 +265,20 @@ func (in *NetInterface) DeepCopy() *NetInterface {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeConfiguration) DeepCopyInto(out *NodeConfiguration) {
+	*out = *in
+	in.Host.DeepCopyInto(&out.Host)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeConfiguration.
+func (in *NodeConfiguration) DeepCopy() *NodeConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
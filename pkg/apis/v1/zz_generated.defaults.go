@@ -37,6 +37,7 @@ func RegisterDefaults(scheme *runtime.Scheme) error {
 func SetObjectDefaults_ClusterConfiguration(in *ClusterConfiguration) {
 	SetDefaults_ClusterConfiguration(in)
 	SetDefaults_MysqlConnection(&in.MysqlConnection)
+	SetDefaults_CalicoConfiguration(&in.Calico)
 }
 
 func SetObjectDefaults_InitConfiguration(in *InitConfiguration) {
@@ -0,0 +1,188 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+// addConversionFuncs registers the conversions between v1beta1 and the v1 types used internally.
+// The kubernetes settings embedded in v1 types are (un)marshalled as kubeadm documents, so they are
+// not touched here.
+func addConversionFuncs(scheme *runtime.Scheme) error {
+	for _, f := range []struct {
+		a, b interface{}
+		fn   conversion.ConversionFunc
+	}{
+		{(*InitConfiguration)(nil), (*apiv1.InitConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1beta1_InitConfiguration_To_v1_InitConfiguration(a.(*InitConfiguration), b.(*apiv1.InitConfiguration), scope)
+		}},
+		{(*apiv1.InitConfiguration)(nil), (*InitConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1_InitConfiguration_To_v1beta1_InitConfiguration(a.(*apiv1.InitConfiguration), b.(*InitConfiguration), scope)
+		}},
+		{(*ClusterConfiguration)(nil), (*apiv1.ClusterConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1beta1_ClusterConfiguration_To_v1_ClusterConfiguration(a.(*ClusterConfiguration), b.(*apiv1.ClusterConfiguration), scope)
+		}},
+		{(*apiv1.ClusterConfiguration)(nil), (*ClusterConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1_ClusterConfiguration_To_v1beta1_ClusterConfiguration(a.(*apiv1.ClusterConfiguration), b.(*ClusterConfiguration), scope)
+		}},
+		{(*JoinConfiguration)(nil), (*apiv1.JoinConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1beta1_JoinConfiguration_To_v1_JoinConfiguration(a.(*JoinConfiguration), b.(*apiv1.JoinConfiguration), scope)
+		}},
+		{(*apiv1.JoinConfiguration)(nil), (*JoinConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+			return Convert_v1_JoinConfiguration_To_v1beta1_JoinConfiguration(a.(*apiv1.JoinConfiguration), b.(*JoinConfiguration), scope)
+		}},
+	} {
+		if err := scheme.AddConversionFunc(f.a, f.b, f.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Convert_v1beta1_InitConfiguration_To_v1_InitConfiguration(in *InitConfiguration, out *apiv1.InitConfiguration, s conversion.Scope) error {
+	if err := Convert_v1beta1_ClusterConfiguration_To_v1_ClusterConfiguration(&in.ClusterConfiguration, &out.ClusterConfiguration, s); err != nil {
+		return err
+	}
+	out.HostLocalInfo.Zone = in.Zone
+	out.HostLocalInfo.ManagementNetInterface.Wire = in.ManagementWire
+	convert_v1beta1_NodeConfiguration_To_v1_NodeConfiguration(&in.Node, &out.Node)
+	return nil
+}
+
+func Convert_v1_InitConfiguration_To_v1beta1_InitConfiguration(in *apiv1.InitConfiguration, out *InitConfiguration, s conversion.Scope) error {
+	if err := Convert_v1_ClusterConfiguration_To_v1beta1_ClusterConfiguration(&in.ClusterConfiguration, &out.ClusterConfiguration, s); err != nil {
+		return err
+	}
+	out.Zone = in.HostLocalInfo.Zone
+	out.ManagementWire = in.HostLocalInfo.ManagementNetInterface.Wire
+	convert_v1_NodeConfiguration_To_v1beta1_NodeConfiguration(&in.Node, &out.Node)
+	return nil
+}
+
+func Convert_v1beta1_ClusterConfiguration_To_v1_ClusterConfiguration(in *ClusterConfiguration, out *apiv1.ClusterConfiguration, s conversion.Scope) error {
+	out.MysqlConnection = apiv1.MysqlConnection{
+		Server:   in.MysqlConnection.Server,
+		Port:     in.MysqlConnection.Port,
+		Username: in.MysqlConnection.Username,
+		Password: in.MysqlConnection.Password,
+	}
+	Convert_v1beta1_MysqlConnectionOptions_To_v1_MysqlConnectionOptions(&in.MysqlConnection.MysqlConnectionOptions, &out.MysqlConnection.MysqlConnectionOptions, s)
+	out.OnecloudVersion = in.OnecloudVersion
+	out.OperatorVersion = in.OperatorVersion
+	out.Region = in.Region
+	out.OnecloudCertificatesDir = in.OnecloudCertificatesDir
+	out.HighAvailabilityVIP = in.HighAvailabilityVIP
+	out.KeepalivedVersionTag = in.KeepalivedVersionTag
+	out.NodeCIDRMaskSize = in.NodeCIDRMaskSize
+	out.Calico = apiv1.CalicoConfiguration{
+		IPAutodetectionMethod: in.Calico.IPAutodetectionMethod,
+		FelixChainInsertMode:  in.Calico.FelixChainInsertMode,
+		IPV4PoolBlockSize:     in.Calico.IPV4PoolBlockSize,
+	}
+	out.Addons.Disabled = copyStrings(in.Addons.Disabled)
+	return nil
+}
+
+func Convert_v1_ClusterConfiguration_To_v1beta1_ClusterConfiguration(in *apiv1.ClusterConfiguration, out *ClusterConfiguration, s conversion.Scope) error {
+	out.MysqlConnection = MysqlConnection{
+		Server:   in.MysqlConnection.Server,
+		Port:     in.MysqlConnection.Port,
+		Username: in.MysqlConnection.Username,
+		Password: in.MysqlConnection.Password,
+	}
+	Convert_v1_MysqlConnectionOptions_To_v1beta1_MysqlConnectionOptions(&in.MysqlConnection.MysqlConnectionOptions, &out.MysqlConnection.MysqlConnectionOptions, s)
+	out.OnecloudVersion = in.OnecloudVersion
+	out.OperatorVersion = in.OperatorVersion
+	out.Region = in.Region
+	out.OnecloudCertificatesDir = in.OnecloudCertificatesDir
+	out.HighAvailabilityVIP = in.HighAvailabilityVIP
+	out.KeepalivedVersionTag = in.KeepalivedVersionTag
+	out.NodeCIDRMaskSize = in.NodeCIDRMaskSize
+	out.Calico = CalicoConfiguration{
+		IPAutodetectionMethod: in.Calico.IPAutodetectionMethod,
+		FelixChainInsertMode:  in.Calico.FelixChainInsertMode,
+		IPV4PoolBlockSize:     in.Calico.IPV4PoolBlockSize,
+	}
+	out.Addons.Disabled = copyStrings(in.Addons.Disabled)
+	return nil
+}
+
+// Convert_v1beta1_MysqlConnectionOptions_To_v1_MysqlConnectionOptions is also used to decode the options
+// persisted outside of the configuration, e.g. in OnecloudCluster annotation
+func Convert_v1beta1_MysqlConnectionOptions_To_v1_MysqlConnectionOptions(in *MysqlConnectionOptions, out *apiv1.MysqlConnectionOptions, s conversion.Scope) error {
+	out.TLSMode = apiv1.MysqlTLSMode(in.TLSMode)
+	out.CAFile = in.CAFile
+	out.CertFile = in.CertFile
+	out.KeyFile = in.KeyFile
+	out.ConnectTimeout = in.ConnectTimeout.Duration
+	out.ReadTimeout = in.ReadTimeout.Duration
+	out.Charset = in.Charset
+	return nil
+}
+
+func Convert_v1_MysqlConnectionOptions_To_v1beta1_MysqlConnectionOptions(in *apiv1.MysqlConnectionOptions, out *MysqlConnectionOptions, s conversion.Scope) error {
+	out.TLSMode = string(in.TLSMode)
+	out.CAFile = in.CAFile
+	out.CertFile = in.CertFile
+	out.KeyFile = in.KeyFile
+	out.ConnectTimeout = metav1.Duration{Duration: in.ConnectTimeout}
+	out.ReadTimeout = metav1.Duration{Duration: in.ReadTimeout}
+	out.Charset = in.Charset
+	return nil
+}
+
+func Convert_v1beta1_JoinConfiguration_To_v1_JoinConfiguration(in *JoinConfiguration, out *apiv1.JoinConfiguration, s conversion.Scope) error {
+	convert_v1beta1_NodeConfiguration_To_v1_NodeConfiguration(&in.Node, &out.Node)
+	out.AsOnecloudController = in.AsOnecloudController
+	out.HighAvailabilityVIP = in.HighAvailabilityVIP
+	out.KeepalivedVersionTag = in.KeepalivedVersionTag
+	return nil
+}
+
+func Convert_v1_JoinConfiguration_To_v1beta1_JoinConfiguration(in *apiv1.JoinConfiguration, out *JoinConfiguration, s conversion.Scope) error {
+	convert_v1_NodeConfiguration_To_v1beta1_NodeConfiguration(&in.Node, &out.Node)
+	out.AsOnecloudController = in.AsOnecloudController
+	out.HighAvailabilityVIP = in.HighAvailabilityVIP
+	out.KeepalivedVersionTag = in.KeepalivedVersionTag
+	return nil
+}
+
+func convert_v1beta1_NodeConfiguration_To_v1_NodeConfiguration(in *NodeConfiguration, out *apiv1.NodeConfiguration) {
+	out.NodeIP = in.NodeIP
+	out.Host = apiv1.HostConfiguration{
+		Enabled:        in.Host.Enabled,
+		LocalImagePath: copyStrings(in.Host.LocalImagePath),
+		Networks:       copyStrings(in.Host.Networks),
+		Hostname:       in.Host.Hostname,
+		EnableHugepage: in.Host.EnableHugepage,
+	}
+	out.GlanceNode = in.GlanceNode
+	out.BaremetalNode = in.BaremetalNode
+	out.EsxiNode = in.EsxiNode
+}
+
+func convert_v1_NodeConfiguration_To_v1beta1_NodeConfiguration(in *apiv1.NodeConfiguration, out *NodeConfiguration) {
+	out.NodeIP = in.NodeIP
+	out.Host = HostConfiguration{
+		Enabled:        in.Host.Enabled,
+		LocalImagePath: copyStrings(in.Host.LocalImagePath),
+		Networks:       copyStrings(in.Host.Networks),
+		Hostname:       in.Host.Hostname,
+		EnableHugepage: in.Host.EnableHugepage,
+	}
+	out.GlanceNode = in.GlanceNode
+	out.BaremetalNode = in.BaremetalNode
+	out.EsxiNode = in.EsxiNode
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
@@ -0,0 +1,70 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func addDefaultingFuncs(scheme *runtime.Scheme) error {
+	return RegisterDefaults(scheme)
+}
+
+// SetDefaults_InitConfiguration assigns default values for the InitConfiguration
+func SetDefaults_InitConfiguration(obj *InitConfiguration) {
+	SetDefaults_ClusterConfiguration(&obj.ClusterConfiguration)
+	if obj.Zone == "" {
+		obj.Zone = apiv1.DefaultOnecloudZone
+	}
+	if obj.ManagementWire == "" {
+		obj.ManagementWire = apiv1.DefaultOnecloudAdminWire
+	}
+}
+
+// SetDefaults_ClusterConfiguration assigns default values for the ClusterConfiguration
+func SetDefaults_ClusterConfiguration(obj *ClusterConfiguration) {
+	SetDefaults_MysqlConnection(&obj.MysqlConnection)
+	if obj.OnecloudVersion == "" {
+		obj.OnecloudVersion = apiv1.DefaultOnecloudVersion
+	}
+	if obj.OperatorVersion == "" {
+		obj.OperatorVersion = apiv1.DefaultOperatorVersion
+	}
+	if obj.Region == "" {
+		obj.Region = apiv1.DefaultOnecloudRegion
+	}
+	if obj.OnecloudCertificatesDir == "" {
+		obj.OnecloudCertificatesDir = apiv1.DefaultOnecloudCertificatesDir
+	}
+	if obj.NodeCIDRMaskSize == 0 {
+		obj.NodeCIDRMaskSize = apiv1.DefaultNodeCIDRMaskSize
+	}
+	SetDefaults_CalicoConfiguration(&obj.Calico)
+}
+
+func SetDefaults_MysqlConnection(obj *MysqlConnection) {
+	if obj.Username == "" {
+		obj.Username = apiv1.DefaultMysqlUser
+	}
+	if obj.Server == "" {
+		obj.Server = apiv1.DefaultMysqlAddress
+	}
+	if obj.Port == 0 {
+		obj.Port = apiv1.DefaultMysqlPort
+	}
+	if obj.TLSMode == "" {
+		obj.TLSMode = string(apiv1.MysqlTLSDisabled)
+	}
+	if obj.Charset == "" {
+		obj.Charset = apiv1.DefaultMysqlCharset
+	}
+	if obj.ConnectTimeout.Duration == 0 {
+		obj.ConnectTimeout.Duration = apiv1.DefaultMysqlConnectTimeout
+	}
+}
+
+func SetDefaults_CalicoConfiguration(obj *CalicoConfiguration) {
+	if obj.IPV4PoolBlockSize == 0 {
+		obj.IPV4PoolBlockSize = apiv1.DefaultCalicoIPV4PoolBlockSize
+	}
+}
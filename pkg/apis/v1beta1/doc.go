@@ -0,0 +1,7 @@
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=ocadm.yunion.io
+// +k8s:deepcopy-gen=package
+
+// Package v1beta1 is the serializable version of the ocadm configuration API,
+// all the objects are converted to and from the types of package v1 used internally.
+package v1beta1
@@ -0,0 +1,167 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InitConfiguration contains the onecloud settings of the init node, the kubernetes settings
+// are described by kubeadm InitConfiguration in the same file.
+type InitConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ClusterConfiguration holds the cluster-wide information, it is (un)marshalled as a separate document
+	ClusterConfiguration `json:"-"`
+
+	// Zone is the first default zone
+	Zone string `json:"zone,omitempty"`
+
+	// ManagementWire is the first default management wire
+	ManagementWire string `json:"managementWire,omitempty"`
+
+	// Node holds the onecloud settings of the init node
+	Node NodeConfiguration `json:"node,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterConfiguration contains cluster-wide configuration for a onecloud cluster
+type ClusterConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MysqlConnection specifies mysql admin connection info.
+	MysqlConnection MysqlConnection `json:"mysqlConnection"`
+
+	// OnecloudVersion is the target version of the control plane.
+	OnecloudVersion string `json:"onecloudVersion,omitempty"`
+
+	// OperatorVersion is the version of onecloud operator
+	OperatorVersion string `json:"operatorVersion,omitempty"`
+
+	// Region specify keystone auth region
+	Region string `json:"region,omitempty"`
+
+	// OnecloudCertificatesDir specifies where to store or look for the onecloud certificates
+	OnecloudCertificatesDir string `json:"onecloudCertificatesDir,omitempty"`
+
+	// HighAvailabilityVIP is the keepalived VIP of control plane
+	HighAvailabilityVIP string `json:"highAvailabilityVIP,omitempty"`
+
+	// KeepalivedVersionTag is the image tag of keepalived
+	KeepalivedVersionTag string `json:"keepalivedVersionTag,omitempty"`
+
+	// NodeCIDRMaskSize is the mask size of node pod cidr allocated by controller manager
+	NodeCIDRMaskSize int `json:"nodeCIDRMaskSize,omitempty"`
+
+	// Calico holds the calico addon options
+	Calico CalicoConfiguration `json:"calico,omitempty"`
+
+	// Addons holds the addons toggles
+	Addons AddonsConfiguration `json:"addons,omitempty"`
+}
+
+type MysqlConnection struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+
+	MysqlConnectionOptions `json:",inline"`
+}
+
+// MysqlConnectionOptions holds the TLS and socket options shared by all connections to the mysql server
+type MysqlConnectionOptions struct {
+	// TLSMode is one of disabled, preferred, required, verify-ca and verify-identity, defaults to disabled.
+	// Services managed by onecloud-operator can't use TLS, so only disabled and preferred are accepted by cluster creation
+	TLSMode string `json:"tlsMode,omitempty"`
+
+	// CAFile is the CA certificate verifying the server, required by verify-ca and verify-identity
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile and KeyFile are the client certificate and key, used if the server requires X509 authentication
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+
+	// ConnectTimeout is the timeout of establishing connection
+	ConnectTimeout metav1.Duration `json:"connectTimeout,omitempty"`
+
+	// ReadTimeout is the I/O read timeout, zero means no timeout
+	ReadTimeout metav1.Duration `json:"readTimeout,omitempty"`
+
+	// Charset is the connection character set of services, defaults to utf8,
+	// connections of ocadm always use utf8mb4
+	Charset string `json:"charset,omitempty"`
+}
+
+type CalicoConfiguration struct {
+	// IPAutodetectionMethod is the IP_AUTODETECTION_METHOD of calico node
+	IPAutodetectionMethod string `json:"ipAutodetectionMethod,omitempty"`
+
+	// FelixChainInsertMode is the FELIX_CHAININSERTMODE of calico node
+	FelixChainInsertMode string `json:"felixChainInsertMode,omitempty"`
+
+	// IPV4PoolBlockSize is the block size of default IPv4 pool
+	IPV4PoolBlockSize int `json:"ipv4PoolBlockSize,omitempty"`
+}
+
+type AddonsConfiguration struct {
+	// Disabled are the names of addons not installed by init
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// NodeConfiguration holds the onecloud settings of a node
+type NodeConfiguration struct {
+	// NodeIP is the ip address used by kubelet
+	NodeIP string `json:"nodeIP,omitempty"`
+
+	// Host holds the host agent settings
+	Host HostConfiguration `json:"host,omitempty"`
+
+	// GlanceNode labels the node to run glance
+	GlanceNode bool `json:"glanceNode,omitempty"`
+
+	// BaremetalNode labels the node to run baremetal agent
+	BaremetalNode bool `json:"baremetalNode,omitempty"`
+
+	// EsxiNode labels the node to run esxi agent
+	EsxiNode bool `json:"esxiNode,omitempty"`
+}
+
+// HostConfiguration holds the host agent settings of a node
+type HostConfiguration struct {
+	// Enabled labels the node to run host agent
+	Enabled bool `json:"enabled,omitempty"`
+
+	// LocalImagePath are the local image directories of host agent
+	LocalImagePath []string `json:"localImagePath,omitempty"`
+
+	// Networks are the host networks, e.g. eth0/br0/10.168.222.21
+	Networks []string `json:"networks,omitempty"`
+
+	// Hostname is the name of host agent
+	Hostname string `json:"hostname,omitempty"`
+
+	// EnableHugepage enables hugepage of host agent
+	EnableHugepage bool `json:"enableHugepage,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// JoinConfiguration contains the onecloud settings of the joining node, the kubernetes settings
+// are described by kubeadm JoinConfiguration in the same file.
+type JoinConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Node holds the onecloud settings of the joining node
+	Node NodeConfiguration `json:"node,omitempty"`
+
+	// AsOnecloudController labels the node to run onecloud controller services
+	AsOnecloudController bool `json:"asOnecloudController,omitempty"`
+
+	// HighAvailabilityVIP is the keepalived VIP of control plane, only used by control plane node
+	HighAvailabilityVIP string `json:"highAvailabilityVIP,omitempty"`
+
+	// KeepalivedVersionTag is the image tag of keepalived
+	KeepalivedVersionTag string `json:"keepalivedVersionTag,omitempty"`
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	cmdutil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/apis/scheme"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/addons"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/all"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+type addonOptions struct {
+	kubeconfigPath string
+	params         []string
+	rolloutTimeout time.Duration
+}
+
+func newAddonOptions() *addonOptions {
+	return &addonOptions{
+		kubeconfigPath: constants.GetAdminKubeConfigPath(),
+		rolloutTimeout: 5 * time.Minute,
+	}
+}
+
+func AddAddonFlags(flagSet *flag.FlagSet, opt *addonOptions, withParams bool) {
+	options.AddKubeConfigFlag(flagSet, &opt.kubeconfigPath)
+	if withParams {
+		flagSet.StringArrayVar(
+			&opt.params, options.AddonParam, opt.params,
+			"Addon parameter in format of key=value, could be specified multiple times. Run 'ocadm addon list' for supported parameters.",
+		)
+	}
+}
+
+func addRolloutTimeoutFlag(flagSet *flag.FlagSet, opt *addonOptions) {
+	flagSet.DurationVar(
+		&opt.rolloutTimeout, options.RolloutTimeout, opt.rolloutTimeout,
+		"How long to wait for the workloads of addon to be rolled out, 0 means not waiting",
+	)
+}
+
+func (o *addonOptions) client() (clientset.Interface, error) {
+	return kubeconfigutil.ClientSetFromFile(o.kubeconfigPath)
+}
+
+func (o *addonOptions) clusterConfig(client clientset.Interface) (*apiv1.InitConfiguration, error) {
+	return configutil.FetchInitConfigurationFromCluster(client, ioutil.Discard, "addon", false)
+}
+
+func (o *addonOptions) manager(out io.Writer) (*addons.Manager, error) {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := o.clusterConfig(client)
+	if err != nil {
+		return nil, err
+	}
+	applier, err := newAddonApplier(o.kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	m := addons.NewManager(addons.DefaultRegistry(), cfg, client, applier, out)
+	m.RolloutTimeout = o.rolloutTimeout
+	return m, nil
+}
+
+// NewCmdAddon returns the "ocadm addon" command
+func NewCmdAddon(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "addon",
+		Short: "Manage the addons of a running cluster",
+		RunE:  cmdutil.SubCmdRunE("addon"),
+	}
+	cmd.AddCommand(NewCmdAddonList(out))
+	cmd.AddCommand(NewCmdAddonEnable(out))
+	cmd.AddCommand(NewCmdAddonDisable(out))
+	cmd.AddCommand(NewCmdAddonUpgrade(out))
+	cmd.AddCommand(NewCmdAddonRender(out))
+	return cmd
+}
+
+// NewCmdAddonList returns the "ocadm addon list" command
+func NewCmdAddonList(out io.Writer) *cobra.Command {
+	opt := newAddonOptions()
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the supported addons and the installed versions",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runAddonList(out, opt)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	AddAddonFlags(cmd.Flags(), opt, false)
+	return cmd
+}
+
+func runAddonList(out io.Writer, opt *addonOptions) error {
+	list, err := addons.DefaultRegistry().List()
+	if err != nil {
+		return err
+	}
+	var installed map[string]addons.InstalledAddon
+	client, err := opt.client()
+	if err == nil {
+		installed, err = addons.GetInstalledAddons(client)
+	}
+	if err != nil {
+		klog.Warningf("[addon] Unable to get installed addons from cluster: %v", err)
+	}
+
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tINSTALLED\tDEPENDENCIES\tPARAMETERS\tDESCRIPTION")
+	for _, a := range list {
+		installedVersion := "-"
+		if installed == nil {
+			installedVersion = "<unknown>"
+		} else if info, ok := installed[a.Name]; ok {
+			installedVersion = info.Version
+		}
+		params := make([]string, 0, len(a.Parameters))
+		for _, p := range a.Parameters {
+			params = append(params, p.Name)
+		}
+		description := a.Description
+		if a.Optional {
+			description += " (optional)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", a.Name, a.Version, installedVersion,
+			joinOrNone(a.Dependencies), joinOrNone(params), description)
+	}
+	return w.Flush()
+}
+
+func joinOrNone(items []string) string {
+	if len(items) == 0 {
+		return "<none>"
+	}
+	return strings.Join(items, ",")
+}
+
+// NewCmdAddonEnable returns the "ocadm addon enable" command
+func NewCmdAddonEnable(out io.Writer) *cobra.Command {
+	opt := newAddonOptions()
+	cmd := &cobra.Command{
+		Use:   "enable <name>",
+		Short: "Install the addon to cluster, its dependencies must be installed",
+		Run: func(cmd *cobra.Command, args []string) {
+			params, err := addons.ParseParameters(opt.params)
+			kubeadmutil.CheckErr(err)
+			m, err := opt.manager(out)
+			kubeadmutil.CheckErr(err)
+			kubeadmutil.CheckErr(m.Enable(args[0], params))
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddAddonFlags(cmd.Flags(), opt, true)
+	addRolloutTimeoutFlag(cmd.Flags(), opt)
+	return cmd
+}
+
+// NewCmdAddonDisable returns the "ocadm addon disable" command
+func NewCmdAddonDisable(out io.Writer) *cobra.Command {
+	opt := newAddonOptions()
+	cmd := &cobra.Command{
+		Use:   "disable <name>",
+		Short: "Delete the addon from cluster, addons depending on it must be disabled first",
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := opt.manager(out)
+			kubeadmutil.CheckErr(err)
+			kubeadmutil.CheckErr(m.Disable(args[0]))
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddAddonFlags(cmd.Flags(), opt, false)
+	return cmd
+}
+
+// NewCmdAddonUpgrade returns the "ocadm addon upgrade" command
+func NewCmdAddonUpgrade(out io.Writer) *cobra.Command {
+	opt := newAddonOptions()
+	cmd := &cobra.Command{
+		Use:   "upgrade <name>",
+		Short: "Re-apply the installed addon with the version of this ocadm, recorded parameters are kept unless overridden",
+		Run: func(cmd *cobra.Command, args []string) {
+			params, err := addons.ParseParameters(opt.params)
+			kubeadmutil.CheckErr(err)
+			m, err := opt.manager(out)
+			kubeadmutil.CheckErr(err)
+			kubeadmutil.CheckErr(m.Upgrade(args[0], params))
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddAddonFlags(cmd.Flags(), opt, true)
+	addRolloutTimeoutFlag(cmd.Flags(), opt)
+	return cmd
+}
+
+// NewCmdAddonRender returns the "ocadm addon render" command
+func NewCmdAddonRender(out io.Writer) *cobra.Command {
+	opt := newAddonOptions()
+	var cfgPath string
+	cmd := &cobra.Command{
+		Use:   "render <name>",
+		Short: "Print the manifest of the addon without applying it",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runAddonRender(out, opt, cfgPath, args[0])
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddAddonFlags(cmd.Flags(), opt, true)
+	options.AddConfigFlag(cmd.Flags(), &cfgPath)
+	return cmd
+}
+
+func runAddonRender(out io.Writer, opt *addonOptions, cfgPath string, name string) error {
+	a, err := addons.DefaultRegistry().Get(name)
+	if err != nil {
+		return err
+	}
+	overrides, err := addons.ParseParameters(opt.params)
+	if err != nil {
+		return err
+	}
+	var cfg *apiv1.InitConfiguration
+	if len(cfgPath) != 0 {
+		defaultCfg := &apiv1.InitConfiguration{}
+		scheme.Scheme.Default(defaultCfg)
+		cfg, err = configutil.LoadOrDefaultInitConfiguration(cfgPath, defaultCfg)
+	} else {
+		var client clientset.Interface
+		client, err = opt.client()
+		if err != nil {
+			return errors.Wrapf(err, "no --%s specified and unable to connect cluster", options.CfgPath)
+		}
+		cfg, err = opt.clusterConfig(client)
+	}
+	if err != nil {
+		return err
+	}
+	params, err := a.ResolveParameters(cfg, overrides)
+	if err != nil {
+		return err
+	}
+	manifest, err := a.Render(cfg, params)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(out, manifest)
+	return err
+}
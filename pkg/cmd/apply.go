@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/apply"
+)
+
+var (
+	applyExample = `
+	# Install all the nodes described in inventory
+	ocadm apply -f inventory.yaml
+
+	# Only join the nodes after control plane initialized
+	ocadm apply phase join -f inventory.yaml`
+
+	inventoryExample = `
+	ssh:
+	  user: root
+	  privateKeyFile: /root/.ssh/id_rsa
+	  knownHostsFile: /root/.ssh/known_hosts
+	cluster:
+	  mysql:
+	    host: 10.168.222.10
+	    password: your-sql-passwd
+	  highAvailabilityVIP: 10.168.222.100
+	  createCluster: true
+	nodes:
+	- host: 10.168.222.11
+	  roles: [control-plane, vip]
+	- host: 10.168.222.12
+	  roles: [control-plane, vip]
+	- host: 10.168.222.13
+	  roles: [control-plane, vip, glance]
+	- host: 10.168.222.21
+	  roles: [host-agent]
+	  ssh:
+	    hostKeyFingerprint: SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8
+	  hostNetworks: [eth0/br0/10.168.222.21]`
+)
+
+type applyOptions struct {
+	inventoryFile   string
+	knownHostsFile  string
+	trustOnFirstUse bool
+}
+
+func newApplyOptions() *applyOptions {
+	return &applyOptions{}
+}
+
+// NewCmdApply returns "ocadm apply" command
+func NewCmdApply(out io.Writer) *cobra.Command {
+	opt := newApplyOptions()
+	runner := workflow.NewRunner()
+
+	cmd := &cobra.Command{
+		Use:     "apply",
+		Short:   "Install kubernetes and onecloud on all the nodes described in inventory file through ssh",
+		Long:    "Inventory file example:\n" + inventoryExample,
+		Example: applyExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			kubeadmutil.CheckErr(runApply(runner, args, out))
+		},
+		Args: cobra.NoArgs,
+	}
+	AddApplyOptions(cmd.Flags(), opt)
+
+	runner.AppendPhase(apply.NewPreflightPhase())
+	runner.AppendPhase(apply.NewInitPhase())
+	runner.AppendPhase(apply.NewClusterPhase())
+	runner.AppendPhase(apply.NewJoinInfoPhase())
+	runner.AppendPhase(apply.NewJoinPhase())
+	runner.AppendPhase(apply.NewLabelsPhase())
+
+	runner.SetDataInitializer(func(cmd *cobra.Command, args []string) (workflow.RunData, error) {
+		return newApplyData(opt, out)
+	})
+	runner.BindToCommand(cmd)
+	return cmd
+}
+
+// runApply returns the error instead of exiting, so the ssh clients are closed on failure
+func runApply(runner *workflow.Runner, args []string, out io.Writer) error {
+	c, err := runner.InitData(args)
+	if err != nil {
+		return err
+	}
+	data := c.(*apply.Data)
+	defer data.Close()
+
+	err = runner.Run(args)
+	data.Progress().Print(out)
+	return err
+}
+
+func AddApplyOptions(flagSet *flag.FlagSet, opt *applyOptions) {
+	flagSet.StringVarP(&opt.inventoryFile, options.InventoryFile, "f", opt.inventoryFile, "Path to the inventory file describing all the nodes")
+	flagSet.StringVar(&opt.knownHostsFile, options.SSHKnownHosts, opt.knownHostsFile, "Path to the known_hosts file verifying host keys of nodes, overrides ssh.knownHostsFile of inventory")
+	flagSet.BoolVar(&opt.trustOnFirstUse, options.SSHTrustOnFirstUse, opt.trustOnFirstUse, "Record the host keys of nodes not in known_hosts instead of failing, mismatched keys are still rejected")
+}
+
+func newApplyData(opt *applyOptions, out io.Writer) (*apply.Data, error) {
+	if opt.inventoryFile == "" {
+		return nil, errors.Errorf("--%s is required", options.InventoryFile)
+	}
+	inv, err := apply.LoadInventory(opt.inventoryFile)
+	if err != nil {
+		return nil, err
+	}
+	if opt.knownHostsFile != "" {
+		inv.SSH.KnownHostsFile = opt.knownHostsFile
+	}
+	if opt.trustOnFirstUse {
+		inv.SSH.TrustOnFirstUse = true
+	}
+	return apply.NewData(inv, out, apply.SSHDialer), nil
+}
@@ -9,6 +9,7 @@ import (
 	"k8s.io/klog"
 	"yunion.io/x/ocadm/pkg/apis/constants"
 	"yunion.io/x/ocadm/pkg/phases/cluster"
+	"yunion.io/x/ocadm/pkg/util/kube"
 	"yunion.io/x/ocadm/pkg/util/kubectl"
 
 	"yunion.io/x/onecloud-operator/pkg/client/clientset/versioned"
@@ -16,6 +17,7 @@ import (
 
 type kubectlCli struct {
 	kubectlClient  *kubectl.Client
+	applier        *kube.Applier
 	kubeconfigPath string
 	client         versioned.Interface
 }
@@ -32,6 +34,27 @@ func (d *kubectlCli) KubectlClient() (*kubectl.Client, error) {
 	return d.kubectlClient, nil
 }
 
+// Applier returns the applier of addon manifests
+func (d *kubectlCli) Applier() (*kube.Applier, error) {
+	if d.applier != nil {
+		return d.applier, nil
+	}
+	applier, err := newAddonApplier(d.KubeConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	d.applier = applier
+	return d.applier, nil
+}
+
+func newAddonApplier(kubeconfigPath string) (*kube.Applier, error) {
+	cli, err := kube.NewClientByFile(kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Applier(constants.AddonFieldManager)
+}
+
 // KubeConfigPath returns the path to the kubeconfig file to use for connecting to Kubernetes
 func (d *kubectlCli) KubeConfigPath() string {
 	return d.kubeconfigPath
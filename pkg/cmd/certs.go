@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/lithammer/dedent"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/duration"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	cmdutil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/apis/scheme"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	certsphase "yunion.io/x/ocadm/pkg/phases/certs"
+	clusterphase "yunion.io/x/ocadm/pkg/phases/cluster"
+	"yunion.io/x/ocadm/pkg/phases/copycerts"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+const (
+	certsRenewOnecloud = "onecloud"
+	certsRenewAll      = "all"
+)
+
+var (
+	certsRenewLongDesc = dedent.Dedent(`
+		Renew the certificates signed by the local CA.
+
+		"onecloud" renews the leaf certificates in the onecloud certificates directory,
+		updates the ocadm-certs Secret if it's not expired and the certs Secret of
+		onecloud operator if the onecloud CA is provided by user, then restarts the
+		workloads in the onecloud namespace mounting them.
+
+		"all" renews the certificates managed by kubeadm as well, the control plane
+		static pods need to be restarted to use the renewed certificates.
+	`)
+)
+
+type certsOptions struct {
+	cfgPath        string
+	kubeconfigPath string
+	kubeconfigDir  string
+}
+
+func newCertsOptions() *certsOptions {
+	return &certsOptions{
+		kubeconfigPath: constants.GetAdminKubeConfigPath(),
+		kubeconfigDir:  kubeadmconstants.KubernetesDir,
+	}
+}
+
+func addCertsFlags(flagSet *flag.FlagSet, opt *certsOptions) {
+	options.AddConfigFlag(flagSet, &opt.cfgPath)
+	options.AddKubeConfigFlag(flagSet, &opt.kubeconfigPath)
+	options.AddKubeConfigDirFlag(flagSet, &opt.kubeconfigDir)
+}
+
+func (o *certsOptions) client() (clientset.Interface, error) {
+	return kubeconfigutil.ClientSetFromFile(o.kubeconfigPath)
+}
+
+// clusterConfig loads the configuration from --config, or from the cluster if it's not specified
+func (o *certsOptions) clusterConfig(client clientset.Interface) (*apiv1.InitConfiguration, error) {
+	if len(o.cfgPath) != 0 {
+		defaultCfg := &apiv1.InitConfiguration{}
+		scheme.Scheme.Default(defaultCfg)
+		return configutil.LoadOrDefaultInitConfiguration(o.cfgPath, defaultCfg)
+	}
+	if client == nil {
+		return nil, errors.Errorf("no --%s specified and unable to connect cluster", options.CfgPath)
+	}
+	return configutil.FetchInitConfigurationFromCluster(client, ioutil.Discard, "certs", false)
+}
+
+// NewCmdCerts returns the "ocadm certs" command
+func NewCmdCerts(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Commands related to handling kubernetes and onecloud certificates",
+		RunE:  cmdutil.SubCmdRunE("certs"),
+	}
+	cmd.AddCommand(NewCmdCertsCheckExpiration(out))
+	cmd.AddCommand(NewCmdCertsRenew(out))
+	return cmd
+}
+
+// NewCmdCertsCheckExpiration returns the "ocadm certs check-expiration" command
+func NewCmdCertsCheckExpiration(out io.Writer) *cobra.Command {
+	opt := newCertsOptions()
+	cmd := &cobra.Command{
+		Use:   "check-expiration",
+		Short: "Check the expiration of the kubernetes and onecloud certificates",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runCertsCheckExpiration(out, opt)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	addCertsFlags(cmd.Flags(), opt)
+	return cmd
+}
+
+func runCertsCheckExpiration(out io.Writer, opt *certsOptions) error {
+	client, err := opt.client()
+	if err != nil {
+		klog.V(1).Infof("[certs] Unable to create kubernetes client: %v", err)
+		client = nil
+	}
+	cfg, err := opt.clusterConfig(client)
+	if err != nil {
+		return err
+	}
+	kubeInfos, err := certsphase.GetKubernetesExpirationInfos(&cfg.InitConfiguration.ClusterConfiguration, opt.kubeconfigDir)
+	if err != nil {
+		return err
+	}
+	ocInfos, err := certsphase.GetOnecloudExpirationInfos(cfg.OnecloudCertificatesDir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "CERTIFICATE\tGROUP\tEXPIRES\tRESIDUAL TIME\tEXTERNALLY MANAGED")
+	for _, info := range append(kubeInfos, ocInfos...) {
+		name := info.Name
+		if info.IsCA {
+			name += " (CA)"
+		}
+		if info.Missing {
+			fmt.Fprintf(w, "%s\t%s\t<missing>\t-\t%v\n", name, info.Group, info.ExternallyManaged)
+			continue
+		}
+		residual := "<expired>"
+		if info.ResidualTime() > 0 {
+			residual = duration.ShortHumanDuration(info.ResidualTime())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", name, info.Group,
+			info.ExpirationDate.Format("Jan 02, 2006 15:04 MST"), residual, info.ExternallyManaged)
+	}
+	return w.Flush()
+}
+
+// NewCmdCertsRenew returns the "ocadm certs renew" command
+func NewCmdCertsRenew(out io.Writer) *cobra.Command {
+	opt := newCertsOptions()
+	cmd := &cobra.Command{
+		Use:       fmt.Sprintf("renew %s|%s", certsRenewOnecloud, certsRenewAll),
+		Short:     "Renew the certificates signed by the local CA",
+		Long:      certsRenewLongDesc,
+		ValidArgs: []string{certsRenewOnecloud, certsRenewAll},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runCertsRenew(out, opt, args[0])
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	addCertsFlags(cmd.Flags(), opt)
+	return cmd
+}
+
+func runCertsRenew(out io.Writer, opt *certsOptions, target string) error {
+	if target != certsRenewOnecloud && target != certsRenewAll {
+		return errors.Errorf("unknown certificates %q, must be one of %s or %s", target, certsRenewOnecloud, certsRenewAll)
+	}
+	client, err := opt.client()
+	if err != nil {
+		klog.Warningf("[certs] Unable to create kubernetes client, the ocadm-certs Secret and workloads won't be updated: %v", err)
+		client = nil
+	}
+	cfg, err := opt.clusterConfig(client)
+	if err != nil {
+		return err
+	}
+
+	if target == certsRenewAll {
+		if err := certsphase.RenewKubernetesCerts(&cfg.InitConfiguration.ClusterConfiguration, opt.kubeconfigDir, out); err != nil {
+			return err
+		}
+	}
+	if err := certsphase.RenewOnecloudCerts(cfg.OnecloudCertificatesDir, out); err != nil {
+		return err
+	}
+
+	if client != nil {
+		updated, err := copycerts.UpdateCertsSecret(client, cfg)
+		if err != nil {
+			return err
+		}
+		if updated {
+			fmt.Fprintf(out, "[certs] Updated Secret %q with the renewed certificates\n", constants.OcadmCertsSecret)
+		}
+		mode, err := certsphase.UsingExternalOnecloudCA(cfg.OnecloudCertificatesDir)
+		if err != nil {
+			return err
+		}
+		secrets := []string{}
+		if mode != certsphase.OnecloudCAGenerated {
+			if err := certsphase.CreateOrUpdateOperatorCertsSecret(client, constants.OnecloudNamespace, clusterphase.DefaultClusterName, cfg.OnecloudCertificatesDir); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "[certs] Updated Secret %q with the renewed certificates\n", certsphase.OperatorCertsSecretName(clusterphase.DefaultClusterName))
+			secrets = append(secrets, certsphase.OperatorCertsSecretName(clusterphase.DefaultClusterName))
+		}
+		if _, err := certsphase.RestartCertsConsumers(client, constants.OnecloudNamespace, cfg.OnecloudCertificatesDir, secrets, out); err != nil {
+			return err
+		}
+	}
+	if target == certsRenewAll {
+		fmt.Fprintln(out, "[certs] Restart kube-apiserver, kube-controller-manager, kube-scheduler and etcd on this node to use the renewed certificates")
+	}
+	return nil
+}
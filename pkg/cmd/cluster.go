@@ -17,6 +17,11 @@ func NewCmdCluster(out io.Writer) *cobra.Command {
 	cmds.AddCommand(clusterphase.NewCmdCreate(out))
 	cmds.AddCommand(clusterphase.NewCmdConfig())
 	cmds.AddCommand(clusterphase.NewCmdUpdate(out))
+	cmds.AddCommand(clusterphase.NewCmdRollback(out))
+	cmds.AddCommand(clusterphase.NewCmdStatus(out))
+	cmds.AddCommand(clusterphase.NewCmdBackup(out))
+	cmds.AddCommand(clusterphase.NewCmdRestore(out))
+	cmds.AddCommand(clusterphase.NewCmdBootstrap(out))
 
 	return cmds
 }
@@ -22,16 +22,20 @@ func NewOneCloudAdminCommand(in io.Reader, out, err io.Writer) (*cobra.Command,
 	cmds.AddCommand(NewCmdConfig(out))
 	cmds.AddCommand(NewCmdInit(out, nil))
 	cmds.AddCommand(NewCmdJoin(out, nil))
+	cmds.AddCommand(NewCmdApply(out))
 	cmds.AddCommand(NewCmdReset(in, out, nil))
 	cmds.AddCommand(NewCmdToken(out, err))
 	cmds.AddCommand(alpha.NewCmdAlpha(in, out))
 
 	cmds.AddCommand(NewCmdCluster(out))
 	cmds.AddCommand(NewCmdComponent(out))
+	cmds.AddCommand(NewCmdDB(out))
 	cmds.AddCommand(NewCmdNode(out))
 	cmds.AddCommand(NewCmdBaremetal(out))
 	cmds.AddCommand(NewCmdVersion(out))
 	cmds.AddCommand(NewCmdLonghorn(out))
+	cmds.AddCommand(NewCmdAddon(out))
+	cmds.AddCommand(NewCmdCerts(out))
 
 	commandFns := []func() *cobra.Command{}
 
@@ -1,24 +1,52 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/lithammer/dedent"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	cmdutil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
+	"k8s.io/kubernetes/cmd/kubeadm/app/componentconfigs"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
 	"k8s.io/kubernetes/cmd/kubeadm/app/features"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	//configutil "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
 	utilruntime "k8s.io/kubernetes/cmd/kubeadm/app/util/runtime"
 	utilsexec "k8s.io/utils/exec"
 
+	"yunion.io/x/ocadm/pkg/apis/constants"
 	"yunion.io/x/ocadm/pkg/apis/scheme"
 	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/apis/v1beta1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/options"
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
 	configutil "yunion.io/x/ocadm/pkg/util/config"
+	"yunion.io/x/ocadm/pkg/util/registry"
+)
+
+var (
+	// placeholderToken is only set statically to make ocadm not randomize the token on every run
+	placeholderToken = kubeadmapi.BootstrapToken{
+		Token: &kubeadmapi.BootstrapTokenString{
+			ID:     "abcdef",
+			Secret: "0123456789abcdef",
+		},
+	}
 )
 
 func NewCmdConfig(out io.Writer) *cobra.Command {
@@ -29,6 +57,218 @@ func NewCmdConfig(out io.Writer) *cobra.Command {
 	}
 
 	cmd.AddCommand(NewCmdConfigImages(out))
+	cmd.AddCommand(NewCmdConfigMigrate(out))
+	cmd.AddCommand(NewCmdConfigPrint(out))
+	cmd.AddCommand(NewCmdConfigValidate(out))
+	return cmd
+}
+
+// NewCmdConfigValidate returns cobra.Command for "ocadm config validate" command
+func NewCmdConfigValidate(out io.Writer) *cobra.Command {
+	var cfgPath string
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the ocadm configuration file without touching the local host or the cluster",
+		Long: dedent.Dedent(`
+			This command loads the init and join configurations in the file, applies the defaults and validates them,
+			so that mistakes could be found before running 'ocadm init' or 'ocadm join'.
+
+			The settings detected on the local host, e.g. the management interface, are not validated.
+		`),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(cfgPath) == 0 {
+				kubeadmutil.CheckErr(errors.Errorf("the --%s flag is mandatory", options.ConfigFile))
+			}
+			kubeadmutil.CheckErr(configutil.ValidateConfigFile(cfgPath))
+			fmt.Fprintf(out, "[config] %s is valid\n", cfgPath)
+		},
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringVarP(&cfgPath, options.ConfigFile, "f", "", "Path to the ocadm config file to validate. This flag is mandatory.")
+	return cmd
+}
+
+// NewCmdConfigPrint returns cobra.Command for "ocadm config print" command
+func NewCmdConfigPrint(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print configuration",
+		Long:  "This command prints configurations for subcommands provided.",
+		RunE:  cmdutil.SubCmdRunE("print"),
+	}
+	cmd.AddCommand(NewCmdConfigPrintInitDefaults(out))
+	cmd.AddCommand(NewCmdConfigPrintJoinDefaults(out))
+	return cmd
+}
+
+// NewCmdConfigPrintInitDefaults returns cobra.Command for "ocadm config print init-defaults" command
+func NewCmdConfigPrintInitDefaults(out io.Writer) *cobra.Command {
+	return newCmdConfigPrintActionDefaults(out, "init", getDefaultInitConfigBytes)
+}
+
+// NewCmdConfigPrintJoinDefaults returns cobra.Command for "ocadm config print join-defaults" command
+func NewCmdConfigPrintJoinDefaults(out io.Writer) *cobra.Command {
+	return newCmdConfigPrintActionDefaults(out, "join", getDefaultNodeConfigBytes)
+}
+
+func newCmdConfigPrintActionDefaults(out io.Writer, action string, configBytesProc func() ([]byte, error)) *cobra.Command {
+	componentConfigs := []string{}
+	cmd := &cobra.Command{
+		Use:   fmt.Sprintf("%s-defaults", action),
+		Short: fmt.Sprintf("Print default %s configuration, that can be used for 'ocadm %s'", action, action),
+		Long: fmt.Sprintf(dedent.Dedent(`
+			This command prints objects such as the default %s configuration that is used for 'ocadm %s'.
+
+			Note that sensitive values like the Bootstrap Token fields are replaced with placeholder values like %q in order to pass validation but
+			not perform the real computation for creating a token.
+		`), action, action, placeholderToken),
+		Run: func(cmd *cobra.Command, args []string) {
+			kubeadmutil.CheckErr(runConfigPrintActionDefaults(out, componentConfigs, configBytesProc))
+		},
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringSliceVar(&componentConfigs, "component-configs", componentConfigs,
+		fmt.Sprintf("A comma-separated list for component config API objects to print the default values for. Available values: %v. If this flag is not set, no component configs will be printed.", getSupportedComponentConfigAPIObjects()))
+	return cmd
+}
+
+func runConfigPrintActionDefaults(out io.Writer, componentConfigs []string, configBytesProc func() ([]byte, error)) error {
+	initialConfig, err := configBytesProc()
+	if err != nil {
+		return err
+	}
+
+	// component configs differ from the kubeadm defaults are already printed
+	gvkmap, err := ocadmutil.SplitYAMLDocuments(initialConfig)
+	if err != nil {
+		return err
+	}
+	printed := sets.NewString()
+	for gvk := range gvkmap {
+		printed.Insert(gvk.Kind)
+	}
+
+	allBytes := [][]byte{initialConfig}
+	for _, componentConfig := range componentConfigs {
+		if printed.Has(componentConfig) {
+			continue
+		}
+		cfgBytes, err := getDefaultComponentConfigBytes(componentConfig)
+		if err != nil {
+			return err
+		}
+		allBytes = append(allBytes, cfgBytes)
+	}
+
+	fmt.Fprint(out, string(bytes.Join(allBytes, []byte(constants.YAMLDocumentSeparator))))
+	return nil
+}
+
+func getDefaultComponentConfigBytes(apiObject string) ([]byte, error) {
+	registration, ok := componentconfigs.Known[componentconfigs.RegistrationKind(apiObject)]
+	if !ok {
+		return []byte{}, errors.Errorf("--component-configs needs to contain some of %v", getSupportedComponentConfigAPIObjects())
+	}
+
+	defaultedInitConfig, err := getDefaultedInitConfig()
+	if err != nil {
+		return []byte{}, err
+	}
+
+	realObj, ok := registration.GetFromInternalConfig(&defaultedInitConfig.InitConfiguration.ClusterConfiguration)
+	if !ok {
+		return []byte{}, errors.New("GetFromInternalConfig failed")
+	}
+
+	return registration.Marshal(realObj)
+}
+
+// getSupportedComponentConfigAPIObjects returns all currently supported component config API object names
+func getSupportedComponentConfigAPIObjects() []string {
+	objects := []string{}
+	for componentType := range componentconfigs.Known {
+		objects = append(objects, string(componentType))
+	}
+	sort.Strings(objects)
+	return objects
+}
+
+func getDefaultedInitConfig() (*apiv1.InitConfiguration, error) {
+	externalcfg := &apiv1.InitConfiguration{}
+	externalcfg.BootstrapTokens = []kubeadmapi.BootstrapToken{placeholderToken}
+	externalcfg.NodeRegistration.CRISocket = kubeadmconstants.DefaultDockerCRISocket // avoid CRI detection
+	scheme.Scheme.Default(externalcfg)
+	return configutil.DefaultedInitConfiguration(externalcfg)
+}
+
+func getDefaultInitConfigBytes() ([]byte, error) {
+	internalcfg, err := getDefaultedInitConfig()
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return configutil.MarshalOcadmConfigObject(internalcfg)
+}
+
+func getDefaultNodeConfigBytes() ([]byte, error) {
+	externalcfg := &apiv1.JoinConfiguration{}
+	externalcfg.Discovery.BootstrapToken = &kubeadmapi.BootstrapTokenDiscovery{
+		Token:                    placeholderToken.Token.String(),
+		APIServerEndpoint:        "kube-apiserver:6443",
+		UnsafeSkipCAVerification: true, // TODO: UnsafeSkipCAVerification: true needs to be set for validation to pass, but shouldn't be recommended as the default
+	}
+	externalcfg.NodeRegistration.CRISocket = kubeadmconstants.DefaultDockerCRISocket // avoid CRI detection
+	scheme.Scheme.Default(externalcfg)
+
+	internalcfg, err := configutil.DefaultedJoinConfiguration(externalcfg)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return configutil.MarshalOcadmConfigObject(internalcfg)
+}
+
+// NewCmdConfigMigrate returns cobra.Command for "ocadm config migrate" command
+func NewCmdConfigMigrate(out io.Writer) *cobra.Command {
+	var oldCfgPath, newCfgPath string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Read an older version of the ocadm configuration API types from a file, and output the similar config object for the newer version",
+		Long: fmt.Sprintf(dedent.Dedent(`
+			This command lets you convert configuration objects of older versions to the latest supported version,
+			locally in the CLI tool without ever touching anything in the cluster.
+			In this version of ocadm, the following API versions are supported:
+			- %s
+			- %s
+
+			Further, ocadm can only write out config of version %q, but read both types.
+			So regardless of what version you pass to the --%s parameter here, the API object will be
+			read, deserialized, defaulted, converted and re-serialized when written to stdout or
+			--%s if specified. The kubeadm documents in the same file are migrated by kubeadm.
+		`), apiv1.SchemeGroupVersion, v1beta1.SchemeGroupVersion, v1beta1.SchemeGroupVersion, options.OldConfig, options.NewConfig),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(oldCfgPath) == 0 {
+				kubeadmutil.CheckErr(errors.Errorf("the --%s flag is mandatory", options.OldConfig))
+			}
+
+			oldCfgBytes, err := ioutil.ReadFile(oldCfgPath)
+			kubeadmutil.CheckErr(err)
+
+			outputBytes, err := configutil.MigrateOldConfig(oldCfgBytes)
+			kubeadmutil.CheckErr(err)
+
+			if newCfgPath == "" {
+				fmt.Fprint(out, string(outputBytes))
+			} else {
+				if err := ioutil.WriteFile(newCfgPath, outputBytes, 0644); err != nil {
+					kubeadmutil.CheckErr(errors.Wrapf(err, "failed to write the new configuration to the file %q", newCfgPath))
+				}
+			}
+		},
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&oldCfgPath, options.OldConfig, "", "Path to the ocadm config file that is using an old API version and should be converted. This flag is mandatory.")
+	cmd.Flags().StringVar(&newCfgPath, options.NewConfig, "", "Path to the resulting equivalent ocadm config file using the new API version. Optional, if not specified output will be sent to STDOUT.")
 	return cmd
 }
 
@@ -41,6 +281,8 @@ func NewCmdConfigImages(out io.Writer) *cobra.Command {
 	}
 	cmd.AddCommand(NewCmdConfigImagesList(out, nil))
 	cmd.AddCommand(NewCmdConfigImagesPull())
+	cmd.AddCommand(NewCmdConfigImagesSave(out))
+	cmd.AddCommand(NewCmdConfigImagesLoad(out))
 	return cmd
 }
 
@@ -50,6 +292,8 @@ func NewCmdConfigImagesPull() *cobra.Command {
 	scheme.Scheme.Default(externalcfg)
 	var cfgPath, featureGatesString, operatorVersion string
 	var err error
+	filter := &images.ImageFilter{}
+	pullOpts := images.DefaultPullOptions()
 
 	cmd := &cobra.Command{
 		Use:   "pull",
@@ -61,11 +305,18 @@ func NewCmdConfigImagesPull() *cobra.Command {
 			kubeadmutil.CheckErr(err)
 			containerRuntime, err := utilruntime.NewContainerRuntime(utilsexec.New(), internalcfg.NodeRegistration.CRISocket)
 			kubeadmutil.CheckErr(err)
-			imagesPull := NewImagesPull(containerRuntime, images.GetAllImages(&internalcfg.ClusterConfiguration, &internalcfg.InitConfiguration.ClusterConfiguration, operatorVersion))
+			if len(filter.Features) == 0 {
+				filter.Features = images.InitFeatures(&internalcfg.ClusterConfiguration)
+			}
+			imgs, err := images.ListImages(&internalcfg.ClusterConfiguration, &internalcfg.InitConfiguration.ClusterConfiguration, operatorVersion, *filter)
+			kubeadmutil.CheckErr(err)
+			imagesPull := NewImagesPull(containerRuntime, images.ImageNames(imgs), pullOpts)
 			kubeadmutil.CheckErr(imagesPull.PullAll())
 		},
 	}
 	AddImagesCommonConfigFlags(cmd.PersistentFlags(), externalcfg, &cfgPath, &featureGatesString, &operatorVersion)
+	AddImagesFilterFlags(cmd.PersistentFlags(), filter, "the images deployed by 'ocadm init' are selected")
+	AddImagesPullFlags(cmd.PersistentFlags(), &pullOpts)
 	cmdutil.AddCRISocketFlag(cmd.PersistentFlags(), &externalcfg.NodeRegistration.CRISocket)
 
 	return cmd
@@ -75,25 +326,179 @@ func NewCmdConfigImagesPull() *cobra.Command {
 type ImagesPull struct {
 	runtime utilruntime.ContainerRuntime
 	images  []string
+	opts    images.PullOptions
 }
 
 // NewImagesPull initializes and returns the `kubeadm config images pull` command
-func NewImagesPull(runtime utilruntime.ContainerRuntime, images []string) *ImagesPull {
+func NewImagesPull(runtime utilruntime.ContainerRuntime, images []string, opts images.PullOptions) *ImagesPull {
 	return &ImagesPull{
 		runtime: runtime,
 		images:  images,
+		opts:    opts,
 	}
 }
 
-// PullAll pulls all images that the ImagesPull knows about
+// PullAll pulls all images that the ImagesPull knows about, the failed images are summarized at the end
 func (ip *ImagesPull) PullAll() error {
-	for _, image := range ip.images {
-		fmt.Printf("[config/images] Pulling %s\n", image)
-		if err := ip.runtime.PullImage(image); err != nil {
-			return errors.Wrapf(err, "failed to pull image %q", image)
+	return images.NewPuller(ip.runtime, ip.opts, os.Stdout, "[config/images]").Pull(ip.images)
+}
+
+// AddImagesPullFlags adds the flags configuring how images are pulled
+func AddImagesPullFlags(flagSet *flag.FlagSet, opts *images.PullOptions) {
+	flagSet.IntVar(&opts.Parallelism, options.ImagePullParallelism, opts.Parallelism, "Number of images pulled at the same time")
+	flagSet.IntVar(&opts.Retries, options.ImagePullRetries, opts.Retries, "Times to retry pulling a failed image, the wait between retries is doubled every time")
+}
+
+// imagesRegistryOptions are the options to access registry when saving or loading images bundle
+type imagesRegistryOptions struct {
+	username           string
+	password           string
+	insecureRegistries []string
+}
+
+func (o *imagesRegistryOptions) addFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&o.username, options.RegistryUsername, "", "Username of the registry")
+	flagSet.StringVar(&o.password, options.RegistryPassword, "", "Password of the registry")
+	flagSet.StringSliceVar(&o.insecureRegistries, options.InsecureRegistry, nil, "Registries allowed plain http and skipping tls verification, e.g. 192.168.0.1:5000")
+}
+
+func (o *imagesRegistryOptions) client() *registry.Client {
+	cli := registry.NewClient(10*time.Minute, o.insecureRegistries...)
+	cli.Username = o.username
+	cli.Password = o.password
+	return cli
+}
+
+// NewCmdConfigImagesSave returns the "ocadm config images save" command
+func NewCmdConfigImagesSave(out io.Writer) *cobra.Command {
+	externalCfg := &apiv1.InitConfiguration{}
+	scheme.Scheme.Default(externalCfg)
+	var cfgPath, featureGatesString, operatorVersion, output string
+	platform := fmt.Sprintf("linux/%s", runtime.GOARCH)
+	regOpts := &imagesRegistryOptions{}
+	filter := &images.ImageFilter{}
+
+	cmd := &cobra.Command{
+		Use:   "save",
+		Short: "Save images used by ocadm to an archive, which could be loaded on the nodes can't reach the registry.",
+		Long: fmt.Sprintf(dedent.Dedent(`
+			This command downloads all the images needed by ocadm, including the images of addons, keepalived
+			and longhorn, from registry and writes them into an OCI layout archive. The archive could be
+			imported by 'ocadm config images load' on the offline nodes.
+
+			Use --%s to save only the images of some features, e.g. --%s kubernetes,network,operator.
+		`), options.ImageFeature, options.ImageFeature),
+		Run: func(_ *cobra.Command, _ []string) {
+			if len(output) == 0 {
+				kubeadmutil.CheckErr(errors.Errorf("the --%s flag is mandatory", options.ImageBundleOutput))
+			}
+			var err error
+			externalCfg.InitConfiguration.ClusterConfiguration.FeatureGates, err = features.NewFeatureGate(&features.InitFeatureGates, featureGatesString)
+			kubeadmutil.CheckErr(err)
+			internalcfg, err := configutil.LoadOrDefaultInitConfiguration(cfgPath, externalCfg)
+			kubeadmutil.CheckErr(err)
+			kubeadmutil.CheckErr(runConfigImagesSave(out, internalcfg, operatorVersion, *filter, platform, output, regOpts))
+		},
+		Args: cobra.NoArgs,
+	}
+	AddImagesCommonConfigFlags(cmd.PersistentFlags(), externalCfg, &cfgPath, &featureGatesString, &operatorVersion)
+	AddImagesFilterFlags(cmd.PersistentFlags(), filter, "all the images are selected")
+	cmd.Flags().StringVarP(&output, options.ImageBundleOutput, "o", "", "Path of the archive to write. This flag is mandatory.")
+	cmd.Flags().StringVar(&platform, options.ImagePlatform, platform, "Platform of the images in format of os/arch[/variant]")
+	regOpts.addFlags(cmd.Flags())
+	return cmd
+}
+
+func runConfigImagesSave(out io.Writer, cfg *apiv1.InitConfiguration, operatorVersion string, filter images.ImageFilter, platform, output string, regOpts *imagesRegistryOptions) error {
+	imgs, err := images.ListImages(&cfg.ClusterConfiguration, &cfg.InitConfiguration.ClusterConfiguration, operatorVersion, filter)
+	if err != nil {
+		return err
+	}
+	manifest := &images.BundleManifest{
+		KubernetesVersion: cfg.KubernetesVersion,
+		OnecloudVersion:   cfg.OnecloudVersion,
+		OperatorVersion:   operatorVersion,
+	}
+	// write to a temporary file first, so a broken archive is never left at output
+	f, err := ioutil.TempFile(filepath.Dir(output), filepath.Base(output)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create archive")
+	}
+	defer os.Remove(f.Name())
+	if err := images.NewBundleSaver(regOpts.client(), platform, out).Save(f, manifest, images.ImageNames(imgs)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "write archive")
+	}
+	if err := os.Rename(f.Name(), output); err != nil {
+		return errors.Wrap(err, "rename archive")
+	}
+	fmt.Fprintf(out, "[config/images] Saved %d images to %s\n", len(manifest.Images), output)
+	return nil
+}
+
+// NewCmdConfigImagesLoad returns the "ocadm config images load" command
+func NewCmdConfigImagesLoad(out io.Writer) *cobra.Command {
+	var input, targetRegistry, criSocket string
+	regOpts := &imagesRegistryOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "load",
+		Short: "Load images from an archive written by 'ocadm config images save'.",
+		Long: fmt.Sprintf(dedent.Dedent(`
+			This command verifies the digests of all the images in archive, then imports them into the local
+			container runtime. If --%s is specified, the images are pushed to the repository instead, e.g.
+			10.0.0.1:5000/yunionio, which could be used as the --%s of 'ocadm init' later.
+		`), options.TargetRegistry, options.ImageRepository),
+		Run: func(_ *cobra.Command, _ []string) {
+			if len(input) == 0 {
+				kubeadmutil.CheckErr(errors.Errorf("the --%s flag is mandatory", options.ImageBundleInput))
+			}
+			kubeadmutil.CheckErr(runConfigImagesLoad(out, input, targetRegistry, criSocket, regOpts))
+		},
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringVarP(&input, options.ImageBundleInput, "i", "", "Path of the archive to load. This flag is mandatory.")
+	cmd.Flags().StringVar(&targetRegistry, options.TargetRegistry, "", "Repository the images are pushed to, e.g. 10.0.0.1:5000/yunionio")
+	regOpts.addFlags(cmd.Flags())
+	cmdutil.AddCRISocketFlag(cmd.Flags(), &criSocket)
+	return cmd
+}
+
+func runConfigImagesLoad(out io.Writer, input, targetRegistry, criSocket string, regOpts *imagesRegistryOptions) error {
+	extractDir := ""
+	if len(targetRegistry) != 0 {
+		dir, err := ioutil.TempDir("", "ocadm-images")
+		if err != nil {
+			return errors.Wrap(err, "create extract dir")
 		}
-		fmt.Printf("[config/images] Pulled %s\n", image)
+		defer os.RemoveAll(dir)
+		extractDir = dir
 	}
+	fmt.Fprintf(out, "[config/images] Verifying %s\n", input)
+	bundle, err := images.OpenBundle(input, extractDir)
+	if err != nil {
+		return err
+	}
+	if len(targetRegistry) != 0 {
+		if err := bundle.Push(regOpts.client(), targetRegistry, out); err != nil {
+			return err
+		}
+	} else {
+		if len(criSocket) == 0 {
+			criSocket, err = utilruntime.DetectCRISocket()
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "[config/images] Importing %d images into container runtime\n", len(bundle.Manifest.Images))
+		if err := bundle.ImportToRuntime(utilsexec.New(), criSocket); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "[config/images] Loaded %d images from %s\n", len(bundle.Manifest.Images), input)
 	return nil
 }
 
@@ -101,7 +506,8 @@ func (ip *ImagesPull) PullAll() error {
 func NewCmdConfigImagesList(out io.Writer, mockK8sVersion *string) *cobra.Command {
 	externalCfg := &apiv1.InitConfiguration{}
 	scheme.Scheme.Default(externalCfg)
-	var cfgPath, featureGatesString, operatorVersion string
+	var cfgPath, featureGatesString, operatorVersion, outputFormat string
+	filter := &images.ImageFilter{}
 
 	if mockK8sVersion != nil {
 		externalCfg.KubernetesVersion = *mockK8sVersion
@@ -113,16 +519,19 @@ func NewCmdConfigImagesList(out io.Writer, mockK8sVersion *string) *cobra.Comman
 		Run: func(_ *cobra.Command, _ []string) {
 			var err error
 			externalCfg.InitConfiguration.ClusterConfiguration.FeatureGates, err = features.NewFeatureGate(&features.InitFeatureGates, featureGatesString)
-			imagesList, err := NewImagesList(cfgPath, externalCfg, operatorVersion)
 			kubeadmutil.CheckErr(err)
-			kubeadmutil.CheckErr(imagesList.Run(out))
+			imagesList, err := NewImagesList(cfgPath, externalCfg, operatorVersion, *filter)
+			kubeadmutil.CheckErr(err)
+			kubeadmutil.CheckErr(imagesList.Run(out, outputFormat))
 		},
 	}
 	AddImagesCommonConfigFlags(cmd.PersistentFlags(), externalCfg, &cfgPath, &featureGatesString, &operatorVersion)
+	AddImagesFilterFlags(cmd.PersistentFlags(), filter, "all the images are selected")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format; available options are 'json'")
 	return cmd
 }
 
-func NewImagesList(cfgPath string, cfg *apiv1.InitConfiguration, operatorVersion string) (*ImagesList, error) {
+func NewImagesList(cfgPath string, cfg *apiv1.InitConfiguration, operatorVersion string, filter images.ImageFilter) (*ImagesList, error) {
 	// TODO: load configuration
 	initcfg, err := configutil.LoadOrDefaultInitConfiguration(cfgPath, cfg)
 	if err != nil {
@@ -131,23 +540,46 @@ func NewImagesList(cfgPath string, cfg *apiv1.InitConfiguration, operatorVersion
 	return &ImagesList{
 		cfg:             initcfg,
 		operatorVersion: operatorVersion,
+		filter:          filter,
 	}, nil
 }
 
 type ImagesList struct {
 	cfg             *apiv1.InitConfiguration
 	operatorVersion string
+	filter          images.ImageFilter
 }
 
-func (i *ImagesList) Run(out io.Writer) error {
-	imgs := images.GetAllImages(&i.cfg.ClusterConfiguration, &i.cfg.InitConfiguration.ClusterConfiguration, i.operatorVersion)
-	for _, img := range imgs {
-		fmt.Fprintln(out, img)
+func (i *ImagesList) Run(out io.Writer, outputFormat string) error {
+	imgs, err := images.ListImages(&i.cfg.ClusterConfiguration, &i.cfg.InitConfiguration.ClusterConfiguration, i.operatorVersion, i.filter)
+	if err != nil {
+		return err
+	}
+	switch outputFormat {
+	case "":
+		for _, img := range imgs {
+			fmt.Fprintln(out, img.Image)
+		}
+	case "json":
+		data, err := json.MarshalIndent(imgs, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshal images")
+		}
+		fmt.Fprintln(out, string(data))
+	default:
+		return errors.Errorf("invalid output format: %s", outputFormat)
 	}
-
 	return nil
 }
 
+// AddImagesFilterFlags adds the flags selecting images by feature and edition
+func AddImagesFilterFlags(flagSet *flag.FlagSet, filter *images.ImageFilter, unsetUsage string) {
+	flagSet.StringSliceVar(&filter.Features, options.ImageFeature, filter.Features,
+		fmt.Sprintf("Only the images of these features, %s if not set. Available values: %s", unsetUsage, strings.Join(images.AllFeatures(), ", ")))
+	flagSet.StringVar(&filter.Edition, options.Edition, images.EditionCE,
+		fmt.Sprintf("Onecloud edition of the images, one of %s|%s", images.EditionCE, images.EditionEE))
+}
+
 // AddImagesCommonConfigFlags adds the flags that configure kubeadm (and affect the images kubeadm will use)
 func AddImagesCommonConfigFlags(flagSet *flag.FlagSet, cfg *apiv1.InitConfiguration, cfgPath *string, featureGatesString *string, operatorVersion *string) {
 	options.AddKubernetesVersionFlag(flagSet, &cfg.KubernetesVersion)
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+func TestRunConfigPrintActionDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name             string
+		configBytesProc  func() ([]byte, error)
+		componentConfigs []string
+		wantKinds        []string
+		wantErr          bool
+	}{
+		{
+			name:            "init",
+			configBytesProc: getDefaultInitConfigBytes,
+			wantKinds:       []string{"InitConfiguration", "ClusterConfiguration"},
+		},
+		{
+			name:             "init with component configs",
+			configBytesProc:  getDefaultInitConfigBytes,
+			componentConfigs: []string{"KubeletConfiguration", "KubeProxyConfiguration"},
+			wantKinds:        []string{"InitConfiguration", "ClusterConfiguration", "KubeletConfiguration", "KubeProxyConfiguration"},
+		},
+		{
+			name:            "join",
+			configBytesProc: getDefaultNodeConfigBytes,
+			wantKinds:       []string{"JoinConfiguration"},
+		},
+		{
+			name:             "unknown component config",
+			configBytesProc:  getDefaultNodeConfigBytes,
+			componentConfigs: []string{"SchedulerConfiguration"},
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			err := runConfigPrintActionDefaults(out, tt.componentConfigs, tt.configBytesProc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runConfigPrintActionDefaults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			gvkmap, err := ocadmutil.SplitYAMLDocuments(out.Bytes())
+			if err != nil {
+				t.Fatalf("split printed documents: %v\n%s", err, out.String())
+			}
+			kinds := sets.NewString()
+			for gvk := range gvkmap {
+				kinds.Insert(gvk.Kind)
+			}
+			if !kinds.HasAll(tt.wantKinds...) {
+				t.Errorf("printed kinds %v, want %v", kinds.List(), tt.wantKinds)
+			}
+			if !strings.Contains(out.String(), placeholderToken.Token.String()) {
+				t.Errorf("printed config doesn't use placeholder token %s:\n%s", placeholderToken.Token, out.String())
+			}
+
+			// the printed defaults are usable by init and join
+			cfgPath := filepath.Join(dir, tt.name+".yaml")
+			if err := ioutil.WriteFile(cfgPath, out.Bytes(), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := configutil.ValidateConfigFile(cfgPath); err != nil {
+				t.Errorf("ValidateConfigFile() of printed defaults error = %v\n%s", err, out.String())
+			}
+		})
+	}
+}
+
+func TestImagesRegistryOptions(t *testing.T) {
+	opts := &imagesRegistryOptions{}
+	flagSet := flag.NewFlagSet("save", flag.ContinueOnError)
+	opts.addFlags(flagSet)
+	if err := flagSet.Parse([]string{
+		"--registry-username", "admin",
+		"--insecure-registry", "10.0.0.1:5000,registry.local",
+		"--insecure-registry", "10.0.0.2:5000",
+	}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	cli := opts.client()
+	if cli.Username != "admin" {
+		t.Errorf("client username = %q, want admin", cli.Username)
+	}
+	for registry, want := range map[string]bool{
+		"10.0.0.1:5000":                    true,
+		"registry.local":                   true,
+		"10.0.0.2:5000":                    true,
+		"10.0.0.3:5000":                    false,
+		"registry.cn-beijing.aliyuncs.com": false,
+	} {
+		if got := cli.IsInsecure(registry); got != want {
+			t.Errorf("IsInsecure(%q) = %v, want %v", registry, got, want)
+		}
+	}
+}
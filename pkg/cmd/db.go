@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+
+	dbphase "yunion.io/x/ocadm/pkg/phases/db"
+)
+
+func NewCmdDB(out io.Writer) *cobra.Command {
+	cmds := &cobra.Command{
+		Use:   "db",
+		Short: "Onecloud service databases administration",
+	}
+
+	cmds.AddCommand(dbphase.NewCmdList(out))
+	cmds.AddCommand(dbphase.NewCmdCheck(out))
+	cmds.AddCommand(dbphase.NewCmdRepairGrants(out))
+	cmds.AddCommand(dbphase.NewCmdDump(out))
+	cmds.AddCommand(dbphase.NewCmdMigrate(out))
+
+	return cmds
+}
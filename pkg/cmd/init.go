@@ -33,13 +33,17 @@ import (
 	"yunion.io/x/ocadm/pkg/apis/constants"
 	ocadmscheme "yunion.io/x/ocadm/pkg/apis/scheme"
 	v1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocadmvalidation "yunion.io/x/ocadm/pkg/apis/v1/validation"
 	occmdutil "yunion.io/x/ocadm/pkg/cmd/util"
+	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/occonfig"
 	"yunion.io/x/ocadm/pkg/options"
 	"yunion.io/x/ocadm/pkg/phases/addons/keepalived"
+	occerts "yunion.io/x/ocadm/pkg/phases/certs"
 	initphases "yunion.io/x/ocadm/pkg/phases/init"
+	"yunion.io/x/ocadm/pkg/phases/nodelabels"
 	configutil "yunion.io/x/ocadm/pkg/util/config"
-	"yunion.io/x/ocadm/pkg/util/kubectl"
+	"yunion.io/x/ocadm/pkg/util/kube"
 	"yunion.io/x/ocadm/pkg/util/mysql"
 	"yunion.io/x/ocadm/pkg/util/onecloud"
 	"yunion.io/x/onecloud/pkg/mcclient"
@@ -88,66 +92,45 @@ var (
 // Please note that this structure includes the public kubeadm config API, but only a subset of the options
 // supported by this api will exposed as a flag
 type initOptions struct {
-	cfgPath                          string
-	skipTokenPrint                   bool
-	dryRun                           bool
-	kubeconfigDir                    string
-	kubeconfigPath                   string
-	featureGatesString               string
-	ignorePreflightErrors            []string
-	bto                              *options.BootstrapTokenOptions
-	externalCfg                      *v1.InitConfiguration
-	hostCfg                          *onecloud.HostCfg
-	uploadCerts                      bool
-	certificateKey                   string
-	skipCertificateKeyPrint          bool
-	printAddonYaml                   bool
-	operatorVersion                  string
-	nodeIP                           string
-	addonCalicoIpAutodetectionMethod string
-	addonCalicoiFelixChaininsertmode string
-	addonCalicoIPV4PoolBlockSize     int
-	nodeCIDRMaskSize                 int
-	highAvailabilityVIP              string
-	keepalivedVersionTag             string
-	glanceNode                       bool
-	baremetalNode                    bool
-	esxiNode                         bool
-	region                           string
-	zone                             string
-	upgradeFromV2                    bool
+	cfgPath                 string
+	skipTokenPrint          bool
+	dryRun                  bool
+	kubeconfigDir           string
+	kubeconfigPath          string
+	featureGatesString      string
+	ignorePreflightErrors   []string
+	bto                     *options.BootstrapTokenOptions
+	externalCfg             *v1.InitConfiguration
+	uploadCerts             bool
+	certificateKey          string
+	skipCertificateKeyPrint bool
+	printAddonYaml          bool
+	upgradeFromV2           bool
+	imagePullOptions        images.PullOptions
 }
 
 var _ initphases.InitData = &initData{}
 
 type initData struct {
-	cfg                              *v1.InitConfiguration
-	skipTokenPrint                   bool
-	dryRun                           bool
-	kubeconfigDir                    string
-	kubeconfigPath                   string
-	ignorePreflightErrors            sets.String
-	certificatesDir                  string
-	dryRunDir                        string
-	externalCA                       bool
-	client                           clientset.Interface
-	kubectlClient                    *kubectl.Client
-	ocClient                         *mcclient.ClientSession
-	waiter                           apiclient.Waiter
-	outputWriter                     io.Writer
-	uploadCerts                      bool
-	certificateKey                   string
-	skipCertificateKeyPrint          bool
-	enableHostAgent                  bool
-	printAddonYaml                   bool
-	operatorVersion                  string
-	nodeIP                           string
-	addonCalicoIpAutodetectionMethod string
-	addonCalicoiFelixChaininsertmode string
-	addonCalicoIPV4PoolBlockSize     int
-	nodeCIDRMaskSize                 int
-	highAvailabilityVIP              string
-	keepalivedVersionTag             string
+	cfg                     *v1.InitConfiguration
+	skipTokenPrint          bool
+	dryRun                  bool
+	kubeconfigDir           string
+	kubeconfigPath          string
+	ignorePreflightErrors   sets.String
+	certificatesDir         string
+	dryRunDir               string
+	externalCA              bool
+	client                  clientset.Interface
+	applier                 *kube.Applier
+	ocClient                *mcclient.ClientSession
+	waiter                  apiclient.Waiter
+	outputWriter            io.Writer
+	uploadCerts             bool
+	certificateKey          string
+	skipCertificateKeyPrint bool
+	printAddonYaml          bool
+	imagePullOptions        images.PullOptions
 }
 
 // NewCmdInit returns "deployer init" command
@@ -165,14 +148,13 @@ func NewCmdInit(out io.Writer, initOptions *initOptions) *cobra.Command {
 			kubeadmutil.CheckErr(err)
 
 			data := c.(*initData)
-			data.enableHostAgent = initOptions.hostCfg.EnableHost
 			data.cfg.ComponentConfigs.KubeProxy.IPVS.StrictARP = true
 			fmt.Printf("[init] Using Kubernetes and Onecloud version: %s & %s\n", data.Cfg().KubernetesVersion, data.OnecloudCfg().OnecloudVersion)
 
 			err = initRunner.Run(args)
 			kubeadmutil.CheckErr(err)
 			if !initOptions.upgradeFromV2 {
-				err = onecloud.GenerateDefaultHostConfig(initOptions.hostCfg, true)
+				err = onecloud.GenerateDefaultHostConfig(newHostCfg(&data.cfg.Node.Host), true)
 				kubeadmutil.CheckErr(err)
 			}
 
@@ -187,7 +169,7 @@ func NewCmdInit(out io.Writer, initOptions *initOptions) *cobra.Command {
 	externalKubeadmCfg := &initOptions.externalCfg.InitConfiguration
 	externalCfg := initOptions.externalCfg
 	AddInitConfigFlags(cmd.Flags(), initOptions.externalCfg)
-	AddHostConfigFlags(cmd.Flags(), initOptions.hostCfg)
+	AddHostConfigFlags(cmd.Flags(), &initOptions.externalCfg.Node.Host)
 	AddKubeadmInitConfigFlags(cmd.Flags(), externalKubeadmCfg, &initOptions.featureGatesString)
 	AddInitOtherFlags(cmd.Flags(), initOptions)
 	initOptions.bto.AddTokenFlag(cmd.Flags())
@@ -219,6 +201,7 @@ func NewCmdInit(out io.Writer, initOptions *initOptions) *cobra.Command {
 	initRunner.AppendPhase(kubeadminitphases.NewMarkControlPlanePhase())
 	initRunner.AppendPhase(kubeadminitphases.NewBootstrapTokenPhase())
 	initRunner.AppendPhase(initphases.NewUploadConfigPhase())
+	initRunner.AppendPhase(initphases.NewOCCertsPhase())
 	initRunner.AppendPhase(kubeadminitphases.NewAddonPhase())
 	initRunner.AppendPhase(initphases.NewOCAddonPhase())
 	initRunner.AppendPhase(initphases.NodeEnableHostAgent())
@@ -266,9 +249,44 @@ func AddInitConfigFlags(flagSet *flag.FlagSet, cfg *v1.InitConfiguration) {
 		&cfg.MysqlConnection.Port, options.MysqlPort, cfg.MysqlConnection.Port,
 		"The port of mysql server",
 	)
+	flagSet.StringVar(
+		&cfg.Node.NodeIP, options.NodeIP, cfg.Node.NodeIP,
+		"Init Node IP",
+	)
+	flagSet.StringVar(
+		&cfg.Calico.IPAutodetectionMethod, options.AddonCalicoIpAutodetectionMethod, cfg.Calico.IPAutodetectionMethod,
+		"Calico IP Autodetection Method",
+	)
+	flagSet.StringVar(
+		&cfg.Calico.FelixChainInsertMode, options.AddonCalicoiFelixChaininsertmode, cfg.Calico.FelixChainInsertMode,
+		fmt.Sprintf(`Calico Felix Chaininsertmode (default: "%s")`, constants.DefaultCalicoFelixChaininsertmode),
+	)
+	flagSet.IntVar(
+		&cfg.Calico.IPV4PoolBlockSize, options.AddonCalicoIPV4BlockSize, cfg.Calico.IPV4PoolBlockSize,
+		"Calico default IPV4 pool block size",
+	)
+	flagSet.IntVar(
+		&cfg.NodeCIDRMaskSize, options.NodeCIDRMaskSize, cfg.NodeCIDRMaskSize,
+		"Kubernetes controller manager node-cidrmask-size config",
+	)
+	flagSet.StringVar(
+		&cfg.ClusterConfiguration.HighAvailabilityVIP, options.HighAvailabilityVIP, cfg.ClusterConfiguration.HighAvailabilityVIP,
+		"high availability VIP",
+	)
+	flagSet.StringVar(
+		&cfg.ClusterConfiguration.KeepalivedVersionTag, options.KeepalivedVersionTag, cfg.ClusterConfiguration.KeepalivedVersionTag,
+		fmt.Sprintf(`keepalived docker image tag within yunion aliyun registry. (default: "%s")`, constants.DefaultKeepalivedVersionTag),
+	)
+	flagSet.StringSliceVar(
+		&cfg.Addons.Disabled, options.DisableAddons, cfg.Addons.Disabled,
+		"The onecloud addons not installed by init, e.g. 'calico'",
+	)
+	options.AddOperatorVersionFlags(flagSet, &cfg.ClusterConfiguration.OperatorVersion)
+	options.AddGlanceNodeLabelFlag(flagSet, &cfg.Node.GlanceNode, &cfg.Node.BaremetalNode, &cfg.Node.EsxiNode)
 }
 
-func AddHostConfigFlags(flagSet *flag.FlagSet, o *onecloud.HostCfg) {
+// AddHostConfigFlags adds host agent flags bound to the node config to the specified flagset
+func AddHostConfigFlags(flagSet *flag.FlagSet, o *v1.HostConfiguration) {
 	flagSet.StringArrayVar(
 		&o.LocalImagePath, options.HostLocalImagePath, o.LocalImagePath,
 		"Host configure: local image path",
@@ -282,11 +300,11 @@ func AddHostConfigFlags(flagSet *flag.FlagSet, o *onecloud.HostCfg) {
 		"Host configure: networks",
 	)
 	flagSet.BoolVar(
-		&o.EnableHost, "enable-host-agent", o.EnableHost,
+		&o.Enabled, options.EnableHostAgent, o.Enabled,
 		"Enable host agent",
 	)
 	flagSet.BoolVar(
-		&o.EnableHugepage, "enable-hugepage", o.EnableHugepage,
+		&o.EnableHugepage, options.EnableHugepage, o.EnableHugepage,
 		"Host configure: hugepage options",
 	)
 }
@@ -338,26 +356,6 @@ func AddInitOtherFlags(flagSet *flag.FlagSet, initOptions *initOptions) {
 		&initOptions.ignorePreflightErrors, options.IgnorePreflightErrors, initOptions.ignorePreflightErrors,
 		"A list of checks whose errors will be shown as warnings. Example: 'IsPrivilegedUser,Swap'. Value 'all' ignores errors from all checks.",
 	)
-	flagSet.StringVar(
-		&initOptions.nodeIP, options.NodeIP, initOptions.nodeIP,
-		"Init Node IP",
-	)
-	flagSet.StringVar(
-		&initOptions.addonCalicoIpAutodetectionMethod, options.AddonCalicoIpAutodetectionMethod, initOptions.addonCalicoIpAutodetectionMethod,
-		"Calico IP Autodetection Method",
-	)
-	flagSet.StringVar(
-		&initOptions.addonCalicoiFelixChaininsertmode, options.AddonCalicoiFelixChaininsertmode, initOptions.addonCalicoiFelixChaininsertmode,
-		fmt.Sprintf(`Calico Felix Chaininsertmode (default: "%s")`, constants.DefaultCalicoFelixChaininsertmode),
-	)
-	flagSet.StringVar(
-		&initOptions.highAvailabilityVIP, options.HighAvailabilityVIP, initOptions.highAvailabilityVIP,
-		"high availability VIP",
-	)
-	flagSet.StringVar(
-		&initOptions.keepalivedVersionTag, options.KeepalivedVersionTag, initOptions.keepalivedVersionTag,
-		fmt.Sprintf(`keepalived docker image tag within yunion aliyun registry. (default: "%s")`, constants.DefaultKeepalivedVersionTag),
-	)
 	flagSet.BoolVar(
 		&initOptions.dryRun, options.DryRun, initOptions.dryRun,
 		"Don't apply any changes; just output what would be done.",
@@ -366,17 +364,8 @@ func AddInitOtherFlags(flagSet *flag.FlagSet, initOptions *initOptions) {
 		&initOptions.printAddonYaml, options.PrintAddonYaml, initOptions.printAddonYaml,
 		"Print addon yaml manifest",
 	)
-	flagSet.IntVar(
-		&initOptions.nodeCIDRMaskSize, options.NodeCIDRMaskSize, 24,
-		"Kubernetes controller manager node-cidrmask-size config",
-	)
-	flagSet.IntVar(
-		&initOptions.addonCalicoIPV4PoolBlockSize, options.AddonCalicoIPV4BlockSize, 26,
-		"Calico default IPV4 pool block size")
-
-	options.AddOperatorVersionFlags(flagSet, &initOptions.operatorVersion)
-	options.AddGlanceNodeLabelFlag(flagSet, &initOptions.glanceNode, &initOptions.baremetalNode, &initOptions.esxiNode)
 	options.AddUpgradeFromV2Flags(flagSet, &initOptions.upgradeFromV2)
+	AddImagesPullFlags(flagSet, &initOptions.imagePullOptions)
 }
 
 // newInitOptions returns a struct ready for being used for creating cmd init flags.
@@ -390,12 +379,12 @@ func newInitOptions() *initOptions {
 	bto.Description = "The default bootstrap token generated by 'ocadm init'."
 
 	return &initOptions{
-		externalCfg:    externalCfg,
-		bto:            bto,
-		kubeconfigDir:  kubeadmconstants.KubernetesDir,
-		kubeconfigPath: kubeadmconstants.GetAdminKubeConfigPath(),
-		uploadCerts:    true, // always upload certs
-		hostCfg:        new(onecloud.HostCfg),
+		externalCfg:      externalCfg,
+		bto:              bto,
+		kubeconfigDir:    kubeadmconstants.KubernetesDir,
+		kubeconfigPath:   kubeadmconstants.GetAdminKubeConfigPath(),
+		uploadCerts:      true, // always upload certs
+		imagePullOptions: images.DefaultPullOptions(),
 	}
 }
 
@@ -448,8 +437,11 @@ func newInitData(cmd *cobra.Command, args []string, options *initOptions, out io
 	}
 
 	// init node always as onecloud controller
-	cfg.NodeRegistration.KubeletExtraArgs = customizeKubeletExtarArgs(
-		options.hostCfg.EnableHost, options.glanceNode, options.baremetalNode, options.esxiNode, true, options.nodeIP)
+	roles := nodelabels.ConfiguredRoles(&cfg.Node, true)
+	if err := nodelabels.ValidateRoles(roles); err != nil {
+		return nil, err
+	}
+	cfg.NodeRegistration.KubeletExtraArgs = customizeKubeletExtarArgs(roles, cfg.Node.NodeIP)
 
 	if err := configutil.VerifyAPIServerBindAddress(cfg.LocalAPIEndpoint.AdvertiseAddress); err != nil {
 		return nil, err
@@ -496,6 +488,11 @@ func newInitData(cmd *cobra.Command, args []string, options *initOptions, out io
 		}
 	}
 
+	// Checks the onecloud CA provided by the user, the leaf certificates are required if the CA key is absent
+	if _, err := occerts.UsingExternalOnecloudCA(cfg.OnecloudCertificatesDir); err != nil {
+		return nil, errors.Wrapf(err, "invalid or incomplete external onecloud CA")
+	}
+
 	if options.uploadCerts && (externalCA || externalFrontProxyCA) {
 		return nil, errors.New("can't use upload-certs with an external CA or an external front-proxy CA")
 	}
@@ -504,44 +501,42 @@ func newInitData(cmd *cobra.Command, args []string, options *initOptions, out io
 		cfg.ControlPlaneEndpoint = fmt.Sprintf("%s:%d", cfg.LocalAPIEndpoint.AdvertiseAddress, cfg.LocalAPIEndpoint.BindPort)
 	}
 
-	if options.nodeCIDRMaskSize > options.addonCalicoIPV4PoolBlockSize {
-		return nil, errors.Errorf("--node-cidr-mask-size %d must less or equal than --addon-calico-ipv4-block-size %d", options.nodeCIDRMaskSize, options.addonCalicoIPV4PoolBlockSize)
+	if err := ocadmvalidation.ValidateInitConfiguration(cfg).ToAggregate(); err != nil {
+		return nil, err
 	}
 	if cfg.InitConfiguration.ControllerManager.ExtraArgs == nil {
 		cfg.InitConfiguration.ControllerManager.ExtraArgs = make(map[string]string, 0)
 	}
-	cfg.InitConfiguration.ControllerManager.ExtraArgs["node-cidr-mask-size"] = fmt.Sprintf("%d", options.nodeCIDRMaskSize)
+	cfg.InitConfiguration.ControllerManager.ExtraArgs["node-cidr-mask-size"] = fmt.Sprintf("%d", cfg.NodeCIDRMaskSize)
 
 	data := &initData{
-		cfg:                              cfg,
-		certificatesDir:                  cfg.CertificatesDir,
-		skipTokenPrint:                   options.skipTokenPrint,
-		dryRun:                           options.dryRun,
-		dryRunDir:                        dryRunDir,
-		kubeconfigDir:                    options.kubeconfigDir,
-		kubeconfigPath:                   options.kubeconfigPath,
-		ignorePreflightErrors:            ignorePreflightErrorsSet,
-		externalCA:                       externalCA,
-		outputWriter:                     out,
-		uploadCerts:                      options.uploadCerts,
-		certificateKey:                   options.certificateKey,
-		skipCertificateKeyPrint:          options.skipCertificateKeyPrint,
-		printAddonYaml:                   options.printAddonYaml,
-		operatorVersion:                  options.operatorVersion,
-		addonCalicoIpAutodetectionMethod: options.addonCalicoIpAutodetectionMethod,
-		addonCalicoiFelixChaininsertmode: options.addonCalicoiFelixChaininsertmode,
-		addonCalicoIPV4PoolBlockSize:     options.addonCalicoIPV4PoolBlockSize,
-		nodeCIDRMaskSize:                 options.nodeCIDRMaskSize,
-		nodeIP:                           options.nodeIP,
-		highAvailabilityVIP:              options.highAvailabilityVIP,
-		keepalivedVersionTag:             options.keepalivedVersionTag,
+		cfg:                     cfg,
+		certificatesDir:         cfg.CertificatesDir,
+		skipTokenPrint:          options.skipTokenPrint,
+		dryRun:                  options.dryRun,
+		dryRunDir:               dryRunDir,
+		kubeconfigDir:           options.kubeconfigDir,
+		kubeconfigPath:          options.kubeconfigPath,
+		ignorePreflightErrors:   ignorePreflightErrorsSet,
+		externalCA:              externalCA,
+		outputWriter:            out,
+		uploadCerts:             options.uploadCerts,
+		certificateKey:          options.certificateKey,
+		skipCertificateKeyPrint: options.skipCertificateKeyPrint,
+		printAddonYaml:          options.printAddonYaml,
+		imagePullOptions:        options.imagePullOptions,
 	}
 	return data, nil
 }
 
 // EnableHostAgent return is enable host agent
 func (d *initData) EnabledHostAgent() bool {
-	return d.enableHostAgent
+	return d.cfg.Node.Host.Enabled
+}
+
+// ImagePullOptions returns the options used to pull images in preflight
+func (d *initData) ImagePullOptions() images.PullOptions {
+	return d.imagePullOptions
 }
 
 // PrintAddonYaml only print onecloud addon yaml manifest
@@ -551,27 +546,27 @@ func (d *initData) PrintAddonYaml() bool {
 
 // AddonCalicoIpAutodetectionMethod return addonCalicoIpAutodetectionMethod
 func (d *initData) AddonCalicoIpAutodetectionMethod() string {
-	return d.addonCalicoIpAutodetectionMethod
+	return d.cfg.Calico.IPAutodetectionMethod
 }
 
 // AddonCalicoiFelixChaininsertmode return addonCalicoiFelixChaininsertmode
 func (d *initData) AddonCalicoiFelixChaininsertmode() string {
-	return d.addonCalicoiFelixChaininsertmode
+	return d.cfg.Calico.FelixChainInsertMode
 }
 
 // AddonCalicoIPV4PoolBlockSize return addonCalicoIPV4PoolBlockSize
 func (d *initData) AddonCalicoIPV4PoolBlockSize() int {
-	return d.addonCalicoIPV4PoolBlockSize
+	return d.cfg.Calico.IPV4PoolBlockSize
 }
 
 // GetHighAvailabilityVIP return highAvailabilityVIP
 func (d *initData) GetHighAvailabilityVIP() string {
-	return d.highAvailabilityVIP
+	return d.cfg.ClusterConfiguration.HighAvailabilityVIP
 }
 
 // GetKeepalivedVersionTag return keepalivedVersionTag
 func (d *initData) GetKeepalivedVersionTag() string {
-	return d.keepalivedVersionTag
+	return d.cfg.ClusterConfiguration.KeepalivedVersionTag
 }
 
 // UploadCerts returns Uploadcerts flag.
@@ -648,16 +643,17 @@ func (d *initData) KubeConfigPath() string {
 	return d.kubeconfigPath
 }
 
-func (d *initData) KubectlClient() (*kubectl.Client, error) {
-	if d.kubectlClient != nil {
-		return d.kubectlClient, nil
+// Applier returns the applier of addon manifests
+func (d *initData) Applier() (*kube.Applier, error) {
+	if d.applier != nil {
+		return d.applier, nil
 	}
-	cli, err := kubectl.NewClientFormKubeconfigFile(d.KubeConfigPath())
+	applier, err := newAddonApplier(d.KubeConfigPath())
 	if err != nil {
 		return nil, err
 	}
-	d.kubectlClient = cli
-	return d.kubectlClient, nil
+	d.applier = applier
+	return d.applier, nil
 }
 
 // ManifestDir returns the path where manifest should be stored or the temporary folder path in case of DryRun.
@@ -739,16 +735,16 @@ func (d *initData) OnecloudClientSession() (*mcclient.ClientSession, error) {
 }
 
 func (d *initData) OperatorVersion() string {
-	return d.operatorVersion
+	return d.cfg.ClusterConfiguration.OperatorVersion
 }
 
 // GetNodeIP returns current node ip for init mode
 func (d *initData) GetNodeIP() string {
-	if len(d.nodeIP) > 0 {
-		return d.nodeIP
+	if len(d.cfg.Node.NodeIP) > 0 {
+		return d.cfg.Node.NodeIP
 	}
-	if strings.HasPrefix(d.addonCalicoIpAutodetectionMethod, "can-reach=") {
-		return strings.Replace(d.addonCalicoIpAutodetectionMethod, "can-reach=", "", -1)
+	if strings.HasPrefix(d.cfg.Calico.IPAutodetectionMethod, "can-reach=") {
+		return strings.Replace(d.cfg.Calico.IPAutodetectionMethod, "can-reach=", "", -1)
 	}
 	return ""
 }
@@ -788,3 +784,14 @@ func showJoinCommand(i *initData, out io.Writer) error {
 
 	return nil
 }
+
+// newHostCfg returns the host agent config generated by onecloud from the node config
+func newHostCfg(o *v1.HostConfiguration) *onecloud.HostCfg {
+	return &onecloud.HostCfg{
+		EnableHost:     o.Enabled,
+		LocalImagePath: o.LocalImagePath,
+		Networks:       o.Networks,
+		Hostname:       o.Hostname,
+		EnableHugepage: o.EnableHugepage,
+	}
+}
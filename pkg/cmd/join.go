@@ -24,14 +24,15 @@ import (
 	"k8s.io/kubernetes/cmd/kubeadm/app/discovery"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
-	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
 	ocadmscheme "yunion.io/x/ocadm/pkg/apis/scheme"
 	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocadmvalidation "yunion.io/x/ocadm/pkg/apis/v1/validation"
 	"yunion.io/x/ocadm/pkg/options"
 	"yunion.io/x/ocadm/pkg/phases/addons/keepalived"
 	joinphases "yunion.io/x/ocadm/pkg/phases/join"
+	"yunion.io/x/ocadm/pkg/phases/nodelabels"
 	configutil "yunion.io/x/ocadm/pkg/util/config"
 	"yunion.io/x/ocadm/pkg/util/onecloud"
 )
@@ -75,17 +76,8 @@ type joinOptions struct {
 	controlPlane          bool
 	ignorePreflightErrors []string
 	externalcfg           *apiv1.JoinConfiguration
-	hostCfg               *onecloud.HostCfg
 	certificateKey        string
-	asOnecloudController  bool
-	nodeIP                string
-	highAvailabilityVIP   string
-	keepalivedVersionTag  string
-	glanceNode            bool
-	baremetalNode         bool
-	esxiNode              bool
 	upgradeFromV2         bool
-	hostInterface         string
 }
 
 // compile-time assert that the local data object satisfies the phases data interface.
@@ -102,14 +94,6 @@ type joinData struct {
 	ignorePreflightErrors sets.String
 	outputWriter          io.Writer
 	certificateKey        string
-	enableHostAgent       bool
-	asOnecloudController  bool
-	nodeIP                string
-	highAvailabilityVIP   string
-	keepalivedVersionTag  string
-	glanceNode            bool
-	baremetalNode         bool
-	esxiNode              bool
 	hostInterface         string
 }
 
@@ -131,19 +115,11 @@ func NewCmdJoin(out io.Writer, joinOptions *joinOptions) *cobra.Command {
 			kubeadmutil.CheckErr(err)
 
 			data := c.(*joinData)
-			data.enableHostAgent = joinOptions.hostCfg.EnableHost
-			data.glanceNode = joinOptions.glanceNode
-			data.esxiNode = joinOptions.esxiNode
-			data.baremetalNode = joinOptions.baremetalNode
-			// by default, control plane node as onecloud controller
-			if joinOptions.asOnecloudController {
-				data.asOnecloudController = true
-			}
 			err = joinRunner.Run(args)
 			kubeadmutil.CheckErr(err)
 
 			if !joinOptions.upgradeFromV2 {
-				err = onecloud.GenerateDefaultHostConfig(joinOptions.hostCfg, joinOptions.controlPlane)
+				err = onecloud.GenerateDefaultHostConfig(newHostCfg(&data.cfg.Node.Host), data.cfg.ControlPlane != nil)
 				kubeadmutil.CheckErr(err)
 			}
 
@@ -173,8 +149,9 @@ func NewCmdJoin(out io.Writer, joinOptions *joinOptions) *cobra.Command {
 
 	addJoinConfigFlags(cmd.Flags(), joinOptions.externalcfg)
 	addJoinOtherFlags(cmd.Flags(), joinOptions)
-	AddHostConfigFlags(cmd.Flags(), joinOptions.hostCfg)
+	AddHostConfigFlags(cmd.Flags(), &joinOptions.externalcfg.Node.Host)
 	joinRunner.AppendPhase(kubeadmjoinphases.NewPreflightPhase())
+	joinRunner.AppendPhase(joinphases.NewHostAgentPreflightPhase())
 	joinRunner.AppendPhase(keepalived.NewKeepalivedPhase())
 	joinRunner.AppendPhase(kubeadmjoinphases.NewControlPlanePreparePhase())
 	// joinRunner.AppendPhase(joinphases.NewNodePreparePhase())
@@ -235,6 +212,23 @@ func addJoinConfigFlags(flagSet *flag.FlagSet, cfg *apiv1.JoinConfiguration) {
 		`Specify the token used to temporarily authenticate with the Kubernetes Control Plane while joining the node.`,
 	)
 	cmdutil.AddCRISocketFlag(flagSet, &cfg.NodeRegistration.CRISocket)
+	flagSet.BoolVar(
+		&cfg.AsOnecloudController, options.AsOnecloudController, cfg.AsOnecloudController,
+		"Join node and set node as onecloud controller",
+	)
+	flagSet.StringVar(
+		&cfg.Node.NodeIP, options.NodeIP, cfg.Node.NodeIP,
+		"Join node IP",
+	)
+	flagSet.StringVar(
+		&cfg.HighAvailabilityVIP, options.HighAvailabilityVIP, cfg.HighAvailabilityVIP,
+		"high Availability VIP",
+	)
+	flagSet.StringVar(
+		&cfg.KeepalivedVersionTag, options.KeepalivedVersionTag, cfg.KeepalivedVersionTag,
+		fmt.Sprintf(`keepalived docker image tag within yunion aliyun registry. (default: "%s")`, constants.DefaultKeepalivedVersionTag),
+	)
+	options.AddGlanceNodeLabelFlag(flagSet, &cfg.Node.GlanceNode, &cfg.Node.BaremetalNode, &cfg.Node.EsxiNode)
 }
 
 // addJoinOtherFlags adds join flags that are not bound to a configuration file to the given flagset
@@ -259,23 +253,6 @@ func addJoinOtherFlags(flagSet *flag.FlagSet, joinOptions *joinOptions) {
 		&joinOptions.certificateKey, options.CertificateKey, "",
 		"Use this key to decrypt the certificate secrets uploaded by init.",
 	)
-	flagSet.BoolVar(
-		&joinOptions.asOnecloudController, options.AsOnecloudController, joinOptions.asOnecloudController,
-		"Join node and set node as onecloud controller",
-	)
-	flagSet.StringVar(
-		&joinOptions.nodeIP, options.NodeIP, joinOptions.nodeIP,
-		"Join node IP",
-	)
-	flagSet.StringVar(
-		&joinOptions.highAvailabilityVIP, options.HighAvailabilityVIP, joinOptions.highAvailabilityVIP,
-		"high Availability VIP",
-	)
-	flagSet.StringVar(
-		&joinOptions.keepalivedVersionTag, options.KeepalivedVersionTag, joinOptions.keepalivedVersionTag,
-		fmt.Sprintf(`keepalived docker image tag within yunion aliyun registry. (default: "%s")`, constants.DefaultKeepalivedVersionTag),
-	)
-	options.AddGlanceNodeLabelFlag(flagSet, &joinOptions.glanceNode, &joinOptions.baremetalNode, &joinOptions.esxiNode)
 	options.AddUpgradeFromV2Flags(flagSet, &joinOptions.upgradeFromV2)
 }
 
@@ -295,7 +272,6 @@ func newJoinOptions() *joinOptions {
 
 	return &joinOptions{
 		externalcfg: externalcfg,
-		hostCfg:     new(onecloud.HostCfg),
 	}
 }
 
@@ -385,6 +361,12 @@ func newJoinData(cmd *cobra.Command, args []string, opt *joinOptions, out io.Wri
 	if err != nil {
 		return nil, err
 	}
+	if err := ocadmvalidation.ValidateJoinConfiguration(cfg).ToAggregate(); err != nil {
+		return nil, err
+	}
+	if err := nodelabels.ValidateRoles(nodelabels.ConfiguredRoles(&cfg.Node, cfg.AsOnecloudController)); err != nil {
+		return nil, err
+	}
 
 	// override node name and CRI socket from the command line opt
 	if opt.externalcfg.NodeRegistration.Name != "" {
@@ -400,9 +382,15 @@ func newJoinData(cmd *cobra.Command, args []string, opt *joinOptions, out io.Wri
 		}
 	}
 
+	// the certificate key can be specified in the config file written by 'ocadm token create --join-config-file'
+	certificateKey := opt.certificateKey
+	if certificateKey == "" && cfg.ControlPlane != nil {
+		certificateKey = cfg.ControlPlane.CertificateKey
+	}
+
 	hostInterface := ""
-	if len(opt.hostCfg.Networks) >= 1 && strings.Contains(opt.hostCfg.Networks[0], "/") {
-		hostInterface = strings.Split(opt.hostCfg.Networks[0], "/")[0]
+	if networks := cfg.Node.Host.Networks; len(networks) >= 1 && strings.Contains(networks[0], "/") {
+		hostInterface = strings.Split(networks[0], "/")[0]
 	}
 
 	return &joinData{
@@ -410,22 +398,19 @@ func newJoinData(cmd *cobra.Command, args []string, opt *joinOptions, out io.Wri
 		tlsBootstrapCfg:       tlsBootstrapCfg,
 		ignorePreflightErrors: ignorePreflightErrorsSet,
 		outputWriter:          out,
-		certificateKey:        opt.certificateKey,
-		nodeIP:                opt.nodeIP,
-		highAvailabilityVIP:   opt.highAvailabilityVIP,
-		keepalivedVersionTag:  opt.keepalivedVersionTag,
+		certificateKey:        certificateKey,
 		hostInterface:         hostInterface,
 	}, nil
 }
 
 // GetHighAvailabilityVIP return the highAvailabilityVIP
 func (j *joinData) GetHighAvailabilityVIP() string {
-	return j.highAvailabilityVIP
+	return j.cfg.HighAvailabilityVIP
 }
 
 // GetKeepalivedVersionTag return the keepalivedVersionTag
 func (j *joinData) GetKeepalivedVersionTag() string {
-	return j.keepalivedVersionTag
+	return j.cfg.KeepalivedVersionTag
 }
 
 // GetHostInterface return the hostInterface
@@ -435,7 +420,7 @@ func (j *joinData) GetHostInterface() string {
 
 // EnableHostAgent return is enable host agent
 func (j *joinData) EnabledHostAgent() bool {
-	return j.enableHostAgent
+	return j.cfg.Node.Host.Enabled
 }
 
 // CertificateKey returns the key used to encrypt the certs.
@@ -476,61 +461,26 @@ func (j *joinData) OnecloudInitCfg() (*apiv1.InitConfiguration, error) {
 	if err != nil {
 		return nil, err
 	}
-	initCfg.NodeRegistration.KubeletExtraArgs = customizeKubeletExtarArgs(
-		j.enableHostAgent, j.glanceNode, j.baremetalNode, j.esxiNode, j.asOnecloudController, j.nodeIP)
+	initCfg.NodeRegistration.KubeletExtraArgs = customizeKubeletExtarArgs(nodelabels.ConfiguredRoles(&j.cfg.Node, j.cfg.AsOnecloudController), j.cfg.Node.NodeIP)
 	j.initCfg = initCfg
 	return j.initCfg, nil
 }
 
-func customizeKubeletExtarArgs(
-	enableHostAgent, glanceNode, baremetalNode, esxiNode, asOnecloudController bool, nodeIP string,
-) map[string]string {
-	if !enableHostAgent && !asOnecloudController {
+func customizeKubeletExtarArgs(roles []string, nodeIP string) map[string]string {
+	enabled := sets.NewString(roles...)
+	if !enabled.Has(nodelabels.RoleHost) && !enabled.Has(nodelabels.RoleController) {
 		return nil
 	}
 	ret := make(map[string]string)
-	if enableHostAgent {
-		klog.V(1).Infoln("[preflight] Enable host agent")
-		lableStr := fmt.Sprintf("%s=enable", operatorconstants.OnecloudEnableHostLabelKey)
-		ret["node-labels"] = lableStr
-	}
-	if glanceNode {
-		klog.V(1).Infoln("[preflight] As glance node")
-		lableStr := ret["node-labels"]
-		if len(lableStr) > 0 {
-			lableStr += ","
-		}
-		lableStr += "onecloud.yunion.io/glance=enable"
-		ret["node-labels"] = lableStr
-	}
-	if baremetalNode {
-		klog.V(1).Infoln("[preflight] As baremetal node")
-		lableStr := ret["node-labels"]
-		if len(lableStr) > 0 {
-			lableStr += ","
-		}
-		lableStr += "onecloud.yunion.io/baremetal=enable"
-		ret["node-labels"] = lableStr
-	}
-	if esxiNode {
-		klog.V(1).Infoln("[preflight] As esxi node")
-		lableStr := ret["node-labels"]
-		if len(lableStr) > 0 {
-			lableStr += ","
-		}
-		lableStr += "onecloud.yunion.io/esxi=enable"
-		ret["node-labels"] = lableStr
-	}
-	if asOnecloudController {
-		klog.V(1).Infoln("[preflight] As onecloud controller")
-		var labelStr string
-		if _labelStr, ok := ret["node-labels"]; ok {
-			labelStr = fmt.Sprintf("%s,%s=enable", _labelStr, operatorconstants.OnecloudControllerLabelKey)
-		} else {
-			labelStr = fmt.Sprintf("%s=enable", operatorconstants.OnecloudControllerLabelKey)
+	labels := make([]string, 0)
+	for _, role := range nodelabels.Roles {
+		if !enabled.Has(role.Name) {
+			continue
 		}
-		ret["node-labels"] = labelStr
+		klog.V(1).Infof("[preflight] As %s node", role.Name)
+		labels = append(labels, role.Label())
 	}
+	ret["node-labels"] = strings.Join(labels, ",")
 
 	if len(nodeIP) > 0 {
 		ret["node-ip"] = nodeIP
@@ -574,7 +524,7 @@ func (j *joinData) OutputWriter() io.Writer {
 
 // GetNodeIP returns current node ip for join mode
 func (j *joinData) GetNodeIP() string {
-	return j.nodeIP
+	return j.cfg.Node.NodeIP
 }
 
 // fetchInitConfigurationFromJoinConfiguration retrieves the init configuration from a join configuration, performing the discovery
@@ -1,9 +1,22 @@
 package cmd
 
 import (
-	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/phases/nodelabels"
 )
 
+// roleLabels returns the node labels setting or unsetting the role
+func roleLabels(name string, enable bool) map[string]string {
+	role, err := nodelabels.GetRole(name)
+	if err != nil {
+		panic(err)
+	}
+	value := role.DisabledValue
+	if enable {
+		value = role.EnabledValue
+	}
+	return map[string]string{role.LabelKey: value}
+}
+
 type hostEnableData struct {
 	nodesBaseData
 }
@@ -17,9 +30,7 @@ func (h *hostEnableData) Short() string {
 }
 
 func (h *hostEnableData) GetLabels() map[string]string {
-	return map[string]string{
-		operatorconstants.OnecloudEnableHostLabelKey: "enable",
-	}
+	return roleLabels(nodelabels.RoleHost, true)
 }
 
 type hostDisableData struct {
@@ -35,9 +46,7 @@ func (h *hostDisableData) Short() string {
 }
 
 func (h *hostDisableData) GetLabels() map[string]string {
-	return map[string]string{
-		operatorconstants.OnecloudEnableHostLabelKey: "disable",
-	}
+	return roleLabels(nodelabels.RoleHost, false)
 }
 
 type onecloudControllerEnableData struct {
@@ -53,9 +62,7 @@ func (h *onecloudControllerEnableData) Short() string {
 }
 
 func (h *onecloudControllerEnableData) GetLabels() map[string]string {
-	return map[string]string{
-		operatorconstants.OnecloudControllerLabelKey: "enable",
-	}
+	return roleLabels(nodelabels.RoleController, true)
 }
 
 type onecloudControllerDisableData struct {
@@ -71,7 +78,5 @@ func (h *onecloudControllerDisableData) Short() string {
 }
 
 func (h *onecloudControllerDisableData) GetLabels() map[string]string {
-	return map[string]string{
-		operatorconstants.OnecloudControllerLabelKey: "disable",
-	}
+	return roleLabels(nodelabels.RoleController, false)
 }
@@ -60,7 +60,7 @@ func cmdLonghornEnable() *cobra.Command {
 			return nil, err
 		}
 		opt.kubeconfigPath = kubeadmconstants.GetAdminKubeConfigPath()
-		_, err = opt.KubectlClient()
+		_, err = opt.Applier()
 		if err != nil {
 			return nil, err
 		}
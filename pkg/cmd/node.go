@@ -1,17 +1,24 @@
 package cmd
 
 import (
+	"fmt"
 	"io"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/lithammer/dedent"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	cmdutil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/options"
 	"yunion.io/x/ocadm/pkg/phases/nodelabels"
 )
 
@@ -24,10 +31,129 @@ func NewCmdNode(out io.Writer) *cobra.Command {
 	for _, cmd := range cmdSetNodeLables() {
 		cmds.AddCommand(cmd)
 	}
+	cmds.AddCommand(NewCmdNodeRole(out))
 
 	return cmds
 }
 
+// nodeRoleOptions holds the flags of "ocadm node role" commands
+type nodeRoleOptions struct {
+	kubeconfigPath string
+	nodes          []string
+	selector       string
+	roles          []string
+}
+
+func (o *nodeRoleOptions) addFlags(flagSet *flag.FlagSet, withRoles bool) {
+	options.AddKubeConfigFlag(flagSet, &o.kubeconfigPath)
+	flagSet.StringArrayVar(
+		&o.nodes, "node", o.nodes,
+		"Node names to operate on",
+	)
+	flagSet.StringVarP(
+		&o.selector, "selector", "l", o.selector,
+		"Label selector of nodes to operate on, e.g. zone=zone0",
+	)
+	if withRoles {
+		flagSet.StringSliceVar(
+			&o.roles, "role", o.roles,
+			fmt.Sprintf("Roles to operate on, one or more of %s", strings.Join(nodelabels.RoleNames(), ", ")),
+		)
+	}
+}
+
+func (o *nodeRoleOptions) listNodes() (clientset.Interface, []corev1.Node, error) {
+	client, err := kubeconfigutil.ClientSetFromFile(o.kubeconfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := nodelabels.ListNodes(client, o.nodes, o.selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, nodes, nil
+}
+
+// NewCmdNodeRole returns the "ocadm node role" command
+func NewCmdNodeRole(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "role",
+		Short: "Manage the onecloud roles of nodes",
+		Long: fmt.Sprintf(dedent.Dedent(`
+			Manage the onecloud roles of nodes, the services of a role are scheduled to the nodes by label:
+
+			%s
+			The nodes are selected by --node or --selector, "list" shows all the nodes if neither is specified.
+		`), nodeRolesDesc()),
+		RunE: cmdutil.SubCmdRunE("role"),
+	}
+	cmd.AddCommand(newCmdNodeRoleList(out))
+	cmd.AddCommand(newCmdNodeRoleSet(out, "set", "Set the roles of nodes", true))
+	cmd.AddCommand(newCmdNodeRoleSet(out, "unset", "Unset the roles of nodes", false))
+	return cmd
+}
+
+func nodeRolesDesc() string {
+	desc := ""
+	for _, r := range nodelabels.Roles {
+		desc += fmt.Sprintf("  %-12s%s\n", r.Name, r.Label())
+	}
+	return desc
+}
+
+func newCmdNodeRoleList(out io.Writer) *cobra.Command {
+	opt := &nodeRoleOptions{kubeconfigPath: constants.GetAdminKubeConfigPath()}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List nodes and their onecloud roles",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, nodes, err := opt.listNodes()
+			kubeadmutil.CheckErr(err)
+			err = printNodeRoles(out, nodes)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	opt.addFlags(cmd.Flags(), false)
+	return cmd
+}
+
+func newCmdNodeRoleSet(out io.Writer, use, short string, enable bool) *cobra.Command {
+	opt := &nodeRoleOptions{kubeconfigPath: constants.GetAdminKubeConfigPath()}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(opt.roles) == 0 {
+				kubeadmutil.CheckErr(errors.New("no --role specified"))
+			}
+			if len(opt.nodes) == 0 && opt.selector == "" {
+				kubeadmutil.CheckErr(errors.New("no --node or --selector specified"))
+			}
+			client, nodes, err := opt.listNodes()
+			kubeadmutil.CheckErr(err)
+			err = nodelabels.SetNodesRoles(client, nodes, opt.roles, enable, out)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	opt.addFlags(cmd.Flags(), true)
+	return cmd
+}
+
+func printNodeRoles(out io.Writer, nodes []corev1.Node) error {
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLES")
+	for i := range nodes {
+		roles := strings.Join(nodelabels.NodeRoles(&nodes[i]), ",")
+		if roles == "" {
+			roles = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", nodes[i].Name, roles)
+	}
+	return w.Flush()
+}
+
 type nodeOptions interface {
 	GetNodes() []string
 	ClientSet() (*clientset.Clientset, error)
@@ -5,10 +5,13 @@ import (
 	"io"
 
 	"github.com/lithammer/dedent"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeadmapiv1beta2 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta2"
@@ -19,10 +22,15 @@ import (
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	utilruntime "k8s.io/kubernetes/cmd/kubeadm/app/util/runtime"
 
+	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
+
 	"yunion.io/x/ocadm/pkg/apis/constants"
 	apis "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/cluster"
+	resetphases "yunion.io/x/ocadm/pkg/phases/reset"
 	configutil "yunion.io/x/ocadm/pkg/util/config"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
 )
 
 var (
@@ -47,6 +55,8 @@ type resetOptions struct {
 	forceReset            bool
 	ignorePreflightErrors []string
 	kubeconfigPath        string
+	dryRun                bool
+	purgeDatabases        bool
 }
 
 // resetData defines all the runtime information used when running the kubeadm reset workflow;
@@ -60,6 +70,10 @@ type resetData struct {
 	inputReader           io.Reader
 	outputWriter          io.Writer
 	cfg                   *kubeadmapi.InitConfiguration
+	ocCfg                 *apis.InitConfiguration
+	kubeconfigPath        string
+	dryRun                bool
+	purgeDatabases        bool
 	dirsToClean           []string
 }
 
@@ -83,8 +97,10 @@ func newResetData(cmd *cobra.Command, options *resetOptions, in io.Reader, out i
 		ocCfg, err = configutil.FetchInitConfigurationFromCluster(client, out, "reset", false)
 		if err != nil {
 			klog.Warningf("[reset] Unable to fetch the kubeadm-config ConfigMap from cluster: %v", err)
+			ocCfg = nil
+		} else {
+			cfg = &ocCfg.InitConfiguration
 		}
-		cfg = &ocCfg.InitConfiguration
 	} else {
 		klog.V(1).Infof("[reset] Could not obtain a client set from the kubeconfig file: %s", options.kubeconfigPath)
 	}
@@ -120,6 +136,10 @@ func newResetData(cmd *cobra.Command, options *resetOptions, in io.Reader, out i
 		inputReader:           in,
 		outputWriter:          out,
 		cfg:                   cfg,
+		ocCfg:                 ocCfg,
+		kubeconfigPath:        options.kubeconfigPath,
+		dryRun:                options.dryRun,
+		purgeDatabases:        options.purgeDatabases,
 	}, nil
 }
 
@@ -140,6 +160,14 @@ func AddResetFlags(flagSet *flag.FlagSet, resetOptions *resetOptions) {
 		&resetOptions.forceReset, options.ForceReset, "f", false,
 		"Reset the node without prompting for confirmation.",
 	)
+	flagSet.BoolVar(
+		&resetOptions.dryRun, options.DryRun, resetOptions.dryRun,
+		"Don't apply any changes; just output what would be removed.",
+	)
+	flagSet.BoolVar(
+		&resetOptions.purgeDatabases, options.PurgeDatabases, resetOptions.purgeDatabases,
+		"Drop the databases and users of onecloud services recorded in cluster config from mysql.",
+	)
 
 	options.AddKubeConfigFlag(flagSet, &resetOptions.kubeconfigPath)
 	options.AddIgnorePreflightErrorsFlag(flagSet, &resetOptions.ignorePreflightErrors)
@@ -165,6 +193,9 @@ func NewCmdReset(in io.Reader, out io.Writer, resetOptions *resetOptions) *cobra
 
 			// Then clean contents from the stateful kubelet, etcd and cni directories
 			data := c.(*resetData)
+			if data.dryRun {
+				return
+			}
 			cleanDirs(data)
 
 			// Output help text instructing user how to remove iptables rules
@@ -175,10 +206,13 @@ func NewCmdReset(in io.Reader, out io.Writer, resetOptions *resetOptions) *cobra
 	AddResetFlags(cmd.Flags(), resetOptions)
 
 	// initialize the workflow runner with the list of phases
-	resetRunner.AppendPhase(phases.NewPreflightPhase())
-	resetRunner.AppendPhase(phases.NewUpdateClusterStatus())
-	resetRunner.AppendPhase(phases.NewRemoveETCDMemberPhase())
-	resetRunner.AppendPhase(phases.NewCleanupNodePhase())
+	resetRunner.AppendPhase(skipOnDryRun(phases.NewPreflightPhase()))
+	// databases are read from cluster, so drop them before the control plane is removed
+	resetRunner.AppendPhase(resetphases.NewDatabasesPhase())
+	resetRunner.AppendPhase(skipOnDryRun(phases.NewUpdateClusterStatus()))
+	resetRunner.AppendPhase(skipOnDryRun(phases.NewRemoveETCDMemberPhase()))
+	resetRunner.AppendPhase(skipOnDryRun(phases.NewCleanupNodePhase()))
+	resetRunner.AppendPhase(resetphases.NewCleanupPhase())
 
 	// sets the data builder function, that will be used by the runner
 	// both when running the entire workflow or single phases
@@ -193,6 +227,22 @@ func NewCmdReset(in io.Reader, out io.Writer, resetOptions *resetOptions) *cobra
 	return cmd
 }
 
+// skipOnDryRun makes the kubeadm reset phase only report itself on dry run
+func skipOnDryRun(phase workflow.Phase) workflow.Phase {
+	phase.RunIf = func(c workflow.RunData) (bool, error) {
+		data, ok := c.(*resetData)
+		if !ok {
+			return false, errors.Errorf("%s phase invoked with an invalid data struct", phase.Name)
+		}
+		if data.dryRun {
+			fmt.Printf("[dryrun] Would run kubeadm reset phase %q\n", phase.Name)
+			return false, nil
+		}
+		return true, nil
+	}
+	return phase
+}
+
 func cleanDirs(data *resetData) {
 	fmt.Printf("[reset] Deleting contents of stateful directories: %v\n", data.dirsToClean)
 	for _, dir := range data.dirsToClean {
@@ -236,6 +286,45 @@ func (r *resetData) AddDirsToClean(dirs ...string) {
 	r.dirsToClean = append(r.dirsToClean, dirs...)
 }
 
+// OnecloudCfg returns the onecloud InitConfiguration fetched from cluster, nil if cluster isn't reachable.
+func (r *resetData) OnecloudCfg() *apis.InitConfiguration {
+	return r.ocCfg
+}
+
+// DryRun returns the dryRun flag.
+func (r *resetData) DryRun() bool {
+	return r.dryRun
+}
+
+// PurgeDatabases returns the purgeDatabases flag.
+func (r *resetData) PurgeDatabases() bool {
+	return r.purgeDatabases
+}
+
+// ServiceDBConfigs returns the databases of onecloud services recorded in the onecloud cluster config.
+func (r *resetData) ServiceDBConfigs() ([]ocutil.ServiceDBConfig, error) {
+	if r.client == nil {
+		return nil, errors.Errorf("could not obtain a client set from the kubeconfig file %s", r.kubeconfigPath)
+	}
+	kubeCfg, err := clientcmd.LoadFromFile(r.kubeconfigPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load kubeconfig %s", r.kubeconfigPath)
+	}
+	cli, err := cluster.NewClusterClient(kubeCfg)
+	if err != nil {
+		return nil, err
+	}
+	oc, err := cli.OnecloudV1alpha1().OnecloudClusters(constants.OnecloudNamespace).Get(cluster.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	ocCfg, err := occonfig.GetClusterConfigByClient(r.client, oc)
+	if err != nil {
+		return nil, errors.Wrap(err, "get onecloud cluster config")
+	}
+	return ocutil.GetServiceDBConfigs(ocCfg), nil
+}
+
 // CRISocketPath returns the criSocketPath.
 func (r *resetData) CRISocketPath() string {
 	return r.criSocketPath
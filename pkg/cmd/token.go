@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/lithammer/dedent"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
 	clientset "k8s.io/client-go/kubernetes"
 	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
 	"k8s.io/klog"
@@ -20,6 +25,9 @@ import (
 	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
 
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	occmdutil "yunion.io/x/ocadm/pkg/cmd/util"
+	ocoptions "yunion.io/x/ocadm/pkg/options"
 	configutil "yunion.io/x/ocadm/pkg/util/config"
 )
 
@@ -64,6 +72,7 @@ func NewCmdToken(out io.Writer, errW io.Writer) *cobra.Command {
 	var cfgPath string
 	var printJoinCommand bool
 	bto := options.NewBootstrapTokenOptions()
+	joinOpt := &tokenJoinOptions{}
 
 	createCmd := &cobra.Command{
 		Use:                   "create [token]",
@@ -76,6 +85,10 @@ func NewCmdToken(out io.Writer, errW io.Writer) *cobra.Command {
 			The [token] is the actual token to write.
 			This should be a securely generated random token of the form "[a-z0-9]{6}.[a-z0-9]{16}".
 			If no [token] is given, kubeadm will generate a random token instead.
+
+			The --role flags select the onecloud roles of the joining node printed by --print-join-command,
+			the VIP of control plane is taken from the ocadm-config of the cluster. With --join-config-file,
+			a configuration file of the roles usable by 'ocadm join --config' is written as well.
 		`),
 		Run: func(tokenCmd *cobra.Command, args []string) {
 			if len(args) > 0 {
@@ -100,14 +113,15 @@ func NewCmdToken(out io.Writer, errW io.Writer) *cobra.Command {
 			err = bto.ApplyTo(kubeadmcfg)
 			kubeadmutil.CheckErr(err)
 
-			err = kubeadmcmd.RunCreateToken(out, client, cfgPath, kubeadmcfg, printJoinCommand, kubeConfigFile)
+			err = RunCreateToken(out, client, cfgPath, cfg, kubeadmcfg, printJoinCommand, joinOpt, kubeConfigFile)
 			kubeadmutil.CheckErr(err)
 		},
 	}
 
 	options.AddConfigFlag(createCmd.Flags(), &cfgPath)
 	createCmd.Flags().BoolVar(&printJoinCommand,
-		"print-join-command", false, "Instead of printing only the token, print the full 'kubeadm join' flag needed to join the cluster using the token.")
+		"print-join-command", false, "Instead of printing only the token, print the full 'ocadm join' flag needed to join the cluster using the token.")
+	addTokenJoinFlags(createCmd.Flags(), joinOpt)
 	bto.AddTTLFlagWithName(createCmd.Flags(), "ttl")
 	bto.AddUsagesFlag(createCmd.Flags())
 	bto.AddGroupsFlag(createCmd.Flags())
@@ -160,6 +174,87 @@ func NewCmdToken(out io.Writer, errW io.Writer) *cobra.Command {
 	return tokenCmd
 }
 
+// tokenJoinOptions holds the flags describing the joining node of the created token
+type tokenJoinOptions struct {
+	roles          []string
+	hostNetworks   []string
+	certificateKey string
+	joinConfigPath string
+}
+
+func addTokenJoinFlags(flagSet *flag.FlagSet, o *tokenJoinOptions) {
+	flagSet.StringSliceVar(
+		&o.roles, "role", o.roles,
+		fmt.Sprintf("Roles of the joining node added to the join command, one or more of %s", strings.Join(occmdutil.JoinRoles(), ", ")),
+	)
+	flagSet.StringArrayVar(
+		&o.hostNetworks, ocoptions.HostNetworks, o.hostNetworks,
+		"Host networks of the joining node with role host, e.g. eth0/br0/10.168.222.21",
+	)
+	flagSet.StringVar(
+		&o.certificateKey, ocoptions.CertificateKey, o.certificateKey,
+		"Key used to decrypt the certificates uploaded by init, added to the join command of role control-plane",
+	)
+	flagSet.StringVar(
+		&o.joinConfigPath, "join-config-file", o.joinConfigPath,
+		"Path to write the join configuration of the token and roles, which can be used by 'ocadm join --config'",
+	)
+}
+
+// RunCreateToken generates a new bootstrap token and stores it as a secret on the server,
+// then prints the token or the ocadm join command of the roles
+func RunCreateToken(out io.Writer, client clientset.Interface, cfgPath string, cfg *apiv1.InitConfiguration, initCfg *kubeadmapiv1beta2.InitConfiguration, printJoinCommand bool, joinOpt *tokenJoinOptions, kubeConfigFile string) error {
+	if len(joinOpt.roles) != 0 && !printJoinCommand && joinOpt.joinConfigPath == "" {
+		return errors.New("--role is only used with --print-join-command or --join-config-file")
+	}
+	profile, err := occmdutil.NewJoinProfile(joinOpt.roles, &cfg.ClusterConfiguration)
+	if err != nil {
+		return err
+	}
+	profile.HostNetworks = joinOpt.hostNetworks
+	profile.CertificateKey = joinOpt.certificateKey
+	if profile.HasRole(occmdutil.JoinRoleControlPlane) && profile.CertificateKey == "" {
+		klog.Warningf("[token] No --%s specified, run 'ocadm init phase upload-certs --upload-certs' on a control plane node to get one", ocoptions.CertificateKey)
+	}
+
+	// the token created by kubeadm is printed to buf, the join command is printed with the roles of profile
+	buf := new(bytes.Buffer)
+	if err := kubeadmcmd.RunCreateToken(buf, client, cfgPath, initCfg, false, kubeConfigFile); err != nil {
+		return err
+	}
+	token := strings.TrimSpace(buf.String())
+
+	if joinOpt.joinConfigPath != "" {
+		joinCfg, err := occmdutil.GetJoinConfigurationForProfile(kubeConfigFile, token, profile)
+		if err != nil {
+			return errors.Wrap(err, "failed to get join configuration")
+		}
+		joinBytes, err := configutil.MarshalOcadmConfigObject(joinCfg)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(joinOpt.joinConfigPath, joinBytes, 0600); err != nil {
+			return errors.Wrapf(err, "failed to write join configuration to %q", joinOpt.joinConfigPath)
+		}
+		klog.V(1).Infof("[token] wrote join configuration to %q", joinOpt.joinConfigPath)
+	}
+
+	// if --print-join-command was specified, print a machine-readable full `ocadm join` command
+	// otherwise, just print the token
+	if !printJoinCommand {
+		fmt.Fprintln(out, token)
+		return nil
+	}
+	joinCommand, err := occmdutil.GetJoinCommandForProfile(kubeConfigFile, token, profile, false, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to get join command")
+	}
+	joinCommand = strings.ReplaceAll(joinCommand, "\\\n", "")
+	joinCommand = strings.ReplaceAll(joinCommand, "    ", "")
+	fmt.Fprintln(out, joinCommand)
+	return nil
+}
+
 // NewCmdTokenGenerate returns cobra.Command to generate new token
 func NewCmdTokenGenerate(out io.Writer) *cobra.Command {
 	return &cobra.Command{
@@ -19,45 +19,209 @@ package util
 import (
 	"bytes"
 	"crypto/x509"
-	"html/template"
 	"strings"
+	"text/template"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcertutil "k8s.io/client-go/util/cert"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
 	"k8s.io/kubernetes/cmd/kubeadm/app/util/pubkeypin"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/nodelabels"
+	"yunion.io/x/ocadm/pkg/util/ssh"
 )
 
 var joinCommandTemplate = template.Must(template.New("join").Parse(`` +
 	`ocadm join {{.ControlPlaneHostPort}} --token {{.Token}} \
     {{range $h := .CAPubKeyPins}}--discovery-token-ca-cert-hash {{$h}} {{end}}{{if .ControlPlane}}\
-    --control-plane {{if .CertificateKey}}--certificate-key {{.CertificateKey}}{{end}}{{end}}`,
+    --control-plane {{if .CertificateKey}}--certificate-key {{.CertificateKey}}{{end}}{{end}}{{if .RoleArgs}}\
+    {{.RoleArgs}}{{end}}`,
 ))
 
+// JoinRoleControlPlane joins the node as a control plane instance, using the VIP of the cluster if configured.
+// The other roles of a joining node are the node roles enabled by the flags of ocadm join.
+const JoinRoleControlPlane = "control-plane"
+
+// JoinRoles returns all the supported roles of a joining node
+func JoinRoles() []string {
+	roles := []string{JoinRoleControlPlane}
+	for _, r := range nodelabels.Roles {
+		if r.JoinFlag != "" {
+			roles = append(roles, r.Name)
+		}
+	}
+	return roles
+}
+
+// JoinProfile holds the roles of a joining node and the settings derived from them
+type JoinProfile struct {
+	roles sets.String
+
+	// HighAvailabilityVIP is the keepalived VIP of control plane
+	HighAvailabilityVIP string
+	// KeepalivedVersionTag is the image tag of keepalived
+	KeepalivedVersionTag string
+	// HostNetworks are the host networks of host agent, e.g. eth0/br0/10.168.222.21
+	HostNetworks []string
+	// CertificateKey is the key to decrypt the certificates uploaded by init
+	CertificateKey string
+}
+
+// NewJoinProfile validates the roles and returns the profile with the
+// control plane settings taken from the cluster configuration
+func NewJoinProfile(roles []string, cfg *apiv1.ClusterConfiguration) (*JoinProfile, error) {
+	supported := sets.NewString(JoinRoles()...)
+	p := &JoinProfile{roles: sets.NewString()}
+	for _, r := range roles {
+		if !supported.Has(r) {
+			return nil, errors.Errorf("unknown role %q, supported roles: %s", r, strings.Join(supported.List(), ", "))
+		}
+		p.roles.Insert(r)
+	}
+	if err := nodelabels.ValidateRoles(p.nodeRoles()); err != nil {
+		return nil, err
+	}
+	// glance, baremetal and esxi labels are only applied along with the host or controller label
+	for _, r := range []string{nodelabels.RoleGlance, nodelabels.RoleBaremetal, nodelabels.RoleEsxi} {
+		if p.HasRole(r) && !p.HasRole(nodelabels.RoleHost) && !p.HasRole(nodelabels.RoleController) {
+			return nil, errors.Errorf("role %s requires role %s or %s", r, nodelabels.RoleHost, nodelabels.RoleController)
+		}
+	}
+	if p.HasRole(JoinRoleControlPlane) && cfg != nil {
+		p.HighAvailabilityVIP = cfg.HighAvailabilityVIP
+		p.KeepalivedVersionTag = cfg.KeepalivedVersionTag
+	}
+	return p, nil
+}
+
+// HasRole returns whether the profile has the role
+func (p *JoinProfile) HasRole(role string) bool {
+	return p.roles.Has(role)
+}
+
+// nodeRoles returns the roles labeled on the node
+func (p *JoinProfile) nodeRoles() []string {
+	return p.roles.Difference(sets.NewString(JoinRoleControlPlane)).List()
+}
+
+// RoleArgs returns the flags of ocadm join for the roles except --control-plane and --certificate-key
+func (p *JoinProfile) RoleArgs() []string {
+	args := make([]string, 0)
+	if p.HasRole(JoinRoleControlPlane) && p.HighAvailabilityVIP != "" {
+		args = append(args, "--"+options.HighAvailabilityVIP, p.HighAvailabilityVIP)
+		if p.KeepalivedVersionTag != "" {
+			args = append(args, "--"+options.KeepalivedVersionTag, p.KeepalivedVersionTag)
+		}
+	}
+	return append(args, nodelabels.JoinArgs(p.nodeRoles(), p.HostNetworks)...)
+}
+
+// JoinConfiguration returns the join configuration of the profile discovering the cluster with the token
+func (p *JoinProfile) JoinConfiguration(apiServerEndpoint, token string, caCertHashes []string) *apiv1.JoinConfiguration {
+	cfg := &apiv1.JoinConfiguration{
+		JoinConfiguration: kubeadmapi.JoinConfiguration{
+			Discovery: kubeadmapi.Discovery{
+				BootstrapToken: &kubeadmapi.BootstrapTokenDiscovery{
+					Token:             token,
+					APIServerEndpoint: apiServerEndpoint,
+					CACertHashes:      caCertHashes,
+				},
+				TLSBootstrapToken: token,
+			},
+		},
+		AsOnecloudController: p.HasRole(nodelabels.RoleController),
+	}
+	if p.HasRole(JoinRoleControlPlane) {
+		cfg.ControlPlane = &kubeadmapi.JoinControlPlane{CertificateKey: p.CertificateKey}
+		cfg.HighAvailabilityVIP = p.HighAvailabilityVIP
+		cfg.KeepalivedVersionTag = p.KeepalivedVersionTag
+	}
+	cfg.Node.Host.Enabled = p.HasRole(nodelabels.RoleHost)
+	if cfg.Node.Host.Enabled {
+		cfg.Node.Host.Networks = p.HostNetworks
+	}
+	cfg.Node.GlanceNode = p.HasRole(nodelabels.RoleGlance)
+	cfg.Node.BaremetalNode = p.HasRole(nodelabels.RoleBaremetal)
+	cfg.Node.EsxiNode = p.HasRole(nodelabels.RoleEsxi)
+	return cfg
+}
+
 // GetJoinWorkerCommand returns the kubeadm join command for a given token and
 // and Kubernetes cluster (the current cluster in the kubeconfig file)
 func GetJoinWorkerCommand(kubeConfigFile, token string, skipTokenPrint bool) (string, error) {
-	return getJoinCommand(kubeConfigFile, token, "", false, skipTokenPrint, false)
+	return getJoinCommand(kubeConfigFile, token, "", false, nil, skipTokenPrint, false)
 }
 
 // GetJoinControlPlaneCommand returns the kubeadm join command for a given token and
 // and Kubernetes cluster (the current cluster in the kubeconfig file)
 func GetJoinControlPlaneCommand(kubeConfigFile, token, key string, skipTokenPrint, skipCertificateKeyPrint bool) (string, error) {
-	return getJoinCommand(kubeConfigFile, token, key, true, skipTokenPrint, skipCertificateKeyPrint)
+	return getJoinCommand(kubeConfigFile, token, key, true, nil, skipTokenPrint, skipCertificateKeyPrint)
 }
 
-func getJoinCommand(kubeConfigFile, token, key string, controlPlane, skipTokenPrint, skipCertificateKeyPrint bool) (string, error) {
+// GetJoinCommandForProfile returns the ocadm join command with the flags of the profile roles
+// for a given token and Kubernetes cluster (the current cluster in the kubeconfig file)
+func GetJoinCommandForProfile(kubeConfigFile, token string, profile *JoinProfile, skipTokenPrint, skipCertificateKeyPrint bool) (string, error) {
+	return getJoinCommand(kubeConfigFile, token, profile.CertificateKey, profile.HasRole(JoinRoleControlPlane), profile.RoleArgs(), skipTokenPrint, skipCertificateKeyPrint)
+}
+
+// GetJoinConfigurationForProfile returns the join configuration of the profile for a given token and
+// Kubernetes cluster (the current cluster in the kubeconfig file)
+func GetJoinConfigurationForProfile(kubeConfigFile, token string, profile *JoinProfile) (*apiv1.JoinConfiguration, error) {
+	endpoint, publicKeyPins, err := getClusterDiscoveryInfo(kubeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return profile.JoinConfiguration(endpoint, token, publicKeyPins), nil
+}
+
+func getJoinCommand(kubeConfigFile, token, key string, controlPlane bool, roleArgs []string, skipTokenPrint, skipCertificateKeyPrint bool) (string, error) {
+	endpoint, publicKeyPins, err := getClusterDiscoveryInfo(kubeConfigFile)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := map[string]interface{}{
+		"Token":                token,
+		"CAPubKeyPins":         publicKeyPins,
+		"ControlPlaneHostPort": endpoint,
+		"CertificateKey":       key,
+		"ControlPlane":         controlPlane,
+		"RoleArgs":             ssh.QuoteArgs(roleArgs),
+	}
+
+	if skipTokenPrint {
+		ctx["Token"] = "<value withheld>"
+	}
+	if skipCertificateKeyPrint {
+		ctx["CertificateKey"] = "<value withheld>"
+	}
+
+	var out bytes.Buffer
+	err = joinCommandTemplate.Execute(&out, ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to render join command template")
+	}
+	return out.String(), nil
+}
+
+// getClusterDiscoveryInfo returns the API server endpoint and the public key pins of CA certificates
+// of the current cluster in the kubeconfig file
+func getClusterDiscoveryInfo(kubeConfigFile string) (string, []string, error) {
 	// load the kubeconfig file to get the CA certificate and endpoint
 	config, err := clientcmd.LoadFromFile(kubeConfigFile)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to load kubeconfig")
+		return "", nil, errors.Wrap(err, "failed to load kubeconfig")
 	}
 
 	// load the default cluster config
 	clusterConfig := kubeconfigutil.GetClusterFromKubeConfig(config)
 	if clusterConfig == nil {
-		return "", errors.New("failed to get default cluster config")
+		return "", nil, errors.New("failed to get default cluster config")
 	}
 
 	// load CA certificates from the kubeconfig (either from PEM data or by file path)
@@ -65,15 +229,15 @@ func getJoinCommand(kubeConfigFile, token, key string, controlPlane, skipTokenPr
 	if clusterConfig.CertificateAuthorityData != nil {
 		caCerts, err = clientcertutil.ParseCertsPEM(clusterConfig.CertificateAuthorityData)
 		if err != nil {
-			return "", errors.Wrap(err, "failed to parse CA certificate from kubeconfig")
+			return "", nil, errors.Wrap(err, "failed to parse CA certificate from kubeconfig")
 		}
 	} else if clusterConfig.CertificateAuthority != "" {
 		caCerts, err = clientcertutil.CertsFromFile(clusterConfig.CertificateAuthority)
 		if err != nil {
-			return "", errors.Wrap(err, "failed to load CA certificate referenced by kubeconfig")
+			return "", nil, errors.Wrap(err, "failed to load CA certificate referenced by kubeconfig")
 		}
 	} else {
-		return "", errors.New("no CA certificates found in kubeconfig")
+		return "", nil, errors.New("no CA certificates found in kubeconfig")
 	}
 
 	// hash all the CA certs and include their public key pins as trusted values
@@ -81,26 +245,5 @@ func getJoinCommand(kubeConfigFile, token, key string, controlPlane, skipTokenPr
 	for _, caCert := range caCerts {
 		publicKeyPins = append(publicKeyPins, pubkeypin.Hash(caCert))
 	}
-
-	ctx := map[string]interface{}{
-		"Token":                token,
-		"CAPubKeyPins":         publicKeyPins,
-		"ControlPlaneHostPort": strings.Replace(clusterConfig.Server, "https://", "", -1),
-		"CertificateKey":       key,
-		"ControlPlane":         controlPlane,
-	}
-
-	if skipTokenPrint {
-		ctx["Token"] = template.HTML("<value withheld>")
-	}
-	if skipCertificateKeyPrint {
-		ctx["CertificateKey"] = template.HTML("<value withheld>")
-	}
-
-	var out bytes.Buffer
-	err = joinCommandTemplate.Execute(&out, ctx)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to render join command template")
-	}
-	return out.String(), nil
+	return strings.Replace(clusterConfig.Server, "https://", "", -1), publicKeyPins, nil
 }
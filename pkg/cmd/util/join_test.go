@@ -0,0 +1,147 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	certutil "k8s.io/client-go/util/cert"
+	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/pubkeypin"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+func TestNewJoinProfile(t *testing.T) {
+	clusterCfg := &apiv1.ClusterConfiguration{HighAvailabilityVIP: "10.0.0.100", KeepalivedVersionTag: "v2.0.20"}
+	tests := []struct {
+		name    string
+		roles   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "worker",
+			roles: nil,
+			want:  []string{},
+		},
+		{
+			name:  "host with glance",
+			roles: []string{"host", "glance"},
+			want:  []string{"--enable-host-agent", "--host-networks", "eth0/br0/10.0.0.10", "--glance-node"},
+		},
+		{
+			name:  "control plane controller",
+			roles: []string{"control-plane", "controller"},
+			want:  []string{"--high-availability-vip", "10.0.0.100", "--keepalived-version-tag", "v2.0.20", "--as-onecloud-controller"},
+		},
+		{
+			name:    "esxi without host",
+			roles:   []string{"esxi"},
+			wantErr: true,
+		},
+		{
+			name:    "host with baremetal",
+			roles:   []string{"host", "baremetal"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown role",
+			roles:   []string{"host", "db"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewJoinProfile(tt.roles, clusterCfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewJoinProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			p.HostNetworks = []string{"eth0/br0/10.0.0.10"}
+			if got := p.RoleArgs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RoleArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeTestKubeConfig(t *testing.T, dir string) (string, string) {
+	caCert, _, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: "kubernetes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := kubeconfigutil.CreateBasic("https://10.0.0.100:6443", "kubernetes", "admin", pkiutil.EncodeCertPEM(caCert))
+	path := filepath.Join(dir, "admin.conf")
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		t.Fatal(err)
+	}
+	return path, pubkeypin.Hash(caCert)
+}
+
+func TestGetJoinCommandForProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-join")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeConfigFile, caHash := writeTestKubeConfig(t, dir)
+
+	p, err := NewJoinProfile([]string{"control-plane", "controller", "host"}, &apiv1.ClusterConfiguration{HighAvailabilityVIP: "10.0.0.100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.HostNetworks = []string{"eth0/br0/10.0.0.10"}
+	p.CertificateKey = "cafe0123"
+	cmd, err := GetJoinCommandForProfile(kubeConfigFile, "abcdef.0123456789abcdef", p, false, false)
+	if err != nil {
+		t.Fatalf("GetJoinCommandForProfile() error: %v", err)
+	}
+	want := []string{
+		"ocadm", "join", "10.0.0.100:6443", "--token", "abcdef.0123456789abcdef",
+		"--discovery-token-ca-cert-hash", caHash,
+		"--control-plane", "--certificate-key", "cafe0123",
+		"--high-availability-vip", "10.0.0.100",
+		"--enable-host-agent", "--host-networks", "eth0/br0/10.0.0.10", "--as-onecloud-controller",
+	}
+	if got := strings.Fields(strings.Replace(cmd, "\\", " ", -1)); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetJoinCommandForProfile() = %v, want %v", got, want)
+	}
+
+	joinCfg, err := GetJoinConfigurationForProfile(kubeConfigFile, "abcdef.0123456789abcdef", p)
+	if err != nil {
+		t.Fatalf("GetJoinConfigurationForProfile() error: %v", err)
+	}
+	b, err := configutil.MarshalOcadmConfigObject(joinCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(dir, "join.yaml")
+	if err := ioutil.WriteFile(cfgPath, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := configutil.LoadJoinConfigurationFromFile(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadJoinConfigurationFromFile() error: %v\n%s", err, b)
+	}
+	if loaded.Discovery.BootstrapToken == nil || loaded.Discovery.BootstrapToken.APIServerEndpoint != "10.0.0.100:6443" {
+		t.Errorf("unexpected discovery %#v", loaded.Discovery)
+	}
+	if loaded.ControlPlane == nil || loaded.ControlPlane.CertificateKey != "cafe0123" {
+		t.Errorf("unexpected control plane %#v", loaded.ControlPlane)
+	}
+	if !loaded.AsOnecloudController || !loaded.Node.Host.Enabled || loaded.HighAvailabilityVIP != "10.0.0.100" {
+		t.Errorf("roles aren't kept in join configuration:\n%s", b)
+	}
+	if !reflect.DeepEqual(loaded.Node.Host.Networks, p.HostNetworks) {
+		t.Errorf("host networks %v, want %v", loaded.Node.Host.Networks, p.HostNetworks)
+	}
+}
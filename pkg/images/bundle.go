@@ -0,0 +1,493 @@
+package images
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	utilsexec "k8s.io/utils/exec"
+
+	"yunion.io/x/ocadm/pkg/util/registry"
+)
+
+const (
+	// BundleManifestFile is the file in bundle describing the saved images
+	BundleManifestFile = "ocadm-bundle.json"
+
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	dockerManifestFile = "manifest.json"
+	blobsDir           = "blobs"
+
+	annotationRefName             = "org.opencontainers.image.ref.name"
+	annotationContainerdImageName = "io.containerd.image.name"
+)
+
+// BundleManifest describes the images saved in bundle
+type BundleManifest struct {
+	KubernetesVersion string        `json:"kubernetesVersion,omitempty"`
+	OnecloudVersion   string        `json:"onecloudVersion,omitempty"`
+	OperatorVersion   string        `json:"operatorVersion,omitempty"`
+	Platform          string        `json:"platform"`
+	Images            []BundleImage `json:"images"`
+}
+
+// BundleImage is an image saved in bundle
+type BundleImage struct {
+	// Name is the full name of image, e.g. registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5
+	Name      string `json:"name"`
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *platform         `json:"platform,omitempty"`
+}
+
+type imageManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+// dockerManifestEntry is the entry of manifest.json read by 'docker load'
+type dockerManifestEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+func blobPath(digest string) string {
+	return path.Join(blobsDir, strings.Replace(digest, ":", "/", 1))
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// BundleSaver downloads images from registry and writes them to an OCI layout archive,
+// the archive also contains the manifest.json of docker archive, so it could be imported
+// by both 'docker load' and 'ctr images import'.
+type BundleSaver struct {
+	client *registry.Client
+	// platform is in format of os/arch[/variant], it's used to select image from manifest list
+	platform string
+	out      io.Writer
+}
+
+func NewBundleSaver(client *registry.Client, platform string, out io.Writer) *BundleSaver {
+	return &BundleSaver{
+		client:   client,
+		platform: platform,
+		out:      out,
+	}
+}
+
+// Save writes images to w as tar archive, the Images and Platform of manifest are filled
+func (s *BundleSaver) Save(w io.Writer, manifest *BundleManifest, imgs []string) error {
+	manifest.Platform = s.platform
+	manifest.Images = nil
+	tw := tar.NewWriter(w)
+	written := sets.NewString()
+	index := imageIndex{SchemaVersion: 2}
+	dockerManifest := []dockerManifestEntry{}
+	for _, img := range sets.NewString(imgs...).List() {
+		fmt.Fprintf(s.out, "[config/images] Saving %s\n", img)
+		desc, entry, err := s.saveImage(tw, written, img)
+		if err != nil {
+			return errors.Wrapf(err, "save image %q", img)
+		}
+		manifest.Images = append(manifest.Images, BundleImage{
+			Name:      img,
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+		})
+		index.Manifests = append(index.Manifests, *desc)
+		dockerManifest = append(dockerManifest, *entry)
+	}
+	for name, obj := range map[string]interface{}{
+		ociLayoutFile:      map[string]string{"imageLayoutVersion": "1.0.0"},
+		ociIndexFile:       index,
+		dockerManifestFile: dockerManifest,
+		BundleManifestFile: manifest,
+	} {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return errors.Wrapf(err, "marshal %s", name)
+		}
+		if err := writeTarFile(tw, name, data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func (s *BundleSaver) saveImage(tw *tar.Writer, written sets.String, img string) (*descriptor, *dockerManifestEntry, error) {
+	ref, err := registry.ParseReference(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, mediaType, err := s.resolveManifest(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := imageManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal manifest")
+	}
+	entry := &dockerManifestEntry{
+		Config:   blobPath(manifest.Config.Digest),
+		RepoTags: []string{img},
+	}
+	for _, layer := range manifest.Layers {
+		entry.Layers = append(entry.Layers, blobPath(layer.Digest))
+	}
+	for _, blob := range append([]descriptor{manifest.Config}, manifest.Layers...) {
+		if written.Has(blob.Digest) {
+			continue
+		}
+		if err := s.saveBlob(tw, ref, blob); err != nil {
+			return nil, nil, err
+		}
+		written.Insert(blob.Digest)
+	}
+	desc := &descriptor{
+		MediaType: mediaType,
+		Digest:    sha256Digest(data),
+		Size:      int64(len(data)),
+		Annotations: map[string]string{
+			annotationRefName:             ref.Reference,
+			annotationContainerdImageName: img,
+		},
+	}
+	if !written.Has(desc.Digest) {
+		if err := writeTarFile(tw, blobPath(desc.Digest), data); err != nil {
+			return nil, nil, err
+		}
+		written.Insert(desc.Digest)
+	}
+	return desc, entry, nil
+}
+
+// resolveManifest returns the image manifest of ref, the one of platform is selected if ref is a manifest list
+func (s *BundleSaver) resolveManifest(ref *registry.Reference) ([]byte, string, error) {
+	data, desc, err := s.client.GetManifest(ref.Registry, ref.Path, ref.Reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := verifyManifestDigest(data, desc.Digest); err != nil {
+		return nil, "", err
+	}
+	switch desc.MediaType {
+	case registry.MediaTypeDockerManifest, registry.MediaTypeOCIManifest:
+		return data, desc.MediaType, nil
+	case registry.MediaTypeDockerManifestList, registry.MediaTypeOCIIndex:
+	default:
+		return nil, "", errors.Errorf("unsupported manifest media type %q", desc.MediaType)
+	}
+	index := imageIndex{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, "", errors.Wrap(err, "unmarshal manifest list")
+	}
+	for _, m := range index.Manifests {
+		if m.Platform == nil || !s.matchPlatform(m.Platform) {
+			continue
+		}
+		data, desc, err := s.client.GetManifest(ref.Registry, ref.Path, m.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := verifyManifestDigest(data, m.Digest); err != nil {
+			return nil, "", err
+		}
+		return data, desc.MediaType, nil
+	}
+	return nil, "", errors.Errorf("platform %s not found in manifest list", s.platform)
+}
+
+func (s *BundleSaver) matchPlatform(p *platform) bool {
+	parts := strings.Split(s.platform, "/")
+	if len(parts) < 2 || parts[0] != p.OS || parts[1] != p.Architecture {
+		return false
+	}
+	return len(parts) < 3 || parts[2] == p.Variant
+}
+
+func (s *BundleSaver) saveBlob(tw *tar.Writer, ref *registry.Reference, blob descriptor) error {
+	body, err := s.client.GetBlob(ref.Registry, ref.Path, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := tw.WriteHeader(&tar.Header{
+		Name: blobPath(blob.Digest),
+		Mode: 0644,
+		Size: blob.Size,
+	}); err != nil {
+		return errors.Wrapf(err, "write header of blob %s", blob.Digest)
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, hash), body, blob.Size); err != nil {
+		return errors.Wrapf(err, "download blob %s", blob.Digest)
+	}
+	if got := "sha256:" + hex.EncodeToString(hash.Sum(nil)); got != blob.Digest {
+		return errors.Errorf("blob digest mismatch, expected %s, got %s", blob.Digest, got)
+	}
+	return nil
+}
+
+func verifyManifestDigest(data []byte, digest string) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	if got := sha256Digest(data); got != digest {
+		return errors.Errorf("manifest digest mismatch, expected %s, got %s", digest, got)
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}); err != nil {
+		return errors.Wrapf(err, "write header of %s", name)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	return nil
+}
+
+// Bundle is an image bundle written by BundleSaver
+type Bundle struct {
+	// Path is the path of bundle archive
+	Path     string
+	Manifest *BundleManifest
+	// dir is where the blobs are extracted to
+	dir       string
+	manifests map[string]*imageManifest
+}
+
+// OpenBundle reads the bundle archive at path and verifies the digests of all the blobs.
+// The blobs are extracted to dir if it isn't empty, which is required by Push.
+func OpenBundle(bundlePath string, dir string) (*Bundle, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open bundle")
+	}
+	defer f.Close()
+	b := &Bundle{
+		Path:      bundlePath,
+		dir:       dir,
+		manifests: make(map[string]*imageManifest),
+	}
+	blobs := sets.NewString()
+	blobData := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read bundle")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == BundleManifestFile:
+			b.Manifest = &BundleManifest{}
+			if err := json.NewDecoder(tr).Decode(b.Manifest); err != nil {
+				return nil, errors.Wrapf(err, "decode %s", BundleManifestFile)
+			}
+		case strings.HasPrefix(name, blobsDir+"/"):
+			digest, data, err := b.readBlob(name, tr)
+			if err != nil {
+				return nil, err
+			}
+			blobs.Insert(digest)
+			if data != nil {
+				blobData[digest] = data
+			}
+		}
+	}
+	if b.Manifest == nil {
+		return nil, errors.Errorf("%s not found, %s isn't an image bundle", BundleManifestFile, bundlePath)
+	}
+	for _, img := range b.Manifest.Images {
+		data, ok := blobData[img.Digest]
+		if !ok {
+			return nil, errors.Errorf("manifest %s of image %s not found in bundle", img.Digest, img.Name)
+		}
+		manifest := &imageManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal manifest of image %s", img.Name)
+		}
+		for _, blob := range append([]descriptor{manifest.Config}, manifest.Layers...) {
+			if !blobs.Has(blob.Digest) {
+				return nil, errors.Errorf("blob %s of image %s not found in bundle", blob.Digest, img.Name)
+			}
+		}
+		b.manifests[img.Name] = manifest
+	}
+	return b, nil
+}
+
+// readBlob verifies the digest of blob, the content is returned if it's a small json document which may be a manifest
+func (b *Bundle) readBlob(name string, r io.Reader) (string, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(name, blobsDir+"/"), "/")
+	if len(parts) != 2 || parts[0] != "sha256" {
+		return "", nil, errors.Errorf("unsupported blob %s", name)
+	}
+	digest := parts[0] + ":" + parts[1]
+	hash := sha256.New()
+	writers := []io.Writer{hash}
+	buf := &bytes.Buffer{}
+	writers = append(writers, &limitedBuffer{buf: buf, limit: 4 << 20})
+	if len(b.dir) != 0 {
+		target := filepath.Join(b.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", nil, errors.Wrap(err, "create blobs dir")
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "create %s", target)
+		}
+		defer out.Close()
+		writers = append(writers, out)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return "", nil, errors.Wrapf(err, "read %s", name)
+	}
+	if got := "sha256:" + hex.EncodeToString(hash.Sum(nil)); got != digest {
+		return "", nil, errors.Errorf("blob %s is corrupted, its digest is %s", digest, got)
+	}
+	if buf.Len() == 0 || buf.Bytes()[0] != '{' {
+		return digest, nil, nil
+	}
+	return digest, buf.Bytes(), nil
+}
+
+// limitedBuffer keeps the written content until it exceeds limit
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.buf.Len()+len(p) > l.limit {
+		l.buf.Reset()
+		l.limit = 0
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+// TargetImage returns the name of img after it's pushed to repository, e.g.
+// registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5 is pushed to 10.0.0.1:5000/yunionio as 10.0.0.1:5000/yunionio/region:v3.8.5
+func TargetImage(img string, repository string) (string, error) {
+	ref, err := registry.ParseReference(img)
+	if err != nil {
+		return "", err
+	}
+	return GetGenericImage(strings.TrimSuffix(repository, "/"), path.Base(ref.Path), ref.Reference), nil
+}
+
+// Push pushes all the images in bundle to repository, the bundle must be opened with an extract dir
+func (b *Bundle) Push(client *registry.Client, repository string, out io.Writer) error {
+	if len(b.dir) == 0 {
+		return errors.New("bundle isn't extracted")
+	}
+	for _, img := range b.Manifest.Images {
+		target, err := TargetImage(img.Name, repository)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "[config/images] Pushing %s to %s\n", img.Name, target)
+		if err := b.pushImage(client, img, target); err != nil {
+			return errors.Wrapf(err, "push image %q", target)
+		}
+	}
+	return nil
+}
+
+func (b *Bundle) pushImage(client *registry.Client, img BundleImage, target string) error {
+	ref, err := registry.ParseReference(target)
+	if err != nil {
+		return err
+	}
+	manifest := b.manifests[img.Name]
+	for _, blob := range append([]descriptor{manifest.Config}, manifest.Layers...) {
+		exists, err := client.BlobExists(ref.Registry, ref.Path, blob.Digest)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		blobFile := filepath.Join(b.dir, filepath.FromSlash(blobPath(blob.Digest)))
+		open := func() (io.ReadCloser, error) {
+			return os.Open(blobFile)
+		}
+		if err := client.PushBlob(ref.Registry, ref.Path, blob.Digest, blob.Size, open); err != nil {
+			return err
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, filepath.FromSlash(blobPath(img.Digest))))
+	if err != nil {
+		return errors.Wrap(err, "read manifest")
+	}
+	return client.PutManifest(ref.Registry, ref.Path, ref.Reference, img.MediaType, data)
+}
+
+// ImportToRuntime imports the bundle into the container runtime of criSocket,
+// 'docker load' is used for docker, otherwise 'ctr images import' of containerd is used
+func (b *Bundle) ImportToRuntime(execer utilsexec.Interface, criSocket string) error {
+	var cmd utilsexec.Cmd
+	if criSocket == kubeadmconstants.DefaultDockerCRISocket {
+		cmd = execer.Command("docker", "load", "-i", b.Path)
+	} else {
+		cmd = execer.Command("ctr", "-n", "k8s.io", "images", "import", b.Path)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "import bundle to container runtime, output: %s", string(out))
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package images
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yunion.io/x/ocadm/pkg/util/registry"
+)
+
+// fakeRegistry is an in memory registry serving manifests and blobs
+type fakeRegistry struct {
+	lock      sync.Mutex
+	manifests map[string][]byte
+	types     map[string]string
+	blobs     map[string][]byte
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs:     make(map[string][]byte),
+	}
+}
+
+func (r *fakeRegistry) addBlob(data []byte) descriptor {
+	digest := sha256Digest(data)
+	r.blobs[digest] = data
+	return descriptor{MediaType: "application/octet-stream", Digest: digest, Size: int64(len(data))}
+}
+
+func (r *fakeRegistry) addManifest(repo string, ref string, mediaType string, obj interface{}) descriptor {
+	data, _ := json.Marshal(obj)
+	digest := sha256Digest(data)
+	for _, key := range []string{repo + ":" + ref, repo + ":" + digest} {
+		r.manifests[key] = data
+		r.types[key] = mediaType
+	}
+	return descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(p, "/manifests/"):
+		parts := strings.SplitN(p, "/manifests/", 2)
+		key := parts[0] + ":" + parts[1]
+		if req.Method == http.MethodPut {
+			data, _ := ioutil.ReadAll(req.Body)
+			r.manifests[key] = data
+			r.types[key] = req.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		data, ok := r.manifests[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[key])
+		w.Header().Set("Docker-Content-Digest", sha256Digest(data))
+		w.Write(data)
+	case strings.HasSuffix(p, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", "/upload/1")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.Contains(p, "/blobs/"):
+		digest := p[strings.LastIndex(p, "/")+1:]
+		data, ok := r.blobs[digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case req.URL.Path == "/upload/1" && req.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if sha256Digest(data) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBundleSaveAndPush(t *testing.T) {
+	fake := newFakeRegistry()
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	config := fake.addBlob([]byte(`{"architecture":"amd64","os":"linux"}`))
+	layer := fake.addBlob([]byte("layer content"))
+	amd64 := fake.addManifest("yunionio/region", "amd64", registry.MediaTypeDockerManifest, imageManifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifest,
+		Config:        config,
+		Layers:        []descriptor{layer},
+	})
+	amd64.Platform = &platform{OS: "linux", Architecture: "amd64"}
+	arm64 := descriptor{
+		MediaType: registry.MediaTypeDockerManifest,
+		Digest:    sha256Digest([]byte("missing")),
+		Platform:  &platform{OS: "linux", Architecture: "arm64"},
+	}
+	fake.addManifest("yunionio/region", "v3.8.5", registry.MediaTypeDockerManifestList, imageIndex{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifestList,
+		Manifests:     []descriptor{arm64, amd64},
+	})
+	fake.addManifest("yunionio/keystone", "v3.8.5", registry.MediaTypeDockerManifest, imageManifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifest,
+		Config:        config,
+		Layers:        []descriptor{layer},
+	})
+
+	client := registry.NewClient(10*time.Second, host)
+	imgs := []string{host + "/yunionio/region:v3.8.5", host + "/yunionio/keystone:v3.8.5"}
+	buf := &bytes.Buffer{}
+	manifest := &BundleManifest{OnecloudVersion: "v3.8.5"}
+	if err := NewBundleSaver(client, "linux/amd64", ioutil.Discard).Save(buf, manifest, imgs); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundlePath := filepath.Join(dir, "bundle.tar")
+	if err := ioutil.WriteFile(bundlePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := OpenBundle(bundlePath, filepath.Join(dir, "extract"))
+	if err != nil {
+		t.Fatalf("OpenBundle() error = %v", err)
+	}
+	if len(bundle.Manifest.Images) != 2 || bundle.Manifest.OnecloudVersion != "v3.8.5" || bundle.Manifest.Platform != "linux/amd64" {
+		t.Fatalf("unexpected bundle manifest %#v", bundle.Manifest)
+	}
+	for _, img := range bundle.Manifest.Images {
+		if img.Digest != amd64.Digest {
+			t.Errorf("image %s digest = %s, want %s", img.Name, img.Digest, amd64.Digest)
+		}
+	}
+
+	delete(fake.blobs, layer.Digest)
+	if err := bundle.Push(client, host+"/mirror/", ioutil.Discard); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	for _, key := range []string{"mirror/region:v3.8.5", "mirror/keystone:v3.8.5"} {
+		if sha256Digest(fake.manifests[key]) != amd64.Digest {
+			t.Errorf("manifest %s isn't pushed", key)
+		}
+	}
+	if _, ok := fake.blobs[layer.Digest]; !ok {
+		t.Errorf("layer %s isn't pushed", layer.Digest)
+	}
+
+	corrupted := bytes.Replace(buf.Bytes(), []byte("layer content"), []byte("layer c0ntent"), 1)
+	if err := ioutil.WriteFile(bundlePath, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBundle(bundlePath, ""); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("OpenBundle() of corrupted bundle error = %v, want corrupted", err)
+	}
+}
+
+func TestTargetImage(t *testing.T) {
+	tests := []struct {
+		img  string
+		repo string
+		want string
+	}{
+		{"registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5", "10.0.0.1:5000/yunionio", "10.0.0.1:5000/yunionio/region:v3.8.5"},
+		{"k8s.gcr.io/pause:3.1", "10.0.0.1:5000/yunionio/", "10.0.0.1:5000/yunionio/pause:3.1"},
+	}
+	for _, tt := range tests {
+		got, err := TargetImage(tt.img, tt.repo)
+		if err != nil {
+			t.Fatalf("TargetImage(%q) error = %v", tt.img, err)
+		}
+		if got != tt.want {
+			t.Errorf("TargetImage(%q, %q) = %q, want %q", tt.img, tt.repo, got, tt.want)
+		}
+	}
+}
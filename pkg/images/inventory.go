@@ -0,0 +1,321 @@
+package images
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/images"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+// Feature is the function of cluster which needs the image
+type Feature string
+
+const (
+	FeatureKubernetes Feature = "kubernetes"
+	FeatureNetwork    Feature = "network"
+	FeatureStorage    Feature = "storage"
+	FeatureIngress    Feature = "ingress"
+	FeatureMetrics    Feature = "metrics"
+	FeatureMonitor    Feature = "monitor"
+	FeatureHA         Feature = "ha"
+	FeatureLonghorn   Feature = "longhorn"
+	FeatureOperator   Feature = "operator"
+	FeatureOnecloud   Feature = "onecloud"
+	FeatureHostAgent  Feature = "host"
+	FeatureBaremetal  Feature = "baremetal"
+	FeatureEsxi       Feature = "esxi"
+	FeatureComponents Feature = "components"
+)
+
+// VersionSource tells where the tag of image comes from
+type VersionSource string
+
+const (
+	// VersionSourceKubeadm means the image and its tag are decided by kubeadm with the kubernetes version
+	VersionSourceKubeadm VersionSource = "kubeadm"
+	// VersionSourceOnecloud means the tag is the onecloud version
+	VersionSourceOnecloud VersionSource = "onecloud"
+	// VersionSourceOperator means the tag is the onecloud operator version
+	VersionSourceOperator VersionSource = "operator"
+	// VersionSourceKeepalived means the tag is the keepalived version of cluster configuration
+	VersionSourceKeepalived VersionSource = "keepalived"
+	// VersionSourceFixed means the tag is the Version of descriptor
+	VersionSourceFixed VersionSource = "fixed"
+)
+
+const (
+	EditionCE = operatorconstants.OnecloudCommunityEdition
+	EditionEE = operatorconstants.OnecloudEnterpriseEdition
+)
+
+// ImageDescriptor describes an image used by cluster
+type ImageDescriptor struct {
+	Name          string
+	Features      []Feature
+	VersionSource VersionSource
+	// Version is the tag of image when VersionSource is fixed
+	Version string
+	// Edition is the onecloud edition using the image, empty means all the editions
+	Edition string
+}
+
+// Descriptors are all the images known by ocadm.
+// The images of onecloud services follow the defaults of onecloud operator.
+var Descriptors = []ImageDescriptor{
+	{Name: kubeadmconstants.KubeAPIServer, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: kubeadmconstants.KubeControllerManager, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: kubeadmconstants.KubeScheduler, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: kubeadmconstants.KubeProxy, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: "pause", Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: kubeadmconstants.Etcd, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+	{Name: kubeadmconstants.CoreDNSImageName, Features: []Feature{FeatureKubernetes}, VersionSource: VersionSourceKubeadm},
+
+	{Name: constants.CalicoKubeControllers, Features: []Feature{FeatureNetwork}, VersionSource: VersionSourceFixed, Version: constants.DefaultCalicoVersion},
+	{Name: constants.CalicoNode, Features: []Feature{FeatureNetwork}, VersionSource: VersionSourceFixed, Version: constants.DefaultCalicoVersion},
+	{Name: constants.CalicoCNI, Features: []Feature{FeatureNetwork}, VersionSource: VersionSourceFixed, Version: constants.DefaultCalicoVersion},
+	{Name: constants.RancherLocalPathProvisioner, Features: []Feature{FeatureStorage}, VersionSource: VersionSourceFixed, Version: constants.DefaultLocalProvisionerVersion},
+	{Name: constants.Busybox, Features: []Feature{FeatureStorage}, VersionSource: VersionSourceFixed, Version: constants.BusyboxVersion},
+	{Name: constants.IngressControllerTraefik, Features: []Feature{FeatureIngress}, VersionSource: VersionSourceFixed, Version: constants.DefaultTraefikVersion},
+	{Name: constants.MetricsServer, Features: []Feature{FeatureMetrics}, VersionSource: VersionSourceFixed, Version: constants.MetricsServerVersion},
+	{Name: constants.Loki, Features: []Feature{FeatureMonitor}, VersionSource: VersionSourceFixed, Version: constants.DefaultLokiVersion},
+	{Name: constants.Promtail, Features: []Feature{FeatureMonitor}, VersionSource: VersionSourceFixed, Version: constants.DefaultPromtailVersion},
+	{Name: constants.Grafana, Features: []Feature{FeatureMonitor}, VersionSource: VersionSourceFixed, Version: constants.DefaultGrafanaVersion},
+	{Name: constants.K8sSidecar, Features: []Feature{FeatureMonitor}, VersionSource: VersionSourceFixed, Version: constants.DefaultK8sSidecarVersion},
+	{Name: constants.Keepalived, Features: []Feature{FeatureHA}, VersionSource: VersionSourceKeepalived},
+	{Name: constants.LonghornManager, Features: []Feature{FeatureLonghorn}, VersionSource: VersionSourceFixed, Version: constants.DefaultLonghornVersion},
+	{Name: constants.LonghornEngine, Features: []Feature{FeatureLonghorn}, VersionSource: VersionSourceFixed, Version: constants.DefaultLonghornVersion},
+	{Name: constants.LonghornInstanceManager, Features: []Feature{FeatureLonghorn}, VersionSource: VersionSourceFixed, Version: constants.DefaultLonghornVersion},
+	{Name: constants.LonghornUi, Features: []Feature{FeatureLonghorn}, VersionSource: VersionSourceFixed, Version: constants.DefaultLonghornVersion},
+	{Name: constants.RsyncSSH, Features: []Feature{FeatureLonghorn}, VersionSource: VersionSourceFixed, Version: constants.RsyncSSHVersion},
+	{Name: constants.OnecloudOperator, Features: []Feature{FeatureOperator}, VersionSource: VersionSourceOperator},
+
+	{Name: onecloud.KeystoneComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.RegionComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.RegionDNSComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.ClimcComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.WebconsoleComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.SchedulerComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.LoggerComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.YunionconfComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.YunionagentComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.KubeServerComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.AnsibleServerComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.CloudnetComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.CloudproxyComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.CloudeventComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.S3gatewayComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.DevtoolComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.AutoUpdateComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.VpcAgentComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.MonitorComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.ServiceOperatorComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.ItsmComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.CloudIdComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.SuggestionComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.CloudmonComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.GlanceComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.NotifyComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.MeterComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.APIGatewayComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud, Edition: EditionCE},
+	{Name: onecloud.APIGatewayComponentTypeEE.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud, Edition: EditionEE},
+	{Name: onecloud.WebComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud, Edition: EditionCE},
+	{Name: operatorconstants.WebEEImageName, Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceOnecloud, Edition: EditionEE},
+	{Name: onecloud.InfluxdbComponentType.String(), Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultInfluxdbImageVersion},
+	{Name: onecloud.DefaultTelegrafImageName, Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultTelegrafImageTag},
+	{Name: onecloud.DefaultTelegrafInitImageName, Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultTelegrafInitImageTag},
+	{Name: onecloud.DefaultTelegrafRaidImageName, Features: []Feature{FeatureOnecloud}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultTelegrafRaidImageTag},
+	{Name: onecloud.DefaultOvnImageName, Features: []Feature{FeatureOnecloud, FeatureHostAgent}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultOvnImageTag},
+
+	{Name: onecloud.HostComponentType.String(), Features: []Feature{FeatureHostAgent}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.HostDeployerComponentType.String(), Features: []Feature{FeatureHostAgent}, VersionSource: VersionSourceOnecloud},
+	{Name: "sdnagent", Features: []Feature{FeatureHostAgent}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.DefaultHostImageName, Features: []Feature{FeatureHostAgent}, VersionSource: VersionSourceFixed, Version: onecloud.DefaultHostImageTag},
+	{Name: onecloud.BaremetalAgentComponentType.String(), Features: []Feature{FeatureBaremetal}, VersionSource: VersionSourceOnecloud},
+	{Name: onecloud.EsxiAgentComponentType.String(), Features: []Feature{FeatureEsxi}, VersionSource: VersionSourceOnecloud},
+
+	// java-app runs the optional components installed by 'ocadm component'
+	{Name: "java-app", Features: []Feature{FeatureComponents}, VersionSource: VersionSourceOnecloud},
+}
+
+// AllFeatures returns the features of all the descriptors
+func AllFeatures() []string {
+	features := sets.NewString()
+	for _, desc := range Descriptors {
+		for _, f := range desc.Features {
+			features.Insert(string(f))
+		}
+	}
+	return features.List()
+}
+
+// InitFeatures returns the features of images deployed by 'ocadm init' with cfg
+func InitFeatures(cfg *v1.ClusterConfiguration) []string {
+	features := []string{
+		string(FeatureKubernetes),
+		string(FeatureNetwork),
+		string(FeatureStorage),
+		string(FeatureIngress),
+		string(FeatureOperator),
+	}
+	if len(cfg.HighAvailabilityVIP) != 0 {
+		features = append(features, string(FeatureHA))
+	}
+	return features
+}
+
+// ImageFilter selects images from Descriptors
+type ImageFilter struct {
+	// Features are the features of images, empty means all the features
+	Features []string
+	// Edition is the onecloud edition, the community edition is used if it's empty
+	Edition string
+}
+
+// Validate checks the features and edition of filter are known
+func (f ImageFilter) Validate() error {
+	known := sets.NewString(AllFeatures()...)
+	for _, feature := range f.Features {
+		if !known.Has(feature) {
+			return errors.Errorf("unknown image feature %q, supported: %s", feature, strings.Join(known.List(), ", "))
+		}
+	}
+	switch f.Edition {
+	case "", EditionCE, EditionEE:
+	default:
+		return errors.Errorf("unknown edition %q, supported: %s, %s", f.Edition, EditionCE, EditionEE)
+	}
+	return nil
+}
+
+func (f ImageFilter) match(desc ImageDescriptor) bool {
+	edition := f.Edition
+	if edition == "" {
+		edition = EditionCE
+	}
+	if desc.Edition != "" && desc.Edition != edition {
+		return false
+	}
+	if len(f.Features) == 0 {
+		return true
+	}
+	features := sets.NewString(f.Features...)
+	for _, feature := range desc.Features {
+		if features.Has(string(feature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Image is an image resolved from descriptor
+type Image struct {
+	// Image is the full name, e.g. registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5
+	Image      string   `json:"image"`
+	Repository string   `json:"repository"`
+	Name       string   `json:"name"`
+	Tag        string   `json:"tag"`
+	Features   []string `json:"features"`
+}
+
+// ListImages resolves the images of descriptors selected by filter
+func ListImages(cfg *v1.ClusterConfiguration, kubeadmCfg *kubeadmapi.ClusterConfiguration, operatorVersion string, filter ImageFilter) ([]Image, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	ret := []Image{}
+	seen := sets.NewString()
+	for _, desc := range Descriptors {
+		if !filter.match(desc) {
+			continue
+		}
+		img := resolveImage(desc, cfg, kubeadmCfg, operatorVersion)
+		if len(img) == 0 || seen.Has(img) {
+			continue
+		}
+		seen.Insert(img)
+		ret = append(ret, newImage(img, desc.Features))
+	}
+	return ret, nil
+}
+
+func resolveImage(desc ImageDescriptor, cfg *v1.ClusterConfiguration, kubeadmCfg *kubeadmapi.ClusterConfiguration, operatorVersion string) string {
+	repoPrefix := kubeadmCfg.ImageRepository
+	switch desc.VersionSource {
+	case VersionSourceKubeadm:
+		return resolveKubeadmImage(desc.Name, kubeadmCfg)
+	case VersionSourceOnecloud:
+		return GetOnecloudImage(desc.Name, cfg, kubeadmCfg)
+	case VersionSourceOperator:
+		if len(operatorVersion) == 0 {
+			operatorVersion = cfg.OperatorVersion
+		}
+		return GetGenericImage(repoPrefix, desc.Name, operatorVersion)
+	case VersionSourceKeepalived:
+		version := cfg.KeepalivedVersionTag
+		if len(version) == 0 {
+			version = constants.DefaultKeepalivedVersionTag
+		}
+		return GetGenericImage(repoPrefix, desc.Name, version)
+	default:
+		return GetGenericImage(repoPrefix, desc.Name, desc.Version)
+	}
+}
+
+// resolveKubeadmImage returns the kubernetes image the same as 'kubeadm config images list'
+func resolveKubeadmImage(name string, cfg *kubeadmapi.ClusterConfiguration) string {
+	switch name {
+	case "pause":
+		return images.GetPauseImage(cfg)
+	case kubeadmconstants.Etcd:
+		if cfg.Etcd.Local == nil {
+			return ""
+		}
+		return images.GetEtcdImage(cfg)
+	case kubeadmconstants.CoreDNSImageName:
+		return images.GetDNSImage(cfg, kubeadmconstants.CoreDNSImageName)
+	default:
+		if cfg.UseHyperKubeImage {
+			return images.GetKubernetesImage(kubeadmconstants.HyperKube, cfg)
+		}
+		return images.GetKubernetesImage(name, cfg)
+	}
+}
+
+// newImage splits img to repository, name and tag
+func newImage(img string, features []Feature) Image {
+	ret := Image{Image: img}
+	rest := img
+	if idx := strings.LastIndex(rest, "/"); idx >= 0 {
+		ret.Repository = rest[:idx]
+		rest = rest[idx+1:]
+	}
+	if idx := strings.Index(rest, ":"); idx >= 0 {
+		ret.Tag = rest[idx+1:]
+		rest = rest[:idx]
+	}
+	ret.Name = rest
+	for _, f := range features {
+		ret.Features = append(ret.Features, string(f))
+	}
+	sort.Strings(ret.Features)
+	return ret
+}
+
+// ImageNames returns the full names of imgs
+func ImageNames(imgs []Image) []string {
+	names := make([]string, 0, len(imgs))
+	for _, img := range imgs {
+		names = append(names, img.Image)
+	}
+	return names
+}
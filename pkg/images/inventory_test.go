@@ -0,0 +1,155 @@
+package images
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+
+	"yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func newTestConfig() (*v1.ClusterConfiguration, *kubeadmapi.ClusterConfiguration) {
+	cfg := &v1.ClusterConfiguration{OnecloudVersion: "v3.8.5"}
+	kubeadmCfg := &kubeadmapi.ClusterConfiguration{
+		ImageRepository:   "registry.cn-beijing.aliyuncs.com/yunionio",
+		KubernetesVersion: "v1.15.12",
+		Etcd:              kubeadmapi.Etcd{Local: &kubeadmapi.LocalEtcd{}},
+		DNS:               kubeadmapi.DNS{Type: kubeadmapi.CoreDNS},
+	}
+	return cfg, kubeadmCfg
+}
+
+func TestListImages(t *testing.T) {
+	cfg, kubeadmCfg := newTestConfig()
+	repo := kubeadmCfg.ImageRepository
+	tests := []struct {
+		name     string
+		filter   ImageFilter
+		contains []string
+		excludes []string
+		wantErr  bool
+	}{
+		{
+			name:   "all community edition",
+			filter: ImageFilter{},
+			contains: []string{
+				repo + "/kube-apiserver:v1.15.12",
+				repo + "/metrics-server:v0.3.6",
+				repo + "/keepalived:v2.0.25",
+				repo + "/longhorn-manager:v1.0.0",
+				repo + "/busybox:1.28.0-glibc",
+				repo + "/region:v3.8.5",
+				repo + "/web:v3.8.5",
+				repo + "/onecloud-operator:v3.8.0",
+			},
+			excludes: []string{repo + "/web-ee:v3.8.5", repo + "/apigateway-ee:v3.8.5"},
+		},
+		{
+			name:     "enterprise edition",
+			filter:   ImageFilter{Edition: EditionEE},
+			contains: []string{repo + "/web-ee:v3.8.5", repo + "/apigateway-ee:v3.8.5"},
+			excludes: []string{repo + "/web:v3.8.5", repo + "/apigateway:v3.8.5"},
+		},
+		{
+			name:     "host feature",
+			filter:   ImageFilter{Features: []string{string(FeatureHostAgent)}},
+			contains: []string{repo + "/host:v3.8.5", repo + "/sdnagent:v3.8.5", repo + "/openvswitch:2.10.5-1"},
+			excludes: []string{repo + "/region:v3.8.5", repo + "/kube-apiserver:v1.15.12"},
+		},
+		{
+			name:    "unknown feature",
+			filter:  ImageFilter{Features: []string{"foo"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown edition",
+			filter:  ImageFilter{Edition: "foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imgs, err := ListImages(cfg, kubeadmCfg, "v3.8.0", tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListImages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			names := sets.NewString(ImageNames(imgs)...)
+			if len(names) != len(imgs) {
+				t.Errorf("ListImages() returns duplicated images: %v", ImageNames(imgs))
+			}
+			for _, img := range tt.contains {
+				if !names.Has(img) {
+					t.Errorf("ListImages() doesn't contain %s", img)
+				}
+			}
+			for _, img := range tt.excludes {
+				if names.Has(img) {
+					t.Errorf("ListImages() contains %s", img)
+				}
+			}
+		})
+	}
+}
+
+func TestInitFeatures(t *testing.T) {
+	cfg, kubeadmCfg := newTestConfig()
+	repo := kubeadmCfg.ImageRepository
+	imgs, err := ListImages(cfg, kubeadmCfg, "v3.8.0", ImageFilter{Features: InitFeatures(cfg)})
+	if err != nil {
+		t.Fatalf("ListImages() error = %v", err)
+	}
+	names := sets.NewString(ImageNames(imgs)...)
+	for _, img := range []string{
+		repo + "/kube-apiserver:v1.15.12",
+		repo + "/calico-node:v3.12.1",
+		repo + "/local-path-provisioner:v0.0.11",
+		repo + "/traefik:v1.7.34",
+		repo + "/onecloud-operator:v3.8.0",
+	} {
+		if !names.Has(img) {
+			t.Errorf("init images don't contain %s", img)
+		}
+	}
+	for _, img := range []string{
+		repo + "/region:v3.8.5",
+		repo + "/host:v3.8.5",
+		repo + "/longhorn-manager:v1.0.0",
+		repo + "/keepalived:v2.0.25",
+	} {
+		if names.Has(img) {
+			t.Errorf("init images contain %s", img)
+		}
+	}
+
+	cfg.HighAvailabilityVIP = "10.0.0.100"
+	imgs, err = ListImages(cfg, kubeadmCfg, "v3.8.0", ImageFilter{Features: InitFeatures(cfg)})
+	if err != nil {
+		t.Fatalf("ListImages() error = %v", err)
+	}
+	if !sets.NewString(ImageNames(imgs)...).Has(repo + "/keepalived:v2.0.25") {
+		t.Errorf("init images of HA cluster don't contain keepalived")
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	tests := []struct {
+		img  string
+		want Image
+	}{
+		{
+			img:  "registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5",
+			want: Image{Image: "registry.cn-beijing.aliyuncs.com/yunionio/region:v3.8.5", Repository: "registry.cn-beijing.aliyuncs.com/yunionio", Name: "region", Tag: "v3.8.5", Features: []string{"onecloud"}},
+		},
+		{
+			img:  "10.0.0.1:5000/pause:3.1",
+			want: Image{Image: "10.0.0.1:5000/pause:3.1", Repository: "10.0.0.1:5000", Name: "pause", Tag: "3.1", Features: []string{"onecloud"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := newImage(tt.img, []Feature{FeatureOnecloud}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newImage(%q) = %#v, want %#v", tt.img, got, tt.want)
+		}
+	}
+}
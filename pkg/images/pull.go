@@ -0,0 +1,167 @@
+package images
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImageRuntime is the container runtime pulling images, it's satisfied by kubeadm ContainerRuntime
+type ImageRuntime interface {
+	PullImage(image string) error
+	ImageExists(image string) (bool, error)
+}
+
+// PullOptions configures how Puller pulls images
+type PullOptions struct {
+	// Parallelism is the number of images pulled at the same time
+	Parallelism int
+	// Retries is the times to retry a failed pull
+	Retries int
+	// Backoff is the wait before the first retry, it's doubled after every retry
+	Backoff time.Duration
+	// SkipExisting skips the images already exist in runtime
+	SkipExisting bool
+}
+
+// DefaultPullOptions returns the default options of Puller
+func DefaultPullOptions() PullOptions {
+	return PullOptions{
+		Parallelism: 4,
+		Retries:     3,
+		Backoff:     5 * time.Second,
+	}
+}
+
+// PullError is the error of image failed to pull after all the retries
+type PullError struct {
+	Image string
+	Err   error
+}
+
+func (e *PullError) Error() string {
+	return fmt.Sprintf("failed to pull image %q: %v", e.Image, e.Err)
+}
+
+// Puller pulls images concurrently with retries and prints the progress
+type Puller struct {
+	runtime ImageRuntime
+	opts    PullOptions
+	out     io.Writer
+	// prefix is printed at the beginning of every progress line, e.g. [config/images]
+	prefix string
+
+	lock sync.Mutex
+	done int
+}
+
+// NewPuller returns a Puller printing the progress to out
+func NewPuller(runtime ImageRuntime, opts PullOptions, out io.Writer, prefix string) *Puller {
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 1
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	return &Puller{
+		runtime: runtime,
+		opts:    opts,
+		out:     out,
+		prefix:  prefix,
+	}
+}
+
+// PullAll pulls all the imgs, the failed images are returned as PullError after all the others are pulled
+func (p *Puller) PullAll(imgs []string) []error {
+	p.done = 0
+	queue := make(chan string)
+	results := make(chan error, len(imgs))
+	wg := &sync.WaitGroup{}
+	for i := 0; i < p.opts.Parallelism && i < len(imgs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range queue {
+				results <- p.pull(img, len(imgs))
+			}
+		}()
+	}
+	for _, img := range imgs {
+		queue <- img
+	}
+	close(queue)
+	wg.Wait()
+	close(results)
+
+	errs := []error{}
+	for err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		p.printf("Failed to pull %d of %d images:\n", len(errs), len(imgs))
+		for _, err := range errs {
+			pe := err.(*PullError)
+			p.printf("  - %s: %v\n", pe.Image, pe.Err)
+		}
+	}
+	return errs
+}
+
+// Pull pulls all the imgs and returns an error summarizing the failed images
+func (p *Puller) Pull(imgs []string) error {
+	errs := p.PullAll(imgs)
+	if len(errs) == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(errs))
+	for _, err := range errs {
+		failed = append(failed, err.(*PullError).Image)
+	}
+	return errors.Errorf("failed to pull %d images: %v", len(failed), failed)
+}
+
+func (p *Puller) pull(img string, total int) error {
+	if p.opts.SkipExisting {
+		if exists, err := p.runtime.ImageExists(img); err == nil && exists {
+			p.progress(total, "Image %s already exists", img)
+			return nil
+		}
+	}
+	backoff := p.opts.Backoff
+	start := time.Now()
+	var err error
+	for attempt := 0; attempt <= p.opts.Retries; attempt++ {
+		if attempt > 0 {
+			p.printf("Retrying %s in %s (%d/%d): %v\n", img, backoff, attempt, p.opts.Retries, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		} else {
+			p.printf("Pulling %s\n", img)
+		}
+		if err = p.runtime.PullImage(img); err == nil {
+			p.progress(total, "Pulled %s in %s", img, time.Since(start).Round(time.Second))
+			return nil
+		}
+	}
+	p.progress(total, "Failed to pull %s", img)
+	return &PullError{Image: img, Err: err}
+}
+
+// progress prints msg with the count of finished images
+func (p *Puller) progress(total int, format string, args ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.done++
+	fmt.Fprintf(p.out, "%s [%d/%d] %s\n", p.prefix, p.done, total, fmt.Sprintf(format, args...))
+}
+
+func (p *Puller) printf(format string, args ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fmt.Fprintf(p.out, "%s %s", p.prefix, fmt.Sprintf(format, args...))
+}
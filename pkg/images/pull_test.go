@@ -0,0 +1,144 @@
+package images
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRuntime struct {
+	lock sync.Mutex
+	// failures is the times PullImage fails before succeeded, negative means always fail
+	failures map[string]int
+	existing map[string]bool
+	pulls    map[string]int
+	running  int
+	maxRun   int
+}
+
+func newFakeRuntime(failures map[string]int, existing ...string) *fakeRuntime {
+	r := &fakeRuntime{
+		failures: failures,
+		existing: map[string]bool{},
+		pulls:    map[string]int{},
+	}
+	for _, img := range existing {
+		r.existing[img] = true
+	}
+	return r
+}
+
+func (r *fakeRuntime) PullImage(image string) error {
+	r.lock.Lock()
+	r.running++
+	if r.running > r.maxRun {
+		r.maxRun = r.running
+	}
+	r.pulls[image]++
+	count := r.pulls[image]
+	r.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.running--
+	if failures, ok := r.failures[image]; ok && (failures < 0 || count <= failures) {
+		return fmt.Errorf("pull %s failed", image)
+	}
+	return nil
+}
+
+func (r *fakeRuntime) ImageExists(image string) (bool, error) {
+	return r.existing[image], nil
+}
+
+func TestPullerPullAll(t *testing.T) {
+	imgs := []string{"a:v1", "b:v1", "c:v1", "d:v1", "e:v1", "f:v1"}
+	tests := []struct {
+		name      string
+		opts      PullOptions
+		failures  map[string]int
+		existing  []string
+		wantPulls map[string]int
+		wantErrs  []string
+		maxRun    int
+	}{
+		{
+			name:      "all succeeded",
+			opts:      PullOptions{Parallelism: 2},
+			wantPulls: map[string]int{"a:v1": 1, "b:v1": 1, "c:v1": 1, "d:v1": 1, "e:v1": 1, "f:v1": 1},
+			maxRun:    2,
+		},
+		{
+			name:      "retry until succeeded",
+			opts:      PullOptions{Parallelism: 3, Retries: 2, Backoff: time.Millisecond},
+			failures:  map[string]int{"b:v1": 2, "d:v1": 1},
+			wantPulls: map[string]int{"a:v1": 1, "b:v1": 3, "c:v1": 1, "d:v1": 2, "e:v1": 1, "f:v1": 1},
+			maxRun:    3,
+		},
+		{
+			name:      "failed after retries",
+			opts:      PullOptions{Parallelism: 4, Retries: 1, Backoff: time.Millisecond},
+			failures:  map[string]int{"c:v1": -1, "e:v1": 3},
+			wantPulls: map[string]int{"a:v1": 1, "b:v1": 1, "c:v1": 2, "d:v1": 1, "e:v1": 2, "f:v1": 1},
+			wantErrs:  []string{"c:v1", "e:v1"},
+			maxRun:    4,
+		},
+		{
+			name:      "skip existing",
+			opts:      PullOptions{Parallelism: 1, SkipExisting: true},
+			existing:  []string{"a:v1", "f:v1"},
+			wantPulls: map[string]int{"b:v1": 1, "c:v1": 1, "d:v1": 1, "e:v1": 1},
+			maxRun:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime(tt.failures, tt.existing...)
+			out := &bytes.Buffer{}
+			errs := NewPuller(runtime, tt.opts, out, "[test]").PullAll(imgs)
+
+			failed := map[string]bool{}
+			for _, err := range errs {
+				failed[err.(*PullError).Image] = true
+			}
+			if len(failed) != len(tt.wantErrs) {
+				t.Errorf("PullAll() errors = %v, want failed images %v", errs, tt.wantErrs)
+			}
+			for _, img := range tt.wantErrs {
+				if !failed[img] {
+					t.Errorf("PullAll() doesn't return error of %s", img)
+				}
+				if !strings.Contains(out.String(), "- "+img) {
+					t.Errorf("summary doesn't contain %s:\n%s", img, out.String())
+				}
+			}
+			if len(runtime.pulls) != len(tt.wantPulls) {
+				t.Errorf("pulls = %v, want %v", runtime.pulls, tt.wantPulls)
+			}
+			for img, count := range tt.wantPulls {
+				if runtime.pulls[img] != count {
+					t.Errorf("%s pulled %d times, want %d", img, runtime.pulls[img], count)
+				}
+			}
+			if runtime.maxRun > tt.maxRun {
+				t.Errorf("%d images pulled at the same time, want at most %d", runtime.maxRun, tt.maxRun)
+			}
+			if !strings.Contains(out.String(), fmt.Sprintf("[test] [%d/%d]", len(imgs), len(imgs))) {
+				t.Errorf("progress doesn't reach the end:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestPullerPull(t *testing.T) {
+	runtime := newFakeRuntime(map[string]int{"b:v1": -1})
+	err := NewPuller(runtime, PullOptions{Parallelism: 2}, &bytes.Buffer{}, "[test]").Pull([]string{"a:v1", "b:v1"})
+	if err == nil || !strings.Contains(err.Error(), "b:v1") {
+		t.Errorf("Pull() error = %v, want error of b:v1", err)
+	}
+}
@@ -38,6 +38,32 @@ const (
 	LonghornOverProvisioningPercentage = "longhorn-over-provisioning-percentage"
 	LonghornReplicaCount               = "longhorn-replica-count"
 	PVCMigrateToLonghorn               = "source-pvc"
+	InventoryFile                      = "file"
+	SSHKnownHosts                      = "ssh-known-hosts"
+	SSHTrustOnFirstUse                 = "ssh-trust-on-first-use"
+	DisableAddons                      = "disable-addons"
+	OldConfig                          = "old-config"
+	NewConfig                          = "new-config"
+	ConfigFile                         = "file"
+	EnableHostAgent                    = "enable-host-agent"
+	GlanceNode                         = "glance-node"
+	BaremetalNode                      = "baremetal-node"
+	EsxiNode                           = "esxi-node"
+	EnableHugepage                     = "enable-hugepage"
+	PurgeDatabases                     = "purge-databases"
+	AddonParam                         = "param"
+	RolloutTimeout                     = "rollout-timeout"
+	ImageBundleOutput                  = "output"
+	ImageBundleInput                   = "input"
+	ImagePlatform                      = "platform"
+	TargetRegistry                     = "registry"
+	RegistryUsername                   = "registry-username"
+	RegistryPassword                   = "registry-password"
+	InsecureRegistry                   = "insecure-registry"
+	ImageFeature                       = "feature"
+	Edition                            = "edition"
+	ImagePullParallelism               = "image-pull-parallelism"
+	ImagePullRetries                   = "image-pull-retries"
 )
 
 const (
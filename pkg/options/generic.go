@@ -39,9 +39,9 @@ func AddUpgradeFromV2Flags(fs *pflag.FlagSet, upgradeFromV2 *bool) {
 }
 
 func AddGlanceNodeLabelFlag(fs *pflag.FlagSet, glanceNode, baremetalNode, esxiNode *bool) {
-	fs.BoolVar(glanceNode, "glance-node", false, "as glance node on upgrade from onecloud version 2.x")
-	fs.BoolVar(baremetalNode, "baremetal-node", false, "as baremetal node on upgrade from onecloud version 2.x")
-	fs.BoolVar(esxiNode, "esxi-node", false, "as esxi node on upgrade from onecloud version 2.x")
+	fs.BoolVar(glanceNode, GlanceNode, false, "as glance node on upgrade from onecloud version 2.x")
+	fs.BoolVar(baremetalNode, BaremetalNode, false, "as baremetal node on upgrade from onecloud version 2.x")
+	fs.BoolVar(esxiNode, EsxiNode, false, "as esxi node on upgrade from onecloud version 2.x")
 }
 
 var (
@@ -0,0 +1,12 @@
+// Package all registers all the addons to the default addons registry
+package all
+
+import (
+	_ "yunion.io/x/ocadm/pkg/phases/addons/calico"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/csi"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/grafana"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/loki"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/metricsserver"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/onecloudoperator"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/traefik"
+)
@@ -1,16 +1,68 @@
 package calico
 
 import (
+	"strconv"
+
+	"github.com/pkg/errors"
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
 const (
 	DefaultVersion = constants.DefaultCalicoVersion
+
+	ParamIPAutodetectionMethod = "ipAutodetectionMethod"
+	ParamFelixChainInsertMode  = "felixChainInsertMode"
+	ParamIPV4PoolBlockSize     = "ipv4PoolBlockSize"
+
+	minIPV4PoolBlockSize = 20
+	maxIPV4PoolBlockSize = 32
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:        "calico",
+		Description: "Calico CNI network plugin",
+		Version:     DefaultVersion,
+		Parameters: []addons.Parameter{
+			{Name: ParamIPAutodetectionMethod, Description: "IP_AUTODETECTION_METHOD of calico node"},
+			{Name: ParamFelixChainInsertMode, Description: "FELIX_CHAININSERTMODE of calico node"},
+			{Name: ParamIPV4PoolBlockSize, Description: "block size of default IPv4 pool", Validate: validateBlockSize},
+		},
+		DefaultParameters: func(cfg *apiv1.InitConfiguration) addons.Parameters {
+			return addons.Parameters{
+				ParamIPAutodetectionMethod: cfg.Calico.IPAutodetectionMethod,
+				ParamFelixChainInsertMode:  cfg.Calico.FelixChainInsertMode,
+				ParamIPV4PoolBlockSize:     strconv.Itoa(cfg.Calico.IPV4PoolBlockSize),
+			}
+		},
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			// the parameter is checked by validateBlockSize, empty means the default block size
+			blockSize := -1
+			if v := params[ParamIPV4PoolBlockSize]; len(v) != 0 {
+				blockSize, _ = strconv.Atoi(v)
+			}
+			return NewCalicoConfig(&cfg.InitConfiguration.ClusterConfiguration,
+				params[ParamIPAutodetectionMethod], params[ParamFelixChainInsertMode], blockSize).(addons.ImagesConfiger)
+		},
+	})
+}
+
+func validateBlockSize(value string) error {
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Errorf("block size must be an integer")
+	}
+	if size < minIPV4PoolBlockSize || size > maxIPV4PoolBlockSize {
+		return errors.Errorf("block size must be between %d and %d, inclusive", minIPV4PoolBlockSize, maxIPV4PoolBlockSize)
+	}
+	return nil
+}
+
 type CNICalicoConfig struct {
 	ControllerImage       string
 	NodeImage             string
@@ -45,6 +97,10 @@ func (c CNICalicoConfig) Name() string {
 	return "calico"
 }
 
+func (c CNICalicoConfig) Images() []string {
+	return []string{c.ControllerImage, c.NodeImage, c.CNIImage}
+}
+
 func (c CNICalicoConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(CNICalicoTemplate, c)
 }
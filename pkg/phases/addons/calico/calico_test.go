@@ -0,0 +1,47 @@
+package calico
+
+import (
+	"testing"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/phases/addons"
+)
+
+func TestBlockSizeParameter(t *testing.T) {
+	a, err := addons.DefaultRegistry().Get("calico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiv1.InitConfiguration{}
+	cfg.Calico.IPV4PoolBlockSize = apiv1.DefaultCalicoIPV4PoolBlockSize
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", want: apiv1.DefaultCalicoIPV4PoolBlockSize},
+		{name: "valid", value: "24", want: 24},
+		{name: "not integer", value: "abc", wantErr: true},
+		{name: "too small", value: "19", wantErr: true},
+		{name: "too large", value: "33", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides := addons.Parameters{}
+			if len(tt.value) != 0 {
+				overrides[ParamIPV4PoolBlockSize] = tt.value
+			}
+			params, err := a.ResolveParameters(cfg, overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveParameters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := a.NewConfiger(cfg, params).(*CNICalicoConfig).IPV4PoolBlockSize; got != tt.want {
+				t.Errorf("IPV4PoolBlockSize = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,10 +4,23 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "csi",
+		Description:  "Local path provisioner CSI storage class",
+		Version:      constants.DefaultLocalProvisionerVersion,
+		Dependencies: []string{"calico"},
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewLocalPathProvisionerConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type LocalPathProvisionerConfig struct {
 	Image       string
 	HelperImage string
@@ -26,6 +39,10 @@ func (c LocalPathProvisionerConfig) Name() string {
 	return "local-path-provisioner"
 }
 
+func (c LocalPathProvisionerConfig) Images() []string {
+	return []string{c.Image, c.HelperImage}
+}
+
 func (c LocalPathProvisionerConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(LocalPathProvisioner, c)
 }
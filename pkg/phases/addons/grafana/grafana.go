@@ -4,10 +4,24 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "grafana",
+		Description:  "Grafana dashboards",
+		Version:      constants.DefaultGrafanaVersion,
+		Dependencies: []string{"csi", "traefik"},
+		Optional:     true,
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewGrafanaConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type GrafanaConfig struct {
 	Image        string
 	SidecarImage string
@@ -29,6 +43,10 @@ func (c GrafanaConfig) Name() string {
 	return "grafana"
 }
 
+func (c GrafanaConfig) Images() []string {
+	return []string{c.Image, c.SidecarImage}
+}
+
 func (c GrafanaConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(GrafanaTempate, c)
 }
@@ -7,7 +7,7 @@ import (
 
 	"github.com/pkg/errors"
 
-	"yunion.io/x/ocadm/pkg/util/kubectl"
+	"yunion.io/x/ocadm/pkg/util/kube"
 )
 
 func CompileTemplateFromMap(tmplt string, configMap interface{}) (string, error) {
@@ -24,7 +24,8 @@ type Configer interface {
 	GenerateYAML() (string, error)
 }
 
-func KubectlApplyAddon(c Configer, client *kubectl.Client, onlyShow bool) error {
+// ApplyAddon applies the manifest of c labeled with its name and version, objects are not recorded nor pruned
+func ApplyAddon(c Configer, applier *kube.Applier, version string, onlyShow bool) error {
 	manifest, err := c.GenerateYAML()
 	if err != nil {
 		return errors.Wrapf(err, "get addon %s manifest", c.Name())
@@ -33,7 +34,7 @@ func KubectlApplyAddon(c Configer, client *kubectl.Client, onlyShow bool) error
 		fmt.Printf("%s", manifest)
 		return nil
 	}
-	if err := client.Apply(manifest); err != nil {
+	if _, err := applier.Apply(manifest, AddonLabels(c.Name(), version)); err != nil {
 		return errors.Wrapf(err, "apply addon %s", c.Name())
 	}
 	fmt.Printf("[oc-addons] Applied addon: %s\n", c.Name())
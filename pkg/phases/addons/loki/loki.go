@@ -4,10 +4,34 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "loki",
+		Description:  "Loki log aggregation",
+		Version:      constants.DefaultLokiVersion,
+		Dependencies: []string{"csi"},
+		Optional:     true,
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewLokiConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+	addons.Register(&addons.Addon{
+		Name:         "promtail",
+		Description:  "Promtail log collector shipping to loki",
+		Version:      constants.DefaultPromtailVersion,
+		Dependencies: []string{"loki"},
+		Optional:     true,
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewPromtailConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type LokiConfig struct {
 	Image string
 }
@@ -24,6 +48,10 @@ func (c LokiConfig) Name() string {
 	return "loki"
 }
 
+func (c LokiConfig) Images() []string {
+	return []string{c.Image}
+}
+
 func (c LokiConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(LokiTemplate, c)
 }
@@ -44,6 +72,10 @@ func (c PromtailConfig) Name() string {
 	return "promtail"
 }
 
+func (c PromtailConfig) Images() []string {
+	return []string{c.Image}
+}
+
 func (c PromtailConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(PromtailTemplate, c)
 }
@@ -0,0 +1,196 @@
+package addons
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/kube"
+)
+
+// Manager installs, upgrades and removes the addons of a running cluster
+type Manager struct {
+	registry *Registry
+	cfg      *apiv1.InitConfiguration
+	client   clientset.Interface
+	applier  *kube.Applier
+	out      io.Writer
+
+	// RolloutTimeout is how long Install waits for the workloads of addon to be rolled out, 0 means not waiting
+	RolloutTimeout time.Duration
+}
+
+func NewManager(registry *Registry, cfg *apiv1.InitConfiguration, client clientset.Interface, applier *kube.Applier, out io.Writer) *Manager {
+	return &Manager{
+		registry: registry,
+		cfg:      cfg,
+		client:   client,
+		applier:  applier,
+		out:      out,
+	}
+}
+
+// AddonLabels returns the labels set on the objects applied by addon of name and version
+func AddonLabels(name string, version string) map[string]string {
+	return map[string]string{
+		constants.AddonNameLabel:    name,
+		constants.AddonVersionLabel: version,
+	}
+}
+
+func addonSelector(name string) map[string]string {
+	return map[string]string{constants.AddonNameLabel: name}
+}
+
+// sharedObjects returns the objects applied by installed addons other than name, they are never pruned by name
+func sharedObjects(installed map[string]InstalledAddon, name string) []kube.ObjectReference {
+	ret := make([]kube.ObjectReference, 0)
+	for other, info := range installed {
+		if other != name {
+			ret = append(ret, info.Objects...)
+		}
+	}
+	return ret
+}
+
+// Install applies addon with params and records it, dependencies are not checked.
+// Objects applied by the previous installation but removed from the manifest are pruned.
+func (m *Manager) Install(a *Addon, params Parameters) error {
+	manifest, err := a.Render(m.cfg, params)
+	if err != nil {
+		return err
+	}
+	installed, err := GetInstalledAddons(m.client)
+	if err != nil {
+		return err
+	}
+	version := a.VersionOf(params)
+	objects, err := m.applier.Apply(manifest, AddonLabels(a.Name, version))
+	if err != nil {
+		return errors.Wrapf(err, "apply addon %s", a.Name)
+	}
+	candidates := append(installed[a.Name].Objects, objects...)
+	keep := append(sharedObjects(installed, a.Name), objects...)
+	if err := m.applier.Prune(addonSelector(a.Name), candidates, keep); err != nil {
+		return errors.Wrapf(err, "prune addon %s", a.Name)
+	}
+	if m.RolloutTimeout > 0 {
+		if err := m.applier.WaitRollout(objects, m.RolloutTimeout); err != nil {
+			return errors.Wrapf(err, "addon %s", a.Name)
+		}
+	}
+	if err := RecordInstalledAddon(m.client, a.Name, InstalledAddon{
+		Version:     version,
+		Parameters:  params,
+		InstalledAt: time.Now(),
+		Objects:     objects,
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "[addon] Applied addon %s %s\n", a.Name, a.VersionOf(params))
+	return nil
+}
+
+// Enable installs the addon of name after its dependencies are installed
+func (m *Manager) Enable(name string, overrides Parameters) error {
+	a, err := m.registry.Get(name)
+	if err != nil {
+		return err
+	}
+	installed, err := GetInstalledAddons(m.client)
+	if err != nil {
+		return err
+	}
+	if info, ok := installed[name]; ok {
+		return errors.Errorf("addon %s %s is already installed, use upgrade to change it", name, info.Version)
+	}
+	for _, dep := range a.Dependencies {
+		if _, ok := installed[dep]; !ok {
+			return errors.Errorf("addon %s depends on %s which isn't installed, enable it first", name, dep)
+		}
+	}
+	params, err := a.ResolveParameters(m.cfg, overrides)
+	if err != nil {
+		return err
+	}
+	return m.Install(a, params)
+}
+
+// Upgrade re-applies the installed addon of name with its recorded parameters merged with overrides
+func (m *Manager) Upgrade(name string, overrides Parameters) error {
+	a, err := m.registry.Get(name)
+	if err != nil {
+		return err
+	}
+	installed, err := GetInstalledAddons(m.client)
+	if err != nil {
+		return err
+	}
+	info, ok := installed[name]
+	if !ok {
+		return errors.Errorf("addon %s isn't installed, use enable to install it", name)
+	}
+	merged := Parameters{}
+	for k, v := range info.Parameters {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	// drop the recorded version, so the addon is upgraded to the default version unless a new one is given
+	if _, ok := overrides[VersionParameter]; !ok {
+		delete(merged, VersionParameter)
+	}
+	params, err := a.ResolveParameters(m.cfg, merged)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "[addon] Upgrading addon %s from %s to %s\n", name, info.Version, a.VersionOf(params))
+	return m.Install(a, params)
+}
+
+// Disable deletes the resources of installed addon name, it fails if any installed addon depends on it
+func (m *Manager) Disable(name string) error {
+	a, err := m.registry.Get(name)
+	if err != nil {
+		return err
+	}
+	installed, err := GetInstalledAddons(m.client)
+	if err != nil {
+		return err
+	}
+	info, ok := installed[name]
+	if !ok {
+		return errors.Errorf("addon %s isn't installed", name)
+	}
+	for _, dependent := range m.registry.Dependents(name) {
+		if _, ok := installed[dependent]; ok {
+			return errors.Errorf("addon %s is required by installed addon %s, disable it first", name, dependent)
+		}
+	}
+	manifest, err := a.Render(m.cfg, info.Parameters)
+	if err != nil {
+		return err
+	}
+	objs, err := kube.ParseManifest(manifest)
+	if err != nil {
+		return errors.Wrapf(err, "parse addon %s manifest", name)
+	}
+	refs := append([]kube.ObjectReference{}, info.Objects...)
+	for _, obj := range objs {
+		refs = append(refs, kube.NewObjectReference(obj))
+	}
+	if err := m.applier.Prune(addonSelector(name), refs, sharedObjects(installed, name)); err != nil {
+		return errors.Wrapf(err, "delete addon %s", name)
+	}
+	if err := RemoveInstalledAddon(m.client, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "[addon] Deleted addon %s\n", name)
+	return nil
+}
@@ -0,0 +1,125 @@
+package addons
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/kube"
+)
+
+var (
+	configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+type manifestConfiger struct {
+	fakeConfiger
+	manifest string
+}
+
+func (c manifestConfiger) GenerateYAML() (string, error) { return c.manifest, nil }
+
+func newManifestAddon(name string, manifest string) *Addon {
+	a := newFakeAddon(name)
+	a.NewConfiger = func(*apiv1.InitConfiguration, Parameters) ImagesConfiger {
+		return manifestConfiger{fakeConfiger: fakeConfiger{name: name}, manifest: manifest}
+	}
+	return a
+}
+
+func newFakeManager(registry *Registry) (*Manager, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	// the fake client doesn't support apply patches, reject them as old apiservers do
+	dynamicClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.PatchAction).GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", schema.GroupResource{}, "", "", 0, false)
+	})
+	applier := kube.NewApplier(dynamicClient, mapper, "test")
+	return NewManager(registry, &apiv1.InitConfiguration{}, fake.NewSimpleClientset(), applier, ioutil.Discard), dynamicClient
+}
+
+func TestManagerDisableKeepsSharedObjects(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(newManifestAddon("loki", `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: monitor
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: loki
+  namespace: monitor
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  namespace: monitor
+`))
+	registry.Register(newManifestAddon("grafana", `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: monitor
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: grafana
+  namespace: monitor
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  namespace: monitor
+`))
+	m, client := newFakeManager(registry)
+	for _, name := range []string{"loki", "grafana"} {
+		if err := m.Enable(name, nil); err != nil {
+			t.Fatalf("Enable(%s) error = %v", name, err)
+		}
+	}
+	if err := m.Disable("grafana"); err != nil {
+		t.Fatalf("Disable(grafana) error = %v", err)
+	}
+
+	if _, err := client.Resource(namespacesGVR).Get("monitor", metav1.GetOptions{}); err != nil {
+		t.Errorf("Namespace monitor shouldn't be deleted: %v", err)
+	}
+	for name, want := range map[string]bool{"grafana": false, "loki": true, "shared": true} {
+		_, err := client.Resource(configMapsGVR).Namespace("monitor").Get(name, metav1.GetOptions{})
+		if exists := err == nil; exists != want {
+			t.Errorf("ConfigMap %s exists = %v, want %v, error: %v", name, exists, want, err)
+		}
+	}
+
+	if err := m.Disable("loki"); err != nil {
+		t.Fatalf("Disable(loki) error = %v", err)
+	}
+	if _, err := client.Resource(namespacesGVR).Get("monitor", metav1.GetOptions{}); err != nil {
+		t.Errorf("Namespace monitor shouldn't be deleted by the last addon: %v", err)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("monitor").Get("loki", metav1.GetOptions{}); err == nil {
+		t.Errorf("ConfigMap loki should be deleted")
+	}
+}
@@ -6,10 +6,23 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "metrics-server",
+		Description:  "Kubernetes resource metrics server",
+		Version:      constants.MetricsServerVersion,
+		Dependencies: []string{"calico"},
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewMetricsServerConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type MetricsServerConfig struct {
 	Image string
 	Arch  string
@@ -29,6 +42,10 @@ func (c MetricsServerConfig) Name() string {
 	return "metrics-server"
 }
 
+func (c MetricsServerConfig) Images() []string {
+	return []string{c.Image}
+}
+
 func (c MetricsServerConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(MetricsServerTemplate, c)
 }
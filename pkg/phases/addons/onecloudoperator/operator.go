@@ -4,7 +4,7 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
-
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
@@ -13,6 +13,24 @@ var (
 	DefaultOperatorVersion = constants.DefaultOperatorVersion
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "onecloud-operator",
+		Description:  "Onecloud operator managing onecloud services",
+		Version:      DefaultOperatorVersion,
+		Dependencies: []string{"calico"},
+		Parameters: []addons.Parameter{
+			{Name: addons.VersionParameter, Description: "version of onecloud operator"},
+		},
+		DefaultParameters: func(cfg *apiv1.InitConfiguration) addons.Parameters {
+			return addons.Parameters{addons.VersionParameter: cfg.OperatorVersion}
+		},
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewOperatorConfig(&cfg.InitConfiguration.ClusterConfiguration, params[addons.VersionParameter]).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type OperatorConfig struct {
 	Image     string
 	Namespace string
@@ -34,6 +52,10 @@ func (c OperatorConfig) Name() string {
 	return "onecloud-operator"
 }
 
+func (c OperatorConfig) Images() []string {
+	return []string{c.Image}
+}
+
 func (c OperatorConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(OperatorTemplate, c)
 }
@@ -0,0 +1,224 @@
+package addons
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+// VersionParameter is the parameter overriding the version of addon
+const VersionParameter = "version"
+
+// ImagesConfiger is a Configer declaring the images used by its manifest
+type ImagesConfiger interface {
+	Configer
+	Images() []string
+}
+
+// Parameters are the key value options of an addon
+type Parameters map[string]string
+
+// ParseParameters parses parameters in format of key=value
+func ParseParameters(kvs []string) (Parameters, error) {
+	params := Parameters{}
+	for _, kv := range kvs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, errors.Errorf("invalid parameter %q, must be in format of key=value", kv)
+		}
+		params[parts[0]] = parts[1]
+	}
+	return params, nil
+}
+
+// Parameter describes a parameter accepted by addon
+type Parameter struct {
+	Name        string
+	Description string
+	// Validate checks the value set by user, optional
+	Validate func(value string) error
+}
+
+// Addon describes an addon which can be installed to cluster
+type Addon struct {
+	Name        string
+	Description string
+	// Version is the version installed when VersionParameter isn't set
+	Version string
+	// Dependencies are the addons must be installed before this one
+	Dependencies []string
+	// Parameters are the parameters accepted by NewConfiger
+	Parameters []Parameter
+	// DefaultParameters returns the parameters derived from cluster configuration, optional
+	DefaultParameters func(cfg *apiv1.InitConfiguration) Parameters
+	// NewConfiger returns the configer rendering addon manifest
+	NewConfiger func(cfg *apiv1.InitConfiguration, params Parameters) ImagesConfiger
+	// Optional addons are not installed by init
+	Optional bool
+}
+
+// ResolveParameters merges overrides into the default parameters of cfg
+func (a *Addon) ResolveParameters(cfg *apiv1.InitConfiguration, overrides Parameters) (Parameters, error) {
+	params := Parameters{}
+	if a.DefaultParameters != nil {
+		for k, v := range a.DefaultParameters(cfg) {
+			params[k] = v
+		}
+	}
+	for k, v := range overrides {
+		p := a.parameter(k)
+		if p == nil {
+			return nil, errors.Errorf("addon %s doesn't accept parameter %q, supported: %v", a.Name, k, a.parameterNames())
+		}
+		if p.Validate != nil {
+			if err := p.Validate(v); err != nil {
+				return nil, errors.Wrapf(err, "invalid parameter %s=%q of addon %s", k, v, a.Name)
+			}
+		}
+		params[k] = v
+	}
+	return params, nil
+}
+
+// VersionOf returns the version installed with params
+func (a *Addon) VersionOf(params Parameters) string {
+	if v := params[VersionParameter]; len(v) != 0 {
+		return v
+	}
+	return a.Version
+}
+
+// Render returns the manifest of addon with params
+func (a *Addon) Render(cfg *apiv1.InitConfiguration, params Parameters) (string, error) {
+	manifest, err := a.NewConfiger(cfg, params).GenerateYAML()
+	if err != nil {
+		return "", errors.Wrapf(err, "render addon %s", a.Name)
+	}
+	return manifest, nil
+}
+
+// Images returns the images used by addon with params
+func (a *Addon) Images(cfg *apiv1.InitConfiguration, params Parameters) []string {
+	return a.NewConfiger(cfg, params).Images()
+}
+
+func (a *Addon) parameter(name string) *Parameter {
+	for i := range a.Parameters {
+		if a.Parameters[i].Name == name {
+			return &a.Parameters[i]
+		}
+	}
+	return nil
+}
+
+func (a *Addon) parameterNames() []string {
+	names := make([]string, 0, len(a.Parameters))
+	for _, p := range a.Parameters {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Registry holds the known addons by name
+type Registry struct {
+	addons map[string]*Addon
+}
+
+func NewRegistry() *Registry {
+	return &Registry{addons: make(map[string]*Addon)}
+}
+
+// Register adds addon to registry, it panics if the name is registered twice
+func (r *Registry) Register(a *Addon) {
+	if _, ok := r.addons[a.Name]; ok {
+		panic(fmt.Sprintf("addon %s is already registered", a.Name))
+	}
+	r.addons[a.Name] = a
+}
+
+// Get returns the addon of name
+func (r *Registry) Get(name string) (*Addon, error) {
+	a, ok := r.addons[name]
+	if !ok {
+		return nil, errors.Errorf("unknown addon %q, supported: %v", name, r.names())
+	}
+	return a, nil
+}
+
+// List returns all the addons ordered by dependencies, then by name
+func (r *Registry) List() ([]*Addon, error) {
+	names := r.names()
+	ret := make([]*Addon, 0, len(names))
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var visit func(name string, from string) error
+	visit = func(name string, from string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return errors.Errorf("addon %s has circular dependency on %s", from, name)
+		}
+		a, ok := r.addons[name]
+		if !ok {
+			return errors.Errorf("addon %s depends on unknown addon %s", from, name)
+		}
+		visiting[name] = true
+		deps := append([]string{}, a.Dependencies...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		ret = append(ret, a)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Dependents returns the names of addons directly depending on name
+func (r *Registry) Dependents(name string) []string {
+	ret := []string{}
+	for _, a := range r.addons {
+		for _, dep := range a.Dependencies {
+			if dep == name {
+				ret = append(ret, a.Name)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.addons))
+	for name := range r.addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry addon packages register to
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register adds addon to the default registry, it's called by addon packages on init
+func Register(a *Addon) {
+	defaultRegistry.Register(a)
+}
@@ -0,0 +1,132 @@
+package addons
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+type fakeConfiger struct {
+	name string
+}
+
+func (c fakeConfiger) Name() string                  { return c.name }
+func (c fakeConfiger) GenerateYAML() (string, error) { return "", nil }
+func (c fakeConfiger) Images() []string              { return nil }
+
+func newFakeAddon(name string, deps ...string) *Addon {
+	return &Addon{
+		Name:         name,
+		Version:      "v1.0.0",
+		Dependencies: deps,
+		Parameters:   []Parameter{{Name: VersionParameter}, {Name: "replicas"}},
+		DefaultParameters: func(*apiv1.InitConfiguration) Parameters {
+			return Parameters{"replicas": "1"}
+		},
+		NewConfiger: func(*apiv1.InitConfiguration, Parameters) ImagesConfiger {
+			return fakeConfiger{name: name}
+		},
+	}
+}
+
+func TestRegistryList(t *testing.T) {
+	tests := []struct {
+		name    string
+		addons  []*Addon
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "ordered by dependencies then name",
+			addons: []*Addon{newFakeAddon("grafana", "csi", "traefik"), newFakeAddon("traefik", "calico"), newFakeAddon("csi", "calico"), newFakeAddon("calico")},
+			want:   []string{"calico", "csi", "traefik", "grafana"},
+		},
+		{
+			name:    "unknown dependency",
+			addons:  []*Addon{newFakeAddon("csi", "calico")},
+			wantErr: true,
+		},
+		{
+			name:    "circular dependency",
+			addons:  []*Addon{newFakeAddon("a", "b"), newFakeAddon("b", "a")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for _, a := range tt.addons {
+				r.Register(a)
+			}
+			list, err := r.List()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := []string{}
+			for _, a := range list {
+				got = append(got, a.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddonResolveParameters(t *testing.T) {
+	a := newFakeAddon("traefik")
+	params, err := a.ResolveParameters(nil, Parameters{VersionParameter: "v2.0.0"})
+	if err != nil {
+		t.Fatalf("ResolveParameters() error = %v", err)
+	}
+	want := Parameters{"replicas": "1", VersionParameter: "v2.0.0"}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("ResolveParameters() = %v, want %v", params, want)
+	}
+	if v := a.VersionOf(params); v != "v2.0.0" {
+		t.Errorf("VersionOf() = %s, want v2.0.0", v)
+	}
+	if _, err := a.ResolveParameters(nil, Parameters{"unknown": "1"}); err == nil {
+		t.Errorf("ResolveParameters() with unknown parameter should fail")
+	}
+}
+
+func TestManagerDependencies(t *testing.T) {
+	r := NewRegistry()
+	r.Register(newFakeAddon("calico"))
+	r.Register(newFakeAddon("csi", "calico"))
+	client := fake.NewSimpleClientset()
+	m := NewManager(r, &apiv1.InitConfiguration{}, client, nil, nil)
+
+	if err := m.Enable("csi", nil); err == nil {
+		t.Errorf("Enable(csi) without calico installed should fail")
+	}
+	for _, name := range []string{"calico", "csi"} {
+		if err := RecordInstalledAddon(client, name, InstalledAddon{Version: "v1.0.0"}); err != nil {
+			t.Fatalf("RecordInstalledAddon(%s) error = %v", name, err)
+		}
+	}
+	if err := m.Disable("calico"); err == nil {
+		t.Errorf("Disable(calico) with csi installed should fail")
+	}
+	if err := m.Enable("csi", nil); err == nil {
+		t.Errorf("Enable(csi) already installed should fail")
+	}
+
+	if err := RemoveInstalledAddon(client, "csi"); err != nil {
+		t.Fatalf("RemoveInstalledAddon(csi) error = %v", err)
+	}
+	installed, err := GetInstalledAddons(client)
+	if err != nil {
+		t.Fatalf("GetInstalledAddons() error = %v", err)
+	}
+	if _, ok := installed["csi"]; ok || len(installed) != 1 {
+		t.Errorf("GetInstalledAddons() = %v, want only calico", installed)
+	}
+}
@@ -0,0 +1,93 @@
+package addons
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/kube"
+)
+
+// InstalledAddon is the record of an addon installed to cluster,
+// it's stored as json under the addon name key of the ocadm-addons ConfigMap
+type InstalledAddon struct {
+	Version     string     `json:"version"`
+	Parameters  Parameters `json:"parameters,omitempty"`
+	InstalledAt time.Time  `json:"installedAt"`
+	// Objects are the objects applied by the addon, the kinds of them are checked when pruning
+	Objects []kube.ObjectReference `json:"objects,omitempty"`
+}
+
+// GetInstalledAddons returns the installed addons recorded in cluster by name
+func GetInstalledAddons(client clientset.Interface) (map[string]InstalledAddon, error) {
+	ret := make(map[string]InstalledAddon)
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(constants.OnecloudAddonsConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ret, nil
+		}
+		return nil, errors.Wrapf(err, "get %s ConfigMap", constants.OnecloudAddonsConfigMap)
+	}
+	for name, data := range cm.Data {
+		installed := InstalledAddon{}
+		if err := json.Unmarshal([]byte(data), &installed); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal installed addon %s", name)
+		}
+		ret[name] = installed
+	}
+	return ret, nil
+}
+
+// RecordInstalledAddon records the addon of name is installed with info
+func RecordInstalledAddon(client clientset.Interface, name string, info InstalledAddon) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrapf(err, "marshal installed addon %s", name)
+	}
+	return updateAddonsConfigMap(client, func(cm *v1.ConfigMap) {
+		cm.Data[name] = string(data)
+	})
+}
+
+// RemoveInstalledAddon removes the record of addon name
+func RemoveInstalledAddon(client clientset.Interface, name string) error {
+	return updateAddonsConfigMap(client, func(cm *v1.ConfigMap) {
+		delete(cm.Data, name)
+	})
+}
+
+func updateAddonsConfigMap(client clientset.Interface, mutate func(*v1.ConfigMap)) error {
+	cms := client.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	cm, err := cms.Get(constants.OnecloudAddonsConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "get %s ConfigMap", constants.OnecloudAddonsConfigMap)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      constants.OnecloudAddonsConfigMap,
+				Namespace: metav1.NamespaceSystem,
+			},
+			Data: make(map[string]string),
+		}
+		mutate(cm)
+		if _, err := cms.Create(cm); err != nil {
+			return errors.Wrapf(err, "create %s ConfigMap", constants.OnecloudAddonsConfigMap)
+		}
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	mutate(cm)
+	if _, err := cms.Update(cm); err != nil {
+		return errors.Wrapf(err, "update %s ConfigMap", constants.OnecloudAddonsConfigMap)
+	}
+	return nil
+}
@@ -4,10 +4,23 @@ import (
 	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 )
 
+func init() {
+	addons.Register(&addons.Addon{
+		Name:         "traefik",
+		Description:  "Traefik ingress controller",
+		Version:      constants.DefaultTraefikVersion,
+		Dependencies: []string{"calico"},
+		NewConfiger: func(cfg *apiv1.InitConfiguration, params addons.Parameters) addons.ImagesConfiger {
+			return NewTraefikConfig(&cfg.InitConfiguration.ClusterConfiguration).(addons.ImagesConfiger)
+		},
+	})
+}
+
 type TraefikConfig struct {
 	Image string
 }
@@ -22,6 +35,10 @@ func (c TraefikConfig) Name() string {
 	return "traefik"
 }
 
+func (c TraefikConfig) Images() []string {
+	return []string{c.Image}
+}
+
 func (c TraefikConfig) GenerateYAML() (string, error) {
 	return addons.CompileTemplateFromMap(TraefikTemplate, c)
 }
@@ -0,0 +1,542 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+
+	ocadmscheme "yunion.io/x/ocadm/pkg/apis/scheme"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/nodelabels"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+	"yunion.io/x/ocadm/pkg/util/ssh"
+)
+
+var (
+	adminKubeConfigPath   = kubeadmconstants.GetAdminKubeConfigPath()
+	kubeletKubeConfigPath = fmt.Sprintf("%s/%s", kubeadmconstants.KubernetesDir, kubeadmconstants.KubeletKubeConfigFileName)
+)
+
+// NewPreflightPhase checks all the nodes are reachable and have ocadm installed
+func NewPreflightPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:         "preflight",
+		Short:        "Check all nodes are reachable through ssh and have ocadm installed",
+		Run:          runPreflight,
+		InheritFlags: getApplyPhaseFlags(),
+	}
+}
+
+// NewInitPhase runs `ocadm init` on the first control plane node
+func NewInitPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:         "init",
+		Short:        "Run ocadm init on the first control plane node",
+		Run:          runInit,
+		InheritFlags: getApplyPhaseFlags(),
+	}
+}
+
+// NewClusterPhase creates the default onecloud cluster
+func NewClusterPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:         "cluster",
+		Short:        "Create onecloud cluster on the first control plane node",
+		Run:          runCreateCluster,
+		InheritFlags: getApplyPhaseFlags(),
+		RunIf: func(c workflow.RunData) (bool, error) {
+			data, err := getData(c, "cluster")
+			if err != nil {
+				return false, err
+			}
+			return data.Inventory().Cluster.CreateCluster, nil
+		},
+	}
+}
+
+// NewJoinInfoPhase creates bootstrap token and uploads certificates for joining nodes
+func NewJoinInfoPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:         "join-info",
+		Short:        "Create bootstrap token and certificate key used by joining nodes",
+		Run:          runJoinInfo,
+		InheritFlags: getApplyPhaseFlags(),
+	}
+}
+
+// NewJoinPhase joins control plane nodes then worker nodes
+func NewJoinPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "join",
+		Short: "Run ocadm join on the other nodes",
+		Phases: []workflow.Phase{
+			{
+				Name:           "all",
+				Short:          "Join all the nodes",
+				RunAllSiblings: true,
+				InheritFlags:   getApplyPhaseFlags(),
+			},
+			{
+				Name:         "control-plane",
+				Short:        "Join the other control plane nodes",
+				Run:          runJoinControlPlane,
+				InheritFlags: getApplyPhaseFlags(),
+			},
+			{
+				Name:         "node",
+				Short:        "Join the worker nodes",
+				Run:          runJoinNode,
+				InheritFlags: getApplyPhaseFlags(),
+			},
+		},
+	}
+}
+
+// NewLabelsPhase sets onecloud labels of nodes according to their roles
+func NewLabelsPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:         "labels",
+		Short:        "Set onecloud node labels according to roles",
+		Run:          runLabels,
+		InheritFlags: getApplyPhaseFlags(),
+	}
+}
+
+func getApplyPhaseFlags() []string {
+	return []string{
+		options.InventoryFile,
+	}
+}
+
+func getData(c workflow.RunData, phase string) (ApplyData, error) {
+	data, ok := c.(ApplyData)
+	if !ok {
+		return nil, errors.Errorf("%s phase invoked with an invalid data struct", phase)
+	}
+	return data, nil
+}
+
+func runPreflight(c workflow.RunData) error {
+	data, err := getData(c, "preflight")
+	if err != nil {
+		return err
+	}
+	inv := data.Inventory()
+	progress := data.Progress()
+	for i := range inv.Nodes {
+		node := &inv.Nodes[i]
+		exec, err := data.Executor(node)
+		if err != nil {
+			return progress.Fail(node, err)
+		}
+		if _, err := exec.Run("ocadm version"); err != nil {
+			return progress.Fail(node, errors.Wrap(err, "ocadm is not installed"))
+		}
+		if err := ensureNodeName(exec, node); err != nil {
+			return progress.Fail(node, err)
+		}
+		progress.Update(node, NodeStatusConnected, "node name %s, roles %s", node.Name, strings.Join(node.Roles, ","))
+	}
+	return nil
+}
+
+func runInit(c workflow.RunData) error {
+	data, err := getData(c, "init")
+	if err != nil {
+		return err
+	}
+	inv := data.Inventory()
+	node := inv.InitNode()
+	progress := data.Progress()
+	exec, err := data.Executor(node)
+	if err != nil {
+		return progress.Fail(node, err)
+	}
+	exists, err := fileExists(exec, adminKubeConfigPath)
+	if err != nil {
+		return progress.Fail(node, err)
+	}
+	if exists {
+		progress.Update(node, NodeStatusInitialized, "%s exists, skip init", adminKubeConfigPath)
+		return nil
+	}
+	progress.Infof(node, "running ocadm init")
+	if err := initNode(exec, inv, node); err != nil {
+		return progress.Fail(node, errors.Wrap(err, "ocadm init"))
+	}
+	progress.Update(node, NodeStatusInitialized, "control plane initialized")
+	return nil
+}
+
+func runCreateCluster(c workflow.RunData) error {
+	data, err := getData(c, "cluster")
+	if err != nil {
+		return err
+	}
+	inv := data.Inventory()
+	node := inv.InitNode()
+	progress := data.Progress()
+	exec, err := data.Executor(node)
+	if err != nil {
+		return progress.Fail(node, err)
+	}
+	args := []string{"ocadm", "cluster", "create", "--wait"}
+	if inv.Cluster.UseEE {
+		args = append(args, "--use-ee")
+	}
+	if inv.Cluster.OnecloudVersion != "" {
+		args = append(args, "--version", inv.Cluster.OnecloudVersion)
+	}
+	progress.Infof(node, "creating onecloud cluster")
+	if _, err := exec.Run(ssh.QuoteArgs(args)); err != nil {
+		return progress.Fail(node, errors.Wrap(err, "create onecloud cluster"))
+	}
+	progress.Infof(node, "onecloud cluster created")
+	return nil
+}
+
+func runJoinInfo(c workflow.RunData) error {
+	data, err := getData(c, "join-info")
+	if err != nil {
+		return err
+	}
+	if len(data.Inventory().Nodes) == 1 {
+		return nil
+	}
+	_, err = getJoinInfo(data)
+	return err
+}
+
+// getJoinInfo returns the join information, which is created on the first call
+func getJoinInfo(data ApplyData) (*JoinInfo, error) {
+	if info := data.JoinInfo(); info != nil {
+		return info, nil
+	}
+	inv := data.Inventory()
+	node := inv.InitNode()
+	progress := data.Progress()
+	exec, err := data.Executor(node)
+	if err != nil {
+		return nil, progress.Fail(node, err)
+	}
+	out, err := exec.Run("ocadm token create --print-join-command")
+	if err != nil {
+		return nil, progress.Fail(node, errors.Wrap(err, "create bootstrap token"))
+	}
+	info, err := ParseJoinCommand(out)
+	if err != nil {
+		return nil, progress.Fail(node, err)
+	}
+	if len(controlPlaneJoinNodes(inv)) != 0 {
+		out, err := exec.Run("ocadm init phase upload-certs")
+		if err != nil {
+			return nil, progress.Fail(node, errors.Wrap(err, "upload certificates"))
+		}
+		info.CertificateKey, err = ParseCertificateKey(out)
+		if err != nil {
+			return nil, progress.Fail(node, err)
+		}
+	}
+	data.SetJoinInfo(info)
+	progress.Infof(node, "bootstrap token created, control plane endpoint %s", info.Endpoint)
+	return info, nil
+}
+
+func runJoinControlPlane(c workflow.RunData) error {
+	data, err := getData(c, "join")
+	if err != nil {
+		return err
+	}
+	return joinNodes(data, controlPlaneJoinNodes(data.Inventory()), true)
+}
+
+func runJoinNode(c workflow.RunData) error {
+	data, err := getData(c, "join")
+	if err != nil {
+		return err
+	}
+	inv := data.Inventory()
+	nodes := make([]*Node, 0)
+	for i := range inv.Nodes {
+		if !inv.Nodes[i].HasRole(RoleControlPlane) {
+			nodes = append(nodes, &inv.Nodes[i])
+		}
+	}
+	return joinNodes(data, nodes, false)
+}
+
+func joinNodes(data ApplyData, nodes []*Node, controlPlane bool) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	info, err := getJoinInfo(data)
+	if err != nil {
+		return err
+	}
+	progress := data.Progress()
+	for _, node := range nodes {
+		exec, err := data.Executor(node)
+		if err != nil {
+			return progress.Fail(node, err)
+		}
+		exists, err := fileExists(exec, kubeletKubeConfigPath)
+		if err != nil {
+			return progress.Fail(node, err)
+		}
+		if exists {
+			progress.Update(node, NodeStatusJoined, "%s exists, skip join", kubeletKubeConfigPath)
+			continue
+		}
+		progress.Infof(node, "running ocadm join")
+		if _, err := exec.Run(joinCommand(data.Inventory(), node, info, controlPlane)); err != nil {
+			return progress.Fail(node, errors.Wrap(err, "ocadm join"))
+		}
+		progress.Update(node, NodeStatusJoined, "joined to %s", info.Endpoint)
+	}
+	return nil
+}
+
+func runLabels(c workflow.RunData) error {
+	data, err := getData(c, "labels")
+	if err != nil {
+		return err
+	}
+	inv := data.Inventory()
+	initNode := inv.InitNode()
+	progress := data.Progress()
+	exec, err := data.Executor(initNode)
+	if err != nil {
+		return progress.Fail(initNode, err)
+	}
+	for _, label := range []struct {
+		role    string
+		command string
+	}{
+		{RoleControlPlane, "enable-onecloud-controller"},
+		{RoleHostAgent, "enable-host-agent"},
+	} {
+		args := []string{"ocadm", "node", label.command}
+		for i := range inv.Nodes {
+			node := &inv.Nodes[i]
+			if !node.HasRole(label.role) {
+				continue
+			}
+			nodeExec, err := data.Executor(node)
+			if err != nil {
+				return progress.Fail(node, err)
+			}
+			if err := ensureNodeName(nodeExec, node); err != nil {
+				return progress.Fail(node, err)
+			}
+			args = append(args, "--node", node.Name)
+		}
+		if len(args) == 3 {
+			continue
+		}
+		if _, err := exec.Run(ssh.QuoteArgs(args)); err != nil {
+			return progress.Fail(initNode, errors.Wrapf(err, "ocadm node %s", label.command))
+		}
+	}
+	for i := range inv.Nodes {
+		node := &inv.Nodes[i]
+		progress.Update(node, NodeStatusReady, "labels of roles %s set", strings.Join(node.Roles, ","))
+	}
+	return nil
+}
+
+// controlPlaneJoinNodes returns the control plane nodes except the init one
+func controlPlaneJoinNodes(inv *Inventory) []*Node {
+	initNode := inv.InitNode()
+	nodes := make([]*Node, 0)
+	for i := range inv.Nodes {
+		node := &inv.Nodes[i]
+		if node.HasRole(RoleControlPlane) && node.Host != initNode.Host {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// initNode runs `ocadm init` with the configuration uploaded to a temporary file,
+// the file contains the mysql password and is removed whether init succeeds or not
+func initNode(exec Executor, inv *Inventory, node *Node) (err error) {
+	cfg := initConfiguration(inv, node)
+	content, err := configutil.MarshalOcadmConfigObject(cfg)
+	if err != nil {
+		return errors.Wrap(err, "marshal init configuration")
+	}
+	out, err := exec.Run("mktemp /tmp/ocadm-init.XXXXXX")
+	if err != nil {
+		return errors.Wrap(err, "create init configuration file")
+	}
+	cfgPath := strings.TrimSpace(out)
+	defer func() {
+		if _, rmErr := exec.Run(ssh.QuoteArgs([]string{"rm", "-f", cfgPath})); rmErr != nil && err == nil {
+			err = errors.Wrapf(rmErr, "remove init configuration file %s", cfgPath)
+		}
+	}()
+	if err := exec.WriteFile(cfgPath, content); err != nil {
+		return errors.Wrapf(err, "upload init configuration to %s", cfgPath)
+	}
+	_, err = exec.Run(initCommand(inv, cfgPath))
+	return err
+}
+
+// initConfiguration returns the configuration of `ocadm init` on node. Only the kubernetes settings
+// are statically defaulted, the onecloud settings not in inventory are defaulted by ocadm on node.
+func initConfiguration(inv *Inventory, node *Node) *apiv1.InitConfiguration {
+	defaulted := &apiv1.InitConfiguration{}
+	ocadmscheme.Scheme.Default(defaulted)
+	cfg := &apiv1.InitConfiguration{InitConfiguration: defaulted.InitConfiguration}
+	// the node is named as the labels phase does instead of the local hostname
+	cfg.NodeRegistration.Name = node.Name
+
+	cluster := inv.Cluster
+	// the same default as --image-repository, kubeadm defaults it to k8s.gcr.io
+	cfg.ImageRepository = apiv1.DefaultImageRepository
+	if cluster.ImageRepository != "" {
+		cfg.ImageRepository = cluster.ImageRepository
+	}
+	cfg.InitConfiguration.ControlPlaneEndpoint = cluster.ControlPlaneEndpoint
+	cfg.MysqlConnection = apiv1.MysqlConnection{
+		Server:   cluster.Mysql.Host,
+		Port:     cluster.Mysql.Port,
+		Username: cluster.Mysql.User,
+		Password: cluster.Mysql.Password,
+	}
+	cfg.OnecloudVersion = cluster.OnecloudVersion
+	cfg.ClusterConfiguration.OperatorVersion = cluster.OperatorVersion
+	cfg.Region = cluster.Region
+	cfg.HostLocalInfo.Zone = cluster.Zone
+	if node.HasRole(RoleVIP) {
+		cfg.ClusterConfiguration.HighAvailabilityVIP = cluster.HighAvailabilityVIP
+		cfg.ClusterConfiguration.KeepalivedVersionTag = cluster.KeepalivedVersionTag
+	}
+
+	cfg.Node.NodeIP = node.GetNodeIP()
+	nodelabels.ConfigureRoles(&cfg.Node, nodeRoles(node))
+	if cfg.Node.Host.Enabled {
+		cfg.Node.Host.Networks = node.HostNetworks
+	}
+	return cfg
+}
+
+func initCommand(inv *Inventory, cfgPath string) string {
+	args := []string{"ocadm", "init", "--" + options.CfgPath, cfgPath}
+	args = append(args, inv.Cluster.ExtraInitArgs...)
+	return ssh.QuoteArgs(args)
+}
+
+func joinCommand(inv *Inventory, node *Node, info *JoinInfo, controlPlane bool) string {
+	args := []string{
+		"ocadm", "join", info.Endpoint,
+		"--" + options.TokenStr, info.Token,
+	}
+	for _, hash := range info.CACertHashes {
+		args = append(args, "--"+options.TokenDiscoveryCAHash, hash)
+	}
+	if controlPlane {
+		args = append(args, "--"+options.ControlPlane, "--"+options.AsOnecloudController)
+		if info.CertificateKey != "" {
+			args = append(args, "--"+options.CertificateKey, info.CertificateKey)
+		}
+	}
+	args = append(args, "--"+options.NodeIP, node.GetNodeIP())
+	args = append(args, nodeRoleArgs(inv, node)...)
+	args = append(args, inv.Cluster.ExtraJoinArgs...)
+	return ssh.QuoteArgs(args)
+}
+
+// nodeRoleArgs returns the flags of roles of join
+func nodeRoleArgs(inv *Inventory, node *Node) []string {
+	args := make([]string, 0)
+	if node.HasRole(RoleVIP) {
+		args = append(args, "--"+options.HighAvailabilityVIP, inv.Cluster.HighAvailabilityVIP)
+		if inv.Cluster.KeepalivedVersionTag != "" {
+			args = append(args, "--"+options.KeepalivedVersionTag, inv.Cluster.KeepalivedVersionTag)
+		}
+	}
+	return append(args, nodelabels.JoinArgs(nodeRoles(node), node.HostNetworks)...)
+}
+
+// nodeRoles returns the node roles of the inventory roles, the inventory role host-agent is the node role host
+func nodeRoles(node *Node) []string {
+	roles := make([]string, 0, len(node.Roles))
+	for _, r := range node.Roles {
+		if r == RoleHostAgent {
+			r = nodelabels.RoleHost
+		}
+		roles = append(roles, r)
+	}
+	return roles
+}
+
+// ParseJoinCommand parses the output of `ocadm token create --print-join-command`
+func ParseJoinCommand(out string) (*JoinInfo, error) {
+	fields := strings.Fields(strings.Replace(out, "\\", " ", -1))
+	info := new(JoinInfo)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "join":
+			if i+1 < len(fields) && info.Endpoint == "" {
+				info.Endpoint = fields[i+1]
+				i++
+			}
+		case "--" + options.TokenStr:
+			if i+1 < len(fields) {
+				info.Token = fields[i+1]
+				i++
+			}
+		case "--" + options.TokenDiscoveryCAHash:
+			if i+1 < len(fields) {
+				info.CACertHashes = append(info.CACertHashes, fields[i+1])
+				i++
+			}
+		}
+	}
+	if info.Endpoint == "" || info.Token == "" || len(info.CACertHashes) == 0 {
+		return nil, errors.Errorf("invalid join command: %q", strings.TrimSpace(out))
+	}
+	return info, nil
+}
+
+// ParseCertificateKey parses the output of `ocadm init phase upload-certs`
+func ParseCertificateKey(out string) (string, error) {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "Using certificate key:") {
+			continue
+		}
+		for _, next := range lines[i+1:] {
+			if key := strings.TrimSpace(next); key != "" {
+				return key, nil
+			}
+		}
+	}
+	return "", errors.Errorf("certificate key not found in output: %q", strings.TrimSpace(out))
+}
+
+// ensureNodeName sets node name to the hostname of node if not specified
+func ensureNodeName(exec Executor, node *Node) error {
+	if node.Name != "" {
+		return nil
+	}
+	hostname, err := exec.Run("hostname")
+	if err != nil {
+		return errors.Wrap(err, "get hostname")
+	}
+	node.Name = strings.ToLower(strings.TrimSpace(hostname))
+	return nil
+}
+
+func fileExists(exec Executor, path string) (bool, error) {
+	out, err := exec.Run(fmt.Sprintf("test -f %s && echo yes || echo no", ssh.Quote(path)))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "yes", nil
+}
@@ -0,0 +1,480 @@
+package apply
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+const (
+	testPassword       = "test-password"
+	testInitConfigPath = "/tmp/ocadm-init.abc123"
+)
+
+// standInServer is a local ssh server recording the executed commands and the content written to stdin
+type standInServer struct {
+	listener net.Listener
+	handler  func(cmd string) (string, int)
+	hostKey  ssh.PublicKey
+
+	lock     sync.Mutex
+	commands []string
+	stdins   map[string][]byte
+}
+
+func newStandInServer(t *testing.T, ip string, handler func(cmd string) (string, int)) *standInServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) != testPassword {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &standInServer{
+		listener: l,
+		handler:  handler,
+		hostKey:  signer.PublicKey(),
+		stdins:   make(map[string][]byte),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *standInServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range chReqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				cmd := struct{ Command string }{}
+				ssh.Unmarshal(req.Payload, &cmd)
+				req.Reply(true, nil)
+
+				var stdin []byte
+				if strings.Contains(cmd.Command, "cat > ") {
+					stdin, _ = ioutil.ReadAll(ch)
+				}
+				s.lock.Lock()
+				s.commands = append(s.commands, cmd.Command)
+				if stdin != nil {
+					s.stdins[cmd.Command] = stdin
+				}
+				s.lock.Unlock()
+				out, code := s.handler(cmd.Command)
+				ch.Write([]byte(out))
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, uint32(code))
+				ch.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func (s *standInServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// find returns the first recorded command starting with prefix and containing all the substrings
+func (s *standInServer) find(prefix string, substrs ...string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, cmd := range s.commands {
+		if !strings.HasPrefix(cmd, prefix) {
+			continue
+		}
+		matched := true
+		for _, sub := range substrs {
+			if !strings.Contains(cmd, sub) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return cmd
+		}
+	}
+	return ""
+}
+
+// stdin returns the content written to the stdin of the first recorded command starting with prefix
+func (s *standInServer) stdin(prefix string) []byte {
+	cmd := s.find(prefix)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stdins[cmd]
+}
+
+func nodeHandler(hostname string, failJoin bool) func(string) (string, int) {
+	return func(cmd string) (string, int) {
+		switch {
+		case cmd == "hostname":
+			return hostname + "\n", 0
+		case strings.HasPrefix(cmd, "test -f"):
+			return "no\n", 0
+		case strings.HasPrefix(cmd, "mktemp "):
+			return testInitConfigPath + "\n", 0
+		case cmd == "ocadm token create --print-join-command":
+			return "kubeadm join 10.0.0.100:6443 --token abcdef.0123456789abcdef \\\n" +
+				"    --discovery-token-ca-cert-hash sha256:0123 \n", 0
+		case cmd == "ocadm init phase upload-certs":
+			return "[upload-certs] Storing the certificates in Secret \"kubeadm-certs\"\n" +
+				"[upload-certs] Using certificate key:\ncafe0123\n", 0
+		case failJoin && strings.HasPrefix(cmd, "ocadm join"):
+			return "join failed\n", 1
+		}
+		return "", 0
+	}
+}
+
+func newTestRunner(data *Data) *workflow.Runner {
+	runner := workflow.NewRunner()
+	runner.AppendPhase(NewPreflightPhase())
+	runner.AppendPhase(NewInitPhase())
+	runner.AppendPhase(NewClusterPhase())
+	runner.AppendPhase(NewJoinInfoPhase())
+	runner.AppendPhase(NewJoinPhase())
+	runner.AppendPhase(NewLabelsPhase())
+	runner.SetDataInitializer(func(cmd *cobra.Command, args []string) (workflow.RunData, error) {
+		return data, nil
+	})
+	return runner
+}
+
+func newTestInventory(servers []*standInServer, roles [][]string) *Inventory {
+	inv := &Inventory{
+		SSH: SSHConfig{Password: testPassword},
+		Cluster: ClusterConfig{
+			Mysql:               MysqlConfig{Host: "10.0.0.1", Password: "sql-pass"},
+			HighAvailabilityVIP: "10.0.0.100",
+		},
+	}
+	for i, s := range servers {
+		inv.Nodes = append(inv.Nodes, Node{
+			Host:  s.listener.Addr().(*net.TCPAddr).IP.String(),
+			Roles: roles[i],
+			SSH:   &SSHConfig{Port: s.port(), HostKeyFingerprint: ssh.FingerprintSHA256(s.hostKey)},
+		})
+	}
+	inv.SetDefaults()
+	return inv
+}
+
+func TestApply(t *testing.T) {
+	servers := []*standInServer{
+		newStandInServer(t, "127.0.0.1", nodeHandler("node1", false)),
+		newStandInServer(t, "127.0.0.2", nodeHandler("node2", false)),
+		newStandInServer(t, "127.0.0.3", nodeHandler("node3", false)),
+	}
+	for _, s := range servers {
+		defer s.listener.Close()
+	}
+	inv := newTestInventory(servers, [][]string{
+		{RoleControlPlane, RoleVIP},
+		{RoleControlPlane, RoleVIP},
+		{RoleHostAgent, RoleGlance},
+	})
+	inv.Nodes[2].HostNetworks = []string{"eth0/br0/10.0.0.13"}
+	if err := inv.Validate(); err != nil {
+		t.Fatalf("validate inventory: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	data := NewData(inv, out, SSHDialer)
+	defer data.Close()
+	runner := newTestRunner(data)
+	if _, err := runner.InitData(nil); err != nil {
+		t.Fatalf("init data: %v", err)
+	}
+	if err := runner.Run(nil); err != nil {
+		t.Fatalf("apply: %v\n%s", err, out.String())
+	}
+
+	for _, c := range []struct {
+		server   *standInServer
+		prefix   string
+		contains []string
+		excludes []string
+	}{
+		{
+			server:   servers[0],
+			prefix:   "ocadm init ",
+			contains: []string{"--config " + testInitConfigPath},
+		},
+		{
+			server:   servers[0],
+			prefix:   "rm -f ",
+			contains: []string{testInitConfigPath},
+		},
+		{
+			server:   servers[1],
+			prefix:   "ocadm join ",
+			contains: []string{"10.0.0.100:6443", "--token abcdef.0123456789abcdef", "--discovery-token-ca-cert-hash sha256:0123", "--control-plane", "--certificate-key cafe0123", "--high-availability-vip 10.0.0.100"},
+		},
+		{
+			server:   servers[2],
+			prefix:   "ocadm join ",
+			contains: []string{"--enable-host-agent", "--host-networks eth0/br0/10.0.0.13", "--glance-node"},
+			excludes: []string{"--control-plane", "--certificate-key", "--high-availability-vip"},
+		},
+		{
+			server:   servers[0],
+			prefix:   "ocadm node enable-host-agent",
+			contains: []string{"--node node3"},
+		},
+		{
+			server:   servers[0],
+			prefix:   "ocadm node enable-onecloud-controller",
+			contains: []string{"--node node1", "--node node2"},
+		},
+	} {
+		cmd := c.server.find(c.prefix)
+		if cmd == "" {
+			t.Errorf("command %q not executed", c.prefix)
+			continue
+		}
+		for _, s := range c.contains {
+			if !strings.Contains(cmd, s) {
+				t.Errorf("command %q should contain %q", cmd, s)
+			}
+		}
+		for _, s := range c.excludes {
+			if strings.Contains(cmd, s) {
+				t.Errorf("command %q should not contain %q", cmd, s)
+			}
+		}
+	}
+	if cmd := servers[1].find("ocadm init "); cmd != "" {
+		t.Errorf("init should only run on the first control plane node, got %q", cmd)
+	}
+	for _, s := range servers {
+		if cmd := s.find("", "sql-pass"); cmd != "" {
+			t.Errorf("mysql password should not be in command line, got %q", cmd)
+		}
+	}
+	checkInitConfiguration(t, servers[0].stdin("umask 077 && cat > "))
+	for i := range inv.Nodes {
+		if status := data.Progress().Status(&inv.Nodes[i]); status != NodeStatusReady {
+			t.Errorf("node %s status %s, expected %s", inv.Nodes[i].Host, status, NodeStatusReady)
+		}
+	}
+}
+
+func checkInitConfiguration(t *testing.T, content []byte) {
+	if len(content) == 0 {
+		t.Fatalf("init configuration is not uploaded")
+	}
+	cfg, err := configutil.BytesToInitConfiguration(content)
+	if err != nil {
+		t.Fatalf("load uploaded init configuration: %v\n%s", err, content)
+	}
+	mysql := apiv1.MysqlConnection{Server: "10.0.0.1", Port: 3306, Username: "root", Password: "sql-pass"}
+	if got := cfg.MysqlConnection; got.Server != mysql.Server || got.Port != mysql.Port || got.Username != mysql.Username || got.Password != mysql.Password {
+		t.Errorf("mysql connection %#v, want %#v", got, mysql)
+	}
+	for _, c := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"node name", cfg.NodeRegistration.Name, "node1"},
+		{"node ip", cfg.Node.NodeIP, "127.0.0.1"},
+		{"control plane endpoint", cfg.InitConfiguration.ControlPlaneEndpoint, "10.0.0.100:6443"},
+		{"high availability vip", cfg.ClusterConfiguration.HighAvailabilityVIP, "10.0.0.100"},
+		{"image repository", cfg.ImageRepository, apiv1.DefaultImageRepository},
+		{"kubernetes version", cfg.KubernetesVersion, apiv1.DefaultKubernetesVersion},
+		{"onecloud version", cfg.OnecloudVersion, apiv1.DefaultOnecloudVersion},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s of init configuration is %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if cfg.Node.Host.Enabled {
+		t.Errorf("host agent should not be enabled on init node")
+	}
+}
+
+func TestApplyInitFailed(t *testing.T) {
+	handler := nodeHandler("node1", false)
+	server := newStandInServer(t, "127.0.0.1", func(cmd string) (string, int) {
+		if strings.HasPrefix(cmd, "ocadm init ") {
+			return "init failed\n", 1
+		}
+		return handler(cmd)
+	})
+	defer server.listener.Close()
+	inv := newTestInventory([]*standInServer{server}, [][]string{{RoleControlPlane}})
+
+	data := NewData(inv, new(bytes.Buffer), SSHDialer)
+	defer data.Close()
+	runner := newTestRunner(data)
+	if _, err := runner.InitData(nil); err != nil {
+		t.Fatalf("init data: %v", err)
+	}
+	if err := runner.Run(nil); err == nil {
+		t.Fatalf("apply should fail when init failed")
+	}
+	if status := data.Progress().Status(&inv.Nodes[0]); status != NodeStatusFailed {
+		t.Errorf("node %s status %s, expected %s", inv.Nodes[0].Host, status, NodeStatusFailed)
+	}
+	if cmd := server.find("rm -f ", testInitConfigPath); cmd == "" {
+		t.Errorf("init configuration %s should be removed after init failed", testInitConfigPath)
+	}
+}
+
+func TestApplyJoinFailed(t *testing.T) {
+	servers := []*standInServer{
+		newStandInServer(t, "127.0.0.1", nodeHandler("node1", false)),
+		newStandInServer(t, "127.0.0.2", nodeHandler("node2", true)),
+	}
+	for _, s := range servers {
+		defer s.listener.Close()
+	}
+	inv := newTestInventory(servers, [][]string{
+		{RoleControlPlane},
+		{RoleHostAgent},
+	})
+
+	data := NewData(inv, new(bytes.Buffer), SSHDialer)
+	defer data.Close()
+	runner := newTestRunner(data)
+	if _, err := runner.InitData(nil); err != nil {
+		t.Fatalf("init data: %v", err)
+	}
+	if err := runner.Run(nil); err == nil {
+		t.Fatalf("apply should fail when join failed")
+	}
+	if status := data.Progress().Status(&inv.Nodes[0]); status != NodeStatusInitialized {
+		t.Errorf("node %s status %s, expected %s", inv.Nodes[0].Host, status, NodeStatusInitialized)
+	}
+	if status := data.Progress().Status(&inv.Nodes[1]); status != NodeStatusFailed {
+		t.Errorf("node %s status %s, expected %s", inv.Nodes[1].Host, status, NodeStatusFailed)
+	}
+	if cmd := servers[0].find("ocadm node"); cmd != "" {
+		t.Errorf("labels should not be set after join failed, got %q", cmd)
+	}
+}
+
+func TestInventoryValidate(t *testing.T) {
+	base := func() *Inventory {
+		return &Inventory{
+			SSH: SSHConfig{Password: testPassword},
+			Cluster: ClusterConfig{
+				Mysql: MysqlConfig{Host: "10.0.0.1", Password: "sql-pass"},
+			},
+			Nodes: []Node{
+				{Host: "10.0.0.11", Roles: []string{RoleControlPlane}},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		mutate  func(inv *Inventory)
+		wantErr string
+	}{
+		{name: "valid", mutate: func(inv *Inventory) {}},
+		{
+			name:    "unknown role",
+			mutate:  func(inv *Inventory) { inv.Nodes[0].Roles = append(inv.Nodes[0].Roles, "db") },
+			wantErr: `unknown role "db"`,
+		},
+		{
+			name:    "no control plane",
+			mutate:  func(inv *Inventory) { inv.Nodes[0].Roles = []string{RoleHostAgent} },
+			wantErr: "at least one node with role control-plane",
+		},
+		{
+			name:    "vip without address",
+			mutate:  func(inv *Inventory) { inv.Nodes[0].Roles = append(inv.Nodes[0].Roles, RoleVIP) },
+			wantErr: "requires cluster.highAvailabilityVIP",
+		},
+		{
+			name: "multiple control plane without endpoint",
+			mutate: func(inv *Inventory) {
+				inv.Nodes = append(inv.Nodes, Node{Host: "10.0.0.12", Roles: []string{RoleControlPlane}})
+			},
+			wantErr: "cluster.controlPlaneEndpoint",
+		},
+		{
+			name: "duplicated host",
+			mutate: func(inv *Inventory) {
+				inv.Nodes = append(inv.Nodes, Node{Host: "10.0.0.11", Roles: []string{RoleHostAgent}})
+			},
+			wantErr: "is duplicated",
+		},
+		{
+			name:    "no ssh auth",
+			mutate:  func(inv *Inventory) { inv.SSH.Password = "" },
+			wantErr: "ssh password or privateKeyFile is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := base()
+			tt.mutate(inv)
+			inv.SetDefaults()
+			err := inv.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v should contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
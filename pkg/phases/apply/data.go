@@ -0,0 +1,194 @@
+package apply
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/ocadm/pkg/util/ssh"
+)
+
+// Executor runs shell command on a node
+type Executor interface {
+	Run(cmd string) (string, error)
+	// WriteFile writes content to path of node with mode 0600
+	WriteFile(path string, content []byte) error
+	Close() error
+}
+
+// DialFunc connects to node and returns its Executor
+type DialFunc func(config ssh.Config) (Executor, error)
+
+// SSHDialer connects to node through ssh
+func SSHDialer(config ssh.Config) (Executor, error) {
+	return ssh.NewClient(config)
+}
+
+// ApplyData is the interface to use for apply phases.
+type ApplyData interface {
+	Inventory() *Inventory
+	Executor(node *Node) (Executor, error)
+	JoinInfo() *JoinInfo
+	SetJoinInfo(info *JoinInfo)
+	Progress() *Progress
+}
+
+// JoinInfo is the discovery information used by `ocadm join`
+type JoinInfo struct {
+	Endpoint       string
+	Token          string
+	CACertHashes   []string
+	CertificateKey string
+}
+
+var _ ApplyData = &Data{}
+
+// Data is the default ApplyData implementation, executors are cached for each node
+type Data struct {
+	inventory *Inventory
+	dial      DialFunc
+	executors map[string]Executor
+	joinInfo  *JoinInfo
+	progress  *Progress
+}
+
+func NewData(inv *Inventory, out io.Writer, dial DialFunc) *Data {
+	return &Data{
+		inventory: inv,
+		dial:      dial,
+		executors: make(map[string]Executor),
+		progress:  NewProgress(out, inv),
+	}
+}
+
+func (d *Data) Inventory() *Inventory {
+	return d.inventory
+}
+
+func (d *Data) Executor(node *Node) (Executor, error) {
+	if e, ok := d.executors[node.Host]; ok {
+		return e, nil
+	}
+	e, err := d.dial(d.inventory.SSHConfigOf(node))
+	if err != nil {
+		return nil, err
+	}
+	d.executors[node.Host] = e
+	return e, nil
+}
+
+func (d *Data) JoinInfo() *JoinInfo {
+	return d.joinInfo
+}
+
+func (d *Data) SetJoinInfo(info *JoinInfo) {
+	d.joinInfo = info
+}
+
+func (d *Data) Progress() *Progress {
+	return d.progress
+}
+
+// Close closes all the connections to nodes
+func (d *Data) Close() error {
+	errs := make([]string, 0)
+	for host, e := range d.executors {
+		if err := e.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+		}
+	}
+	d.executors = make(map[string]Executor)
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Node status reported by Progress
+const (
+	NodeStatusPending     = "Pending"
+	NodeStatusConnected   = "Connected"
+	NodeStatusInitialized = "Initialized"
+	NodeStatusJoined      = "Joined"
+	NodeStatusReady       = "Ready"
+	NodeStatusFailed      = "Failed"
+)
+
+type nodeProgress struct {
+	node    *Node
+	status  string
+	message string
+}
+
+// Progress reports the status of each node
+type Progress struct {
+	out   io.Writer
+	nodes []*nodeProgress
+}
+
+func NewProgress(out io.Writer, inv *Inventory) *Progress {
+	p := &Progress{out: out}
+	for i := range inv.Nodes {
+		p.nodes = append(p.nodes, &nodeProgress{
+			node:   &inv.Nodes[i],
+			status: NodeStatusPending,
+		})
+	}
+	return p
+}
+
+func (p *Progress) get(node *Node) *nodeProgress {
+	for _, np := range p.nodes {
+		if np.node.Host == node.Host {
+			return np
+		}
+	}
+	np := &nodeProgress{node: node}
+	p.nodes = append(p.nodes, np)
+	return np
+}
+
+// Infof prints the message of node without changing status
+func (p *Progress) Infof(node *Node, format string, args ...interface{}) {
+	fmt.Fprintf(p.out, "[apply] [%s] %s\n", node.Host, fmt.Sprintf(format, args...))
+}
+
+// Update sets the status of node
+func (p *Progress) Update(node *Node, status string, format string, args ...interface{}) {
+	np := p.get(node)
+	np.status = status
+	np.message = fmt.Sprintf(format, args...)
+	p.Infof(node, "%s: %s", status, np.message)
+}
+
+// Fail marks node failed and returns err
+func (p *Progress) Fail(node *Node, err error) error {
+	p.Update(node, NodeStatusFailed, "%v", err)
+	return errors.Wrapf(err, "node %s", node.Host)
+}
+
+// Status returns the current status of node
+func (p *Progress) Status(node *Node) string {
+	return p.get(node).status
+}
+
+// Print writes the summary of all nodes
+func (p *Progress) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tNAME\tROLES\tSTATUS\tMESSAGE")
+	for _, np := range p.nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", np.node.Host, np.node.Name, strings.Join(np.node.Roles, ","), np.status, firstLine(np.message))
+	}
+	w.Flush()
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.Index(s, "\n"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
@@ -0,0 +1,253 @@
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"yunion.io/x/ocadm/pkg/util/ssh"
+)
+
+// Node roles supported in inventory
+const (
+	RoleControlPlane = "control-plane"
+	RoleHostAgent    = "host-agent"
+	RoleGlance       = "glance"
+	RoleBaremetal    = "baremetal"
+	RoleEsxi         = "esxi"
+	// RoleVIP runs keepalived for the high availability VIP on control plane node
+	RoleVIP = "vip"
+)
+
+var validRoles = sets.NewString(RoleControlPlane, RoleHostAgent, RoleGlance, RoleBaremetal, RoleEsxi, RoleVIP)
+
+// SSHConfig is the login config of nodes
+type SSHConfig struct {
+	User           string `json:"user,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	Password       string `json:"password,omitempty"`
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+	Sudo           bool   `json:"sudo,omitempty"`
+	// HostKeyFingerprint is the SHA256 fingerprint of host key, it's usually set per node
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"`
+	// KnownHostsFile verifies host keys if fingerprint isn't set, defaults to ~/.ssh/known_hosts
+	KnownHostsFile string `json:"knownHostsFile,omitempty"`
+	// TrustOnFirstUse records the keys of hosts not in KnownHostsFile instead of failing
+	TrustOnFirstUse bool `json:"trustOnFirstUse,omitempty"`
+}
+
+// merge returns the config overriding c by non empty fields of o
+func (c SSHConfig) merge(o *SSHConfig) SSHConfig {
+	if o == nil {
+		return c
+	}
+	if o.User != "" {
+		c.User = o.User
+	}
+	if o.Port != 0 {
+		c.Port = o.Port
+	}
+	if o.Password != "" {
+		c.Password = o.Password
+	}
+	if o.PrivateKeyFile != "" {
+		c.PrivateKeyFile = o.PrivateKeyFile
+	}
+	if o.Sudo {
+		c.Sudo = o.Sudo
+	}
+	if o.HostKeyFingerprint != "" {
+		c.HostKeyFingerprint = o.HostKeyFingerprint
+	}
+	if o.KnownHostsFile != "" {
+		c.KnownHostsFile = o.KnownHostsFile
+	}
+	if o.TrustOnFirstUse {
+		c.TrustOnFirstUse = o.TrustOnFirstUse
+	}
+	return c
+}
+
+type MysqlConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password"`
+}
+
+// ClusterConfig holds the options passed to `ocadm init` and `ocadm cluster create`
+type ClusterConfig struct {
+	Mysql                MysqlConfig `json:"mysql"`
+	OnecloudVersion      string      `json:"onecloudVersion,omitempty"`
+	OperatorVersion      string      `json:"operatorVersion,omitempty"`
+	ImageRepository      string      `json:"imageRepository,omitempty"`
+	Region               string      `json:"region,omitempty"`
+	Zone                 string      `json:"zone,omitempty"`
+	ControlPlaneEndpoint string      `json:"controlPlaneEndpoint,omitempty"`
+	HighAvailabilityVIP  string      `json:"highAvailabilityVIP,omitempty"`
+	KeepalivedVersionTag string      `json:"keepalivedVersionTag,omitempty"`
+	// CreateCluster runs `ocadm cluster create --wait` after control plane initialized
+	CreateCluster bool `json:"createCluster,omitempty"`
+	UseEE         bool `json:"useEE,omitempty"`
+	// ExtraInitArgs are appended to `ocadm init --config` command line,
+	// only the flags allowed to mix with --config can be used, e.g. --ignore-preflight-errors
+	ExtraInitArgs []string `json:"extraInitArgs,omitempty"`
+	// ExtraJoinArgs are appended to all `ocadm join` command lines
+	ExtraJoinArgs []string `json:"extraJoinArgs,omitempty"`
+}
+
+type Node struct {
+	// Host is the address used to ssh login
+	Host string `json:"host"`
+	// Name is the kubernetes node name, default is the hostname of node
+	Name string `json:"name,omitempty"`
+	// NodeIP is the ip used by kubelet, default is Host
+	NodeIP       string     `json:"nodeIP,omitempty"`
+	Roles        []string   `json:"roles"`
+	HostNetworks []string   `json:"hostNetworks,omitempty"`
+	SSH          *SSHConfig `json:"ssh,omitempty"`
+}
+
+func (n Node) HasRole(role string) bool {
+	for _, r := range n.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (n Node) GetNodeIP() string {
+	if n.NodeIP != "" {
+		return n.NodeIP
+	}
+	return n.Host
+}
+
+// Inventory describes all the nodes of a onecloud cluster
+type Inventory struct {
+	SSH     SSHConfig     `json:"ssh"`
+	Cluster ClusterConfig `json:"cluster"`
+	Nodes   []Node        `json:"nodes"`
+}
+
+// LoadInventory reads and validates inventory file
+func LoadInventory(path string) (*Inventory, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read inventory %s", path)
+	}
+	inv := new(Inventory)
+	if err := yaml.Unmarshal(content, inv); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal inventory %s", path)
+	}
+	inv.SetDefaults()
+	if err := inv.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid inventory %s", path)
+	}
+	return inv, nil
+}
+
+func (inv *Inventory) SetDefaults() {
+	if inv.SSH.User == "" {
+		inv.SSH.User = ssh.DefaultUser
+	}
+	if inv.SSH.Port == 0 {
+		inv.SSH.Port = ssh.DefaultPort
+	}
+	if inv.Cluster.Mysql.Port == 0 {
+		inv.Cluster.Mysql.Port = 3306
+	}
+	if inv.Cluster.Mysql.User == "" {
+		inv.Cluster.Mysql.User = "root"
+	}
+	if inv.Cluster.ControlPlaneEndpoint == "" && inv.Cluster.HighAvailabilityVIP != "" {
+		inv.Cluster.ControlPlaneEndpoint = net.JoinHostPort(inv.Cluster.HighAvailabilityVIP, "6443")
+	}
+}
+
+func (inv *Inventory) Validate() error {
+	errs := make([]string, 0)
+	if inv.Cluster.Mysql.Host == "" {
+		errs = append(errs, "cluster.mysql.host is required")
+	}
+	if inv.Cluster.Mysql.Password == "" {
+		errs = append(errs, "cluster.mysql.password is required")
+	}
+	if len(inv.Nodes) == 0 {
+		errs = append(errs, "no nodes defined")
+	}
+	hosts := sets.NewString()
+	controlPlanes := 0
+	for i, node := range inv.Nodes {
+		prefix := fmt.Sprintf("nodes[%d]", i)
+		if node.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s.host is required", prefix))
+		} else if hosts.Has(node.Host) {
+			errs = append(errs, fmt.Sprintf("%s.host %s is duplicated", prefix, node.Host))
+		}
+		hosts.Insert(node.Host)
+		for _, role := range node.Roles {
+			if !validRoles.Has(role) {
+				errs = append(errs, fmt.Sprintf("%s.roles: unknown role %q, supported roles: %s", prefix, role, strings.Join(validRoles.List(), ", ")))
+			}
+		}
+		if node.HasRole(RoleControlPlane) {
+			controlPlanes++
+		}
+		if node.HasRole(RoleVIP) {
+			if !node.HasRole(RoleControlPlane) {
+				errs = append(errs, fmt.Sprintf("%s: role %s requires role %s", prefix, RoleVIP, RoleControlPlane))
+			}
+			if inv.Cluster.HighAvailabilityVIP == "" {
+				errs = append(errs, fmt.Sprintf("%s: role %s requires cluster.highAvailabilityVIP", prefix, RoleVIP))
+			}
+		}
+		sshCfg := inv.SSH.merge(node.SSH)
+		if sshCfg.Password == "" && sshCfg.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Sprintf("%s: ssh password or privateKeyFile is required", prefix))
+		}
+	}
+	if len(inv.Nodes) != 0 && controlPlanes == 0 {
+		errs = append(errs, fmt.Sprintf("at least one node with role %s is required", RoleControlPlane))
+	}
+	if controlPlanes > 1 && inv.Cluster.ControlPlaneEndpoint == "" {
+		errs = append(errs, "cluster.controlPlaneEndpoint or cluster.highAvailabilityVIP is required by multiple control plane nodes")
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// InitNode returns the first control plane node, which runs `ocadm init`
+func (inv *Inventory) InitNode() *Node {
+	for i := range inv.Nodes {
+		if inv.Nodes[i].HasRole(RoleControlPlane) {
+			return &inv.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// SSHConfigOf returns the ssh login config of node
+func (inv *Inventory) SSHConfigOf(node *Node) ssh.Config {
+	cfg := inv.SSH.merge(node.SSH)
+	return ssh.Config{
+		Host:           node.Host,
+		Port:           cfg.Port,
+		User:           cfg.User,
+		Password:       cfg.Password,
+		PrivateKeyFile: cfg.PrivateKeyFile,
+		Sudo:           cfg.Sudo,
+
+		HostKeyFingerprint: cfg.HostKeyFingerprint,
+		KnownHostsFile:     cfg.KnownHostsFile,
+		TrustOnFirstUse:    cfg.TrustOnFirstUse,
+	}
+}
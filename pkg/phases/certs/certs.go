@@ -0,0 +1,196 @@
+package certs
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	"k8s.io/kubernetes/cmd/kubeadm/app/phases/certs/renewal"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+const (
+	// GroupKubernetes is the group of certificates managed by kubeadm
+	GroupKubernetes = "kubernetes"
+	// GroupOnecloud is the group of certificates stored in OnecloudCertificatesDir
+	GroupOnecloud = "onecloud"
+)
+
+// OnecloudCert is a certificate stored in OnecloudCertificatesDir
+type OnecloudCert struct {
+	Name     string
+	LongName string
+	BaseName string
+	// CAName is the BaseName of the signing CA, empty means the certificate is a CA
+	CAName string
+	// config is used to sign the certificate when it's created by ocadm
+	config certutil.Config
+}
+
+// IsCA returns whether the certificate is a CA
+func (c *OnecloudCert) IsCA() bool {
+	return c.CAName == ""
+}
+
+var (
+	// OnecloudCACert is the CA signing the onecloud certificates
+	OnecloudCACert = &OnecloudCert{
+		Name:     "onecloud-ca",
+		LongName: "onecloud CA to provision identities for onecloud services",
+		BaseName: constants.CACertAndKeyBaseName,
+	}
+	// ClimcCert is the client certificate used by climc
+	ClimcCert = &OnecloudCert{
+		Name:     "onecloud-climc",
+		LongName: "client certificate for climc to talk to onecloud services",
+		BaseName: constants.ClimcClientCertAndKeyBaseName,
+		CAName:   constants.CACertAndKeyBaseName,
+		config: certutil.Config{
+			CommonName: constants.ClimcClientCertAndKeyBaseName,
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+	}
+	// ServiceCert is the certificate serving onecloud services, its SANs are decided by the InitConfiguration
+	ServiceCert = &OnecloudCert{
+		Name:     "onecloud-service",
+		LongName: "certificate for serving onecloud services",
+		BaseName: constants.ServiceCertAndKeyBaseName,
+		CAName:   constants.CACertAndKeyBaseName,
+		config: certutil.Config{
+			CommonName: constants.ServiceCertAndKeyBaseName,
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+	}
+)
+
+// GetOnecloudCerts returns all the certificates in OnecloudCertificatesDir, the CA comes first
+func GetOnecloudCerts() []*OnecloudCert {
+	return []*OnecloudCert{OnecloudCACert, ClimcCert, ServiceCert}
+}
+
+// ExpirationInfo holds the expiration of a certificate
+type ExpirationInfo struct {
+	Name  string
+	Group string
+	IsCA  bool
+	// Missing is true when the certificate can't be read from disk
+	Missing bool
+	// ExpirationDate is the NotAfter of the certificate
+	ExpirationDate time.Time
+	// ExternallyManaged is true when the signing CA key isn't present, so ocadm can't renew the certificate
+	ExternallyManaged bool
+}
+
+// ResidualTime returns the time left before the certificate expires
+func (e *ExpirationInfo) ResidualTime() time.Duration {
+	return e.ExpirationDate.Sub(time.Now())
+}
+
+// GetKubernetesExpirationInfos returns the expiration of the certificates managed by kubeadm
+func GetKubernetesExpirationInfos(cfg *kubeadmapi.ClusterConfiguration, kubernetesDir string) ([]*ExpirationInfo, error) {
+	rm, err := renewal.NewManager(cfg, kubernetesDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ExpirationInfo, 0)
+	for _, h := range rm.Certificates() {
+		info := &ExpirationInfo{Name: h.Name, Group: GroupKubernetes}
+		e, err := rm.GetExpirationInfo(h.Name)
+		if err != nil {
+			klog.Warningf("[certs] Unable to read certificate %s: %v", h.Name, err)
+			info.Missing = true
+		} else {
+			info.ExpirationDate = e.ExpirationDate
+			info.ExternallyManaged = e.ExternallyManaged
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetOnecloudExpirationInfos returns the expiration of the certificates in certsDir
+func GetOnecloudExpirationInfos(certsDir string) ([]*ExpirationInfo, error) {
+	infos := make([]*ExpirationInfo, 0)
+	for _, c := range GetOnecloudCerts() {
+		info := &ExpirationInfo{Name: c.Name, Group: GroupOnecloud, IsCA: c.IsCA()}
+		cert, err := pkiutil.TryLoadCertFromDisk(certsDir, c.BaseName)
+		if err != nil {
+			certPath, _ := pkiutil.PathsForCertAndKey(certsDir, c.BaseName)
+			if _, statErr := os.Stat(certPath); !os.IsNotExist(statErr) {
+				return nil, errors.Wrapf(err, "read certificate %s", c.Name)
+			}
+			info.Missing = true
+		} else {
+			info.ExpirationDate = cert.NotAfter
+		}
+		caBaseName := c.CAName
+		if c.IsCA() {
+			caBaseName = c.BaseName
+		}
+		_, keyPath := pkiutil.PathsForCertAndKey(certsDir, caBaseName)
+		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+			info.ExternallyManaged = true
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// RenewKubernetesCerts renews the certificates managed by kubeadm with the local CA
+func RenewKubernetesCerts(cfg *kubeadmapi.ClusterConfiguration, kubernetesDir string, out io.Writer) error {
+	rm, err := renewal.NewManager(cfg, kubernetesDir)
+	if err != nil {
+		return err
+	}
+	for _, h := range rm.Certificates() {
+		renewed, err := rm.RenewUsingLocalCA(h.Name)
+		if err != nil {
+			return errors.Wrapf(err, "renew %s", h.Name)
+		}
+		if !renewed {
+			fmt.Fprintf(out, "[certs] Detected external %s, %s can't be renewed\n", h.CABaseName, h.LongName)
+			continue
+		}
+		fmt.Fprintf(out, "[certs] Renewed %s\n", h.LongName)
+	}
+	return nil
+}
+
+// RenewOnecloudCerts signs the existing leaf certificates in certsDir again with the onecloud CA,
+// the subject and SANs of the certificates are kept
+func RenewOnecloudCerts(certsDir string, out io.Writer) error {
+	caCert, caKey, err := pkiutil.TryLoadCertAndKeyFromDisk(certsDir, OnecloudCACert.BaseName)
+	if err != nil {
+		return errors.Wrapf(err, "load onecloud CA from %s, certificates signed by an external CA must be renewed by it", certsDir)
+	}
+	if time.Now().After(caCert.NotAfter) {
+		return errors.Errorf("onecloud CA expired at %s, it can't be used to renew certificates", caCert.NotAfter)
+	}
+	for _, c := range GetOnecloudCerts() {
+		if c.IsCA() {
+			continue
+		}
+		oldCert, err := pkiutil.TryLoadCertFromDisk(certsDir, c.BaseName)
+		if err != nil {
+			klog.V(1).Infof("[certs] Unable to load existing %s, skip renewing it: %v", c.Name, err)
+			continue
+		}
+		cert, key, err := pkiutil.NewCertAndKey(caCert, caKey, pkiutil.CertToConfig(oldCert))
+		if err != nil {
+			return errors.Wrapf(err, "sign %s", c.Name)
+		}
+		if err := pkiutil.WriteCertAndKey(certsDir, c.BaseName, cert, key); err != nil {
+			return errors.Wrapf(err, "write %s", c.Name)
+		}
+		fmt.Fprintf(out, "[certs] Renewed %s\n", c.LongName)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package certs
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	certutil "k8s.io/client-go/util/cert"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+func newTestCertsDir(t *testing.T, withCAKey bool) string {
+	dir, err := ioutil.TempDir("", "ocadm-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, caKey, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: "onecloud"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkiutil.WriteCertAndKey(dir, constants.CACertAndKeyBaseName, caCert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := pkiutil.NewCertAndKey(caCert, caKey, &certutil.Config{
+		CommonName:   "climc",
+		Organization: []string{"yunion"},
+		AltNames:     certutil.AltNames{IPs: []net.IP{net.ParseIP("10.0.0.1")}},
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkiutil.WriteCertAndKey(dir, constants.ClimcClientCertAndKeyBaseName, cert, key); err != nil {
+		t.Fatal(err)
+	}
+	if !withCAKey {
+		_, keyPath := pkiutil.PathsForCertAndKey(dir, constants.CACertAndKeyBaseName)
+		if err := os.Remove(keyPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetOnecloudExpirationInfos(t *testing.T) {
+	dir := newTestCertsDir(t, true)
+	defer os.RemoveAll(dir)
+
+	infos, err := GetOnecloudExpirationInfos(dir)
+	if err != nil {
+		t.Fatalf("GetOnecloudExpirationInfos() error: %v", err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("GetOnecloudExpirationInfos() returns %d certs, want 3", len(infos))
+	}
+	for _, info := range infos[:2] {
+		if info.Missing || info.ExternallyManaged || info.ResidualTime() <= 0 {
+			t.Errorf("unexpected expiration info %#v", info)
+		}
+	}
+	if !infos[2].Missing {
+		t.Errorf("%s should be missing", ServiceCert.Name)
+	}
+	if !infos[0].IsCA || infos[1].IsCA {
+		t.Errorf("only %s should be CA", OnecloudCACert.Name)
+	}
+
+	_, keyPath := pkiutil.PathsForCertAndKey(dir, constants.CACertAndKeyBaseName)
+	os.Remove(keyPath)
+	certPath, _ := pkiutil.PathsForCertAndKey(dir, constants.ClimcClientCertAndKeyBaseName)
+	os.Remove(certPath)
+	infos, err = GetOnecloudExpirationInfos(dir)
+	if err != nil {
+		t.Fatalf("GetOnecloudExpirationInfos() error: %v", err)
+	}
+	if !infos[0].ExternallyManaged || !infos[1].ExternallyManaged {
+		t.Errorf("certs should be externally managed without CA key")
+	}
+	if !infos[1].Missing {
+		t.Errorf("%s should be missing", ClimcCert.Name)
+	}
+}
+
+func TestRenewOnecloudCerts(t *testing.T) {
+	dir := newTestCertsDir(t, true)
+	defer os.RemoveAll(dir)
+
+	oldCert, err := pkiutil.TryLoadCertFromDisk(dir, constants.ClimcClientCertAndKeyBaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RenewOnecloudCerts(dir, ioutil.Discard); err != nil {
+		t.Fatalf("RenewOnecloudCerts() error: %v", err)
+	}
+	newCert, err := pkiutil.TryLoadCertFromDisk(dir, constants.ClimcClientCertAndKeyBaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Errorf("certificate isn't renewed")
+	}
+	if !reflect.DeepEqual(pkiutil.CertToConfig(newCert), pkiutil.CertToConfig(oldCert)) {
+		t.Errorf("renewed certificate config %#v, want %#v", pkiutil.CertToConfig(newCert), pkiutil.CertToConfig(oldCert))
+	}
+	caCert, err := pkiutil.TryLoadCertFromDisk(dir, constants.CACertAndKeyBaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newCert.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("renewed certificate isn't signed by CA: %v", err)
+	}
+}
+
+func TestRenewOnecloudCertsExternalCA(t *testing.T) {
+	dir := newTestCertsDir(t, false)
+	defer os.RemoveAll(dir)
+
+	if err := RenewOnecloudCerts(dir, ioutil.Discard); err == nil {
+		t.Errorf("RenewOnecloudCerts() should fail without CA key")
+	}
+}
+
+func newPodTemplate(volumes ...corev1.Volume) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: volumes}}
+}
+
+func hostPathVolume(path string) corev1.Volume {
+	return corev1.Volume{Name: "host", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path}}}
+}
+
+func TestRestartCertsConsumers(t *testing.T) {
+	ns := constants.OnecloudNamespace
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "region", Namespace: ns},
+			Spec:       appsv1.DeploymentSpec{Template: newPodTemplate(hostPathVolume("/etc/yunion/pki"))},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: ns},
+			Spec:       appsv1.DeploymentSpec{Template: newPodTemplate(hostPathVolume("/etc/yunion/web"))},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "host", Namespace: ns},
+			Spec:       appsv1.DaemonSetSpec{Template: newPodTemplate(hostPathVolume("/etc/yunion/"))},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "rootfs", Namespace: ns},
+			Spec:       appsv1.DaemonSetSpec{Template: newPodTemplate(hostPathVolume("/"))},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "influxdb", Namespace: ns},
+			Spec: appsv1.StatefulSetSpec{Template: newPodTemplate(corev1.Volume{
+				Name:         "certs",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: constants.OcadmCertsSecret}},
+			})},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "apigateway", Namespace: ns},
+			Spec: appsv1.DeploymentSpec{Template: newPodTemplate(corev1.Volume{
+				Name:         "certs",
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "default-certs"}},
+			})},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-ns", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Template: newPodTemplate(hostPathVolume("/etc/yunion/pki"))},
+		},
+	)
+
+	restarted, err := RestartCertsConsumers(client, ns, "/etc/yunion/pki", []string{"default-certs"}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("RestartCertsConsumers() error: %v", err)
+	}
+	sort.Strings(restarted)
+	want := []string{"daemonset/host", "deployment/apigateway", "deployment/region", "statefulset/influxdb"}
+	if !reflect.DeepEqual(restarted, want) {
+		t.Errorf("RestartCertsConsumers() = %v, want %v", restarted, want)
+	}
+	region, err := client.AppsV1().Deployments(ns).Get("region", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := region.Spec.Template.Annotations[CertsRenewedAtAnnotation]; !ok {
+		t.Errorf("deployment region isn't annotated with %s", CertsRenewedAtAnnotation)
+	}
+}
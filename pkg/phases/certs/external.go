@@ -0,0 +1,196 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	certutil "k8s.io/client-go/util/cert"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+// OnecloudCAMode is how the onecloud CA is provided
+type OnecloudCAMode string
+
+const (
+	// OnecloudCAGenerated means no CA is provided, onecloud operator generates a self-signed one
+	OnecloudCAGenerated OnecloudCAMode = "generated"
+	// OnecloudCAWithKey means the CA certificate and key are provided, e.g. an intermediate CA of the corporate CA,
+	// ocadm signs the missing leaf certificates with it
+	OnecloudCAWithKey OnecloudCAMode = "with-key"
+	// OnecloudCAExternal means only the CA certificate is provided, all the leaf certificates must be pre-signed
+	OnecloudCAExternal OnecloudCAMode = "external"
+)
+
+// UsingExternalOnecloudCA returns how the onecloud CA is provided in certsDir and validates the provided certificates:
+// the CA certificate file may contain the chain up to the root CA, every certificate in it must be signed by the next one;
+// the leaf certificates present must be signed by the CA and match their keys, they are all required without the CA key.
+func UsingExternalOnecloudCA(certsDir string) (OnecloudCAMode, error) {
+	caPath, caKeyPath := pkiutil.PathsForCertAndKey(certsDir, OnecloudCACert.BaseName)
+	if _, err := os.Stat(caPath); os.IsNotExist(err) {
+		return OnecloudCAGenerated, nil
+	}
+	chain, err := certutil.CertsFromFile(caPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "read onecloud CA %s", caPath)
+	}
+	if err := ValidateCAChain(chain); err != nil {
+		return "", errors.Wrapf(err, "invalid onecloud CA %s", caPath)
+	}
+	caCert := chain[0]
+
+	mode := OnecloudCAExternal
+	if _, err := os.Stat(caKeyPath); err == nil {
+		mode = OnecloudCAWithKey
+		caKey, err := pkiutil.TryLoadKeyFromDisk(certsDir, OnecloudCACert.BaseName)
+		if err != nil {
+			return "", errors.Wrapf(err, "read onecloud CA key %s", caKeyPath)
+		}
+		if err := validateKeyPair(caCert, caKey); err != nil {
+			return "", errors.Wrapf(err, "onecloud CA key %s", caKeyPath)
+		}
+	}
+
+	for _, c := range GetOnecloudCerts() {
+		if c.IsCA() {
+			continue
+		}
+		certPath, _ := pkiutil.PathsForCertAndKey(certsDir, c.BaseName)
+		if _, err := os.Stat(certPath); os.IsNotExist(err) {
+			if mode == OnecloudCAExternal {
+				return "", errors.Errorf("%s %s is required when using an external onecloud CA without key", c.LongName, certPath)
+			}
+			continue
+		}
+		if err := validateSignedCert(certsDir, c, caCert); err != nil {
+			return "", err
+		}
+	}
+	return mode, nil
+}
+
+// ValidateCAChain checks the first certificate of chain is a CA,
+// and every certificate in chain is valid now and signed by the next one
+func ValidateCAChain(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("no certificate found")
+	}
+	if !chain[0].IsCA {
+		return errors.Errorf("certificate %q is not a CA", chain[0].Subject.CommonName)
+	}
+	now := time.Now()
+	for i, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return errors.Errorf("certificate %q is not valid from %s to %s", cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+		}
+		if i+1 < len(chain) {
+			if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+				return errors.Wrapf(err, "certificate %q is not signed by %q", cert.Subject.CommonName, chain[i+1].Subject.CommonName)
+			}
+		}
+	}
+	return nil
+}
+
+func validateSignedCert(certsDir string, c *OnecloudCert, caCert *x509.Certificate) error {
+	cert, key, err := pkiutil.TryLoadCertAndKeyFromDisk(certsDir, c.BaseName)
+	if err != nil {
+		return errors.Wrapf(err, "load %s", c.LongName)
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		return errors.Wrapf(err, "%s is not signed by the onecloud CA", c.LongName)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return errors.Errorf("%s expired at %s", c.LongName, cert.NotAfter)
+	}
+	if err := validateKeyPair(cert, key); err != nil {
+		return errors.Wrap(err, c.LongName)
+	}
+	return nil
+}
+
+func validateKeyPair(cert *x509.Certificate, key crypto.Signer) error {
+	certPub, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyPub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(certPub, keyPub) {
+		return errors.Errorf("private key doesn't match the certificate %q", cert.Subject.CommonName)
+	}
+	return nil
+}
+
+// CreateOnecloudPKIAssets signs the missing leaf certificates with the provided onecloud CA key,
+// nothing is done if the CA isn't provided or has no key
+func CreateOnecloudPKIAssets(cfg *apiv1.InitConfiguration, out io.Writer) error {
+	certsDir := cfg.OnecloudCertificatesDir
+	mode, err := UsingExternalOnecloudCA(certsDir)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case OnecloudCAGenerated:
+		fmt.Fprintf(out, "[oc-certs] No onecloud CA found in %s, it will be generated by onecloud operator\n", certsDir)
+		return nil
+	case OnecloudCAExternal:
+		fmt.Fprintf(out, "[oc-certs] Using the external onecloud CA and certificates in %s\n", certsDir)
+		return nil
+	}
+
+	caCert, caKey, err := pkiutil.TryLoadCertAndKeyFromDisk(certsDir, OnecloudCACert.BaseName)
+	if err != nil {
+		return errors.Wrap(err, "load onecloud CA")
+	}
+	for _, c := range GetOnecloudCerts() {
+		if c.IsCA() {
+			continue
+		}
+		if pkiutil.CertOrKeyExist(certsDir, c.BaseName) {
+			fmt.Fprintf(out, "[oc-certs] Using the existing %s\n", c.LongName)
+			continue
+		}
+		certCfg, err := leafCertConfig(cfg, c)
+		if err != nil {
+			return err
+		}
+		cert, key, err := pkiutil.NewCertAndKey(caCert, caKey, certCfg)
+		if err != nil {
+			return errors.Wrapf(err, "sign %s", c.Name)
+		}
+		if err := pkiutil.WriteCertAndKey(certsDir, c.BaseName, cert, key); err != nil {
+			return errors.Wrapf(err, "write %s", c.Name)
+		}
+		fmt.Fprintf(out, "[oc-certs] Generated %s signed by the onecloud CA\n", c.LongName)
+	}
+	return nil
+}
+
+func leafCertConfig(cfg *apiv1.InitConfiguration, c *OnecloudCert) (*certutil.Config, error) {
+	certCfg := c.config
+	if c != ServiceCert {
+		return &certCfg, nil
+	}
+	altNames, err := pkiutil.GetServiceAltNames(cfg, c.BaseName, constants.ServiceCertName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s SANs", c.Name)
+	}
+	altNames.DNSNames = append(altNames.DNSNames,
+		"localhost",
+		fmt.Sprintf("%s.%s", c.BaseName, constants.OnecloudNamespace),
+		fmt.Sprintf("%s.%s.svc", c.BaseName, constants.OnecloudNamespace),
+	)
+	certCfg.AltNames = *altNames
+	return &certCfg, nil
+}
@@ -0,0 +1,233 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	certutil "k8s.io/client-go/util/cert"
+	kubeadmpkiutil "k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+// newIntermediateCA returns a CA signed by the parent CA
+func newIntermediateCA(t *testing.T, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := pkiutil.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "onecloud-intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writeLeafCert(t *testing.T, dir string, c *OnecloudCert, caCert *x509.Certificate, caKey crypto.Signer) {
+	cfg := c.config
+	cert, key, err := pkiutil.NewCertAndKey(caCert, caKey, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkiutil.WriteCertAndKey(dir, c.BaseName, cert, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeCAChain(t *testing.T, dir string, chain ...*x509.Certificate) {
+	data := []byte{}
+	for _, cert := range chain {
+		data = append(data, kubeadmpkiutil.EncodeCertPEM(cert)...)
+	}
+	caPath, _ := pkiutil.PathsForCertAndKey(dir, constants.CACertAndKeyBaseName)
+	if err := ioutil.WriteFile(caPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUsingExternalOnecloudCA(t *testing.T) {
+	rootCert, rootKey, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: "corporate-root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interCert, interKey := newIntermediateCA(t, rootCert, rootKey)
+	otherCert, otherKey, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir string)
+		want    OnecloudCAMode
+		wantErr bool
+	}{
+		{
+			name:  "no CA",
+			setup: func(t *testing.T, dir string) {},
+			want:  OnecloudCAGenerated,
+		},
+		{
+			name: "intermediate CA with key",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, rootCert)
+				if err := kubeadmpkiutil.WriteKey(dir, constants.CACertAndKeyBaseName, interKey); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: OnecloudCAWithKey,
+		},
+		{
+			name: "CA key doesn't match",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, rootCert)
+				if err := kubeadmpkiutil.WriteKey(dir, constants.CACertAndKeyBaseName, otherKey); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "broken chain",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, otherCert)
+			},
+			wantErr: true,
+		},
+		{
+			name: "external CA with pre-signed certificates",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, rootCert)
+				writeLeafCert(t, dir, ClimcCert, interCert, interKey)
+				writeLeafCert(t, dir, ServiceCert, interCert, interKey)
+			},
+			want: OnecloudCAExternal,
+		},
+		{
+			name: "external CA without service certificate",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, rootCert)
+				writeLeafCert(t, dir, ClimcCert, interCert, interKey)
+			},
+			wantErr: true,
+		},
+		{
+			name: "certificate signed by other CA",
+			setup: func(t *testing.T, dir string) {
+				writeCAChain(t, dir, interCert, rootCert)
+				writeLeafCert(t, dir, ClimcCert, interCert, interKey)
+				writeLeafCert(t, dir, ServiceCert, otherCert, otherKey)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "ocadm-certs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			tt.setup(t, dir)
+
+			got, err := UsingExternalOnecloudCA(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UsingExternalOnecloudCA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UsingExternalOnecloudCA() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateOnecloudPKIAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rootCert, rootKey, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: "corporate-root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interCert, interKey := newIntermediateCA(t, rootCert, rootKey)
+	writeCAChain(t, dir, interCert, rootCert)
+	if err := kubeadmpkiutil.WriteKey(dir, constants.CACertAndKeyBaseName, interKey); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &apiv1.InitConfiguration{}
+	cfg.OnecloudCertificatesDir = dir
+	cfg.LocalAPIEndpoint.AdvertiseAddress = "192.168.0.10"
+	cfg.InitConfiguration.Networking.ServiceSubnet = "10.96.0.0/12"
+	cfg.InitConfiguration.Networking.DNSDomain = "cluster.local"
+	cfg.NodeRegistration.Name = "node1"
+	if err := CreateOnecloudPKIAssets(cfg, ioutil.Discard); err != nil {
+		t.Fatalf("CreateOnecloudPKIAssets() error: %v", err)
+	}
+
+	for _, c := range []*OnecloudCert{ClimcCert, ServiceCert} {
+		cert, err := pkiutil.TryLoadCertFromDisk(dir, c.BaseName)
+		if err != nil {
+			t.Fatalf("%s isn't created: %v", c.Name, err)
+		}
+		if err := cert.CheckSignatureFrom(interCert); err != nil {
+			t.Errorf("%s isn't signed by the onecloud CA: %v", c.Name, err)
+		}
+		if cert.NotAfter.After(interCert.NotAfter) {
+			t.Errorf("%s expires at %s after the onecloud CA %s", c.Name, cert.NotAfter, interCert.NotAfter)
+		}
+	}
+	svcCert, _ := pkiutil.TryLoadCertFromDisk(dir, ServiceCert.BaseName)
+	if err := svcCert.VerifyHostname("192.168.0.10"); err != nil {
+		t.Errorf("service certificate SANs: %v", err)
+	}
+	if mode, err := UsingExternalOnecloudCA(dir); err != nil || mode != OnecloudCAWithKey {
+		t.Errorf("UsingExternalOnecloudCA() = %q, %v after creating certificates", mode, err)
+	}
+
+	client := fake.NewSimpleClientset()
+	if err := CreateOrUpdateOperatorCertsSecret(client, constants.OnecloudNamespace, "default", dir); err != nil {
+		t.Fatalf("CreateOrUpdateOperatorCertsSecret() error: %v", err)
+	}
+	secret, err := client.CoreV1().Secrets(constants.OnecloudNamespace).Get("default-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{constants.CACertName, constants.CAKeyName, constants.ServiceCertName, constants.ServiceKeyName, constants.IngressTLSCertName, constants.IngressTLSKeyName} {
+		if len(secret.Data[name]) == 0 {
+			t.Errorf("secret doesn't contain %s", name)
+		}
+	}
+	caData, _ := ioutil.ReadFile(filepath.Join(dir, constants.CACertName))
+	if string(secret.Data[constants.CACertName]) != string(caData) {
+		t.Errorf("secret %s isn't the CA chain", constants.CACertName)
+	}
+}
@@ -0,0 +1,109 @@
+package certs
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+)
+
+// CertsRenewedAtAnnotation is set to the pod template of workloads to restart them after certificates renewed
+const CertsRenewedAtAnnotation = "ocadm.yunion.io/certs-renewed-at"
+
+// RestartCertsConsumers restarts the workloads in namespace mounting certsDir from host, the OcadmCertsSecret or
+// the extra secrets, the names of restarted workloads are returned
+func RestartCertsConsumers(client clientset.Interface, namespace string, certsDir string, secrets []string, out io.Writer) ([]string, error) {
+	secretSet := sets.NewString(secrets...)
+	secretSet.Insert(constants.OcadmCertsSecret)
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, CertsRenewedAtAnnotation, time.Now().Format(time.RFC3339)))
+	restarted := make([]string, 0)
+	restart := func(kind string, name string, spec corev1.PodSpec, doPatch func() error) error {
+		if !mountsCerts(spec, certsDir, secretSet) {
+			return nil
+		}
+		if err := doPatch(); err != nil {
+			return errors.Wrapf(err, "restart %s %s/%s", kind, namespace, name)
+		}
+		fmt.Fprintf(out, "[certs] Restarted %s %s/%s\n", kind, namespace, name)
+		restarted = append(restarted, kind+"/"+name)
+		return nil
+	}
+
+	apps := client.AppsV1()
+	deploys, err := apps.Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list deployments")
+	}
+	for _, d := range deploys.Items {
+		name := d.Name
+		if err := restart("deployment", name, d.Spec.Template.Spec, func() error {
+			_, err := apps.Deployments(namespace).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}); err != nil {
+			return restarted, err
+		}
+	}
+	daemonsets, err := apps.DaemonSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return restarted, errors.Wrap(err, "list daemonsets")
+	}
+	for _, ds := range daemonsets.Items {
+		name := ds.Name
+		if err := restart("daemonset", name, ds.Spec.Template.Spec, func() error {
+			_, err := apps.DaemonSets(namespace).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}); err != nil {
+			return restarted, err
+		}
+	}
+	statefulsets, err := apps.StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return restarted, errors.Wrap(err, "list statefulsets")
+	}
+	for _, sts := range statefulsets.Items {
+		name := sts.Name
+		if err := restart("statefulset", name, sts.Spec.Template.Spec, func() error {
+			_, err := apps.StatefulSets(namespace).Patch(name, types.StrategicMergePatchType, patch)
+			return err
+		}); err != nil {
+			return restarted, err
+		}
+	}
+	return restarted, nil
+}
+
+// mountsCerts returns whether the pod mounts certsDir, its parent or child directory from host, or any of the secrets
+func mountsCerts(spec corev1.PodSpec, certsDir string, secrets sets.String) bool {
+	certsDir = filepath.Clean(certsDir)
+	for _, v := range spec.Volumes {
+		if v.Secret != nil && secrets.Has(v.Secret.SecretName) {
+			return true
+		}
+		if v.HostPath == nil {
+			continue
+		}
+		hostPath := filepath.Clean(v.HostPath.Path)
+		if hostPath == "/" {
+			continue
+		}
+		if isSubPath(hostPath, certsDir) || isSubPath(certsDir, hostPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubPath returns whether path is the same as or under dir
+func isSubPath(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
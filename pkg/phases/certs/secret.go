@@ -0,0 +1,63 @@
+package certs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+// OperatorCertsSecretName returns the name of the Secret holding the certificates of onecloud cluster,
+// onecloud operator only generates a self-signed CA when it doesn't exist
+func OperatorCertsSecretName(clusterName string) string {
+	return fmt.Sprintf("%s-certs", clusterName)
+}
+
+// CreateOrUpdateOperatorCertsSecret stores the provided onecloud CA and service certificate in certsDir
+// to the Secret used by onecloud operator, so the onecloud services are served with them
+func CreateOrUpdateOperatorCertsSecret(client clientset.Interface, namespace string, clusterName string, certsDir string) error {
+	caPath, caKeyPath := pkiutil.PathsForCertAndKey(certsDir, OnecloudCACert.BaseName)
+	svcPath, svcKeyPath := pkiutil.PathsForCertAndKey(certsDir, ServiceCert.BaseName)
+	files := map[string]string{
+		constants.CACertName:         caPath,
+		constants.CAKeyName:          caKeyPath,
+		constants.ServiceCertName:    svcPath,
+		constants.ServiceKeyName:     svcKeyPath,
+		constants.IngressTLSCertName: svcPath,
+		constants.IngressTLSKeyName:  svcKeyPath,
+	}
+	data := make(map[string][]byte)
+	for name, path := range files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			// the CA key is absent when using an external CA
+			if os.IsNotExist(err) && name == constants.CAKeyName {
+				continue
+			}
+			return errors.Wrapf(err, "read %s", path)
+		}
+		data[name] = content
+	}
+
+	if _, err := client.CoreV1().Namespaces().Create(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: namespace},
+	}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "create namespace %s", namespace)
+	}
+	return apiclient.CreateOrUpdateSecret(client, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      OperatorCertsSecretName(clusterName),
+			Namespace: namespace,
+		},
+		Data: data,
+	})
+}
@@ -0,0 +1,459 @@
+package cluster
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/pkg/transport"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+	"yunion.io/x/onecloud-operator/pkg/controller"
+	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+const (
+	// BackupFormatVersion is the layout version of the backup archive
+	BackupFormatVersion = "v1"
+
+	backupManifestFile = "manifest.yaml"
+	backupEtcdSnapshot = "etcd/snapshot.db"
+	backupMysqlDir     = "mysql"
+	backupObjectsDir   = "kubernetes"
+	backupFilesDir     = "files"
+
+	backupKindConfigMap       = "ConfigMap"
+	backupKindSecret          = "Secret"
+	backupKindOnecloudCluster = "OnecloudCluster"
+)
+
+// BackupManifest describes the content of a cluster backup archive
+type BackupManifest struct {
+	FormatVersion   string           `json:"formatVersion"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	OnecloudVersion string           `json:"onecloudVersion"`
+	OperatorVersion string           `json:"operatorVersion"`
+	Edition         string           `json:"edition"`
+	EtcdSnapshot    string           `json:"etcdSnapshot,omitempty"`
+	Databases       []BackupDatabase `json:"databases"`
+	Objects         []BackupObject   `json:"objects"`
+	Files           []string         `json:"files"`
+	// FileModes are the permissions of Files, archives without it restore the files by default mode
+	FileModes map[string]os.FileMode `json:"fileModes,omitempty"`
+}
+
+// BackupDatabase is a service database dumped into the archive
+type BackupDatabase struct {
+	Service  string `json:"service"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	File     string `json:"file"`
+}
+
+// BackupObject is a kubernetes object saved into the archive
+type BackupObject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	File      string `json:"file"`
+}
+
+type backupOptions struct {
+	output       string
+	etcdEndpoint string
+	skipEtcd     bool
+	skipDatabase bool
+}
+
+func newBackupOptions() *backupOptions {
+	return &backupOptions{
+		output: fmt.Sprintf("onecloud-backup-%s.tar.gz", time.Now().Format("20060102150405")),
+	}
+}
+
+func NewCmdBackup(out io.Writer) *cobra.Command {
+	opt := newBackupOptions()
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Backup etcd, onecloud databases and ocadm configuration into one archive",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := newClusterData(cmd, args)
+			kubeadmutil.CheckErr(err)
+
+			err = backupCluster(data, opt, out)
+			kubeadmutil.CheckErr(err)
+
+			fmt.Fprintf(out, "Cluster backup saved to %s\n", opt.output)
+		},
+		Args: cobra.NoArgs,
+	}
+	AddBackupOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddBackupOptions(flagSet *flag.FlagSet, opt *backupOptions) {
+	flagSet.StringVarP(&opt.output, "output", "o", opt.output, "backup archive file path")
+	flagSet.StringVar(&opt.etcdEndpoint, "etcd-endpoint", opt.etcdEndpoint, "etcd endpoint used to take snapshot, default is the local etcd member")
+	flagSet.BoolVar(&opt.skipEtcd, "skip-etcd", opt.skipEtcd, "do not save etcd snapshot")
+	flagSet.BoolVar(&opt.skipDatabase, "skip-database", opt.skipDatabase, "do not dump onecloud databases")
+}
+
+type archiveWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func newArchiveWriter(filename string) (*archiveWriter, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create archive %s", filename)
+	}
+	gz := gzip.NewWriter(f)
+	return &archiveWriter{
+		file: f,
+		gz:   gz,
+		tw:   tar.NewWriter(gz),
+	}, nil
+}
+
+func (w *archiveWriter) WriteFile(name string, content []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "write header of %s", name)
+	}
+	if _, err := w.tw.Write(content); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	return nil
+}
+
+func (w *archiveWriter) AddFile(name string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "write header of %s", name)
+	}
+	if _, err := io.Copy(w.tw, f); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	return nil
+}
+
+// Close flushes the tar and gzip streams and closes the archive file, the first error is returned
+func (w *archiveWriter) Close() error {
+	errs := []error{w.tw.Close(), w.gz.Close(), w.file.Close()}
+	for _, err := range errs {
+		if err != nil {
+			return errors.Wrapf(err, "close archive %s", w.file.Name())
+		}
+	}
+	return nil
+}
+
+// Abort closes and removes the incomplete archive
+func (w *archiveWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func backupCluster(data *clusterData, opt *backupOptions, out io.Writer) (err error) {
+	oc, err := data.client.OnecloudV1alpha1().OnecloudClusters(constants.OnecloudNamespace).Get(DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "get default onecloud cluster")
+	}
+	ocCfg, err := occonfig.GetClusterConfigByClient(data.k8sClient, oc)
+	if err != nil {
+		return errors.Wrap(err, "get onecloud cluster config")
+	}
+	operator, err := data.GetOperator()
+	if err != nil {
+		return errors.Wrap(err, "get onecloud operator")
+	}
+	ref, err := getOperatorImage(operator)
+	if err != nil {
+		return errors.Wrap(err, "get operator image reference")
+	}
+
+	manifest := &BackupManifest{
+		FormatVersion:   BackupFormatVersion,
+		CreatedAt:       time.Now(),
+		OnecloudVersion: oc.Spec.Version,
+		OperatorVersion: ref.Tag,
+		Edition:         oc.GetAnnotations()[operatorconstants.OnecloudEditionAnnotationKey],
+	}
+
+	tmpDir, err := ioutil.TempDir("", "ocadm-backup")
+	if err != nil {
+		return errors.Wrap(err, "create temporary directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	w, err := newArchiveWriter(opt.output)
+	if err != nil {
+		return err
+	}
+	// a truncated archive is never left at output
+	defer func() {
+		if err != nil {
+			w.Abort()
+			return
+		}
+		if err = w.Close(); err != nil {
+			os.Remove(opt.output)
+		}
+	}()
+
+	if !opt.skipEtcd {
+		fmt.Fprintf(out, "[backup] Saving etcd snapshot\n")
+		snapshot := filepath.Join(tmpDir, "snapshot.db")
+		if err := saveEtcdSnapshot(&data.cfg.InitConfiguration.ClusterConfiguration, opt.etcdEndpoint, snapshot); err != nil {
+			return errors.Wrap(err, "save etcd snapshot")
+		}
+		if err := w.AddFile(backupEtcdSnapshot, snapshot); err != nil {
+			return err
+		}
+		manifest.EtcdSnapshot = backupEtcdSnapshot
+	}
+
+	if !opt.skipDatabase {
+		conn, err := mysql.NewConnection(&data.cfg.MysqlConnection)
+		if err != nil {
+			return errors.Wrap(err, "connect to mysql")
+		}
+		defer conn.Close()
+		for _, db := range ocutil.GetServiceDBConfigs(ocCfg) {
+			fmt.Fprintf(out, "[backup] Dumping database %s of service %s\n", db.Database, db.Service)
+			dumpFile := filepath.Join(tmpDir, db.Database+".sql")
+			if err := dumpDatabaseToFile(conn, db.Database, dumpFile); err != nil {
+				return err
+			}
+			name := path.Join(backupMysqlDir, db.Database+".sql")
+			if err := w.AddFile(name, dumpFile); err != nil {
+				return err
+			}
+			manifest.Databases = append(manifest.Databases, BackupDatabase{
+				Service:  db.Service,
+				Database: db.Database,
+				Username: db.Username,
+				File:     name,
+			})
+		}
+	}
+
+	objs, err := backupObjects(data, oc, w)
+	if err != nil {
+		return err
+	}
+	manifest.Objects = objs
+
+	files, modes, err := backupConfigFiles(w)
+	if err != nil {
+		return err
+	}
+	manifest.Files = files
+	manifest.FileModes = modes
+
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "marshal backup manifest")
+	}
+	return w.WriteFile(backupManifestFile, content)
+}
+
+func dumpDatabaseToFile(conn *mysql.Connection, db string, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := conn.DumpDatabase(db, f); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "dump database %s", db)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "close %s", filename)
+	}
+	return nil
+}
+
+func saveEtcdSnapshot(cfg *kubeadmapi.ClusterConfiguration, endpoint string, filename string) error {
+	var endpoints []string
+	var tlsInfo transport.TLSInfo
+	if cfg.Etcd.External != nil {
+		endpoints = cfg.Etcd.External.Endpoints
+		tlsInfo = transport.TLSInfo{
+			CertFile:      cfg.Etcd.External.CertFile,
+			KeyFile:       cfg.Etcd.External.KeyFile,
+			TrustedCAFile: cfg.Etcd.External.CAFile,
+		}
+	} else {
+		endpoints = []string{fmt.Sprintf("https://127.0.0.1:%d", kubeadmconstants.EtcdListenClientPort)}
+		tlsInfo = transport.TLSInfo{
+			CertFile:      filepath.Join(cfg.CertificatesDir, kubeadmconstants.EtcdHealthcheckClientCertName),
+			KeyFile:       filepath.Join(cfg.CertificatesDir, kubeadmconstants.EtcdHealthcheckClientKeyName),
+			TrustedCAFile: filepath.Join(cfg.CertificatesDir, kubeadmconstants.EtcdCACertName),
+		}
+	}
+	if endpoint != "" {
+		endpoints = []string{endpoint}
+	}
+	tlsCfg, err := tlsInfo.ClientConfig()
+	if err != nil {
+		return errors.Wrap(err, "load etcd client certificates")
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 20 * time.Second,
+		TLS:         tlsCfg,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "connect to etcd %v", endpoints)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	rc, err := cli.Snapshot(ctx)
+	if err != nil {
+		return errors.Wrap(err, "request snapshot")
+	}
+	defer rc.Close()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return errors.Wrap(err, "receive snapshot")
+	}
+	return f.Sync()
+}
+
+func backupObjects(data *clusterData, oc *v1alpha1.OnecloudCluster, w *archiveWriter) ([]BackupObject, error) {
+	obj, err := data.GetDefaultCluster()
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	ret := make([]BackupObject, 0)
+	add := func(kind string, namespace string, name string, obj interface{}) error {
+		content, err := yaml.Marshal(obj)
+		if err != nil {
+			return errors.Wrapf(err, "marshal %s %s/%s", kind, namespace, name)
+		}
+		file := path.Join(backupObjectsDir, fmt.Sprintf("%s-%s-%s.yaml", strings.ToLower(kind), namespace, name))
+		if err := w.WriteFile(file, content); err != nil {
+			return err
+		}
+		ret = append(ret, BackupObject{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+			File:      file,
+		})
+		return nil
+	}
+
+	for _, cm := range []struct {
+		namespace string
+		name      string
+	}{
+		{metav1.NamespaceSystem, constants.OnecloudAdminConfigConfigMap},
+		{oc.GetNamespace(), controller.ClusterConfigMapName(oc)},
+		{oc.GetNamespace(), ocutil.ComponentsConfigMapName(oc)},
+	} {
+		obj, err := data.k8sClient.CoreV1().ConfigMaps(cm.namespace).Get(cm.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				klog.Warningf("[backup] ConfigMap %s/%s not found, skip it", cm.namespace, cm.name)
+				continue
+			}
+			return nil, errors.Wrapf(err, "get configmap %s/%s", cm.namespace, cm.name)
+		}
+		if err := add(backupKindConfigMap, cm.namespace, cm.name, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := data.k8sClient.CoreV1().Secrets(metav1.NamespaceSystem).Get(constants.OcadmCertsSecret, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "get secret %s", constants.OcadmCertsSecret)
+		}
+		klog.Warningf("[backup] Secret %s/%s not found, skip it", metav1.NamespaceSystem, constants.OcadmCertsSecret)
+	} else {
+		if err := add(backupKindSecret, secret.GetNamespace(), secret.GetName(), secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := add(backupKindOnecloudCluster, obj.GetNamespace(), obj.GetName(), obj.Object); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// backupConfigFiles saves the files under /etc/yunion, the host.conf is skipped because it's node local
+func backupConfigFiles(w *archiveWriter) ([]string, map[string]os.FileMode, error) {
+	files := make([]string, 0)
+	modes := make(map[string]os.FileMode)
+	err := filepath.Walk(constants.OnecloudConfigDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || p == ocutil.HostConfFile {
+			return nil
+		}
+		name := path.Join(backupFilesDir, p)
+		if err := w.AddFile(name, p); err != nil {
+			return errors.Wrapf(err, "add file %s", p)
+		}
+		files = append(files, p)
+		modes[p] = info.Mode().Perm()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrapf(err, "walk %s", constants.OnecloudConfigDir)
+	}
+	return files, modes, nil
+}
@@ -0,0 +1,244 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+func writeTestArchive(t *testing.T, filename string, manifest *BackupManifest, files map[string]string) {
+	w, err := newArchiveWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(backupManifestFile, content); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := w.WriteFile(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "keystone.sql")
+	if err := ioutil.WriteFile(dump, []byte("SET NAMES utf8mb4;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &BackupManifest{
+		FormatVersion:   BackupFormatVersion,
+		CreatedAt:       time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC),
+		OnecloudVersion: "v3.8.5",
+		Databases: []BackupDatabase{
+			{Service: "keystone", Database: "keystone", Username: "keystone", File: "mysql/keystone.sql"},
+		},
+		Files:     []string{"/etc/yunion/region.conf"},
+		FileModes: map[string]os.FileMode{"/etc/yunion/region.conf": 0640},
+	}
+	archive := filepath.Join(dir, "backup.tar.gz")
+	w, err := newArchiveWriter(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(backupManifestFile, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile("mysql/keystone.sql", dump); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile("files/region.conf", []byte("region: region0\n")); err != nil {
+		t.Fatal(err)
+	}
+	// entries escaping the extract dir are kept inside it
+	if err := w.WriteFile("../../escaped.conf", []byte("escaped")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	got, err := extractArchive(archive, extractDir)
+	if err != nil {
+		t.Fatalf("extractArchive() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, manifest) {
+		t.Errorf("extractArchive() manifest = %#v, want %#v", got, manifest)
+	}
+	for name, want := range map[string]string{
+		"mysql/keystone.sql": "SET NAMES utf8mb4;\n",
+		"files/region.conf":  "region: region0\n",
+		"escaped.conf":       "escaped",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(extractDir, name))
+		if err != nil {
+			t.Errorf("read extracted %s: %v", name, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("extracted %s = %q, want %q", name, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.conf")); !os.IsNotExist(err) {
+		t.Errorf("archive entry shouldn't be extracted outside of %s", extractDir)
+	}
+}
+
+func TestExtractArchiveFormatVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "backup.tar.gz")
+	writeTestArchive(t, archive, &BackupManifest{FormatVersion: "v0"}, nil)
+	if _, err := extractArchive(archive, filepath.Join(dir, "extract")); err == nil {
+		t.Errorf("extractArchive() of unsupported format version should fail")
+	}
+}
+
+func TestArchiveWriterAbort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "backup.tar.gz")
+	w, err := newArchiveWriter(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(backupManifestFile, []byte("formatVersion: v1\n")); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("aborted archive %s should be removed, stat error: %v", archive, err)
+	}
+	if _, err := extractArchive(archive, filepath.Join(dir, "extract")); err == nil {
+		t.Errorf("extractArchive() of aborted archive should fail")
+	}
+}
+
+func TestRestoreOnecloudClusterMysqlOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the backup cluster connects mysql by verifying CA
+	backupOC := newTestOnecloudCluster("v3.8.5", "registry.example.com/yunion", "")
+	backupOC.SetAnnotations(map[string]string{"example.com/note": "kept"})
+	unstructured.SetNestedField(backupOC.Object, map[string]interface{}{
+		"host":     "10.0.0.1",
+		"port":     int64(3306),
+		"username": "root",
+		"password": "source",
+	}, "spec", "mysql")
+	sourceOpts := apiv1.MysqlConnectionOptions{TLSMode: apiv1.MysqlTLSVerifyCA, CAFile: "/etc/mysql/source-ca.pem"}
+	anno := backupOC.GetAnnotations()
+	if err := ocutil.SetMysqlOptionsAnnotation(anno, sourceOpts); err != nil {
+		t.Fatal(err)
+	}
+	backupOC.SetAnnotations(anno)
+	content, err := yaml.Marshal(backupOC.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ocObj := &BackupObject{Kind: backupKindOnecloudCluster, Namespace: constants.OnecloudNamespace, Name: DefaultClusterName, File: "kubernetes/oc.yaml"}
+	if err := os.MkdirAll(filepath.Join(dir, "kubernetes"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ocObj.File), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		opts     apiv1.MysqlConnectionOptions
+	}{
+		{
+			name: "create with target options",
+			opts: apiv1.MysqlConnectionOptions{TLSMode: apiv1.MysqlTLSPreferred, ConnectTimeout: 10 * time.Second, Charset: "utf8mb4"},
+		},
+		{
+			name:     "update without target options",
+			existing: []runtime.Object{newTestOnecloudCluster("v3.8.5", "registry.example.com/yunion", "")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiv1.InitConfiguration{}
+			cfg.MysqlConnection = apiv1.MysqlConnection{
+				Server:                 "10.0.0.2",
+				Port:                   3307,
+				Username:               "admin",
+				Password:               "target",
+				MysqlConnectionOptions: tt.opts,
+			}
+			data := &clusterData{
+				cfg:           cfg,
+				dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), tt.existing...),
+			}
+			if err := restoreOnecloudCluster(data, dir, ocObj); err != nil {
+				t.Fatalf("restoreOnecloudCluster() error = %v", err)
+			}
+			obj, err := data.GetDefaultCluster()
+			if err != nil {
+				t.Fatal(err)
+			}
+			oc := new(v1alpha1.OnecloudCluster)
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, oc); err != nil {
+				t.Fatal(err)
+			}
+			if oc.Annotations["example.com/note"] != "kept" {
+				t.Errorf("annotations of backup aren't kept: %v", oc.Annotations)
+			}
+			got, err := ocutil.GetOCMysqlConnection(oc)
+			if err != nil {
+				t.Fatalf("GetOCMysqlConnection() error = %v", err)
+			}
+			want := cfg.MysqlConnection
+			apiv1.SetDefaults_MysqlConnection(&want)
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("restored mysql connection = %#v, want %#v", *got, want)
+			}
+		})
+	}
+}
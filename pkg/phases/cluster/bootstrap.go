@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/onecloud/pkg/mcclient"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/phases/topology"
+)
+
+type bootstrapOptions struct {
+	file   string
+	dryRun bool
+}
+
+func NewCmdBootstrap(out io.Writer) *cobra.Command {
+	opt := &bootstrapOptions{}
+	cmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Reconcile onecloud regions, zones, wires, networks and schedtags described in a topology file",
+		Long: `Reconcile onecloud regions, zones, wires, networks and schedtags described in a topology file.
+
+Missing resources are created and the differing fields of existing ones are updated,
+so the command can be run repeatedly. Resources not in the file are left untouched.
+
+Example topology file:
+
+  region: region0
+  zones:
+  - name: zone0
+    wires:
+    - name: bcast0
+      bandwidth: 1000
+      networks:
+      - name: guest0
+        startIP: 10.168.222.100
+        endIP: 10.168.222.200
+        maskLen: 24
+        gateway: 10.168.222.1
+  schedtags:
+  - name: ssd
+    strategy: prefer
+    dynamic:
+    - name: ssd-hosts
+      condition: host.storages.contains(storage_type="ssd")
+`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if opt.file == "" {
+				kubeadmutil.CheckErr(errors.New("topology file must be specified by --file"))
+			}
+			t, err := topology.LoadTopology(opt.file)
+			kubeadmutil.CheckErr(err)
+
+			data, err := newClusterData(cmd, args)
+			kubeadmutil.CheckErr(err)
+
+			s, err := getClusterAdminSession(data, t.Region)
+			kubeadmutil.CheckErr(err)
+
+			report, err := topology.Bootstrap(s, t, opt.dryRun)
+			if report != nil {
+				report.Print(out)
+			}
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	AddBootstrapOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddBootstrapOptions(flagSet *flag.FlagSet, opt *bootstrapOptions) {
+	flagSet.StringVarP(&opt.file, "file", "f", opt.file, "topology yaml file")
+	flagSet.BoolVar(&opt.dryRun, "dry-run", opt.dryRun, "only print the changes that would be made")
+}
+
+// getClusterAdminSession authenticates to keystone of the cluster as sysadmin and returns session of the region,
+// the region of cluster is used if region is empty
+func getClusterAdminSession(data *clusterData, region string) (*mcclient.ClientSession, error) {
+	oc, err := data.client.OnecloudV1alpha1().OnecloudClusters(constants.OnecloudNamespace).Get(DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	authURL, err := getClusterAuthURL(data, oc)
+	if err != nil {
+		return nil, errors.Wrap(err, "get auth url")
+	}
+	cli := mcclient.NewClient(authURL, 30, false, true, "", "")
+	token, err := cli.AuthenticateWithSource(
+		operatorconstants.SysAdminUsername, oc.Spec.Keystone.BootstrapPassword,
+		operatorconstants.DefaultDomain, operatorconstants.SysAdminProject, "", mcclient.AuthSourceCli)
+	if err != nil {
+		return nil, errors.Wrapf(err, "authenticate to %s", authURL)
+	}
+	if region == "" {
+		region = oc.Spec.Region
+	}
+	return cli.NewSession(context.Background(), region, "", constants.EndpointTypePublic, token, ""), nil
+}
@@ -25,13 +25,13 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/klog"
+	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/validation"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
 
 	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
 	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
 	"yunion.io/x/onecloud-operator/pkg/client/clientset/versioned"
-	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
 	"yunion.io/x/onecloud-operator/pkg/util/image"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
@@ -245,7 +245,10 @@ func CreateCluster(data *clusterData, opt *createOptions) (ICluster, error) {
 		}
 		cObj = oc
 	} else {
-		cluster := newUnstructCluster(cfg, opt)
+		cluster, err := newUnstructCluster(cfg, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "new cluster")
+		}
 		cluster, err = data.GetOnecloudClusterCli().Namespace(constants.OnecloudNamespace).Create(cluster, metav1.CreateOptions{})
 		if err != nil {
 			return nil, errors.Wrap(err, "create cluster use dynamic client")
@@ -261,7 +264,7 @@ func CreateCluster(data *clusterData, opt *createOptions) (ICluster, error) {
 	return cObj, nil
 }
 
-func newCluster(cfg *apiv1.InitConfiguration, opt *createOptions) *v1alpha1.OnecloudCluster {
+func newCluster(cfg *apiv1.InitConfiguration, opt *createOptions) (*v1alpha1.OnecloudCluster, error) {
 	lbEndpoint := cfg.ControlPlaneEndpoint
 	if lbEndpoint != "" {
 		lbEndpoint = strings.Split(lbEndpoint, ":")[0]
@@ -295,10 +298,16 @@ func newCluster(cfg *apiv1.InitConfiguration, opt *createOptions) *v1alpha1.Onec
 	} else {
 		ocutil.SetOCUseCE(oc)
 	}
-	return oc
+	if err := ocutil.CheckOperatorMysqlTLS(cfg.MysqlConnection.MysqlConnectionOptions); err != nil {
+		return nil, err
+	}
+	if err := ocutil.SetOCMysqlOptions(oc, cfg.MysqlConnection.MysqlConnectionOptions); err != nil {
+		return nil, err
+	}
+	return oc, nil
 }
 
-func newUnstructCluster(cfg *apiv1.InitConfiguration, opt *createOptions) *unstructured.Unstructured {
+func newUnstructCluster(cfg *apiv1.InitConfiguration, opt *createOptions) (*unstructured.Unstructured, error) {
 	lbEndpoint := cfg.ControlPlaneEndpoint
 	if lbEndpoint != "" {
 		lbEndpoint = strings.Split(lbEndpoint, ":")[0]
@@ -342,9 +351,15 @@ func newUnstructCluster(cfg *apiv1.InitConfiguration, opt *createOptions) *unstr
 	if opt.useEE {
 		anno[operatorconstants.OnecloudEditionAnnotationKey] = operatorconstants.OnecloudEnterpriseEdition
 	}
+	if err := ocutil.CheckOperatorMysqlTLS(cfg.MysqlConnection.MysqlConnectionOptions); err != nil {
+		return nil, err
+	}
+	if err := ocutil.SetMysqlOptionsAnnotation(anno, cfg.MysqlConnection.MysqlConnectionOptions); err != nil {
+		return nil, err
+	}
 	obj.SetAnnotations(anno)
 
-	return obj
+	return obj, nil
 }
 
 func newCluster2(env map[string]string, cfg *apiv1.InitConfiguration, opt *createOptions) (*v1alpha1.OnecloudCluster, error) {
@@ -605,12 +620,10 @@ func GetClusterRCAdmin(data *clusterData) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cfg, err := occonfig.GetClusterConfigByClient(data.k8sClient, cluster)
+	authURL, err := getClusterAuthURL(data, cluster)
 	if err != nil {
 		return "", err
 	}
-	keystonePort := cfg.Keystone.Port
-	authURL := fmt.Sprintf("https://%s:%d/v3", cluster.Spec.LoadBalancerEndpoint, keystonePort)
 	passwd := cluster.Spec.Keystone.BootstrapPassword
 	return fmt.Sprintf(
 		`export OS_AUTH_URL=%s
@@ -653,6 +666,10 @@ type updateOptions struct {
 	operatorOnly              bool
 	useEE                     bool
 	useCE                     bool
+	plan                      bool
+	rollbackOnFailure         bool
+	ignorePreflightErrors     []string
+	insecureRegistries        []string
 }
 
 func newUpdateOptions() *updateOptions {
@@ -665,8 +682,21 @@ func NewCmdUpdate(out io.Writer) *cobra.Command {
 		Use:   "update",
 		Short: "Run this command to update onecloud cluster",
 		Run: func(cmd *cobra.Command, args []string) {
+			ignorePreflightErrors, err := validation.ValidateIgnorePreflightErrors(opt.ignorePreflightErrors, nil)
+			kubeadmutil.CheckErr(err)
 			data, err := newClusterData(cmd, args)
 			kubeadmutil.CheckErr(err)
+			plan, err := newUpdatePlan(data, opt)
+			kubeadmutil.CheckErr(err)
+			plan.Print(out)
+			err = plan.Check(data, opt, ignorePreflightErrors, out)
+			kubeadmutil.CheckErr(err)
+			if opt.plan {
+				return
+			}
+			if opt.rollbackOnFailure {
+				opt.wait = true
+			}
 			err = updateCluster(data, opt)
 			kubeadmutil.CheckErr(err)
 		},
@@ -685,6 +715,13 @@ func AddUpdateOptions(flagSet *flag.FlagSet, opt *updateOptions) {
 	flagSet.BoolVar(&opt.wait, "wait", opt.wait, "wait until workload updated")
 	flagSet.BoolVar(&opt.useEE, "use-ee", opt.useEE, "use enterprise edition onecloud")
 	flagSet.BoolVar(&opt.useCE, "use-ce", opt.useCE, "use community edition onecloud")
+	flagSet.BoolVar(&opt.plan, "plan", opt.plan, "only print the update plan and run the pre-flight checks, do not change the cluster")
+	flagSet.BoolVar(&opt.rollbackOnFailure, "rollback-on-failure", opt.rollbackOnFailure, "rollback to previous version if the update does not converge, implies --wait")
+	flagSet.StringSliceVar(
+		&opt.ignorePreflightErrors, options.IgnorePreflightErrors, opt.ignorePreflightErrors,
+		"A list of checks whose errors will be shown as warnings. Example: 'DeploymentsHealth,ImageResolve'. Value 'all' ignores errors from all checks.",
+	)
+	flagSet.StringSliceVar(&opt.insecureRegistries, options.InsecureRegistry, opt.insecureRegistries, "Registries allowed plain http and skipping tls verification when resolving images, e.g. 192.168.0.1:5000")
 }
 
 func GetUnstructString(obj *unstructured.Unstructured, fields ...string) (string, error) {
@@ -699,6 +736,30 @@ func GetUnstructString(obj *unstructured.Unstructured, fields ...string) (string
 }
 
 func updateCluster(data *clusterData, opt *updateOptions) error {
+	rev, err := newUpdateRevision(data)
+	if err != nil {
+		return errors.Wrap(err, "get current update revision")
+	}
+	changed := *rev.applyOptions(opt) != *rev
+	if changed {
+		if err := saveUpdateRevision(data, rev); err != nil {
+			return errors.Wrap(err, "save update revision")
+		}
+	}
+	if err := applyClusterUpdate(data, opt); err != nil {
+		if !opt.rollbackOnFailure || !changed {
+			return err
+		}
+		klog.Errorf("[upgrade] Update cluster failed: %v, rolling back", err)
+		if rbErr := rollbackCluster(data, rev, true); rbErr != nil {
+			return errors.Wrapf(rbErr, "rollback after update failure %v", err)
+		}
+		return errors.Wrap(err, "update cluster failed and rolled back")
+	}
+	return nil
+}
+
+func applyClusterUpdate(data *clusterData, opt *updateOptions) error {
 	operator, err := data.GetOperator()
 	if err != nil {
 		return errors.Wrap(err, "get onecloud operator")
@@ -707,25 +768,7 @@ func updateCluster(data *clusterData, opt *updateOptions) error {
 	if err != nil {
 		return errors.Wrap(err, "get operator image reference")
 	}
-	reg := ref.Repository
-	imgName := ref.Image
-	version := ref.Tag
-	digest := ref.Digest
-	if opt.operatorVersion != "" {
-		if opt.operatorVersion != version {
-			version = opt.operatorVersion
-		}
-	}
-	if opt.imageRepository != "" {
-		if opt.imageRepository != reg {
-			reg = opt.imageRepository
-		}
-	}
-	imgStr := fmt.Sprintf("%s/%s:%s", reg, imgName, version)
-	if version == "" && digest != "" {
-		imgStr = fmt.Sprintf("%s/%s@%s", reg, imgName, digest)
-	}
-	operator.Spec.Template.Spec.Containers[0].Image = imgStr
+	operator.Spec.Template.Spec.Containers[0].Image = getTargetOperatorImage(ref, opt)
 	if _, err := data.k8sClient.AppsV1().Deployments(constants.OnecloudNamespace).Update(operator); err != nil {
 		return errors.Wrap(err, "update operator")
 	}
@@ -735,13 +778,7 @@ func updateCluster(data *clusterData, opt *updateOptions) error {
 	}
 
 	if opt.wait {
-		rollout, err := data.kubeClient.Rollout()
-		if err != nil {
-			return errors.Wrap(err, "get rollout cmd")
-		}
-		if err := rollout.Status(0).
-			SetNamespace(constants.OnecloudNamespace).
-			RunDeployment(operator.GetName()); err != nil {
+		if err := waitOperatorRollout(data, operator.GetName()); err != nil {
 			return err
 		}
 	}
@@ -810,16 +847,7 @@ func updateCluster(data *clusterData, opt *updateOptions) error {
 			return errors.Wrap(err, "update default onecloud cluster")
 		}
 		if opt.wait {
-			if err := ocutil.WaitOnecloudDeploymentUpdated(data.client, oc.GetName(), oc.GetNamespace(), 30*time.Minute, nil); err != nil {
-				return errors.Wrap(err, "wait onecloud cluster updated")
-			}
-			rollout, err := data.kubeClient.Rollout()
-			if err != nil {
-				return errors.Wrap(err, "get rollout cmd")
-			}
-			if err := rollout.Status(0).
-				SetNamespace(constants.OnecloudNamespace).
-				RunDeployment(fmt.Sprintf("%s-web", oc.GetName())); err != nil {
+			if err := waitClusterUpdated(data, oc); err != nil {
 				return err
 			}
 		}
@@ -827,6 +855,29 @@ func updateCluster(data *clusterData, opt *updateOptions) error {
 	return nil
 }
 
+func waitOperatorRollout(data *clusterData, name string) error {
+	rollout, err := data.kubeClient.Rollout()
+	if err != nil {
+		return errors.Wrap(err, "get rollout cmd")
+	}
+	return rollout.Status(0).
+		SetNamespace(constants.OnecloudNamespace).
+		RunDeployment(name)
+}
+
+func waitClusterUpdated(data *clusterData, oc *unstructured.Unstructured) error {
+	if err := ocutil.WaitOnecloudDeploymentUpdated(data.client, oc.GetName(), oc.GetNamespace(), 30*time.Minute, nil); err != nil {
+		return errors.Wrap(err, "wait onecloud cluster updated")
+	}
+	rollout, err := data.kubeClient.Rollout()
+	if err != nil {
+		return errors.Wrap(err, "get rollout cmd")
+	}
+	return rollout.Status(0).
+		SetNamespace(constants.OnecloudNamespace).
+		RunDeployment(fmt.Sprintf("%s-web", oc.GetName()))
+}
+
 func getRepoImageName(img string) (string, string, string, error) {
 	ret, err := image.ParseImageReference(img)
 	if err != nil {
@@ -0,0 +1,465 @@
+package cluster
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
+
+	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/apis/scheme"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+type restoreOptions struct {
+	force        bool
+	skipDatabase bool
+	skipFiles    bool
+	etcdDataDir  string
+}
+
+func newRestoreOptions() *restoreOptions {
+	return &restoreOptions{}
+}
+
+func NewCmdRestore(out io.Writer) *cobra.Command {
+	opt := newRestoreOptions()
+	cmd := &cobra.Command{
+		Use:   "restore BACKUP_FILE",
+		Short: "Restore onecloud databases and configuration from a backup archive",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := newClusterData(cmd, args)
+			kubeadmutil.CheckErr(err)
+
+			err = restoreCluster(data, args[0], opt, out)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddRestoreOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddRestoreOptions(flagSet *flag.FlagSet, opt *restoreOptions) {
+	flagSet.BoolVar(&opt.force, "force", opt.force, "restore even if the onecloud or operator version of the target cluster mismatches the backup")
+	flagSet.BoolVar(&opt.skipDatabase, "skip-database", opt.skipDatabase, "do not restore onecloud databases")
+	flagSet.BoolVar(&opt.skipFiles, "skip-files", opt.skipFiles, fmt.Sprintf("do not restore files under %s", constants.OnecloudConfigDir))
+	flagSet.StringVar(&opt.etcdDataDir, "etcd-data-dir", opt.etcdDataDir, "restore etcd snapshot into this new data dir by etcdctl, the etcd static pod should be switched to it manually")
+}
+
+// extractArchive extracts the backup archive into dir and returns the manifest of it
+func extractArchive(filename string, dir string) (*BackupManifest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open archive %s", filename)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read gzip archive %s", filename)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return nil, errors.Wrapf(err, "extract %s", hdr.Name)
+		}
+		out.Close()
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, backupManifestFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", backupManifestFile)
+	}
+	manifest := new(BackupManifest)
+	if err := yaml.Unmarshal(content, manifest); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", backupManifestFile)
+	}
+	if manifest.FormatVersion != BackupFormatVersion {
+		return nil, errors.Errorf("unsupported backup format version %q, expected %q", manifest.FormatVersion, BackupFormatVersion)
+	}
+	return manifest, nil
+}
+
+// checkRestoreTarget refuses to restore the backup into a cluster running different onecloud or operator version
+func checkRestoreTarget(data *clusterData, manifest *BackupManifest) error {
+	onecloudVersion := data.cfg.OnecloudVersion
+	oc, err := data.GetDefaultCluster()
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrap(err, "get default onecloud cluster")
+		}
+	} else {
+		onecloudVersion, err = GetUnstructString(oc, "spec", "version")
+		if err != nil {
+			return errors.Wrap(err, "get onecloud cluster version")
+		}
+	}
+	if onecloudVersion != manifest.OnecloudVersion {
+		return errors.Errorf("onecloud version of backup is %q, but target cluster is %q", manifest.OnecloudVersion, onecloudVersion)
+	}
+
+	operator, err := data.GetOperator()
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "get onecloud operator")
+	}
+	ref, err := getOperatorImage(operator)
+	if err != nil {
+		return errors.Wrap(err, "get operator image reference")
+	}
+	if ref.Tag != manifest.OperatorVersion {
+		return errors.Errorf("operator version of backup is %q, but target cluster is %q", manifest.OperatorVersion, ref.Tag)
+	}
+	return nil
+}
+
+func restoreCluster(data *clusterData, filename string, opt *restoreOptions, out io.Writer) error {
+	tmpDir, err := ioutil.TempDir("", "ocadm-restore")
+	if err != nil {
+		return errors.Wrap(err, "create temporary directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := extractArchive(filename, tmpDir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[restore] Backup created at %s, onecloud version %s, operator version %s\n",
+		manifest.CreatedAt, manifest.OnecloudVersion, manifest.OperatorVersion)
+
+	if err := checkRestoreTarget(data, manifest); err != nil {
+		if !opt.force {
+			return errors.Wrap(err, "target cluster mismatches the backup, use --force to ignore")
+		}
+		klog.Warningf("[restore] %v", err)
+	}
+
+	if !opt.skipFiles {
+		if err := restoreConfigFiles(tmpDir, constants.OnecloudConfigDir, manifest, out); err != nil {
+			return err
+		}
+	}
+
+	var ocObj *BackupObject
+	for i, obj := range manifest.Objects {
+		if obj.Kind == backupKindOnecloudCluster {
+			ocObj = &manifest.Objects[i]
+			continue
+		}
+		fmt.Fprintf(out, "[restore] Restoring %s %s/%s\n", obj.Kind, obj.Namespace, obj.Name)
+		if err := restoreObject(data, tmpDir, obj); err != nil {
+			return err
+		}
+	}
+
+	if !opt.skipDatabase && len(manifest.Databases) != 0 {
+		if ocObj == nil {
+			return errors.Errorf("%s not found in backup", backupKindOnecloudCluster)
+		}
+		if err := restoreDatabases(data, tmpDir, ocObj, manifest, out); err != nil {
+			return err
+		}
+	}
+
+	if ocObj != nil {
+		fmt.Fprintf(out, "[restore] Restoring %s %s/%s\n", ocObj.Kind, ocObj.Namespace, ocObj.Name)
+		if err := restoreOnecloudCluster(data, tmpDir, ocObj); err != nil {
+			return err
+		}
+	}
+
+	if manifest.EtcdSnapshot != "" {
+		snapshot := filepath.Join(tmpDir, manifest.EtcdSnapshot)
+		if opt.etcdDataDir == "" {
+			fmt.Fprintf(out, "[restore] Skip restoring etcd snapshot, use --etcd-data-dir to restore it\n")
+		} else {
+			fmt.Fprintf(out, "[restore] Restoring etcd snapshot into %s\n", opt.etcdDataDir)
+			if err := restoreEtcdSnapshot(snapshot, opt.etcdDataDir); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(out, "[restore] Cluster restored from %s\n", filename)
+	return nil
+}
+
+// restoreConfigFiles writes the backup files back, the files outside of configDir are refused
+func restoreConfigFiles(dir string, configDir string, manifest *BackupManifest, out io.Writer) error {
+	files := make([]string, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		cleaned := filepath.Clean(file)
+		if !strings.HasPrefix(cleaned, filepath.Clean(configDir)+string(filepath.Separator)) {
+			return errors.Errorf("file %q of backup is not under %s", file, configDir)
+		}
+		files = append(files, cleaned)
+	}
+	for i, file := range files {
+		src := filepath.Join(dir, backupFilesDir, file)
+		if _, err := os.Stat(file); err == nil {
+			backup := file + ".backup"
+			if err := os.Rename(file, backup); err != nil {
+				return errors.Wrapf(err, "rename %s to %s", file, backup)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			return errors.Wrapf(err, "read %s from backup", file)
+		}
+		mode := restoreFileMode(file, manifest.FileModes[manifest.Files[i]])
+		if err := ioutil.WriteFile(file, content, mode); err != nil {
+			return errors.Wrapf(err, "write %s", file)
+		}
+		if err := os.Chmod(file, mode); err != nil {
+			return errors.Wrapf(err, "chmod %s", file)
+		}
+		fmt.Fprintf(out, "[restore] Restored file %s\n", file)
+	}
+	return nil
+}
+
+// restoreFileMode returns the recorded mode of file, keys are only readable by owner if mode isn't recorded
+func restoreFileMode(file string, recorded os.FileMode) os.FileMode {
+	if recorded.Perm() != 0 {
+		return recorded.Perm()
+	}
+	if strings.HasSuffix(file, ".key") {
+		return 0600
+	}
+	return 0644
+}
+
+func cleanObjectMeta(meta *metav1.ObjectMeta) {
+	meta.ResourceVersion = ""
+	meta.UID = ""
+	meta.SelfLink = ""
+	meta.CreationTimestamp = metav1.Time{}
+	meta.OwnerReferences = nil
+}
+
+func restoreObject(data *clusterData, dir string, obj BackupObject) error {
+	content, err := ioutil.ReadFile(filepath.Join(dir, obj.File))
+	if err != nil {
+		return errors.Wrapf(err, "read %s from backup", obj.File)
+	}
+	switch obj.Kind {
+	case backupKindConfigMap:
+		cm := new(corev1.ConfigMap)
+		if err := yaml.Unmarshal(content, cm); err != nil {
+			return errors.Wrapf(err, "unmarshal %s", obj.File)
+		}
+		cleanObjectMeta(&cm.ObjectMeta)
+		if cm.GetNamespace() == metav1.NamespaceSystem && cm.GetName() == constants.OnecloudAdminConfigConfigMap {
+			if err := overrideAdminConfigMysql(cm, data.cfg.MysqlConnection); err != nil {
+				return err
+			}
+		}
+		return apiclient.CreateOrUpdateConfigMap(data.k8sClient, cm)
+	case backupKindSecret:
+		secret := new(corev1.Secret)
+		if err := yaml.Unmarshal(content, secret); err != nil {
+			return errors.Wrapf(err, "unmarshal %s", obj.File)
+		}
+		cleanObjectMeta(&secret.ObjectMeta)
+		return apiclient.CreateOrUpdateSecret(data.k8sClient, secret)
+	default:
+		return errors.Errorf("unsupported object kind %q", obj.Kind)
+	}
+}
+
+// UpdateAdminConfigMysql replaces the mysql connection of cluster configuration stored in ocadm-config
+func UpdateAdminConfigMysql(client kubernetes.Interface, conn apiv1.MysqlConnection) error {
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(constants.OnecloudAdminConfigConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "get configmap %s", constants.OnecloudAdminConfigConfigMap)
+	}
+	if err := overrideAdminConfigMysql(cm, conn); err != nil {
+		return err
+	}
+	return apiclient.CreateOrUpdateConfigMap(client, cm)
+}
+
+// overrideAdminConfigMysql keeps the mysql connection of the target cluster in the restored ocadm-config
+func overrideAdminConfigMysql(cm *corev1.ConfigMap, conn apiv1.MysqlConnection) error {
+	clusterCfg := new(apiv1.ClusterConfiguration)
+	if err := runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), []byte(cm.Data[constants.ClusterConfigurationConfigMapKey]), clusterCfg); err != nil {
+		return errors.Wrap(err, "decode cluster configuration of backup")
+	}
+	clusterCfg.MysqlConnection = conn
+	content, err := configutil.MarshalOcadmConfigObject(clusterCfg)
+	if err != nil {
+		return errors.Wrap(err, "marshal cluster configuration")
+	}
+	cm.Data[constants.ClusterConfigurationConfigMapKey] = string(content)
+	return nil
+}
+
+func restoreDatabases(data *clusterData, dir string, ocObj *BackupObject, manifest *BackupManifest, out io.Writer) error {
+	// passwords of database users are read from the restored cluster config
+	oc := &v1alpha1.OnecloudCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ocObj.Name,
+			Namespace: ocObj.Namespace,
+		},
+	}
+	ocCfg, err := occonfig.GetClusterConfigByClient(data.k8sClient, oc)
+	if err != nil {
+		return errors.Wrap(err, "get restored onecloud cluster config")
+	}
+	dbCfgs := make(map[string]ocutil.ServiceDBConfig)
+	for _, db := range ocutil.GetServiceDBConfigs(ocCfg) {
+		dbCfgs[db.Database] = db
+	}
+
+	conn, err := mysql.NewConnection(&data.cfg.MysqlConnection)
+	if err != nil {
+		return errors.Wrap(err, "connect to mysql")
+	}
+	defer conn.Close()
+	for _, db := range manifest.Databases {
+		fmt.Fprintf(out, "[restore] Restoring database %s of service %s\n", db.Database, db.Service)
+		if err := restoreDatabaseFromFile(conn, db.Database, filepath.Join(dir, db.File)); err != nil {
+			return err
+		}
+		dbCfg, ok := dbCfgs[db.Database]
+		if !ok {
+			klog.Warningf("[restore] Database %s not found in cluster config, skip creating user", db.Database)
+			continue
+		}
+		if err := configutil.InitDBUser(conn, apiv1.DBInfo{
+			Database: dbCfg.Database,
+			Username: dbCfg.Username,
+			Password: dbCfg.Password,
+
+			MysqlConnectionOptions: data.cfg.MysqlConnection.MysqlConnectionOptions,
+		}); err != nil {
+			return errors.Wrapf(err, "init user of database %s", db.Database)
+		}
+	}
+	return nil
+}
+
+func restoreDatabaseFromFile(conn *mysql.Connection, db string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := conn.RestoreDatabase(db, f); err != nil {
+		return errors.Wrapf(err, "restore database %s", db)
+	}
+	return nil
+}
+
+func restoreOnecloudCluster(data *clusterData, dir string, ocObj *BackupObject) error {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ocObj.File))
+	if err != nil {
+		return errors.Wrapf(err, "read %s from backup", ocObj.File)
+	}
+	obj := new(unstructured.Unstructured)
+	if err := yaml.Unmarshal(content, &obj.Object); err != nil {
+		return errors.Wrapf(err, "unmarshal %s", ocObj.File)
+	}
+	for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp", "generation", "ownerReferences"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	mysqlConn := data.cfg.MysqlConnection
+	if err := unstructured.SetNestedField(obj.Object, map[string]interface{}{
+		"host":     mysqlConn.Server,
+		"port":     int64(mysqlConn.Port),
+		"username": mysqlConn.Username,
+		"password": mysqlConn.Password,
+	}, "spec", "mysql"); err != nil {
+		return errors.Wrap(err, "set mysql of onecloud cluster")
+	}
+	// the options of the backup cluster's mysql don't apply to the target
+	anno := obj.GetAnnotations()
+	if anno == nil {
+		anno = make(map[string]string)
+	}
+	if err := ocutil.SetMysqlOptionsAnnotation(anno, mysqlConn.MysqlConnectionOptions); err != nil {
+		return err
+	}
+	obj.SetAnnotations(anno)
+
+	cli := data.GetOnecloudClusterCli().Namespace(obj.GetNamespace())
+	old, err := cli.Get(obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "get onecloud cluster %s", obj.GetName())
+		}
+		if _, err := cli.Create(obj, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "create onecloud cluster %s", obj.GetName())
+		}
+		return nil
+	}
+	obj.SetResourceVersion(old.GetResourceVersion())
+	if _, err := cli.Update(obj, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "update onecloud cluster %s", obj.GetName())
+	}
+	return nil
+}
+
+func restoreEtcdSnapshot(snapshot string, dataDir string) error {
+	if _, err := os.Stat(dataDir); err == nil {
+		return errors.Errorf("etcd data dir %s already exists", dataDir)
+	}
+	cmd := exec.Command("etcdctl", "snapshot", "restore", snapshot, "--data-dir", dataDir)
+	cmd.Env = append(os.Environ(), "ETCDCTL_API=3")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "etcdctl snapshot restore: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
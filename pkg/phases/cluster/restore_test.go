@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	extractDir := filepath.Join(dir, "extract")
+	configDir := filepath.Join(dir, "etc", "yunion")
+
+	writeBackupFile := func(file string, content string) {
+		p := filepath.Join(extractDir, backupFilesDir, file)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	regionConf := filepath.Join(configDir, "region.conf")
+	caKey := filepath.Join(configDir, "pki", "ca.key")
+	climcKey := filepath.Join(configDir, "pki", "climc.key")
+	writeBackupFile(regionConf, "region: region0\n")
+	writeBackupFile(caKey, "ca key")
+	writeBackupFile(climcKey, "climc key")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(regionConf, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &BackupManifest{
+		Files: []string{regionConf, caKey, climcKey},
+		// the climc key mode isn't recorded by older archives
+		FileModes: map[string]os.FileMode{regionConf: 0640, caKey: 0600},
+	}
+	if err := restoreConfigFiles(extractDir, configDir, manifest, ioutil.Discard); err != nil {
+		t.Fatalf("restoreConfigFiles() error = %v", err)
+	}
+	for file, want := range map[string]os.FileMode{
+		regionConf: 0640,
+		caKey:      0600,
+		climcKey:   0600,
+	} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Errorf("stat restored %s: %v", file, err)
+			continue
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("restored %s mode = %v, want %v", file, info.Mode().Perm(), want)
+		}
+	}
+	if content, err := ioutil.ReadFile(regionConf + ".backup"); err != nil || string(content) != "old" {
+		t.Errorf("existing file should be kept as .backup, content %q, error %v", content, err)
+	}
+}
+
+func TestRestoreConfigFilesOutsideConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configDir := filepath.Join(dir, "etc", "yunion")
+	victim := filepath.Join(dir, "etc", "passwd")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(victim, []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{
+		configDir + "/../passwd",
+		victim,
+		configDir,
+		configDir + "-other/region.conf",
+	} {
+		manifest := &BackupManifest{
+			Files: []string{filepath.Join(configDir, "region.conf"), file},
+		}
+		if err := restoreConfigFiles(filepath.Join(dir, "extract"), configDir, manifest, ioutil.Discard); err == nil {
+			t.Errorf("restoreConfigFiles() of %q should fail", file)
+		}
+		if content, err := ioutil.ReadFile(victim); err != nil || string(content) != "root" {
+			t.Errorf("file outside of %s is touched by restoring %q, content %q, error %v", configDir, file, content, err)
+		}
+		if _, err := os.Stat(victim + ".backup"); !os.IsNotExist(err) {
+			t.Errorf("file outside of %s is renamed by restoring %q", configDir, file)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/onecloud-operator/pkg/util/image"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+)
+
+const (
+	// UpdateRevisionConfigMap stores the cluster state recorded before the last update
+	UpdateRevisionConfigMap    = "ocadm-update-revision"
+	UpdateRevisionConfigMapKey = "revision"
+)
+
+// updateRevision is the state of cluster changed by `cluster update`
+type updateRevision struct {
+	OperatorImage   string `json:"operatorImage"`
+	Version         string `json:"version"`
+	ImageRepository string `json:"imageRepository"`
+	Edition         string `json:"edition"`
+}
+
+// newUpdateRevision returns the current revision of cluster
+func newUpdateRevision(data *clusterData) (*updateRevision, error) {
+	operator, err := data.GetOperator()
+	if err != nil {
+		return nil, errors.Wrap(err, "get onecloud operator")
+	}
+	oc, err := data.GetDefaultCluster()
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	version, err := GetUnstructString(oc, "spec", "version")
+	if err != nil {
+		return nil, err
+	}
+	repo, err := GetUnstructString(oc, "spec", "imageRepository")
+	if err != nil {
+		return nil, err
+	}
+	return &updateRevision{
+		OperatorImage:   operator.Spec.Template.Spec.Containers[0].Image,
+		Version:         version,
+		ImageRepository: repo,
+		Edition:         oc.GetAnnotations()[operatorconstants.OnecloudEditionAnnotationKey],
+	}, nil
+}
+
+// applyOptions returns the revision after updating cluster with opt
+func (rev updateRevision) applyOptions(opt *updateOptions) *updateRevision {
+	ret := rev
+	ref, err := image.ParseImageReference(rev.OperatorImage)
+	if err == nil {
+		ret.OperatorImage = getTargetOperatorImage(ref, opt)
+	}
+	if opt.operatorOnly {
+		return &ret
+	}
+	if opt.version != "" {
+		ret.Version = opt.version
+	}
+	if opt.imageRepository != "" {
+		ret.ImageRepository = opt.imageRepository
+	}
+	ret.Edition = getTargetEdition(rev.Edition, opt)
+	return &ret
+}
+
+func saveUpdateRevision(data *clusterData, rev *updateRevision) error {
+	content, err := yaml.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	return apiclient.CreateOrUpdateConfigMap(data.k8sClient, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      UpdateRevisionConfigMap,
+			Namespace: constants.OnecloudNamespace,
+		},
+		Data: map[string]string{
+			UpdateRevisionConfigMapKey: string(content),
+		},
+	})
+}
+
+func getUpdateRevision(data *clusterData) (*updateRevision, error) {
+	cm, err := data.k8sClient.CoreV1().ConfigMaps(constants.OnecloudNamespace).Get(UpdateRevisionConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errors.Errorf("no update revision recorded, cluster has not been updated by ocadm")
+		}
+		return nil, errors.Wrapf(err, "get configmap %s", UpdateRevisionConfigMap)
+	}
+	rev := new(updateRevision)
+	if err := yaml.Unmarshal([]byte(cm.Data[UpdateRevisionConfigMapKey]), rev); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal update revision")
+	}
+	if rev.OperatorImage == "" || rev.Version == "" {
+		return nil, errors.Errorf("invalid update revision %#v", rev)
+	}
+	return rev, nil
+}
+
+// rollbackCluster restores the operator image and onecloud cluster to the revision
+func rollbackCluster(data *clusterData, rev *updateRevision, wait bool) error {
+	operator, err := data.GetOperator()
+	if err != nil {
+		return errors.Wrap(err, "get onecloud operator")
+	}
+	if operator.Spec.Template.Spec.Containers[0].Image != rev.OperatorImage {
+		operator.Spec.Template.Spec.Containers[0].Image = rev.OperatorImage
+		if _, err := data.k8sClient.AppsV1().Deployments(constants.OnecloudNamespace).Update(operator); err != nil {
+			return errors.Wrap(err, "rollback operator")
+		}
+	}
+	if wait {
+		if err := waitOperatorRollout(data, operator.GetName()); err != nil {
+			return err
+		}
+	}
+
+	oc, err := data.GetDefaultCluster()
+	if err != nil {
+		return errors.Wrap(err, "get default onecloud cluster")
+	}
+	unstructured.SetNestedField(oc.Object, rev.Version, "spec", "version")
+	unstructured.SetNestedField(oc.Object, rev.ImageRepository, "spec", "imageRepository")
+	anno := oc.GetAnnotations()
+	if anno == nil {
+		anno = make(map[string]string)
+	}
+	if rev.Edition == "" {
+		delete(anno, operatorconstants.OnecloudEditionAnnotationKey)
+	} else {
+		anno[operatorconstants.OnecloudEditionAnnotationKey] = rev.Edition
+	}
+	oc.SetAnnotations(anno)
+	if _, err := data.GetOnecloudClusterCli().Namespace(constants.OnecloudNamespace).Update(oc, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrap(err, "rollback default onecloud cluster")
+	}
+	if wait {
+		return waitClusterUpdated(data, oc)
+	}
+	return nil
+}
+
+type rollbackOptions struct {
+	wait bool
+}
+
+func newRollbackOptions() *rollbackOptions {
+	return &rollbackOptions{
+		wait: true,
+	}
+}
+
+func NewCmdRollback(out io.Writer) *cobra.Command {
+	opt := newRollbackOptions()
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Rollback onecloud cluster to the version before last update",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := newClusterData(cmd, args)
+			kubeadmutil.CheckErr(err)
+			rev, err := getUpdateRevision(data)
+			kubeadmutil.CheckErr(err)
+			fmt.Fprintf(out, "[rollback] Rolling back to version %s, operator image %s\n", rev.Version, rev.OperatorImage)
+			err = rollbackCluster(data, rev, opt.wait)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	AddRollbackOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddRollbackOptions(flagSet *flag.FlagSet, opt *rollbackOptions) {
+	flagSet.BoolVar(&opt.wait, "wait", opt.wait, "wait until workload rolled back")
+}
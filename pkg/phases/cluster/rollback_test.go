@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+)
+
+func newTestOperator(image string) *appv1.Deployment {
+	return &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DefaultOperatorName,
+			Namespace: constants.OnecloudNamespace,
+		},
+		Spec: appv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "operator", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+func newTestOnecloudCluster(version string, repo string, edition string) *unstructured.Unstructured {
+	oc := &unstructured.Unstructured{}
+	oc.SetAPIVersion("onecloud.yunion.io/v1alpha1")
+	oc.SetKind("OnecloudCluster")
+	oc.SetName(DefaultClusterName)
+	oc.SetNamespace(constants.OnecloudNamespace)
+	unstructured.SetNestedField(oc.Object, version, "spec", "version")
+	unstructured.SetNestedField(oc.Object, repo, "spec", "imageRepository")
+	if edition != "" {
+		oc.SetAnnotations(map[string]string{operatorconstants.OnecloudEditionAnnotationKey: edition})
+	}
+	return oc
+}
+
+func newTestClusterData(objects []runtime.Object, oc *unstructured.Unstructured) *clusterData {
+	return &clusterData{
+		k8sClient:     fake.NewSimpleClientset(objects...),
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), oc),
+	}
+}
+
+func TestUpdateRevisionApplyOptions(t *testing.T) {
+	rev := updateRevision{
+		OperatorImage:   "registry.example.com/yunion/onecloud-operator:v3.8.5",
+		Version:         "v3.8.5",
+		ImageRepository: "registry.example.com/yunion",
+		Edition:         operatorconstants.OnecloudCommunityEdition,
+	}
+	tests := []struct {
+		name string
+		opt  *updateOptions
+		want updateRevision
+	}{
+		{
+			name: "no options",
+			opt:  &updateOptions{},
+			want: rev,
+		},
+		{
+			name: "version and edition",
+			opt:  &updateOptions{version: "v3.9.1", operatorVersion: "v3.9.1", useEE: true},
+			want: updateRevision{
+				OperatorImage:   "registry.example.com/yunion/onecloud-operator:v3.9.1",
+				Version:         "v3.9.1",
+				ImageRepository: "registry.example.com/yunion",
+				Edition:         operatorconstants.OnecloudEnterpriseEdition,
+			},
+		},
+		{
+			name: "image repository",
+			opt:  &updateOptions{imageRepository: "mirror.example.com/yunion"},
+			want: updateRevision{
+				OperatorImage:   "mirror.example.com/yunion/onecloud-operator:v3.8.5",
+				Version:         "v3.8.5",
+				ImageRepository: "mirror.example.com/yunion",
+				Edition:         operatorconstants.OnecloudCommunityEdition,
+			},
+		},
+		{
+			name: "operator only",
+			opt:  &updateOptions{version: "v3.9.1", operatorVersion: "v3.9.1", operatorOnly: true, useEE: true},
+			want: updateRevision{
+				OperatorImage:   "registry.example.com/yunion/onecloud-operator:v3.9.1",
+				Version:         "v3.8.5",
+				ImageRepository: "registry.example.com/yunion",
+				Edition:         operatorconstants.OnecloudCommunityEdition,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rev.applyOptions(tt.opt); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("applyOptions() = %#v, want %#v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRevisionRoundTrip(t *testing.T) {
+	data := newTestClusterData(
+		[]runtime.Object{newTestOperator("registry.example.com/yunion/onecloud-operator:v3.8.5")},
+		newTestOnecloudCluster("v3.8.5", "registry.example.com/yunion", operatorconstants.OnecloudEnterpriseEdition),
+	)
+	if _, err := getUpdateRevision(data); err == nil {
+		t.Fatalf("getUpdateRevision() without recorded revision should fail")
+	}
+
+	rev, err := newUpdateRevision(data)
+	if err != nil {
+		t.Fatalf("newUpdateRevision() error = %v", err)
+	}
+	want := &updateRevision{
+		OperatorImage:   "registry.example.com/yunion/onecloud-operator:v3.8.5",
+		Version:         "v3.8.5",
+		ImageRepository: "registry.example.com/yunion",
+		Edition:         operatorconstants.OnecloudEnterpriseEdition,
+	}
+	if !reflect.DeepEqual(rev, want) {
+		t.Fatalf("newUpdateRevision() = %#v, want %#v", rev, want)
+	}
+	if err := saveUpdateRevision(data, rev); err != nil {
+		t.Fatalf("saveUpdateRevision() error = %v", err)
+	}
+	// saving again updates the existing configmap
+	if err := saveUpdateRevision(data, rev); err != nil {
+		t.Fatalf("saveUpdateRevision() again error = %v", err)
+	}
+	got, err := getUpdateRevision(data)
+	if err != nil {
+		t.Fatalf("getUpdateRevision() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getUpdateRevision() = %#v, want %#v", got, want)
+	}
+}
+
+func TestGetUpdateRevisionInvalid(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      UpdateRevisionConfigMap,
+			Namespace: constants.OnecloudNamespace,
+		},
+		Data: map[string]string{
+			UpdateRevisionConfigMapKey: "version: v3.8.5\n",
+		},
+	}
+	data := newTestClusterData([]runtime.Object{cm}, newTestOnecloudCluster("v3.8.5", "", ""))
+	if _, err := getUpdateRevision(data); err == nil {
+		t.Errorf("getUpdateRevision() of revision without operator image should fail")
+	}
+}
+
+func TestRollbackCluster(t *testing.T) {
+	data := newTestClusterData(
+		[]runtime.Object{newTestOperator("registry.example.com/yunion/onecloud-operator:v3.9.1")},
+		newTestOnecloudCluster("v3.9.1", "mirror.example.com/yunion", operatorconstants.OnecloudEnterpriseEdition),
+	)
+	rev := &updateRevision{
+		OperatorImage:   "registry.example.com/yunion/onecloud-operator:v3.8.5",
+		Version:         "v3.8.5",
+		ImageRepository: "registry.example.com/yunion",
+	}
+	if err := rollbackCluster(data, rev, false); err != nil {
+		t.Fatalf("rollbackCluster() error = %v", err)
+	}
+
+	got, err := newUpdateRevision(data)
+	if err != nil {
+		t.Fatalf("newUpdateRevision() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, rev) {
+		t.Errorf("revision after rollback = %#v, want %#v", got, rev)
+	}
+	oc, err := data.GetDefaultCluster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := oc.GetAnnotations()[operatorconstants.OnecloudEditionAnnotationKey]; ok {
+		t.Errorf("edition annotation should be removed by rollback to revision without edition")
+	}
+}
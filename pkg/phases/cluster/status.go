@@ -0,0 +1,376 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
+	"yunion.io/x/onecloud-operator/pkg/util/image"
+	"yunion.io/x/onecloud/pkg/mcclient"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+const (
+	OutputFormatTable = "table"
+	OutputFormatJSON  = "json"
+	OutputFormatYAML  = "yaml"
+)
+
+// ClusterStatus is the health report of onecloud control plane
+type ClusterStatus struct {
+	Name       string            `json:"name"`
+	Version    string            `json:"version"`
+	Healthy    bool              `json:"healthy"`
+	Components []ComponentStatus `json:"components"`
+	Keystone   KeystoneStatus    `json:"keystone"`
+	Mysql      MysqlStatus       `json:"mysql"`
+}
+
+// ComponentStatus is the status of deployment or daemonset of onecloud component
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Ready   int32  `json:"ready"`
+	Desired int32  `json:"desired"`
+	Image   string `json:"image"`
+	Version string `json:"version"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeystoneStatus is the authentication and catalog endpoints status of keystone
+type KeystoneStatus struct {
+	AuthURL   string           `json:"authURL"`
+	Healthy   bool             `json:"healthy"`
+	Message   string           `json:"message,omitempty"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+// EndpointStatus is the reachability of service endpoint registered in keystone catalog
+type EndpointStatus struct {
+	Service   string `json:"service"`
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Message   string `json:"message,omitempty"`
+}
+
+// MysqlStatus is the connectivity of mysql used by onecloud services
+type MysqlStatus struct {
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+	Message   string `json:"message,omitempty"`
+}
+
+type statusOptions struct {
+	output  string
+	timeout time.Duration
+}
+
+func newStatusOptions() *statusOptions {
+	return &statusOptions{
+		output:  OutputFormatTable,
+		timeout: 5 * time.Second,
+	}
+}
+
+func NewCmdStatus(out io.Writer) *cobra.Command {
+	opt := newStatusOptions()
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the health status of onecloud cluster, exit with non-zero code if unhealthy",
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := newClusterData(cmd, args)
+			kubeadmutil.CheckErr(err)
+
+			status, err := GetClusterStatus(data, opt.timeout)
+			kubeadmutil.CheckErr(err)
+
+			err = PrintClusterStatus(out, status, opt.output)
+			kubeadmutil.CheckErr(err)
+
+			if !status.Healthy {
+				kubeadmutil.CheckErr(errors.Errorf("onecloud cluster %s is not healthy", status.Name))
+			}
+		},
+		Args: cobra.NoArgs,
+	}
+	AddStatusOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddStatusOptions(flagSet *flag.FlagSet, opt *statusOptions) {
+	flagSet.StringVarP(&opt.output, "output", "o", opt.output, "output format, one of table|json|yaml")
+	flagSet.DurationVar(&opt.timeout, "timeout", opt.timeout, "timeout of waiting components ready and each endpoint and mysql probe")
+}
+
+func GetClusterStatus(data *clusterData, timeout time.Duration) (*ClusterStatus, error) {
+	oc, err := data.client.OnecloudV1alpha1().OnecloudClusters(constants.OnecloudNamespace).Get(DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	status := &ClusterStatus{
+		Name:    oc.GetName(),
+		Version: oc.Spec.Version,
+	}
+	waiter := ocutil.NewOCWaiter(data.k8sClient, nil, timeout, ioutil.Discard)
+	components, err := getComponentsStatus(data, oc, waiter)
+	if err != nil {
+		return nil, err
+	}
+	status.Components = components
+	status.Keystone = getKeystoneStatus(data, oc, timeout)
+	status.Mysql = getMysqlStatus(oc, timeout)
+
+	status.Healthy = status.Keystone.Healthy && status.Mysql.Connected
+	for _, c := range status.Components {
+		if !c.Healthy {
+			status.Healthy = false
+		}
+	}
+	return status, nil
+}
+
+func getComponentsStatus(data *clusterData, oc *v1alpha1.OnecloudCluster, waiter ocutil.Waiter) ([]ComponentStatus, error) {
+	prefix := oc.GetName() + "-"
+	ret := make([]ComponentStatus, 0)
+	newStatus := func(kind string, name string, spec corev1.PodSpec, ready int32, desired int32) ComponentStatus {
+		s := ComponentStatus{
+			Name:    strings.TrimPrefix(name, prefix),
+			Kind:    kind,
+			Ready:   ready,
+			Desired: desired,
+		}
+		if len(spec.Containers) != 0 {
+			s.Image = spec.Containers[0].Image
+			if ref, err := image.ParseImageReference(s.Image); err == nil {
+				s.Version = ref.Tag
+			}
+		}
+		return s
+	}
+
+	dps, err := data.k8sClient.AppsV1().Deployments(oc.GetNamespace()).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list deployments")
+	}
+	for _, dp := range dps.Items {
+		if !strings.HasPrefix(dp.GetName(), prefix) {
+			continue
+		}
+		desired := int32(1)
+		if dp.Spec.Replicas != nil {
+			desired = *dp.Spec.Replicas
+		}
+		ret = append(ret, newStatus("Deployment", dp.GetName(), dp.Spec.Template.Spec, dp.Status.ReadyReplicas, desired))
+	}
+	dss, err := data.k8sClient.AppsV1().DaemonSets(oc.GetNamespace()).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list daemonsets")
+	}
+	for _, ds := range dss.Items {
+		if !strings.HasPrefix(ds.GetName(), prefix) {
+			continue
+		}
+		ret = append(ret, newStatus("DaemonSet", ds.GetName(), ds.Spec.Template.Spec, ds.Status.NumberReady, ds.Status.DesiredNumberScheduled))
+	}
+
+	// wait components concurrently, so the unready ones don't delay each other
+	var wg sync.WaitGroup
+	for i := range ret {
+		wg.Add(1)
+		go func(s *ComponentStatus) {
+			defer wg.Done()
+			waitFunc := waiter.WaitForDeploymentReady
+			if s.Kind == "DaemonSet" {
+				waitFunc = waiter.WaitForDaemonSetReady
+			}
+			var msgs []string
+			if err := waitFunc(oc.GetNamespace(), prefix+s.Name); err != nil {
+				msgs = append(msgs, err.Error())
+			} else {
+				s.Healthy = true
+			}
+			if s.Version != oc.Spec.Version {
+				msgs = append(msgs, fmt.Sprintf("version %s mismatches %s", s.Version, oc.Spec.Version))
+			}
+			s.Message = strings.Join(msgs, ", ")
+		}(&ret[i])
+	}
+	wg.Wait()
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+func getClusterAuthURL(data *clusterData, oc *v1alpha1.OnecloudCluster) (string, error) {
+	cfg, err := occonfig.GetClusterConfigByClient(data.k8sClient, oc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s:%d/v3", oc.Spec.LoadBalancerEndpoint, cfg.Keystone.Port), nil
+}
+
+func getKeystoneStatus(data *clusterData, oc *v1alpha1.OnecloudCluster, timeout time.Duration) KeystoneStatus {
+	status := KeystoneStatus{}
+	authURL, err := getClusterAuthURL(data, oc)
+	if err != nil {
+		status.Message = fmt.Sprintf("get auth url: %v", err)
+		return status
+	}
+	status.AuthURL = authURL
+	cli := mcclient.NewClient(authURL, int(timeout.Seconds()), false, true, "", "")
+	token, err := cli.AuthenticateWithSource(
+		operatorconstants.SysAdminUsername, oc.Spec.Keystone.BootstrapPassword,
+		operatorconstants.DefaultDomain, operatorconstants.SysAdminProject, "", "cli")
+	if err != nil {
+		status.Message = fmt.Sprintf("authenticate: %v", err)
+		return status
+	}
+	status.Healthy = true
+
+	httpCli := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	for _, ep := range token.GetEndpoints(oc.Spec.Region, "public") {
+		epStatus := EndpointStatus{
+			Service: ep.ServiceName,
+			URL:     ep.Url,
+		}
+		if err := probeEndpoint(httpCli, ep.Url); err != nil {
+			epStatus.Message = err.Error()
+			status.Healthy = false
+		} else {
+			epStatus.Reachable = true
+		}
+		status.Endpoints = append(status.Endpoints, epStatus)
+	}
+	sort.Slice(status.Endpoints, func(i, j int) bool {
+		return status.Endpoints[i].Service < status.Endpoints[j].Service
+	})
+	return status
+}
+
+// probeEndpoint treats the endpoint reachable if any http response returned,
+// the service may reject the request without token.
+func probeEndpoint(cli *http.Client, url string) error {
+	resp, err := cli.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("response %s", resp.Status)
+	}
+	return nil
+}
+
+func getMysqlStatus(oc *v1alpha1.OnecloudCluster, timeout time.Duration) MysqlStatus {
+	status := MysqlStatus{
+		Address: fmt.Sprintf("%s:%d", oc.Spec.Mysql.Host, oc.Spec.Mysql.Port),
+	}
+	info, err := ocutil.GetOCMysqlConnection(oc)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	conn, err := mysql.NewConnection(info)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	defer conn.Close()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- conn.CheckHealth()
+	}()
+	select {
+	case err = <-errCh:
+	case <-time.After(timeout):
+		err = errors.Errorf("timeout after %s", timeout)
+	}
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+	status.Connected = true
+	return status
+}
+
+func PrintClusterStatus(out io.Writer, status *ClusterStatus, format string) error {
+	switch format {
+	case OutputFormatJSON:
+		content, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", content)
+	case OutputFormatYAML:
+		content, err := yaml.Marshal(status)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s", content)
+	case OutputFormatTable, "":
+		printClusterStatusTable(out, status)
+	default:
+		return errors.Errorf("unsupported output format %q", format)
+	}
+	return nil
+}
+
+func healthString(ok bool) string {
+	if ok {
+		return "OK"
+	}
+	return "FAIL"
+}
+
+func printClusterStatusTable(out io.Writer, status *ClusterStatus) {
+	fmt.Fprintf(out, "Cluster: %s\tVersion: %s\tHealthy: %v\n\n", status.Name, status.Version, status.Healthy)
+
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tKIND\tREADY\tVERSION\tSTATUS\tMESSAGE")
+	for _, c := range status.Components {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n", c.Name, c.Kind, c.Ready, c.Desired, c.Version, healthString(c.Healthy), c.Message)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Keystone: %s\t%s\t%s\n", status.Keystone.AuthURL, healthString(status.Keystone.Healthy), status.Keystone.Message)
+	w = tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tENDPOINT\tSTATUS\tMESSAGE")
+	for _, ep := range status.Keystone.Endpoints {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ep.Service, ep.URL, healthString(ep.Reachable), ep.Message)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Mysql: %s\t%s\t%s\n", status.Mysql.Address, healthString(status.Mysql.Connected), status.Mysql.Message)
+}
@@ -0,0 +1,198 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+func newTestPodSpec(image string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "main", Image: image}},
+		},
+	}
+}
+
+func TestGetComponentsStatus(t *testing.T) {
+	replicas := int32(2)
+	objects := []runtime.Object{
+		&appv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-keystone", Namespace: constants.OnecloudNamespace},
+			Spec:       appv1.DeploymentSpec{Replicas: &replicas, Template: newTestPodSpec("registry.example.com/yunion/keystone:v3.8.5")},
+			Status:     appv1.DeploymentStatus{ReadyReplicas: 2},
+		},
+		&appv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-region", Namespace: constants.OnecloudNamespace},
+			Spec:       appv1.DeploymentSpec{Template: newTestPodSpec("registry.example.com/yunion/region:v3.8.5")},
+		},
+		&appv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: DefaultOperatorName, Namespace: constants.OnecloudNamespace},
+			Spec:       appv1.DeploymentSpec{Template: newTestPodSpec("registry.example.com/yunion/onecloud-operator:v3.8.5")},
+		},
+		&appv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-host", Namespace: constants.OnecloudNamespace},
+			Spec:       appv1.DaemonSetSpec{Template: newTestPodSpec("registry.example.com/yunion/host:v3.8.4")},
+			Status:     appv1.DaemonSetStatus{NumberReady: 1, DesiredNumberScheduled: 1},
+		},
+	}
+	oc := &v1alpha1.OnecloudCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: DefaultClusterName, Namespace: constants.OnecloudNamespace},
+		Spec:       v1alpha1.OnecloudClusterSpec{Version: "v3.8.5"},
+	}
+	data := &clusterData{k8sClient: fake.NewSimpleClientset(objects...)}
+	waiter := ocutil.NewOCWaiter(data.k8sClient, nil, 100*time.Millisecond, ioutil.Discard)
+
+	got, err := getComponentsStatus(data, oc, waiter)
+	if err != nil {
+		t.Fatalf("getComponentsStatus() error = %v", err)
+	}
+	want := []ComponentStatus{
+		{
+			Name:    "host",
+			Kind:    "DaemonSet",
+			Ready:   1,
+			Desired: 1,
+			Image:   "registry.example.com/yunion/host:v3.8.4",
+			Version: "v3.8.4",
+			Healthy: true,
+			Message: "version v3.8.4 mismatches v3.8.5",
+		},
+		{
+			Name:    "keystone",
+			Kind:    "Deployment",
+			Ready:   2,
+			Desired: 2,
+			Image:   "registry.example.com/yunion/keystone:v3.8.5",
+			Version: "v3.8.5",
+			Healthy: true,
+		},
+		{
+			Name:    "region",
+			Kind:    "Deployment",
+			Ready:   0,
+			Desired: 1,
+			Image:   "registry.example.com/yunion/region:v3.8.5",
+			Version: "v3.8.5",
+			Healthy: false,
+			Message: "0/1 ready after 100ms",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getComponentsStatus() = %#v, want %#v", got, want)
+	}
+}
+
+func newTestClusterStatus() *ClusterStatus {
+	return &ClusterStatus{
+		Name:    "default",
+		Version: "v3.8.5",
+		Components: []ComponentStatus{
+			{Name: "keystone", Kind: "Deployment", Ready: 1, Desired: 1, Version: "v3.8.5", Healthy: true},
+			{Name: "region", Kind: "Deployment", Ready: 0, Desired: 1, Version: "v3.8.5", Message: "0/1 ready after 5s"},
+		},
+		Keystone: KeystoneStatus{
+			AuthURL: "https://10.0.0.10:30500/v3",
+			Healthy: true,
+			Endpoints: []EndpointStatus{
+				{Service: "compute_v2", URL: "https://10.0.0.10:30888", Reachable: true},
+			},
+		},
+		Mysql: MysqlStatus{Address: "10.0.0.10:3306", Message: "access denied"},
+	}
+}
+
+func TestPrintClusterStatus(t *testing.T) {
+	status := newTestClusterStatus()
+
+	out := new(bytes.Buffer)
+	if err := PrintClusterStatus(out, status, OutputFormatTable); err != nil {
+		t.Fatalf("PrintClusterStatus() table error = %v", err)
+	}
+	for _, want := range []string{
+		"Cluster: default",
+		"region",
+		"0/1 ready after 5s",
+		"compute_v2",
+		"Mysql: 10.0.0.10:3306\tFAIL\taccess denied",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("table output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	for _, format := range []string{OutputFormatJSON, OutputFormatYAML} {
+		out := new(bytes.Buffer)
+		if err := PrintClusterStatus(out, status, format); err != nil {
+			t.Fatalf("PrintClusterStatus() %s error = %v", format, err)
+		}
+		got := new(ClusterStatus)
+		var err error
+		if format == OutputFormatJSON {
+			err = json.Unmarshal(out.Bytes(), got)
+		} else {
+			err = yaml.Unmarshal(out.Bytes(), got)
+		}
+		if err != nil {
+			t.Fatalf("unmarshal %s output: %v\n%s", format, err, out.String())
+		}
+		if !reflect.DeepEqual(got, status) {
+			t.Errorf("%s output = %#v, want %#v", format, got, status)
+		}
+	}
+
+	if err := PrintClusterStatus(new(bytes.Buffer), status, "xml"); err == nil {
+		t.Errorf("PrintClusterStatus() of unsupported format should fail")
+	}
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer srv.Close()
+
+	cli := &http.Client{Timeout: time.Second}
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"ok", srv.URL + "/", false},
+		{"rejected without token", srv.URL + "/unauthorized", false},
+		{"server error", srv.URL + "/broken", true},
+		{"unreachable", closed.URL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := probeEndpoint(cli, tt.url); (err != nil) != tt.wantErr {
+				t.Errorf("probeEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
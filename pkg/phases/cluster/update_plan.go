@@ -0,0 +1,210 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+	"yunion.io/x/onecloud-operator/pkg/util/image"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/preflight"
+)
+
+type updateChange struct {
+	Field   string
+	Current string
+	Target  string
+}
+
+// updatePlan records what will be changed by updateCluster
+type updatePlan struct {
+	CurrentVersion string
+	TargetVersion  string
+	Changes        []updateChange
+	// Images are the images the cluster will run after updating
+	Images []string
+}
+
+func (p *updatePlan) addChange(field, current, target string) {
+	if current == target {
+		return
+	}
+	p.Changes = append(p.Changes, updateChange{
+		Field:   field,
+		Current: current,
+		Target:  target,
+	})
+}
+
+// getTargetOperatorImage returns the operator image after applying update options
+func getTargetOperatorImage(ref *image.ImageReference, opt *updateOptions) string {
+	reg := ref.Repository
+	version := ref.Tag
+	if opt.operatorVersion != "" {
+		version = opt.operatorVersion
+	}
+	if opt.imageRepository != "" {
+		reg = opt.imageRepository
+	}
+	if version == "" && ref.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", reg, ref.Image, ref.Digest)
+	}
+	return fmt.Sprintf("%s/%s:%s", reg, ref.Image, version)
+}
+
+func getTargetEdition(edition string, opt *updateOptions) string {
+	if opt.useEE {
+		return operatorconstants.OnecloudEnterpriseEdition
+	}
+	if opt.useCE {
+		return operatorconstants.OnecloudCommunityEdition
+	}
+	return edition
+}
+
+func newUpdatePlan(data *clusterData, opt *updateOptions) (*updatePlan, error) {
+	operator, err := data.GetOperator()
+	if err != nil {
+		return nil, errors.Wrap(err, "get onecloud operator")
+	}
+	ref, err := getOperatorImage(operator)
+	if err != nil {
+		return nil, errors.Wrap(err, "get operator image reference")
+	}
+	oc, err := data.GetDefaultCluster()
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster")
+	}
+	curVersion, err := GetUnstructString(oc, "spec", "version")
+	if err != nil {
+		return nil, errors.Wrap(err, "get default onecloud cluster version")
+	}
+	curRepo, err := GetUnstructString(oc, "spec", "imageRepository")
+	if err != nil {
+		return nil, errors.Wrap(err, "get default cluster imageRepository")
+	}
+
+	plan := &updatePlan{
+		CurrentVersion: curVersion,
+		TargetVersion:  curVersion,
+	}
+	curOperatorImage := operator.Spec.Template.Spec.Containers[0].Image
+	targetOperatorImage := getTargetOperatorImage(ref, opt)
+	plan.addChange("operator image", curOperatorImage, targetOperatorImage)
+	if opt.operatorOnly {
+		plan.Images = []string{targetOperatorImage}
+		return plan, nil
+	}
+
+	if opt.version != "" {
+		plan.TargetVersion = opt.version
+	}
+	targetRepo := curRepo
+	if opt.imageRepository != "" {
+		targetRepo = opt.imageRepository
+	}
+	plan.addChange("spec.version", curVersion, plan.TargetVersion)
+	plan.addChange("spec.imageRepository", curRepo, targetRepo)
+	edition := oc.GetAnnotations()[operatorconstants.OnecloudEditionAnnotationKey]
+	plan.addChange("edition", edition, getTargetEdition(edition, opt))
+	if opt.disableResourceManagement {
+		isDisable, _, err := unstructured.NestedBool(oc.Object, "spec", "disableResourceManagement")
+		if err != nil {
+			return nil, errors.Wrapf(err, "get spec.disableResourceManagement")
+		}
+		plan.addChange("spec.disableResourceManagement", fmt.Sprintf("%v", isDisable), "true")
+	}
+
+	imgs, err := getClusterTargetImages(data, curRepo, curVersion, targetRepo, plan.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+	plan.Images = append([]string{targetOperatorImage}, imgs...)
+	return plan, nil
+}
+
+// getClusterTargetImages returns the images of onecloud workloads after changing repository and version,
+// only the containers managed by operator, whose image matches current repository and version, are changed.
+func getClusterTargetImages(data *clusterData, curRepo, curVersion, targetRepo, targetVersion string) ([]string, error) {
+	podSpecs := make([]corev1.PodSpec, 0)
+	dps, err := data.k8sClient.AppsV1().Deployments(constants.OnecloudNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list onecloud deployments")
+	}
+	for _, dp := range dps.Items {
+		if dp.GetName() == DefaultOperatorName {
+			continue
+		}
+		podSpecs = append(podSpecs, dp.Spec.Template.Spec)
+	}
+	dss, err := data.k8sClient.AppsV1().DaemonSets(constants.OnecloudNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "list onecloud daemonsets")
+	}
+	for _, ds := range dss.Items {
+		podSpecs = append(podSpecs, ds.Spec.Template.Spec)
+	}
+
+	imgs := sets.NewString()
+	for _, spec := range podSpecs {
+		containers := make([]corev1.Container, 0, len(spec.InitContainers)+len(spec.Containers))
+		containers = append(containers, spec.InitContainers...)
+		containers = append(containers, spec.Containers...)
+		for _, c := range containers {
+			ref, err := image.ParseImageReference(c.Image)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse image %s", c.Image)
+			}
+			if ref.Repository != curRepo || ref.Tag != curVersion {
+				// not managed by cluster version, e.g. host-image or third party components
+				imgs.Insert(c.Image)
+				continue
+			}
+			imgs.Insert(fmt.Sprintf("%s/%s:%s", targetRepo, ref.Image, targetVersion))
+		}
+	}
+	return imgs.List(), nil
+}
+
+func (p *updatePlan) Print(out io.Writer) {
+	fmt.Fprintf(out, "[upgrade/plan] Onecloud cluster version: %s -> %s\n", p.CurrentVersion, p.TargetVersion)
+	if len(p.Changes) == 0 {
+		fmt.Fprintf(out, "[upgrade/plan] Nothing will be changed\n")
+	} else {
+		w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tCURRENT\tTARGET")
+		for _, c := range p.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Field, c.Current, c.Target)
+		}
+		w.Flush()
+	}
+	imgs := make([]string, len(p.Images))
+	copy(imgs, p.Images)
+	sort.Strings(imgs)
+	fmt.Fprintf(out, "[upgrade/plan] Images required after updating:\n")
+	for _, img := range imgs {
+		fmt.Fprintf(out, "\t%s\n", img)
+	}
+}
+
+// Check runs the pre-flight checks of the plan before touching the cluster
+func (p *updatePlan) Check(data *clusterData, opt *updateOptions, ignorePreflightErrors sets.String, out io.Writer) error {
+	return preflight.RunUpgradeChecks(data.k8sClient, &preflight.UpgradeCheckConfig{
+		CRISocket:          data.cfg.NodeRegistration.CRISocket,
+		Namespace:          constants.OnecloudNamespace,
+		CurrentVersion:     p.CurrentVersion,
+		TargetVersion:      p.TargetVersion,
+		Images:             p.Images,
+		MysqlConnection:    &data.cfg.MysqlConnection,
+		InsecureRegistries: opt.insecureRegistries,
+	}, ignorePreflightErrors, out)
+}
@@ -43,7 +43,7 @@ server.tomcat.accesslog.rotate=true
 # ----------------------------------------
 
 # DATASOURCE (DataSourceAutoConfiguration & DataSourceProperties)
-spring.datasource.url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB}}?useUnicode=true&characterEncoding=utf8&zeroDateTimeBehavior=convertToNull&useSSL=false&createDatabaseIfNotExist=true
+spring.datasource.url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB}}?{{.DBParams}}&createDatabaseIfNotExist=true
 spring.datasource.username={{.DBUser}}
 spring.datasource.password={{.DBPassowrd}}
 spring.datasource.driver-class-name=com.mysql.jdbc.Driver
@@ -151,7 +151,10 @@ func (m CloudWatcher) NewDeployment(oc *onecloud.OnecloudCluster) (*apps.Deploym
 
 func (m CloudWatcher) NewConfigMap(oc *onecloud.OnecloudCluster, cCfg *OnecloudComponentsConfig) (*corev1.ConfigMap, error) {
 	cfg := cCfg.CloudWatcherConfig
-	config := NewJavaDBConfig(oc, cfg)
+	config, err := NewJavaDBConfig(oc, cfg)
+	if err != nil {
+		return nil, err
+	}
 	return NewConfigMapByTemplate(m.GetComponentType(), oc, CloudWatcherConfigTemplate, config)
 }
 
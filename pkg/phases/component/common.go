@@ -461,6 +461,31 @@ func SyncConfigMap(
 	return SyncK8sResource(oc, cfgMap, isExistsF, createF, nil, equalF, updateF)
 }
 
+// dbComponents are the components rendering mysql connection into their ConfigMaps
+var dbComponents = []IComponent{ItsmComponent, CloudWatcherComponent}
+
+// SyncDBConfigMaps renders the ConfigMaps of enabled components again, e.g. after the mysql server is changed
+func SyncDBConfigMaps(cli kubernetes.Interface, oc *onecloud.OnecloudCluster, cfg *OnecloudComponentsConfig) error {
+	for _, comp := range dbComponents {
+		name := controller.ComponentConfigMapName(oc, comp.GetComponentType())
+		if _, err := cli.CoreV1().ConfigMaps(oc.GetNamespace()).Get(name, metav1.GetOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				// component isn't enabled
+				continue
+			}
+			return errors.Wrapf(err, "get configmap %s", name)
+		}
+		cfgMap, err := comp.NewConfigMap(oc, cfg)
+		if err != nil {
+			return errors.Wrapf(err, "new configmap of %s", comp.GetName())
+		}
+		if err := SyncConfigMap(cli, oc, cfgMap); err != nil {
+			return errors.Wrapf(err, "sync configmap %s", name)
+		}
+	}
+	return nil
+}
+
 func (m *ComponentManager) DisableComponent(oc *onecloud.OnecloudCluster, comp IComponent) error {
 	if ep := comp.NewCloudEndpoint(); ep != nil {
 		if err := DeleteCloudEndpoint(m.GetCloudSession(), ep); err != nil {
@@ -44,7 +44,7 @@ server.tomcat.accesslog.rotate=true
 # ----------------------------------------
 
 # DATASOURCE (DataSourceAutoConfiguration & DataSourceProperties)
-datasource.primary.jdbc-url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB}}?useUnicode=true&characterEncoding=utf8&zeroDateTimeBehavior=convertToNull&useSSL=false&createDatabaseIfNotExist=true
+datasource.primary.jdbc-url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB}}?{{.DBParams}}&createDatabaseIfNotExist=true
 datasource.primary.username={{.DBUser}}
 datasource.primary.password={{.DBPassowrd}}
 datasource.primary.driver-class-name=com.mysql.cj.jdbc.Driver
@@ -54,7 +54,7 @@ datasource.primary.sql-script-encoding=utf-8
 datasource.primary.schema=classpath:sql/schema.sql
 datasource.primary.initialization-mode=always
 
-datasource.secondary.jdbc-url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB2nd}}?useUnicode=true&characterEncoding=utf8&zeroDateTimeBehavior=convertToNull&useSSL=false&createDatabaseIfNotExist=true&useTimezone=true&serverTimezone=UTC
+datasource.secondary.jdbc-url=jdbc:mysql://{{.DBHost}}:{{.DBPort}}/{{.DB2nd}}?{{.DBParams}}&createDatabaseIfNotExist=true&useTimezone=true&serverTimezone=UTC
 datasource.secondary.username={{.DBUser}}
 datasource.secondary.password={{.DBPassowrd}}
 datasource.secondary.driver-class-name=com.mysql.cj.jdbc.Driver
@@ -154,8 +154,12 @@ func (m Itsm) NewService(oc *onecloud.OnecloudCluster) *corev1.Service {
 
 func (m Itsm) NewConfigMap(oc *onecloud.OnecloudCluster, cCfg *OnecloudComponentsConfig) (*corev1.ConfigMap, error) {
 	cfg := cCfg.ItsmConfig
+	dbCfg, err := NewJavaDBConfig(oc, cfg.ServiceDBCommonOptions)
+	if err != nil {
+		return nil, err
+	}
 	config := ItsmConfigOption{
-		JavaDBConfig:  *NewJavaDBConfig(oc, cfg.ServiceDBCommonOptions),
+		JavaDBConfig:  *dbCfg,
 		DB2nd:         cfg.SecondDatabase,
 		EncryptionKey: cfg.EncryptionKey,
 	}
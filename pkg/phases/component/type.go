@@ -8,6 +8,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
 	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
 	"yunion.io/x/onecloud-operator/pkg/controller"
 	"yunion.io/x/onecloud-operator/pkg/util/passwd"
@@ -104,8 +105,30 @@ func FillOnecloudComponentsConfigDefault(obj *OnecloudComponentsConfig) *Oneclou
 	return obj
 }
 
+// GetComponentDBConfigs returns the databases of components recorded in components config
+func GetComponentDBConfigs(cfg *OnecloudComponentsConfig) []ocutil.ServiceDBConfig {
+	dbs := []ocutil.ServiceDBConfig{
+		{Service: ServiceNameMeterAlert, DBConfig: cfg.MeterAlertConfig.DB},
+		{Service: ServiceNameCloudWatcher, DBConfig: cfg.CloudWatcherConfig.DB},
+		{Service: ServiceNameItsm, DBConfig: cfg.ItsmConfig.DB},
+	}
+	if cfg.ItsmConfig.SecondDatabase != "" {
+		second := cfg.ItsmConfig.DB
+		second.Database = cfg.ItsmConfig.SecondDatabase
+		dbs = append(dbs, ocutil.ServiceDBConfig{Service: ServiceNameItsm, DBConfig: second})
+	}
+	ret := make([]ocutil.ServiceDBConfig, 0, len(dbs))
+	for _, db := range dbs {
+		if db.Database == "" {
+			continue
+		}
+		ret = append(ret, db)
+	}
+	return ret
+}
+
 func ComponentsConfigMapName(oc *onecloud.OnecloudCluster) string {
-	return fmt.Sprintf("%s-%s", oc.GetName(), "cluster-components-config")
+	return ocutil.ComponentsConfigMapName(oc)
 }
 
 func NewOnecloudComponentsConfigFromYaml(data string) (*OnecloudComponentsConfig, error) {
@@ -179,9 +202,15 @@ type JavaDBConfig struct {
 	DB         string
 	DBUser     string
 	DBPassowrd string
+	// DBParams is the query of jdbc url carrying the charset, timeout and TLS options of mysql connection
+	DBParams string
 }
 
-func NewJavaDBConfig(oc *onecloud.OnecloudCluster, cfg onecloud.ServiceDBCommonOptions) *JavaDBConfig {
+func NewJavaDBConfig(oc *onecloud.OnecloudCluster, cfg onecloud.ServiceDBCommonOptions) (*JavaDBConfig, error) {
+	conn, err := ocutil.GetOCMysqlConnection(oc)
+	if err != nil {
+		return nil, errors.Wrap(err, "get mysql connection")
+	}
 	opt := NewJavaBaseConfig(oc, cfg.Port, cfg.CloudUser.Username, cfg.CloudUser.Password)
 	dbCfg := &JavaDBConfig{
 		JavaBaseConfig: *opt,
@@ -190,8 +219,9 @@ func NewJavaDBConfig(oc *onecloud.OnecloudCluster, cfg onecloud.ServiceDBCommonO
 		DB:             cfg.DB.Database,
 		DBUser:         cfg.DB.Username,
 		DBPassowrd:     cfg.DB.Password,
+		DBParams:       conn.JDBCQuery(),
 	}
-	return dbCfg
+	return dbCfg, nil
 }
 
 type CloudEndpoint struct {
@@ -90,6 +90,27 @@ func UploadCerts(client clientset.Interface, cfg *apiv1.InitConfiguration) error
 	//return createRBAC(client)
 }
 
+// UpdateCertsSecret replaces the certs in the existing OcadmCertsSecret with the ones on disk,
+// it returns false if the Secret has expired
+func UpdateCertsSecret(client clientset.Interface, cfg *apiv1.InitConfiguration) (bool, error) {
+	secret, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get(constants.OcadmCertsSecret, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "get secret %s", constants.OcadmCertsSecret)
+	}
+	secretData, err := getDataFromDisk(cfg)
+	if err != nil {
+		return false, err
+	}
+	secret.Data = secretData
+	if _, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Update(secret); err != nil {
+		return false, errors.Wrapf(err, "update secret %s", constants.OcadmCertsSecret)
+	}
+	return true, nil
+}
+
 func getSecretOwnerRef(client clientset.Interface, tokenID string) ([]metav1.OwnerReference, error) {
 	secretName := bootstraputil.BootstrapTokenSecretName(tokenID)
 	secret, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get(secretName, metav1.GetOptions{})
@@ -117,6 +138,9 @@ func certsToTransfer(cfg *apiv1.InitConfiguration) map[string]string {
 		constants.CAKeyName:     path.Join(certsDir, constants.CAKeyName),
 		constants.ClimcCertName: path.Join(certsDir, constants.ClimcCertName),
 		constants.ClimcKeyName:  path.Join(certsDir, constants.ClimcKeyName),
+		// the service certificate only exists when the onecloud CA is provided by user
+		constants.ServiceCertName: path.Join(certsDir, constants.ServiceCertName),
+		constants.ServiceKeyName:  path.Join(certsDir, constants.ServiceKeyName),
 	}
 
 	return certs
@@ -166,6 +190,18 @@ func DownloadCerts(client clientset.Interface, cfg *apiv1.InitConfiguration) err
 	return nil
 }
 
+// CertsSecretExists returns whether the OcadmCertsSecret exists, it's deleted after the upload token expired
+func CertsSecretExists(client clientset.Interface) (bool, error) {
+	_, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get(constants.OcadmCertsSecret, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func writeCertOrKey(certOrKeyPath string, certOrKeyData []byte) error {
 	if _, err := keyutil.ParsePublicKeysPEM(certOrKeyData); err == nil {
 		return keyutil.WriteKey(certOrKeyPath, certOrKeyData)
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	"yunion.io/x/ocadm/pkg/util/mysql"
+)
+
+// UserCheckResult is the result of logging in as the user of a service database
+type UserCheckResult struct {
+	ServiceDatabase
+	// Skipped is true if the database of a disabled component doesn't exist
+	Skipped bool
+	Error   error
+}
+
+func NewCmdCheck(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check [service...]",
+		Short: "Check each service user can log in and access its database with the password stored in cluster config",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runCheck(out, args)
+			kubeadmutil.CheckErr(err)
+		},
+	}
+	return cmd
+}
+
+func runCheck(out io.Writer, services []string) error {
+	data, err := newDBData()
+	if err != nil {
+		return err
+	}
+	dbs, err := data.ServiceDatabases(services)
+	if err != nil {
+		return err
+	}
+	conn, err := data.RootConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	results := make([]UserCheckResult, 0, len(dbs))
+	for _, db := range dbs {
+		results = append(results, checkDatabaseUser(data, conn, db))
+	}
+	printUserCheckResults(out, results)
+	return userCheckError(results)
+}
+
+// userChecker returns the check result of the user of database db
+type userChecker func(db ServiceDatabase) UserCheckResult
+
+// checkDatabaseUser verifies the database exists and is accessible by its user
+func checkDatabaseUser(data *dbData, root *mysql.Connection, db ServiceDatabase) UserCheckResult {
+	ret := UserCheckResult{ServiceDatabase: db}
+	exists, err := root.IsDatabaseExists(db.Database)
+	if err != nil {
+		ret.Error = errors.Wrapf(err, "check database %s exists", db.Database)
+		return ret
+	}
+	if !exists {
+		if db.Optional {
+			ret.Skipped = true
+		} else {
+			ret.Error = errors.Errorf("database %s doesn't exist", db.Database)
+		}
+		return ret
+	}
+	conn, err := data.UserConnection(db)
+	if err != nil {
+		ret.Error = err
+		return ret
+	}
+	defer conn.Close()
+	// the database is only visible to the user having privileges on it
+	visible, err := conn.IsDatabaseExists(db.Database)
+	if err != nil {
+		ret.Error = errors.Wrapf(err, "login as %s", db.Username)
+	} else if !visible {
+		ret.Error = errors.Errorf("user %s has no privilege on database %s", db.Username, db.Database)
+	}
+	return ret
+}
+
+func userCheckError(results []UserCheckResult) error {
+	failed := 0
+	for _, r := range results {
+		if r.Error != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return errors.Errorf("%d of %d database users failed the check, run 'ocadm db repair-grants' to fix them", failed, len(results))
+}
+
+func printUserCheckResults(out io.Writer, results []UserCheckResult) {
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tDATABASE\tUSER\tSTATUS\tMESSAGE")
+	for _, r := range results {
+		status, msg := "OK", ""
+		if r.Skipped {
+			status, msg = "SKIP", "component not enabled"
+		} else if r.Error != nil {
+			status, msg = "FAIL", r.Error.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Service, r.Database, r.Username, status, msg)
+	}
+	w.Flush()
+}
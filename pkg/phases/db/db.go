@@ -0,0 +1,151 @@
+package db
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	kubeconfigutil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+
+	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+	"yunion.io/x/onecloud-operator/pkg/client/clientset/versioned"
+	occonfig "yunion.io/x/onecloud-operator/pkg/manager/config"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/phases/cluster"
+	"yunion.io/x/ocadm/pkg/phases/component"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+// ServiceDatabase is a database used by an onecloud service or a component managed by ocadm
+type ServiceDatabase struct {
+	ocutil.ServiceDBConfig
+	// Optional is true for the databases of components, which don't exist until the component is enabled
+	Optional bool
+}
+
+type dbData struct {
+	kubeCli       kubernetes.Interface
+	clusterCli    versioned.Interface
+	oc            *onecloud.OnecloudCluster
+	ocCfg         *onecloud.OnecloudClusterConfig
+	componentsCfg *component.OnecloudComponentsConfig
+	mysql         *apiv1.MysqlConnection
+}
+
+func newDBData() (*dbData, error) {
+	kubeConfigFile := constants.GetAdminKubeConfigPath()
+	if _, err := os.Stat(kubeConfigFile); err != nil {
+		return nil, errors.Wrapf(err, "not found %s, please run this command at controlplane", kubeConfigFile)
+	}
+	kubeCfg, err := clientcmd.LoadFromFile(kubeConfigFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading %s", kubeConfigFile)
+	}
+	kubeCli, err := kubeconfigutil.ToClientSet(kubeCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "New kubernetes client")
+	}
+	clusterCli, err := cluster.NewClusterClient(kubeCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "New onecloud cluster client")
+	}
+	oc, err := clusterCli.OnecloudV1alpha1().OnecloudClusters(constants.OnecloudNamespace).Get(cluster.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get %s onecloud cluster", cluster.DefaultClusterName)
+	}
+	ocCfg, err := occonfig.GetClusterConfigByClient(kubeCli, oc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get %s onecloud cluster config", cluster.DefaultClusterName)
+	}
+	componentsCfg, err := getComponentsConfig(kubeCli, oc)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ocutil.GetOCMysqlConnection(oc)
+	if err != nil {
+		return nil, err
+	}
+	return &dbData{
+		kubeCli:       kubeCli,
+		clusterCli:    clusterCli,
+		oc:            oc,
+		ocCfg:         ocCfg,
+		componentsCfg: componentsCfg,
+		mysql:         info,
+	}, nil
+}
+
+// getComponentsConfig reads the components config without creating it, nil is returned if no component
+// has ever been configured
+func getComponentsConfig(cli kubernetes.Interface, oc *onecloud.OnecloudCluster) (*component.OnecloudComponentsConfig, error) {
+	name := component.ComponentsConfigMapName(oc)
+	cfgMap, err := cli.CoreV1().ConfigMaps(oc.GetNamespace()).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get configmap %s", name)
+	}
+	return component.NewOnecloudComponentsConfigFromConfigMap(cfgMap)
+}
+
+func (d *dbData) RootConnection() (*mysql.Connection, error) {
+	return mysql.NewConnection(d.mysql)
+}
+
+// UserConnection connects to the mysql server as the user of database db with the options of root connection
+func (d *dbData) UserConnection(db ServiceDatabase) (*mysql.Connection, error) {
+	info := *d.mysql
+	info.Username = db.Username
+	info.Password = db.Password
+	return mysql.NewConnection(&info)
+}
+
+func (d *dbData) ServiceDatabases(services []string) ([]ServiceDatabase, error) {
+	return getServiceDatabases(d.ocCfg, d.componentsCfg, services)
+}
+
+// getServiceDatabases merges the databases of onecloud services and components, only the databases of
+// the services are returned if services isn't empty
+func getServiceDatabases(ocCfg *onecloud.OnecloudClusterConfig, componentsCfg *component.OnecloudComponentsConfig, services []string) ([]ServiceDatabase, error) {
+	dbs := make([]ServiceDatabase, 0)
+	seen := make(map[string]bool)
+	add := func(cfgs []ocutil.ServiceDBConfig, optional bool) {
+		for _, cfg := range cfgs {
+			// the database configured in OnecloudClusterConfig takes precedence
+			if seen[cfg.Database] {
+				continue
+			}
+			seen[cfg.Database] = true
+			dbs = append(dbs, ServiceDatabase{ServiceDBConfig: cfg, Optional: optional})
+		}
+	}
+	add(ocutil.GetServiceDBConfigs(ocCfg), false)
+	if componentsCfg != nil {
+		add(component.GetComponentDBConfigs(componentsCfg), true)
+	}
+	if len(services) == 0 {
+		return dbs, nil
+	}
+
+	ret := make([]ServiceDatabase, 0)
+	for _, svc := range services {
+		found := false
+		for _, db := range dbs {
+			if db.Service == svc {
+				ret = append(ret, db)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("no database found for service %q", svc)
+		}
+	}
+	return ret, nil
+}
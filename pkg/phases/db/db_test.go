@@ -0,0 +1,217 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+
+	"yunion.io/x/ocadm/pkg/phases/component"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+func TestGetServiceDatabases(t *testing.T) {
+	ocCfg := &onecloud.OnecloudClusterConfig{}
+	ocCfg.Keystone.DB = onecloud.DBConfig{Database: "keystone", Username: "keystone", Password: "p1"}
+	ocCfg.RegionServer.DB = onecloud.DBConfig{Database: "yunioncloud", Username: "regionadmin", Password: "p2"}
+	ocCfg.Itsm.DB = onecloud.DBConfig{Database: "itsm", Username: "itsm", Password: "p3"}
+	componentsCfg, err := component.NewOnecloudComponentsConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	databases := func(dbs []ServiceDatabase) []string {
+		ret := make([]string, 0, len(dbs))
+		for _, db := range dbs {
+			ret = append(ret, db.Database)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name          string
+		componentsCfg *component.OnecloudComponentsConfig
+		services      []string
+		want          []string
+		wantErr       bool
+	}{
+		{"without components", nil, nil, []string{"keystone", "yunioncloud", "itsm"}, false},
+		{"with components", componentsCfg, nil, []string{"keystone", "yunioncloud", "itsm", "meteralert", "cloudwatcher", "itsm_engine"}, false},
+		{"filter services", componentsCfg, []string{"itsm", "keystone"}, []string{"itsm", "itsm_engine", "keystone"}, false},
+		{"unknown service", componentsCfg, []string{"glance"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbs, err := getServiceDatabases(ocCfg, tt.componentsCfg, tt.services)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getServiceDatabases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := databases(dbs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getServiceDatabases() = %v, want %v", got, tt.want)
+			}
+			for _, db := range dbs {
+				// itsm of cluster config isn't optional even if it's also in components config
+				wantOptional := db.Database == "meteralert" || db.Database == "cloudwatcher" || db.Database == "itsm_engine"
+				if db.Optional != wantOptional {
+					t.Errorf("database %s optional = %v, want %v", db.Database, db.Optional, wantOptional)
+				}
+			}
+		})
+	}
+}
+
+func newTestServiceDatabase(service, db string, optional bool) ServiceDatabase {
+	return ServiceDatabase{
+		ServiceDBConfig: ocutil.ServiceDBConfig{Service: service, DBConfig: onecloud.DBConfig{Database: db, Username: db, Password: "p"}},
+		Optional:        optional,
+	}
+}
+
+func TestRepairGrants(t *testing.T) {
+	dbs := []ServiceDatabase{
+		newTestServiceDatabase("keystone", "keystone", false),
+		newTestServiceDatabase("region", "yunioncloud", false),
+		newTestServiceDatabase("meter", "meteralert", true),
+	}
+	tests := []struct {
+		name       string
+		opt        repairGrantsOptions
+		failed     []string
+		repairErr  error
+		stillFails bool
+		want       []string
+		wantErr    bool
+	}{
+		{name: "all fine", want: []string{}},
+		{name: "failed users", failed: []string{"yunioncloud"}, want: []string{"yunioncloud"}},
+		{name: "dry run", opt: repairGrantsOptions{dryRun: true}, failed: []string{"yunioncloud"}, want: []string{}},
+		{name: "all users", opt: repairGrantsOptions{all: true}, want: []string{"keystone", "yunioncloud"}},
+		{name: "all users dry run", opt: repairGrantsOptions{all: true, dryRun: true}, want: []string{}},
+		{name: "repair failed", failed: []string{"keystone"}, repairErr: errors.New("access denied"), want: []string{"keystone"}, wantErr: true},
+		{name: "still fails after repair", failed: []string{"keystone"}, stillFails: true, want: []string{"keystone"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed := sets.NewString(tt.failed...)
+			check := func(db ServiceDatabase) UserCheckResult {
+				ret := UserCheckResult{ServiceDatabase: db}
+				if db.Optional {
+					// the database of a disabled component
+					ret.Skipped = true
+				} else if failed.Has(db.Database) {
+					ret.Error = errors.Errorf("user %s has no privilege", db.Username)
+				}
+				return ret
+			}
+			repaired := []string{}
+			repair := func(db ServiceDatabase) error {
+				repaired = append(repaired, db.Database)
+				if tt.repairErr == nil && !tt.stillFails {
+					failed.Delete(db.Database)
+				}
+				return tt.repairErr
+			}
+			out := new(bytes.Buffer)
+			err := repairGrants(dbs, &tt.opt, check, repair, out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repairGrants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(repaired, tt.want) {
+				t.Errorf("repaired users = %v, want %v", repaired, tt.want)
+			}
+			if tt.opt.dryRun && !strings.Contains(out.String(), "Repairing user") && (tt.opt.all || len(tt.failed) != 0) {
+				t.Errorf("dry run should print the users would be repaired, got %q", out.String())
+			}
+		})
+	}
+}
+
+type fakeDumper struct {
+	databases sets.String
+	dumpErr   error
+}
+
+func (d *fakeDumper) IsDatabaseExists(db string) (bool, error) {
+	return d.databases.Has(db), nil
+}
+
+func (d *fakeDumper) DumpDatabase(db string, w io.Writer) error {
+	if d.dumpErr != nil {
+		fmt.Fprintf(w, "-- partial dump of %s\n", db)
+		return d.dumpErr
+	}
+	_, err := fmt.Fprintf(w, "-- ocadm dump of database %s\n", db)
+	return err
+}
+
+func TestDumpDatabases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-db-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		dbs       []ServiceDatabase
+		dumpErr   error
+		wantFiles []string
+		wantErr   bool
+	}{
+		{
+			name:      "skip optional database not exists",
+			dbs:       []ServiceDatabase{newTestServiceDatabase("itsm", "itsm", false), newTestServiceDatabase("itsm", "itsm_engine", true)},
+			wantFiles: []string{"itsm.sql"},
+		},
+		{
+			name:    "required database not exists",
+			dbs:     []ServiceDatabase{newTestServiceDatabase("region", "yunioncloud", false)},
+			wantErr: true,
+		},
+		{
+			name:      "dump failed",
+			dbs:       []ServiceDatabase{newTestServiceDatabase("keystone", "keystone", false)},
+			dumpErr:   errors.New("lost connection"),
+			wantFiles: []string{},
+			wantErr:   true,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(dir, fmt.Sprintf("%d", i))
+			dumper := &fakeDumper{databases: sets.NewString("itsm", "keystone"), dumpErr: tt.dumpErr}
+			err := dumpDatabases(dumper, tt.dbs, output, ioutil.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dumpDatabases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantFiles == nil {
+				return
+			}
+			infos, err := ioutil.ReadDir(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := []string{}
+			for _, info := range infos {
+				files = append(files, info.Name())
+			}
+			// a failed dump leaves no truncated file behind
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("dump files = %v, want %v", files, tt.wantFiles)
+			}
+		})
+	}
+}
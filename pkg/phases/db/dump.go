@@ -0,0 +1,107 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+)
+
+type dumpOptions struct {
+	outputDir string
+}
+
+func NewCmdDump(out io.Writer) *cobra.Command {
+	opt := &dumpOptions{
+		outputDir: ".",
+	}
+	cmd := &cobra.Command{
+		Use:   "dump <service>",
+		Short: "Dump the databases of a service into <database>.sql files",
+		Long: `Dump the databases of a service into <database>.sql files.
+
+The files can be loaded back by mysql client, e.g. 'mysql keystone < keystone.sql'.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runDump(out, args, opt)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.ExactArgs(1),
+	}
+	AddDumpOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddDumpOptions(flagSet *flag.FlagSet, opt *dumpOptions) {
+	flagSet.StringVarP(&opt.outputDir, "output-dir", "d", opt.outputDir, "directory the dump files are written to")
+}
+
+func runDump(out io.Writer, services []string, opt *dumpOptions) error {
+	data, err := newDBData()
+	if err != nil {
+		return err
+	}
+	dbs, err := data.ServiceDatabases(services)
+	if err != nil {
+		return err
+	}
+	conn, err := data.RootConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return dumpDatabases(conn, dbs, opt.outputDir, out)
+}
+
+// databaseDumper dumps databases, it's implemented by mysql.Connection
+type databaseDumper interface {
+	IsDatabaseExists(db string) (bool, error)
+	DumpDatabase(db string, w io.Writer) error
+}
+
+func dumpDatabases(conn databaseDumper, dbs []ServiceDatabase, dir string, out io.Writer) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "create directory %s", dir)
+	}
+	for _, db := range dbs {
+		exists, err := conn.IsDatabaseExists(db.Database)
+		if err != nil {
+			return errors.Wrapf(err, "check database %s exists", db.Database)
+		}
+		if !exists {
+			if db.Optional {
+				fmt.Fprintf(out, "[dump] Skip database %s of service %s, component isn't enabled\n", db.Database, db.Service)
+				continue
+			}
+			return errors.Errorf("database %s of service %s doesn't exist", db.Database, db.Service)
+		}
+		filename := filepath.Join(dir, db.Database+".sql")
+		if err := dumpDatabaseToFile(conn, db.Database, filename); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "[dump] Dumped database %s of service %s to %s\n", db.Database, db.Service, filename)
+	}
+	return nil
+}
+
+func dumpDatabaseToFile(conn databaseDumper, db string, filename string) error {
+	// the dump contains credentials of onecloud, only the owner can read it
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "create %s", filename)
+	}
+	if err := conn.DumpDatabase(db, f); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return errors.Wrapf(err, "dump database %s", db)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(filename)
+		return errors.Wrapf(err, "close %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	"yunion.io/x/ocadm/pkg/util/mysql"
+)
+
+// DatabaseStatus is a service database as seen by the mysql server
+type DatabaseStatus struct {
+	ServiceDatabase
+	Exists bool
+	Tables int
+	Size   int64
+}
+
+func NewCmdList(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [service...]",
+		Short: "List databases of onecloud services and components with owning user, size and table count",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runList(out, args)
+			kubeadmutil.CheckErr(err)
+		},
+	}
+	return cmd
+}
+
+func runList(out io.Writer, services []string) error {
+	data, err := newDBData()
+	if err != nil {
+		return err
+	}
+	dbs, err := data.ServiceDatabases(services)
+	if err != nil {
+		return err
+	}
+	conn, err := data.RootConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	status, err := getDatabasesStatus(conn, dbs)
+	if err != nil {
+		return err
+	}
+	printDatabasesStatus(out, status)
+	return nil
+}
+
+func getDatabasesStatus(conn *mysql.Connection, dbs []ServiceDatabase) ([]DatabaseStatus, error) {
+	ret := make([]DatabaseStatus, 0, len(dbs))
+	for _, db := range dbs {
+		status := DatabaseStatus{ServiceDatabase: db}
+		exists, err := conn.IsDatabaseExists(db.Database)
+		if err != nil {
+			return nil, errors.Wrapf(err, "check database %s exists", db.Database)
+		}
+		if exists {
+			status.Exists = true
+			status.Tables, status.Size, err = conn.GetDatabaseStats(db.Database)
+			if err != nil {
+				return nil, err
+			}
+		} else if db.Optional {
+			// component isn't enabled
+			continue
+		}
+		ret = append(ret, status)
+	}
+	return ret, nil
+}
+
+func printDatabasesStatus(out io.Writer, status []DatabaseStatus) {
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tDATABASE\tUSER\tTABLES\tSIZE")
+	for _, s := range status {
+		if !s.Exists {
+			fmt.Fprintf(w, "%s\t%s\t%s\t-\tmissing\n", s.Service, s.Database, s.Username)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", s.Service, s.Database, s.Username, s.Tables, units.HumanSize(float64(s.Size)))
+	}
+	w.Flush()
+}
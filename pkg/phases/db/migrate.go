@@ -0,0 +1,607 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/validation"
+	k8spreflight "k8s.io/kubernetes/cmd/kubeadm/app/preflight"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	"yunion.io/x/onecloud-operator/pkg/label"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/phases/cluster"
+	"yunion.io/x/ocadm/pkg/phases/component"
+	"yunion.io/x/ocadm/pkg/preflight"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+)
+
+var (
+	// DefaultMigrateStateFile records the progress of database migration
+	DefaultMigrateStateFile = filepath.Join(constants.OnecloudConfigDir, "db-migrate-state.yaml")
+)
+
+// MigrateState is saved after each step of migration, so an interrupted migration can be resumed
+// by running the same command again
+type MigrateState struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Replicas of the deployments scaled down, they are scaled back after migration
+	Replicas map[string]int32 `json:"replicas,omitempty"`
+	Quiesced bool             `json:"quiesced"`
+	// Current is the database being migrated, it's dropped from target and migrated again on resume
+	Current       string   `json:"current,omitempty"`
+	Migrated      []string `json:"migrated,omitempty"`
+	ConfigUpdated bool     `json:"configUpdated"`
+	// RegeneratedConfigs are the ConfigMaps of services deleted to be regenerated by operator
+	RegeneratedConfigs []string `json:"regeneratedConfigs,omitempty"`
+}
+
+type migrateOptions struct {
+	toHost                string
+	toPort                int
+	toUser                string
+	toPassword            string
+	stateFile             string
+	timeout               time.Duration
+	ignorePreflightErrors []string
+}
+
+func NewCmdMigrate(out io.Writer) *cobra.Command {
+	opt := &migrateOptions{
+		toPort:    apiv1.DefaultMysqlPort,
+		toUser:    apiv1.DefaultMysqlUser,
+		stateFile: DefaultMigrateStateFile,
+		timeout:   5 * time.Minute,
+	}
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move all the onecloud databases to a new mysql server",
+		Long: `Move all the onecloud databases to a new mysql server.
+
+The target server is verified by preflight checks, then the onecloud operator and services are
+scaled down, each database is streamed to the target, verified by the row count of every table and
+its user is recreated with the existing password. At last the OnecloudCluster, ocadm-config and component configs are switched to the
+target and the services are scaled back.
+
+The progress is saved into the state file, run the same command again to resume an interrupted
+migration. The TLS and socket options of current mysql connection are used for the target.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if opt.toHost == "" {
+				kubeadmutil.CheckErr(errors.New("target mysql server must be specified by --to-host"))
+			}
+			ignorePreflightErrors, err := validation.ValidateIgnorePreflightErrors(opt.ignorePreflightErrors, nil)
+			kubeadmutil.CheckErr(err)
+
+			data, err := newDBData()
+			kubeadmutil.CheckErr(err)
+
+			err = migrateDatabases(data, opt, ignorePreflightErrors, out)
+			kubeadmutil.CheckErr(err)
+		},
+		Args: cobra.NoArgs,
+	}
+	AddMigrateOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddMigrateOptions(flagSet *flag.FlagSet, opt *migrateOptions) {
+	flagSet.StringVar(&opt.toHost, "to-host", opt.toHost, "address of target mysql server")
+	flagSet.IntVar(&opt.toPort, "to-port", opt.toPort, "port of target mysql server")
+	flagSet.StringVar(&opt.toUser, "to-user", opt.toUser, "admin user of target mysql server")
+	flagSet.StringVar(&opt.toPassword, "to-password", opt.toPassword, "password of target mysql admin user")
+	flagSet.StringVar(&opt.stateFile, "state-file", opt.stateFile, "file recording the progress of migration")
+	flagSet.DurationVar(&opt.timeout, "timeout", opt.timeout, "timeout of waiting onecloud services scaled down")
+	flagSet.StringSliceVar(
+		&opt.ignorePreflightErrors, options.IgnorePreflightErrors, opt.ignorePreflightErrors,
+		"A list of target mysql checks whose errors will be shown as warnings. Example: 'MysqlVersion'. Value 'all' ignores errors from all checks.",
+	)
+}
+
+func mysqlAddress(info *apiv1.MysqlConnection) string {
+	return net.JoinHostPort(info.Server, strconv.Itoa(info.Port))
+}
+
+// loadMigrateState returns nil if the state file doesn't exist
+func loadMigrateState(filename string) (*MigrateState, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "read state file %s", filename)
+	}
+	state := new(MigrateState)
+	if err := yaml.Unmarshal(content, state); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal state file %s", filename)
+	}
+	return state, nil
+}
+
+func saveMigrateState(filename string, state *MigrateState) error {
+	content, err := yaml.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal migrate state")
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	// write to temporary file and rename, the state file is never truncated by interruption
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return errors.Wrapf(err, "write state file %s", tmp)
+	}
+	return os.Rename(tmp, filename)
+}
+
+// resumeMigrateState returns the state of a new migration from source to target if state is nil,
+// otherwise the saved state is checked to be the same migration
+func resumeMigrateState(state *MigrateState, source, target string) (*MigrateState, error) {
+	if state == nil {
+		if source == target {
+			return nil, errors.Errorf("target %s is the current mysql server", target)
+		}
+		return &MigrateState{
+			Source:   source,
+			Target:   target,
+			Replicas: make(map[string]int32),
+		}, nil
+	}
+	if state.Target != target {
+		return nil, errors.Errorf("migration to %s is in progress, remove the state file to start a new one", state.Target)
+	}
+	if !state.ConfigUpdated && state.Source != source {
+		return nil, errors.Errorf("migration from %s is in progress, but current mysql server is %s", state.Source, source)
+	}
+	if state.Replicas == nil {
+		state.Replicas = make(map[string]int32)
+	}
+	return state, nil
+}
+
+func (s *MigrateState) IsMigrated(db string) bool {
+	return sets.NewString(s.Migrated...).Has(db)
+}
+
+type migrator struct {
+	data      *dbData
+	opt       *migrateOptions
+	state     *MigrateState
+	target    *apiv1.MysqlConnection
+	out       io.Writer
+	namespace string
+}
+
+func migrateDatabases(data *dbData, opt *migrateOptions, ignorePreflightErrors sets.String, out io.Writer) error {
+	target := *data.mysql
+	target.Server = opt.toHost
+	target.Port = opt.toPort
+	target.Username = opt.toUser
+	target.Password = opt.toPassword
+
+	saved, err := loadMigrateState(opt.stateFile)
+	if err != nil {
+		return err
+	}
+	state, err := resumeMigrateState(saved, mysqlAddress(data.mysql), mysqlAddress(&target))
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		fmt.Fprintf(out, "[migrate] Resuming migration from %s to %s recorded in %s\n", state.Source, state.Target, opt.stateFile)
+	}
+	m := &migrator{
+		data:      data,
+		opt:       opt,
+		state:     state,
+		target:    &target,
+		out:       out,
+		namespace: data.oc.GetNamespace(),
+	}
+
+	fmt.Fprintf(out, "[migrate] Verifying target mysql server %s\n", state.Target)
+	if err := k8spreflight.RunChecks(preflight.MysqlChecks(&target), os.Stderr, ignorePreflightErrors); err != nil {
+		return err
+	}
+	dst, err := mysql.NewConnection(&target)
+	if err != nil {
+		return errors.Wrap(err, "connect to target mysql")
+	}
+	defer dst.Close()
+
+	if !state.ConfigUpdated {
+		src, err := data.RootConnection()
+		if err != nil {
+			return errors.Wrap(err, "connect to source mysql")
+		}
+		defer src.Close()
+		dbs, err := m.sourceDatabases(src)
+		if err != nil {
+			return err
+		}
+		if saved == nil {
+			if err := checkTargetDatabases(dst, dbs); err != nil {
+				return err
+			}
+		}
+		if err := m.save(); err != nil {
+			return err
+		}
+		if err := m.quiesce(); err != nil {
+			return err
+		}
+		for _, db := range dbs {
+			if state.IsMigrated(db.Database) {
+				continue
+			}
+			if err := m.migrateDatabase(src, dst, db); err != nil {
+				return err
+			}
+		}
+		if err := m.updateConfig(); err != nil {
+			return err
+		}
+	}
+	if err := m.restart(); err != nil {
+		return err
+	}
+	if err := os.Remove(opt.stateFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove state file %s", opt.stateFile)
+	}
+	fmt.Fprintf(out, "[migrate] Onecloud databases migrated to %s\n", state.Target)
+	return nil
+}
+
+func (m *migrator) save() error {
+	return saveMigrateState(m.opt.stateFile, m.state)
+}
+
+// sourceDatabases returns the databases to migrate, databases of disabled components are skipped
+func (m *migrator) sourceDatabases(src *mysql.Connection) ([]ServiceDatabase, error) {
+	dbs, err := m.data.ServiceDatabases(nil)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]ServiceDatabase, 0, len(dbs))
+	for _, db := range dbs {
+		exists, err := src.IsDatabaseExists(db.Database)
+		if err != nil {
+			return nil, errors.Wrapf(err, "check database %s exists", db.Database)
+		}
+		if !exists {
+			if db.Optional {
+				continue
+			}
+			return nil, errors.Errorf("database %s of service %s doesn't exist", db.Database, db.Service)
+		}
+		ret = append(ret, db)
+	}
+	return ret, nil
+}
+
+// checkTargetDatabases refuses to overwrite the existing tables on target server
+func checkTargetDatabases(dst *mysql.Connection, dbs []ServiceDatabase) error {
+	for _, db := range dbs {
+		exists, err := dst.IsDatabaseExists(db.Database)
+		if err != nil {
+			return errors.Wrapf(err, "check database %s exists on target", db.Database)
+		}
+		if !exists {
+			continue
+		}
+		tables, _, err := dst.GetDatabaseStats(db.Database)
+		if err != nil {
+			return err
+		}
+		if tables != 0 {
+			return errors.Errorf("database %s already exists on target with %d tables", db.Database, tables)
+		}
+	}
+	return nil
+}
+
+// quiesce scales the operator and onecloud deployments down, so nothing is written to databases during migration
+func (m *migrator) quiesce() error {
+	if m.state.Quiesced {
+		return nil
+	}
+	names := []string{cluster.DefaultOperatorName}
+	selector, err := label.New().Selector()
+	if err != nil {
+		return err
+	}
+	deploys, err := m.data.kubeCli.AppsV1().Deployments(m.namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return errors.Wrap(err, "list onecloud deployments")
+	}
+	for _, deploy := range deploys.Items {
+		names = append(names, deploy.GetName())
+	}
+	for _, name := range names {
+		deploy, err := m.data.kubeCli.AppsV1().Deployments(m.namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "get deployment %s", name)
+		}
+		if _, ok := m.state.Replicas[name]; !ok {
+			replicas := int32(1)
+			if deploy.Spec.Replicas != nil {
+				replicas = *deploy.Spec.Replicas
+			}
+			// record replicas before scaling down, it's lost otherwise if interrupted
+			m.state.Replicas[name] = replicas
+			if err := m.save(); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(m.out, "[migrate] Scaling down deployment %s\n", name)
+		if err := m.scale(name, 0); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(m.out, "[migrate] Waiting for pods of onecloud services terminated\n")
+	if err := wait.PollImmediate(2*time.Second, m.opt.timeout, func() (bool, error) {
+		for _, name := range names {
+			deploy, err := m.data.kubeCli.AppsV1().Deployments(m.namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if deploy.Status.Replicas != 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return errors.Wrap(err, "wait onecloud deployments scaled down")
+	}
+	m.state.Quiesced = true
+	return m.save()
+}
+
+func (m *migrator) scale(name string, replicas int32) error {
+	cli := m.data.kubeCli.AppsV1().Deployments(m.namespace)
+	deploy, err := cli.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "get deployment %s", name)
+	}
+	deploy.Spec.Replicas = &replicas
+	if _, err := cli.Update(deploy); err != nil {
+		return errors.Wrapf(err, "scale deployment %s to %d", name, replicas)
+	}
+	return nil
+}
+
+// migrateDatabase streams database db from src to dst and recreates its user on dst
+func (m *migrator) migrateDatabase(src, dst *mysql.Connection, db ServiceDatabase) error {
+	if m.state.Current == db.Database {
+		// partially migrated before interruption
+		if err := dst.DropDatabase(db.Database); err != nil {
+			return errors.Wrapf(err, "drop partially migrated database %s", db.Database)
+		}
+	}
+	m.state.Current = db.Database
+	if err := m.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(m.out, "[migrate] Migrating database %s of service %s\n", db.Database, db.Service)
+	pr, pw := io.Pipe()
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := src.DumpDatabase(db.Database, pw)
+		pw.CloseWithError(err)
+		dumpErr <- err
+	}()
+	err := dst.RestoreDatabase(db.Database, pr)
+	// unblock the dump if restore fails
+	pr.CloseWithError(err)
+	if dErr := <-dumpErr; dErr != nil {
+		return errors.Wrapf(dErr, "dump database %s", db.Database)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "restore database %s", db.Database)
+	}
+	if err := verifyDatabase(src, dst, db.Database); err != nil {
+		return err
+	}
+	if err := configutil.InitDBUser(dst, apiv1.DBInfo{
+		Database: db.Database,
+		Username: db.Username,
+		Password: db.Password,
+
+		MysqlConnectionOptions: m.target.MysqlConnectionOptions,
+	}); err != nil {
+		return errors.Wrapf(err, "create user %s of database %s", db.Username, db.Database)
+	}
+	m.state.Current = ""
+	m.state.Migrated = append(m.state.Migrated, db.Database)
+	return m.save()
+}
+
+// verifyDatabase compares the tables and rows of database db restored on dst with src,
+// services are quiesced so the rows of src don't change during migration
+func verifyDatabase(src, dst *mysql.Connection, db string) error {
+	srcRows, err := src.CountTableRows(db)
+	if err != nil {
+		return errors.Wrapf(err, "count rows of source database %s", db)
+	}
+	dstRows, err := dst.CountTableRows(db)
+	if err != nil {
+		return errors.Wrapf(err, "count rows of target database %s", db)
+	}
+	if err := compareTableRows(srcRows, dstRows); err != nil {
+		return errors.Wrapf(err, "verify migrated database %s", db)
+	}
+	return nil
+}
+
+// compareTableRows returns error describing the tables missing or having different rows in dst
+func compareTableRows(src, dst map[string]int64) error {
+	diffs := make([]string, 0)
+	for table, rows := range src {
+		got, ok := dst[table]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s is missing", table))
+		} else if got != rows {
+			diffs = append(diffs, fmt.Sprintf("table %s has %d rows, source has %d", table, got, rows))
+		}
+	}
+	for table := range dst {
+		if _, ok := src[table]; !ok {
+			diffs = append(diffs, fmt.Sprintf("table %s doesn't exist in source", table))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	sort.Strings(diffs)
+	return errors.New(strings.Join(diffs, "; "))
+}
+
+// updateConfig switches the OnecloudCluster, ocadm-config and component configs to target server
+func (m *migrator) updateConfig() error {
+	fmt.Fprintf(m.out, "[migrate] Updating mysql connection of onecloud cluster to %s\n", m.state.Target)
+	cli := m.data.clusterCli.OnecloudV1alpha1().OnecloudClusters(m.namespace)
+	oc, err := cli.Get(m.data.oc.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "get onecloud cluster")
+	}
+	oc.Spec.Mysql.Host = m.target.Server
+	oc.Spec.Mysql.Port = int32(m.target.Port)
+	oc.Spec.Mysql.Username = m.target.Username
+	oc.Spec.Mysql.Password = m.target.Password
+	oc, err = cli.Update(oc)
+	if err != nil {
+		return errors.Wrap(err, "update onecloud cluster")
+	}
+	if err := cluster.UpdateAdminConfigMysql(m.data.kubeCli, *m.target); err != nil {
+		return errors.Wrapf(err, "update %s", constants.OnecloudAdminConfigConfigMap)
+	}
+	if m.data.componentsCfg != nil {
+		if err := component.SyncDBConfigMaps(m.data.kubeCli, oc, m.data.componentsCfg); err != nil {
+			return errors.Wrap(err, "update components config")
+		}
+	}
+	if err := m.deleteServiceConfigs(); err != nil {
+		return err
+	}
+	m.state.ConfigUpdated = true
+	return m.save()
+}
+
+// deleteServiceConfigs deletes the ConfigMaps of services referring to the source mysql server, the operator
+// never updates existing ConfigMaps but creates the missing ones from OnecloudCluster
+func (m *migrator) deleteServiceConfigs() error {
+	selector, err := label.New().Selector()
+	if err != nil {
+		return err
+	}
+	cli := m.data.kubeCli.CoreV1().ConfigMaps(m.namespace)
+	cfgMaps, err := cli.List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return errors.Wrap(err, "list onecloud configmaps")
+	}
+	for _, cfgMap := range cfgMaps.Items {
+		refers := false
+		for _, data := range cfgMap.Data {
+			if refersMysqlAddress(data, m.state.Source) {
+				refers = true
+				break
+			}
+		}
+		if !refers {
+			continue
+		}
+		fmt.Fprintf(m.out, "[migrate] Deleting config %s referring to %s, it's regenerated by operator\n", cfgMap.GetName(), m.state.Source)
+		if !sets.NewString(m.state.RegeneratedConfigs...).Has(cfgMap.GetName()) {
+			// recorded before deleting, so it's still waited if interrupted
+			m.state.RegeneratedConfigs = append(m.state.RegeneratedConfigs, cfgMap.GetName())
+			if err := m.save(); err != nil {
+				return err
+			}
+		}
+		if err := cli.Delete(cfgMap.GetName(), &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "delete configmap %s", cfgMap.GetName())
+		}
+	}
+	return nil
+}
+
+// restart scales the operator back first and waits for it regenerating the configs of services, otherwise
+// services would be started without config
+func (m *migrator) restart() error {
+	if replicas, ok := m.state.Replicas[cluster.DefaultOperatorName]; ok {
+		if err := m.scaleBack(cluster.DefaultOperatorName); err != nil {
+			return err
+		}
+		if replicas == 0 {
+			fmt.Fprintf(m.out, "[migrate] Operator isn't running, configs of onecloud services should be regenerated manually\n")
+		} else if len(m.state.RegeneratedConfigs) != 0 {
+			fmt.Fprintf(m.out, "[migrate] Waiting for operator regenerating configs of onecloud services\n")
+			if err := wait.PollImmediate(5*time.Second, m.opt.timeout, m.configsRegenerated); err != nil {
+				return errors.Wrap(err, "wait configs of onecloud services regenerated")
+			}
+		}
+	}
+	names := make([]string, 0, len(m.state.Replicas))
+	for name := range m.state.Replicas {
+		if name != cluster.DefaultOperatorName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := m.scaleBack(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) scaleBack(name string) error {
+	replicas := m.state.Replicas[name]
+	fmt.Fprintf(m.out, "[migrate] Scaling deployment %s back to %d replicas\n", name, replicas)
+	if err := m.scale(name, replicas); err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// configsRegenerated is true if all the deleted ConfigMaps of services are created again by operator
+func (m *migrator) configsRegenerated() (bool, error) {
+	for _, name := range m.state.RegeneratedConfigs {
+		if _, err := m.data.kubeCli.CoreV1().ConfigMaps(m.namespace).Get(name, metav1.GetOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, errors.Wrapf(err, "get configmap %s", name)
+		}
+	}
+	return true, nil
+}
+
+// refersMysqlAddress checks the sqlalchemy or jdbc urls in config refer to address
+func refersMysqlAddress(config string, address string) bool {
+	return strings.Contains(config, "@"+address+"/") || strings.Contains(config, "//"+address+"/")
+}
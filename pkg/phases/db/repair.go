@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	configutil "yunion.io/x/ocadm/pkg/util/config"
+)
+
+type repairGrantsOptions struct {
+	all    bool
+	dryRun bool
+}
+
+func NewCmdRepairGrants(out io.Writer) *cobra.Command {
+	opt := &repairGrantsOptions{}
+	cmd := &cobra.Command{
+		Use:   "repair-grants [service...]",
+		Short: "Recreate the users failed the check with password and privileges stored in cluster config",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runRepairGrants(out, args, opt)
+			kubeadmutil.CheckErr(err)
+		},
+	}
+	AddRepairGrantsOptions(cmd.Flags(), opt)
+	return cmd
+}
+
+func AddRepairGrantsOptions(flagSet *flag.FlagSet, opt *repairGrantsOptions) {
+	flagSet.BoolVar(&opt.all, "all", opt.all, "repair every user even if it passes the check")
+	flagSet.BoolVar(&opt.dryRun, "dry-run", opt.dryRun, "only print the users would be repaired")
+}
+
+func runRepairGrants(out io.Writer, services []string, opt *repairGrantsOptions) error {
+	data, err := newDBData()
+	if err != nil {
+		return err
+	}
+	dbs, err := data.ServiceDatabases(services)
+	if err != nil {
+		return err
+	}
+	conn, err := data.RootConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	check := func(db ServiceDatabase) UserCheckResult {
+		return checkDatabaseUser(data, conn, db)
+	}
+	repair := func(db ServiceDatabase) error {
+		return configutil.InitDBUser(conn, apiv1.DBInfo{
+			Database: db.Database,
+			Username: db.Username,
+			Password: db.Password,
+		})
+	}
+	return repairGrants(dbs, opt, check, repair, out)
+}
+
+// repairGrants recreates the users failed the check, or all the users with --all
+func repairGrants(dbs []ServiceDatabase, opt *repairGrantsOptions, check userChecker, repair func(db ServiceDatabase) error, out io.Writer) error {
+	repaired := 0
+	for _, db := range dbs {
+		result := check(db)
+		if result.Skipped || (result.Error == nil && !opt.all) {
+			continue
+		}
+		reason := "forced by --all"
+		if result.Error != nil {
+			reason = result.Error.Error()
+		}
+		fmt.Fprintf(out, "[repair-grants] Repairing user %s of database %s: %s\n", db.Username, db.Database, reason)
+		repaired++
+		if opt.dryRun {
+			continue
+		}
+		if err := repair(db); err != nil {
+			return errors.Wrapf(err, "repair user %s of database %s", db.Username, db.Database)
+		}
+		if result := check(db); result.Error != nil {
+			return errors.Wrapf(result.Error, "user %s still fails the check after repair", db.Username)
+		}
+	}
+	if repaired == 0 {
+		fmt.Fprintf(out, "[repair-grants] All the database users are fine\n")
+	}
+	return nil
+}
@@ -2,26 +2,21 @@ package init
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
-	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
 	"k8s.io/kubernetes/pkg/util/normalizer"
+	"yunion.io/x/onecloud-operator/pkg/apis/constants"
+
 	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/options"
 	"yunion.io/x/ocadm/pkg/phases/addons"
-	calicoaddon "yunion.io/x/ocadm/pkg/phases/addons/calico"
-	csiaddon "yunion.io/x/ocadm/pkg/phases/addons/csi"
-	grafanaaddon "yunion.io/x/ocadm/pkg/phases/addons/grafana"
-	lokiaddon "yunion.io/x/ocadm/pkg/phases/addons/loki"
-	msaddon "yunion.io/x/ocadm/pkg/phases/addons/metricsserver"
-	ocaddon "yunion.io/x/ocadm/pkg/phases/addons/onecloudoperator"
-	traefikaddon "yunion.io/x/ocadm/pkg/phases/addons/traefik"
-	"yunion.io/x/ocadm/pkg/util/kubectl"
-	"yunion.io/x/onecloud-operator/pkg/apis/constants"
+	_ "yunion.io/x/ocadm/pkg/phases/addons/all"
+	"yunion.io/x/ocadm/pkg/util/kube"
 )
 
 var (
@@ -73,17 +68,50 @@ func enableHostAgent(c workflow.RunData) error {
 	return nil
 }
 
-func newAddonPhase(name string, rf func(workflow.RunData) error) workflow.Phase {
+func newAddonPhase(addon *addons.Addon) workflow.Phase {
+	name := addon.Name
 	return workflow.Phase{
 		Name:         name,
 		Short:        fmt.Sprintf("Install the %s addon to a Kubernetes cluster", name),
 		InheritFlags: getAddonPhaseFlags(name),
-		Run:          rf,
+		Run: func(c workflow.RunData) error {
+			return runAddon(c, addon)
+		},
+		RunIf: func(c workflow.RunData) (bool, error) {
+			data, ok := c.(InitData)
+			if !ok {
+				return false, errors.New("addon phase invoked with an invalid data struct")
+			}
+			if data.OnecloudCfg().Addons.IsDisabled(name) {
+				klog.Infof("[oc-addon] Skip disabled addon %s", name)
+				return false, nil
+			}
+			return true, nil
+		},
 	}
 }
 
 // NewAddonPhase returns the addon Cobra command
 func NewOCAddonPhase() workflow.Phase {
+	phases := []workflow.Phase{
+		{
+			Name:           "all",
+			Short:          "Installs all the addons",
+			InheritFlags:   getAddonPhaseFlags("all"),
+			RunAllSiblings: true,
+		},
+	}
+	registered, err := addons.DefaultRegistry().List()
+	if err != nil {
+		panic(fmt.Sprintf("invalid addons registry: %v", err))
+	}
+	for _, addon := range registered {
+		// optional addons are installed by 'ocadm addon enable' after init
+		if addon.Optional {
+			continue
+		}
+		phases = append(phases, newAddonPhase(addon))
+	}
 	return workflow.Phase{
 		Name:  "oc-addon",
 		Short: "Installs onecloud required addons to kubernetes cluster",
@@ -93,27 +121,13 @@ func NewOCAddonPhase() workflow.Phase {
 			options.AddonCalicoiFelixChaininsertmode,
 			options.AddonCalicoIPV4BlockSize,
 			options.OperatorVersion,
+			options.DisableAddons,
 		},
-		Phases: []workflow.Phase{
-			{
-				Name:           "all",
-				Short:          "Installs all the addons",
-				InheritFlags:   getAddonPhaseFlags("all"),
-				RunAllSiblings: true,
-			},
-			newAddonPhase("calico", runCalicoAddon),
-			newAddonPhase("csi", runCSIAddon),
-			newAddonPhase("traefik", runTraefikAddon),
-			newAddonPhase("onecloud-operator", runOCOperatorAddon),
-			newAddonPhase("metrics-server", runMetricsServerAddon),
-			//newAddonPhase("grafana", runGrafanaAddon),
-			//newAddonPhase("loki", runLokiAddon),
-			//newAddonPhase("promtail", runPromtailAddon),
-		},
+		Phases: phases,
 	}
 }
 
-func getInitData(c workflow.RunData) (*apiv1.InitConfiguration, clientset.Interface, *kubectl.Client, error) {
+func getInitData(c workflow.RunData) (*apiv1.InitConfiguration, clientset.Interface, *kube.Applier, error) {
 	data, ok := c.(InitData)
 	if !ok {
 		return nil, nil, nil, errors.New("addon phase invoked with an invalid data struct")
@@ -123,59 +137,36 @@ func getInitData(c workflow.RunData) (*apiv1.InitConfiguration, clientset.Interf
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	ctlCli, err := data.KubectlClient()
+	applier, err := data.Applier()
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	return cfg, client, ctlCli, err
+	return cfg, client, applier, err
 }
 
-func kubectlApplyAddon(c workflow.RunData, newF func(*kubeadmapi.ClusterConfiguration) addons.Configer) error {
-	cfg, _, kubectlCli, err := getInitData(c)
+func runAddon(c workflow.RunData, addon *addons.Addon) error {
+	data, ok := c.(InitData)
+	if !ok {
+		return errors.New("addon phase invoked with an invalid data struct")
+	}
+	cfg := data.OnecloudCfg()
+	params, err := addon.ResolveParameters(cfg, nil)
 	if err != nil {
 		return err
 	}
-	configer := newF(&cfg.InitConfiguration.ClusterConfiguration)
-	return addons.KubectlApplyAddon(configer, kubectlCli, c.(InitData).PrintAddonYaml())
-}
-
-func runCalicoAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, func(cfg *kubeadmapi.ClusterConfiguration) addons.Configer {
-		d := c.(InitData)
-		return calicoaddon.NewCalicoConfig(cfg, d.AddonCalicoIpAutodetectionMethod(), d.AddonCalicoiFelixChaininsertmode(), d.AddonCalicoIPV4PoolBlockSize())
-	})
-}
-
-func runOCOperatorAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, func(cfg *kubeadmapi.ClusterConfiguration) addons.Configer {
-		return ocaddon.NewOperatorConfig(cfg, c.(InitData).OperatorVersion())
-	})
-}
-
-func runMetricsServerAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, func(cfg *kubeadmapi.ClusterConfiguration) addons.Configer {
-		return msaddon.NewMetricsServerConfig(cfg)
-	})
-}
-
-func runCSIAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, csiaddon.NewLocalPathProvisionerConfig)
-}
-
-func runTraefikAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, traefikaddon.NewTraefikConfig)
-}
-
-func runGrafanaAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, grafanaaddon.NewGrafanaConfig)
-}
-
-func runLokiAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, lokiaddon.NewLokiConfig)
-}
-
-func runPromtailAddon(c workflow.RunData) error {
-	return kubectlApplyAddon(c, lokiaddon.NewPromtailConfig)
+	if data.PrintAddonYaml() {
+		manifest, err := addon.Render(cfg, params)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s", manifest)
+		return nil
+	}
+	_, client, applier, err := getInitData(c)
+	if err != nil {
+		return err
+	}
+	return addons.NewManager(addons.DefaultRegistry(), cfg, client, applier, os.Stdout).Install(addon, params)
 }
 
 func getAddonPhaseFlags(name string) []string {
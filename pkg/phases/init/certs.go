@@ -0,0 +1,68 @@
+package init
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/options"
+	certsphase "yunion.io/x/ocadm/pkg/phases/certs"
+	clusterphase "yunion.io/x/ocadm/pkg/phases/cluster"
+	"yunion.io/x/ocadm/pkg/phases/copycerts"
+)
+
+// NewOCCertsPhase returns the phase to sign and upload the certificates of the user provided onecloud CA
+func NewOCCertsPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "oc-certs",
+		Short: "Sign and upload the certificates of the user provided onecloud CA",
+		Long: fmt.Sprintf("Sign the missing certificates with the onecloud CA key in the onecloud certificates directory, "+
+			"then upload them to Secret %q for joining control plane nodes and to the certs Secret of onecloud operator. "+
+			"It's skipped if no onecloud CA is provided, onecloud operator generates a self-signed CA in that case.",
+			constants.OcadmCertsSecret),
+		Run: runOCCerts,
+		InheritFlags: []string{
+			options.CfgPath,
+			options.KubeconfigPath,
+		},
+	}
+}
+
+func runOCCerts(c workflow.RunData) error {
+	data, ok := c.(InitData)
+	if !ok {
+		return errors.New("oc-certs phase invoked with an invalid data struct")
+	}
+	cfg := data.OnecloudCfg()
+	if data.DryRun() {
+		fmt.Printf("[oc-certs] Would sign and upload the certificates of onecloud CA in %s\n", cfg.OnecloudCertificatesDir)
+		return nil
+	}
+	if err := certsphase.CreateOnecloudPKIAssets(cfg, os.Stdout); err != nil {
+		return err
+	}
+	mode, err := certsphase.UsingExternalOnecloudCA(cfg.OnecloudCertificatesDir)
+	if err != nil {
+		return err
+	}
+	if mode == certsphase.OnecloudCAGenerated {
+		return nil
+	}
+
+	client, err := data.Client()
+	if err != nil {
+		return err
+	}
+	if err := copycerts.UploadCerts(client, cfg); err != nil {
+		return errors.Wrap(err, "upload onecloud certificates")
+	}
+	fmt.Printf("[oc-certs] Storing the onecloud CA and service certificate in Secret %q in the %q namespace\n",
+		certsphase.OperatorCertsSecretName(clusterphase.DefaultClusterName), constants.OnecloudNamespace)
+	if err := certsphase.CreateOrUpdateOperatorCertsSecret(client, constants.OnecloudNamespace, clusterphase.DefaultClusterName, cfg.OnecloudCertificatesDir); err != nil {
+		return errors.Wrap(err, "create onecloud operator certs secret")
+	}
+	return nil
+}
@@ -4,7 +4,8 @@ import (
 	initphases "k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/init"
 
 	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
-	"yunion.io/x/ocadm/pkg/util/kubectl"
+	"yunion.io/x/ocadm/pkg/images"
+	"yunion.io/x/ocadm/pkg/util/kube"
 	"yunion.io/x/ocadm/pkg/util/mysql"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
@@ -20,7 +21,7 @@ type InitData interface {
 	OnecloudCfg() *apiv1.InitConfiguration
 	OnecloudClientSession() (*mcclient.ClientSession, error)
 	OperatorVersion() string
-	KubectlClient() (*kubectl.Client, error)
+	Applier() (*kube.Applier, error)
 	EnabledHostAgent() bool
 	PrintAddonYaml() bool
 	AddonCalicoIpAutodetectionMethod() string
@@ -29,4 +30,5 @@ type InitData interface {
 	GetHighAvailabilityVIP() string
 	GetKeepalivedVersionTag() string
 	GetNodeIP() string
+	ImagePullOptions() images.PullOptions
 }
@@ -21,6 +21,11 @@ func NewPreflightPhase() workflow.Phase {
 			options.CfgPath,
 			options.KubeadmCfgPath,
 			options.IgnorePreflightErrors,
+			options.EnableHostAgent,
+			options.EnableHugepage,
+			options.HostLocalImagePath,
+			options.ImagePullParallelism,
+			options.ImagePullRetries,
 		},
 	}
 }
@@ -35,12 +40,17 @@ func runPreflight(c workflow.RunData) error {
 	if err := preflight.RunInitNodeChecks(utilsexec.New(), data.OnecloudCfg(), data.Cfg(), data.IgnorePreflightErrors(), false, false); err != nil {
 		return err
 	}
+	if data.EnabledHostAgent() {
+		if err := preflight.RunHostAgentChecks(&data.OnecloudCfg().Node.Host, data.IgnorePreflightErrors()); err != nil {
+			return err
+		}
+	}
 
 	if !data.DryRun() {
 		fmt.Println("[preflight] Pulling images required for setting up a OneCloud on Kubernetes cluster")
 		fmt.Println("[preflight] This might take a minute or two, depending on the speed of your internet connection")
 		fmt.Println("[preflight] You can also perform this action in beforehand using 'ocadm config images pull'")
-		if err := preflight.RunPullImagesCheck(utilsexec.New(), data.OnecloudCfg(), data.Cfg(), data.IgnorePreflightErrors()); err != nil {
+		if err := preflight.RunPullImagesCheck(utilsexec.New(), data.OnecloudCfg(), data.Cfg(), data.ImagePullOptions(), data.IgnorePreflightErrors()); err != nil {
 			return err
 		}
 	} else {
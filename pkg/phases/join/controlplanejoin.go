@@ -4,9 +4,12 @@ import (
 	"fmt"
 
 	"github.com/pkg/errors"
+	"k8s.io/klog"
 	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	certsphase "yunion.io/x/ocadm/pkg/phases/certs"
+	"yunion.io/x/ocadm/pkg/phases/copycerts"
 	"yunion.io/x/ocadm/pkg/phases/uploadconfig"
 )
 
@@ -15,11 +18,58 @@ func NewControlPlaneJoinPhase() workflow.Phase {
 		Name:  "oc-control-plane-join",
 		Short: "Join a machine as a oc control plane instance",
 		Phases: []workflow.Phase{
+			newDownloadCertsSubphase(),
 			newUpdateStatusSubphase(),
 		},
 	}
 }
 
+func newDownloadCertsSubphase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "download-certs",
+		Short: fmt.Sprintf("Download the onecloud certificates from the %s Secret", constants.OcadmCertsSecret),
+		Run:   runDownloadCertsPhase,
+	}
+}
+
+func runDownloadCertsPhase(c workflow.RunData) error {
+	data, ok := c.(JoinData)
+	if !ok {
+		return errors.New("download-certs phase invoked with an invalid data struct")
+	}
+
+	if data.Cfg().ControlPlane == nil {
+		return nil
+	}
+
+	client, err := data.ClientSet()
+	if err != nil {
+		return errors.Wrap(err, "couldn't create Kubernetes client")
+	}
+
+	// the Secret is only uploaded when the onecloud CA is provided by user
+	exists, err := copycerts.CertsSecretExists(client)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		klog.V(1).Infof("[download-certs] Secret %q not found, skip downloading onecloud certificates", constants.OcadmCertsSecret)
+		return nil
+	}
+
+	cfg, err := data.OnecloudInitCfg()
+	if err != nil {
+		return err
+	}
+	if err := copycerts.DownloadCerts(client, cfg); err != nil {
+		return err
+	}
+	if _, err := certsphase.UsingExternalOnecloudCA(cfg.OnecloudCertificatesDir); err != nil {
+		return errors.Wrap(err, "invalid onecloud certificates downloaded")
+	}
+	return nil
+}
+
 func newUpdateStatusSubphase() workflow.Phase {
 	return workflow.Phase{
 		Name: "update-status",
@@ -16,4 +16,5 @@ type JoinData interface {
 	GetKeepalivedVersionTag() string
 	GetNodeIP() string
 	GetHostInterface() string
+	EnabledHostAgent() bool
 }
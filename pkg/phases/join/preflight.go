@@ -0,0 +1,37 @@
+package join
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/preflight"
+)
+
+// NewHostAgentPreflightPhase returns the phase checking the node is able to run host agent
+func NewHostAgentPreflightPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "oc-preflight",
+		Short: "Run host agent pre-flight checks",
+		Long:  "Run pre-flight checks of virtualization, kernel modules and disk space when host agent is enabled.",
+		Run:   runHostAgentPreflight,
+		InheritFlags: []string{
+			options.CfgPath,
+			options.IgnorePreflightErrors,
+			options.EnableHostAgent,
+			options.EnableHugepage,
+			options.HostLocalImagePath,
+		},
+	}
+}
+
+func runHostAgentPreflight(c workflow.RunData) error {
+	data, ok := c.(JoinData)
+	if !ok {
+		return errors.New("oc-preflight phase invoked with an invalid data struct")
+	}
+	if !data.EnabledHostAgent() {
+		return nil
+	}
+	return preflight.RunHostAgentChecks(&data.OnecloudJoinCfg().Node.Host, data.IgnorePreflightErrors())
+}
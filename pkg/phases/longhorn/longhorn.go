@@ -10,7 +10,7 @@ import (
 	"yunion.io/x/ocadm/pkg/apis/constants"
 	"yunion.io/x/ocadm/pkg/phases/addons"
 	"yunion.io/x/ocadm/pkg/phases/addons/longhorn"
-	"yunion.io/x/ocadm/pkg/util/kubectl"
+	"yunion.io/x/ocadm/pkg/util/kube"
 )
 
 func InstallLonghornPhase() workflow.Phase {
@@ -28,7 +28,7 @@ func InstallLonghornPhase() workflow.Phase {
 }
 
 type LonghornData interface {
-	KubectlClient() (*kubectl.Client, error)
+	Applier() (*kube.Applier, error)
 	GetImageRepository() string
 	LonghornConfig() *LonghornConfig
 	ClientSet() (*clientset.Clientset, error)
@@ -46,7 +46,7 @@ func runLonghornAddon(c workflow.RunData) error {
 	if !ok {
 		return errors.New("addon phase invoked with an invalid data struct")
 	}
-	kubectlCli, err := data.KubectlClient()
+	applier, err := data.Applier()
 	if err != nil {
 		return err
 	}
@@ -64,7 +64,7 @@ func runLonghornAddon(c workflow.RunData) error {
 		data.GetImageRepository(), loghornConfig.DataPath,
 		loghornConfig.OverProviosioningPercentage, loghornConfig.ReplicaCount,
 	)
-	return addons.KubectlApplyAddon(configer, kubectlCli, false)
+	return addons.ApplyAddon(configer, applier, constants.DefaultLonghornVersion, false)
 }
 
 func lableLonghornNodes(cli *clientset.Clientset, nodes []string) (int, error) {
@@ -2,7 +2,6 @@ package longhorn
 
 import (
 	"fmt"
-	"path"
 	"strings"
 	"time"
 
@@ -18,6 +17,7 @@ import (
 
 	"yunion.io/x/log"
 	"yunion.io/x/ocadm/pkg/apis/constants"
+	"yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/util/kubectl"
 )
 
@@ -132,12 +132,11 @@ func runLonghornEnsurePvc(c workflow.RunData) error {
 }
 
 const (
-	SYNC_IMAGE = "rsync-ssh"
-	POD_NAME   = "migrate-pv-data"
+	POD_NAME = "migrate-pv-data"
 )
 
 func getSyncImage(imageRepository string) string {
-	return fmt.Sprintf("%s:latest", path.Join(imageRepository, SYNC_IMAGE))
+	return images.GetGenericImage(imageRepository, constants.RsyncSSH, constants.RsyncSSHVersion)
 }
 
 func runLonghornMigrateData(c workflow.RunData) error {
@@ -0,0 +1,259 @@
+package nodelabels
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	operatorconstants "yunion.io/x/onecloud-operator/pkg/apis/constants"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+)
+
+const (
+	RoleHost       = "host"
+	RoleController = "controller"
+	RoleGlance     = "glance"
+	RoleBaremetal  = "baremetal"
+	RoleEsxi       = "esxi"
+	RoleLonghorn   = "longhorn"
+)
+
+// Role is an onecloud role of node, the services of the role are scheduled by the node label
+type Role struct {
+	Name string
+	// LabelKey and EnabledValue are the node label selecting the node for the role
+	LabelKey     string
+	EnabledValue string
+	// DisabledValue is set to the label when the role is unset, the label is removed if it's empty
+	DisabledValue string
+	// Conflicts are the roles that can't be set on the same node
+	Conflicts []string
+	// JoinFlag is the flag of 'ocadm init' and 'ocadm join' enabling the role, empty if there isn't one
+	JoinFlag string
+}
+
+// Label returns the node label of the role in the form key=value
+func (r Role) Label() string {
+	return fmt.Sprintf("%s=%s", r.LabelKey, r.EnabledValue)
+}
+
+// Roles is the table of all the node roles and their labels
+var Roles = []Role{
+	{
+		Name:          RoleHost,
+		LabelKey:      operatorconstants.OnecloudEnableHostLabelKey,
+		EnabledValue:  "enable",
+		DisabledValue: "disable",
+		// the DHCP services of host agent and baremetal agent listen on the same port
+		Conflicts: []string{RoleBaremetal},
+		JoinFlag:  options.EnableHostAgent,
+	},
+	{
+		Name:          RoleController,
+		LabelKey:      operatorconstants.OnecloudControllerLabelKey,
+		EnabledValue:  "enable",
+		DisabledValue: "disable",
+		JoinFlag:      options.AsOnecloudController,
+	},
+	{
+		Name:         RoleGlance,
+		LabelKey:     "onecloud.yunion.io/glance",
+		EnabledValue: "enable",
+		JoinFlag:     options.GlanceNode,
+	},
+	{
+		Name:         RoleBaremetal,
+		LabelKey:     operatorconstants.OnecloudEanbleBaremetalLabelKey,
+		EnabledValue: "enable",
+		Conflicts:    []string{RoleHost},
+		JoinFlag:     options.BaremetalNode,
+	},
+	{
+		Name:         RoleEsxi,
+		LabelKey:     "onecloud.yunion.io/esxi",
+		EnabledValue: "enable",
+		JoinFlag:     options.EsxiNode,
+	},
+	{
+		Name:         RoleLonghorn,
+		LabelKey:     constants.LonghornCreateDiskLable,
+		EnabledValue: "true",
+	},
+}
+
+// RoleNames returns the names of all the roles
+func RoleNames() []string {
+	names := make([]string, 0, len(Roles))
+	for _, r := range Roles {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// GetRole returns the role of name
+func GetRole(name string) (Role, error) {
+	for _, r := range Roles {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return Role{}, errors.Errorf("unknown role %q, supported roles: %s", name, strings.Join(RoleNames(), ", "))
+}
+
+// NodeRoles returns the names of roles enabled by the node labels
+func NodeRoles(node *corev1.Node) []string {
+	roles := make([]string, 0)
+	for _, r := range Roles {
+		if node.Labels[r.LabelKey] == r.EnabledValue {
+			roles = append(roles, r.Name)
+		}
+	}
+	return roles
+}
+
+// ConfiguredRoles returns the names of roles enabled by the node configuration of init or join
+func ConfiguredRoles(node *apiv1.NodeConfiguration, asController bool) []string {
+	enabled := map[string]bool{
+		RoleHost:       node.Host.Enabled,
+		RoleController: asController,
+		RoleGlance:     node.GlanceNode,
+		RoleBaremetal:  node.BaremetalNode,
+		RoleEsxi:       node.EsxiNode,
+	}
+	roles := make([]string, 0)
+	for _, r := range Roles {
+		if enabled[r.Name] {
+			roles = append(roles, r.Name)
+		}
+	}
+	return roles
+}
+
+// ConfigureRoles enables the roles in the node configuration of init or join,
+// the controller role isn't part of the node configuration and is ignored
+func ConfigureRoles(node *apiv1.NodeConfiguration, roles []string) {
+	enabled := sets.NewString(roles...)
+	node.Host.Enabled = enabled.Has(RoleHost)
+	node.GlanceNode = enabled.Has(RoleGlance)
+	node.BaremetalNode = enabled.Has(RoleBaremetal)
+	node.EsxiNode = enabled.Has(RoleEsxi)
+}
+
+// JoinArgs returns the flags of 'ocadm init' and 'ocadm join' enabling roles,
+// the host networks are added after the flag of host agent
+func JoinArgs(roles []string, hostNetworks []string) []string {
+	enabled := sets.NewString(roles...)
+	args := make([]string, 0)
+	for _, r := range Roles {
+		if r.JoinFlag == "" || !enabled.Has(r.Name) {
+			continue
+		}
+		args = append(args, "--"+r.JoinFlag)
+		if r.Name == RoleHost {
+			for _, network := range hostNetworks {
+				args = append(args, "--"+options.HostNetworks, network)
+			}
+		}
+	}
+	return args
+}
+
+// ValidateRoles checks the roles are known and don't conflict with each other
+func ValidateRoles(roles []string) error {
+	set := sets.NewString(roles...)
+	for _, name := range set.List() {
+		r, err := GetRole(name)
+		if err != nil {
+			return err
+		}
+		for _, c := range r.Conflicts {
+			if set.Has(c) {
+				return errors.Errorf("role %s conflicts with role %s", r.Name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// ListNodes returns the nodes of names, or the nodes matching the label selector if no names specified
+func ListNodes(client clientset.Interface, names []string, selector string) ([]corev1.Node, error) {
+	if len(names) != 0 && selector != "" {
+		return nil, errors.New("nodes names and label selector can't be specified at the same time")
+	}
+	if len(names) == 0 {
+		list, err := client.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, errors.Wrap(err, "list nodes")
+		}
+		return list.Items, nil
+	}
+	nodes := make([]corev1.Node, 0, len(names))
+	for _, name := range names {
+		node, err := client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "get node %s", name)
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, nil
+}
+
+// SetNodesRoles sets or unsets the roles of nodes by updating their labels. The resulting roles of every node
+// are validated before any node is updated, so conflicting roles leave all the nodes untouched.
+func SetNodesRoles(client clientset.Interface, nodes []corev1.Node, roles []string, enable bool, out io.Writer) error {
+	if len(roles) == 0 {
+		return errors.New("no roles specified")
+	}
+	if len(nodes) == 0 {
+		return errors.New("no nodes matched")
+	}
+	toSet := make([]Role, 0, len(roles))
+	for _, name := range sets.NewString(roles...).List() {
+		r, err := GetRole(name)
+		if err != nil {
+			return err
+		}
+		toSet = append(toSet, r)
+	}
+	if enable {
+		for i := range nodes {
+			if err := ValidateRoles(append(NodeRoles(&nodes[i]), roles...)); err != nil {
+				return errors.Wrapf(err, "node %s", nodes[i].Name)
+			}
+		}
+	}
+
+	for i := range nodes {
+		node := nodes[i].DeepCopy()
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		for _, r := range toSet {
+			switch {
+			case enable:
+				node.Labels[r.LabelKey] = r.EnabledValue
+			case r.DisabledValue != "":
+				node.Labels[r.LabelKey] = r.DisabledValue
+			default:
+				delete(node.Labels, r.LabelKey)
+			}
+		}
+		if _, err := client.CoreV1().Nodes().Update(node); err != nil {
+			return errors.Wrapf(err, "update labels of node %s", node.Name)
+		}
+		action := "Set"
+		if !enable {
+			action = "Unset"
+		}
+		fmt.Fprintf(out, "[node] %s roles %s of node %s\n", action, strings.Join(roles, ","), node.Name)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package nodelabels
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func newNode(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestValidateRoles(t *testing.T) {
+	tests := []struct {
+		roles   []string
+		wantErr bool
+	}{
+		{roles: []string{RoleHost, RoleGlance, RoleLonghorn}},
+		{roles: []string{RoleController, RoleBaremetal, RoleEsxi}},
+		{roles: []string{RoleHost, RoleBaremetal}, wantErr: true},
+		{roles: []string{"db"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateRoles(tt.roles); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRoles(%v) error = %v, wantErr %v", tt.roles, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfiguredRoles(t *testing.T) {
+	node := &apiv1.NodeConfiguration{GlanceNode: true, BaremetalNode: true}
+	node.Host.Enabled = true
+	roles := ConfiguredRoles(node, true)
+	if want := []string{RoleHost, RoleController, RoleGlance, RoleBaremetal}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("ConfiguredRoles() = %v, want %v", roles, want)
+	}
+	// join --enable-host-agent --baremetal-node must be refused as 'node role set' does
+	if err := ValidateRoles(roles); err == nil {
+		t.Errorf("ValidateRoles(%v) should fail", roles)
+	}
+}
+
+func TestConfigureRoles(t *testing.T) {
+	node := &apiv1.NodeConfiguration{BaremetalNode: true}
+	roles := []string{RoleHost, RoleController, RoleEsxi, RoleLonghorn}
+	ConfigureRoles(node, roles)
+	if !node.Host.Enabled || !node.EsxiNode || node.GlanceNode || node.BaremetalNode {
+		t.Errorf("ConfigureRoles(%v) = %#v", roles, node)
+	}
+	if got, want := ConfiguredRoles(node, true), []string{RoleHost, RoleController, RoleEsxi}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfiguredRoles() after ConfigureRoles() = %v, want %v", got, want)
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	got := JoinArgs([]string{RoleGlance, RoleHost, RoleLonghorn}, []string{"eth0/br0/10.0.0.10"})
+	want := []string{"--enable-host-agent", "--host-networks", "eth0/br0/10.0.0.10", "--glance-node"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JoinArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestNodeRoles(t *testing.T) {
+	node := newNode("node1", map[string]string{
+		"onecloud.yunion.io/host":              "enable",
+		"onecloud.yunion.io/controller":        "disable",
+		"onecloud.yunion.io/glance":            "enable",
+		"node.longhorn.io/create-default-disk": "true",
+	})
+	want := []string{RoleHost, RoleGlance, RoleLonghorn}
+	if got := NodeRoles(node); !reflect.DeepEqual(got, want) {
+		t.Errorf("NodeRoles() = %v, want %v", got, want)
+	}
+}
+
+func TestSetNodesRoles(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newNode("node1", map[string]string{"zone": "zone0"}),
+		newNode("node2", map[string]string{"zone": "zone0", "onecloud.yunion.io/baremetal": "enable"}),
+		newNode("node3", map[string]string{"zone": "zone1"}),
+	)
+
+	nodes, err := ListNodes(client, nil, "zone=zone0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("ListNodes() returns %d nodes, want 2", len(nodes))
+	}
+	if err := SetNodesRoles(client, nodes, []string{RoleHost}, true, ioutil.Discard); err == nil {
+		t.Errorf("SetNodesRoles() should fail on node with conflicting role")
+	}
+	node1, _ := client.CoreV1().Nodes().Get("node1", metav1.GetOptions{})
+	if roles := NodeRoles(node1); len(roles) != 0 {
+		t.Errorf("node1 roles %v should be untouched on conflict", roles)
+	}
+
+	nodes, err = ListNodes(client, []string{"node1", "node3"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetNodesRoles(client, nodes, []string{RoleHost, RoleController, RoleGlance}, true, ioutil.Discard); err != nil {
+		t.Fatalf("SetNodesRoles() error: %v", err)
+	}
+	nodes, _ = ListNodes(client, []string{"node3"}, "")
+	if err := SetNodesRoles(client, nodes, []string{RoleController, RoleGlance}, false, ioutil.Discard); err != nil {
+		t.Fatalf("SetNodesRoles() error: %v", err)
+	}
+
+	node1, _ = client.CoreV1().Nodes().Get("node1", metav1.GetOptions{})
+	if got, want := NodeRoles(node1), []string{RoleHost, RoleController, RoleGlance}; !reflect.DeepEqual(got, want) {
+		t.Errorf("node1 roles = %v, want %v", got, want)
+	}
+	node3, _ := client.CoreV1().Nodes().Get("node3", metav1.GetOptions{})
+	if got, want := NodeRoles(node3), []string{RoleHost}; !reflect.DeepEqual(got, want) {
+		t.Errorf("node3 roles = %v, want %v", got, want)
+	}
+	if v := node3.Labels["onecloud.yunion.io/controller"]; v != "disable" {
+		t.Errorf("controller label of node3 = %q, want disable", v)
+	}
+	if _, ok := node3.Labels["onecloud.yunion.io/glance"]; ok {
+		t.Errorf("glance label of node3 should be removed")
+	}
+
+	if _, err := ListNodes(client, []string{"node1"}, "zone=zone0"); err == nil {
+		t.Errorf("ListNodes() should fail with both names and selector")
+	}
+}
@@ -0,0 +1,122 @@
+package reset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+// NewCleanupPhase returns the phase removing the files written by ocadm on this node
+func NewCleanupPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "oc-cleanup",
+		Short: "Remove onecloud files of this node",
+		Phases: []workflow.Phase{
+			{
+				Name:         "keepalived",
+				Short:        "Remove the keepalived static pod manifest",
+				Run:          runCleanupKeepalived,
+				InheritFlags: []string{options.DryRun},
+			},
+			{
+				Name:         "config-dir",
+				Short:        fmt.Sprintf("Remove the onecloud configs and certificates in %s", constants.OnecloudConfigDir),
+				Run:          runCleanupConfigDir,
+				InheritFlags: []string{options.DryRun},
+			},
+			{
+				Name:         "host-config",
+				Short:        fmt.Sprintf("Remove the host agent config %s", onecloud.HostConfFile),
+				Run:          runCleanupHostConfig,
+				InheritFlags: []string{options.DryRun},
+			},
+		},
+	}
+}
+
+func runCleanupKeepalived(c workflow.RunData) error {
+	data, ok := c.(ResetData)
+	if !ok {
+		return errors.New("oc-cleanup phase invoked with an invalid data struct")
+	}
+	manifest := kubeadmconstants.GetStaticPodFilepath("keepalived", kubeadmconstants.GetStaticPodDirectory())
+	return removePaths(data.DryRun(), manifest)
+}
+
+func runCleanupConfigDir(c workflow.RunData) error {
+	data, ok := c.(ResetData)
+	if !ok {
+		return errors.New("oc-cleanup phase invoked with an invalid data struct")
+	}
+	paths, err := configDirPaths(constants.OnecloudConfigDir, data.OnecloudCfg())
+	if err != nil {
+		return err
+	}
+	return removePaths(data.DryRun(), paths...)
+}
+
+func runCleanupHostConfig(c workflow.RunData) error {
+	data, ok := c.(ResetData)
+	if !ok {
+		return errors.New("oc-cleanup phase invoked with an invalid data struct")
+	}
+	return removePaths(data.DryRun(), onecloud.HostConfFile, onecloud.HostConfFile+".backup")
+}
+
+// configDirPaths returns the entries of configDir and the certificates dir out of it,
+// the host agent config is left to host-config phase
+func configDirPaths(configDir string, cfg *apiv1.InitConfiguration) ([]string, error) {
+	hostConfFiles := map[string]bool{
+		onecloud.HostConfFile:             true,
+		onecloud.HostConfFile + ".backup": true,
+	}
+	paths := []string{}
+	infos, err := ioutil.ReadDir(configDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "read dir %s", configDir)
+	}
+	for _, info := range infos {
+		p := filepath.Join(configDir, info.Name())
+		if hostConfFiles[p] {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	if cfg != nil && len(cfg.OnecloudCertificatesDir) != 0 {
+		rel, err := filepath.Rel(configDir, cfg.OnecloudCertificatesDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			paths = append(paths, cfg.OnecloudCertificatesDir)
+		}
+	}
+	return paths, nil
+}
+
+func removePaths(dryRun bool, paths ...string) error {
+	for _, p := range paths {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			klog.V(1).Infof("[reset] %s doesn't exist, skipping", p)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("[dryrun] Would remove %s\n", p)
+			continue
+		}
+		fmt.Printf("[reset] Removing %s\n", p)
+		if err := os.RemoveAll(p); err != nil {
+			return errors.Wrapf(err, "remove %s", p)
+		}
+	}
+	return nil
+}
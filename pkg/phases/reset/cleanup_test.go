@@ -0,0 +1,126 @@
+package reset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ocadm-reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestConfigDirPaths(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	configDir := filepath.Join(dir, "yunion")
+	if err := os.MkdirAll(filepath.Join(configDir, "pki"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(configDir, "region.conf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		configDir string
+		certsDir  string
+		want      []string
+	}{
+		{
+			name:      "config dir not exists",
+			configDir: filepath.Join(dir, "missing"),
+			want:      []string{},
+		},
+		{
+			name:      "entries of config dir",
+			configDir: configDir,
+			want:      []string{filepath.Join(configDir, "pki"), filepath.Join(configDir, "region.conf")},
+		},
+		{
+			name:      "certificates dir in config dir",
+			configDir: configDir,
+			certsDir:  filepath.Join(configDir, "pki"),
+			want:      []string{filepath.Join(configDir, "pki"), filepath.Join(configDir, "region.conf")},
+		},
+		{
+			name:      "certificates dir out of config dir",
+			configDir: configDir,
+			certsDir:  filepath.Join(dir, "yunion-pki"),
+			want:      []string{filepath.Join(configDir, "pki"), filepath.Join(configDir, "region.conf"), filepath.Join(dir, "yunion-pki")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg *apiv1.InitConfiguration
+			if tt.certsDir != "" {
+				cfg = &apiv1.InitConfiguration{}
+				cfg.OnecloudCertificatesDir = tt.certsDir
+			}
+			got, err := configDirPaths(tt.configDir, cfg)
+			if err != nil {
+				t.Fatalf("configDirPaths() error = %v", err)
+			}
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configDirPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemovePaths(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "region.conf")
+	subDir := filepath.Join(dir, "pki")
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	for _, p := range []string{file, filepath.Join(subDir, "ca.crt"), filepath.Join(target, "keep")} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{file, subDir, link, filepath.Join(dir, "missing")}
+
+	exists := func(p string) bool {
+		_, err := os.Lstat(p)
+		return err == nil
+	}
+	if err := removePaths(true, paths...); err != nil {
+		t.Fatalf("removePaths() dry run error = %v", err)
+	}
+	for _, p := range []string{file, subDir, link} {
+		if !exists(p) {
+			t.Errorf("%s shouldn't be removed by dry run", p)
+		}
+	}
+
+	if err := removePaths(false, paths...); err != nil {
+		t.Fatalf("removePaths() error = %v", err)
+	}
+	for _, p := range []string{file, subDir, link} {
+		if exists(p) {
+			t.Errorf("%s should be removed", p)
+		}
+	}
+	if !exists(filepath.Join(target, "keep")) {
+		t.Errorf("the target of removed symlink shouldn't be removed")
+	}
+}
@@ -0,0 +1,15 @@
+package reset
+
+import (
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+// ResetData is the interface to use for onecloud reset phases.
+// The "resetData" type from "cmd/reset.go" must satisfy this interface.
+type ResetData interface {
+	OnecloudCfg() *apiv1.InitConfiguration
+	DryRun() bool
+	PurgeDatabases() bool
+	ServiceDBConfigs() ([]ocutil.ServiceDBConfig, error)
+}
@@ -0,0 +1,92 @@
+package reset
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"yunion.io/x/ocadm/pkg/options"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+// NewDatabasesPhase returns the phase dropping onecloud databases and users,
+// it must run before the control plane is removed for reading the database list from cluster
+func NewDatabasesPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "oc-databases",
+		Short: "Drop onecloud databases and users from mysql, only run with --purge-databases",
+		Run:   runDatabases,
+		RunIf: func(c workflow.RunData) (bool, error) {
+			data, ok := c.(ResetData)
+			if !ok {
+				return false, errors.New("oc-databases phase invoked with an invalid data struct")
+			}
+			return data.PurgeDatabases(), nil
+		},
+		InheritFlags: []string{
+			options.KubeconfigPath,
+			options.DryRun,
+			options.PurgeDatabases,
+		},
+	}
+}
+
+func runDatabases(c workflow.RunData) error {
+	data, ok := c.(ResetData)
+	if !ok {
+		return errors.New("oc-databases phase invoked with an invalid data struct")
+	}
+	cfg := data.OnecloudCfg()
+	if cfg == nil {
+		return errors.New("onecloud cluster configuration is not available, can't purge databases")
+	}
+	dbs, err := data.ServiceDBConfigs()
+	if err != nil {
+		return errors.Wrap(err, "get databases of onecloud services")
+	}
+
+	if data.DryRun() {
+		for _, db := range dbs {
+			fmt.Printf("[dryrun] Would drop database %s and user %s of service %s on %s:%d\n",
+				db.Database, db.Username, db.Service, cfg.MysqlConnection.Server, cfg.MysqlConnection.Port)
+		}
+		return nil
+	}
+
+	conn, err := mysql.NewConnection(&cfg.MysqlConnection)
+	if err != nil {
+		return errors.Wrap(err, "connect to mysql")
+	}
+	defer conn.Close()
+	return dropDatabases(conn, cfg.MysqlConnection.Username, dbs)
+}
+
+// databaseDropper drops databases and users, it's implemented by mysql.Connection
+type databaseDropper interface {
+	DropDatabase(db string) error
+	DropUser(user string) error
+}
+
+// dropDatabases drops the databases and users of services, the admin user is never dropped
+func dropDatabases(conn databaseDropper, adminUser string, dbs []ocutil.ServiceDBConfig) error {
+	droppedUsers := sets.NewString()
+	for _, db := range dbs {
+		fmt.Printf("[reset] Dropping database %s of service %s\n", db.Database, db.Service)
+		if err := conn.DropDatabase(db.Database); err != nil {
+			return errors.Wrapf(err, "drop database %s", db.Database)
+		}
+		// never drop the admin user even if a service shares it
+		if db.Username == "" || db.Username == adminUser || droppedUsers.Has(db.Username) {
+			continue
+		}
+		fmt.Printf("[reset] Dropping mysql user %s of service %s\n", db.Username, db.Service)
+		if err := conn.DropUser(db.Username); err != nil {
+			return errors.Wrapf(err, "drop user %s", db.Username)
+		}
+		droppedUsers.Insert(db.Username)
+	}
+	return nil
+}
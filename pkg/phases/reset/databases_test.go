@@ -0,0 +1,101 @@
+package reset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+type fakeResetData struct {
+	cfg    *apiv1.InitConfiguration
+	dryRun bool
+	dbs    []ocutil.ServiceDBConfig
+	dbsErr error
+}
+
+func (d *fakeResetData) OnecloudCfg() *apiv1.InitConfiguration { return d.cfg }
+func (d *fakeResetData) DryRun() bool                          { return d.dryRun }
+func (d *fakeResetData) PurgeDatabases() bool                  { return true }
+func (d *fakeResetData) ServiceDBConfigs() ([]ocutil.ServiceDBConfig, error) {
+	return d.dbs, d.dbsErr
+}
+
+type fakeDropper struct {
+	databases []string
+	users     []string
+	err       error
+}
+
+func (d *fakeDropper) DropDatabase(db string) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.databases = append(d.databases, db)
+	return nil
+}
+
+func (d *fakeDropper) DropUser(user string) error {
+	d.users = append(d.users, user)
+	return nil
+}
+
+func newServiceDB(service, db, user string) ocutil.ServiceDBConfig {
+	return ocutil.ServiceDBConfig{Service: service, DBConfig: onecloud.DBConfig{Database: db, Username: user}}
+}
+
+func TestRunDatabases(t *testing.T) {
+	cfg := &apiv1.InitConfiguration{}
+	// the server can't be connected, so only the paths not connecting mysql succeed
+	cfg.MysqlConnection.Server = "127.0.0.1"
+	cfg.MysqlConnection.Port = 1
+	dbs := []ocutil.ServiceDBConfig{newServiceDB("keystone", "keystone", "keystone")}
+	tests := []struct {
+		name    string
+		data    *fakeResetData
+		wantErr bool
+	}{
+		{name: "no cluster configuration", data: &fakeResetData{dryRun: true, dbs: dbs}, wantErr: true},
+		{name: "list databases failed", data: &fakeResetData{cfg: cfg, dryRun: true, dbsErr: errors.New("not found")}, wantErr: true},
+		{name: "dry run", data: &fakeResetData{cfg: cfg, dryRun: true, dbs: dbs}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runDatabases(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("runDatabases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDropDatabases(t *testing.T) {
+	dbs := []ocutil.ServiceDBConfig{
+		newServiceDB("keystone", "keystone", "keystone"),
+		newServiceDB("region", "yunioncloud", "root"),
+		newServiceDB("glance", "glance", ""),
+		newServiceDB("yunionagent", "yunionagent", "keystone"),
+	}
+	d := &fakeDropper{}
+	if err := dropDatabases(d, "root", dbs); err != nil {
+		t.Fatalf("dropDatabases() error = %v", err)
+	}
+	if want := []string{"keystone", "yunioncloud", "glance", "yunionagent"}; !reflect.DeepEqual(d.databases, want) {
+		t.Errorf("dropped databases = %v, want %v", d.databases, want)
+	}
+	// the admin user is kept and the shared user is dropped once
+	if want := []string{"keystone"}; !reflect.DeepEqual(d.users, want) {
+		t.Errorf("dropped users = %v, want %v", d.users, want)
+	}
+
+	failed := &fakeDropper{err: errors.New("access denied")}
+	if err := dropDatabases(failed, "root", dbs); err == nil {
+		t.Errorf("dropDatabases() should fail when database can't be dropped")
+	}
+	if len(failed.users) != 0 {
+		t.Errorf("users %v shouldn't be dropped after database failed", failed.users)
+	}
+}
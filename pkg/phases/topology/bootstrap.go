@@ -0,0 +1,338 @@
+package topology
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	compute_modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+	identity_modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+
+	ocutil "yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+const (
+	KindRegion          = "region"
+	KindZone            = "zone"
+	KindWire            = "wire"
+	KindNetwork         = "network"
+	KindSchedtag        = "schedtag"
+	KindDynamicSchedtag = "dynamicschedtag"
+
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+// Change is the reconcile result of one resource
+type Change struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report collects the changes made, or would be made in dry run, by Bootstrap
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Changes []Change `json:"changes"`
+}
+
+func (r *Report) add(kind, name, action, detail string) {
+	r.Changes = append(r.Changes, Change{Kind: kind, Name: name, Action: action, Detail: detail})
+}
+
+// Count returns the number of changes with the action
+func (r *Report) Count(action string) int {
+	cnt := 0
+	for _, c := range r.Changes {
+		if c.Action == action {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Print writes the changes as a table followed by a summary line
+func (r *Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tACTION\tDETAIL")
+	for _, c := range r.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Kind, c.Name, c.Action, c.Detail)
+	}
+	w.Flush()
+	prefix := ""
+	if r.DryRun {
+		prefix = "[dry-run] would "
+	}
+	fmt.Fprintf(out, "%screate %d, update %d, %d unchanged\n", prefix, r.Count(ActionCreate), r.Count(ActionUpdate), r.Count(ActionUnchanged))
+}
+
+type bootstrapper struct {
+	s      *mcclient.ClientSession
+	dryRun bool
+	report *Report
+}
+
+// Bootstrap reconciles the topology through the onecloud API of session. Missing resources are created and the
+// differing fields of existing ones are updated, resources not described in the topology are left untouched.
+// With dryRun the report contains the changes that would be made without writing anything.
+func Bootstrap(s *mcclient.ClientSession, t *Topology, dryRun bool) (*Report, error) {
+	b := &bootstrapper{
+		s:      s,
+		dryRun: dryRun,
+		report: &Report{DryRun: dryRun, Changes: make([]Change, 0)},
+	}
+	if t.Region != "" {
+		if err := b.ensureRegion(t.Region); err != nil {
+			return b.report, errors.Wrapf(err, "region %s", t.Region)
+		}
+	}
+	for i := range t.Zones {
+		if err := b.ensureZone(&t.Zones[i]); err != nil {
+			return b.report, errors.Wrapf(err, "zone %s", t.Zones[i].Name)
+		}
+	}
+	for i := range t.Schedtags {
+		if err := b.ensureSchedtag(&t.Schedtags[i]); err != nil {
+			return b.report, errors.Wrapf(err, "schedtag %s", t.Schedtags[i].Name)
+		}
+	}
+	return b.report, nil
+}
+
+func (b *bootstrapper) ensureRegion(region string) error {
+	_, exists, err := ocutil.IsResourceExists(b.s, &identity_modules.Regions, region)
+	if err != nil {
+		return err
+	}
+	if exists {
+		b.report.add(KindRegion, region, ActionUnchanged, "")
+		return nil
+	}
+	b.report.add(KindRegion, region, ActionCreate, "")
+	if b.dryRun {
+		return nil
+	}
+	_, err = ocutil.CreateRegion(b.s, region, "")
+	return err
+}
+
+func (b *bootstrapper) ensureZone(zone *Zone) error {
+	obj, exists, err := ocutil.IsZoneExists(b.s, zone.Name)
+	if err != nil {
+		return err
+	}
+	zoneId := ""
+	if exists {
+		zoneId, _ = obj.GetString("id")
+		b.report.add(KindZone, zone.Name, ActionUnchanged, "")
+	} else {
+		b.report.add(KindZone, zone.Name, ActionCreate, "")
+		if !b.dryRun {
+			obj, err := ocutil.CreateZone(b.s, zone.Name)
+			if err != nil {
+				return err
+			}
+			zoneId, _ = obj.GetString("id")
+		}
+	}
+	for i := range zone.Wires {
+		if err := b.ensureWire(zone, zoneId, &zone.Wires[i]); err != nil {
+			return errors.Wrapf(err, "wire %s", zone.Wires[i].Name)
+		}
+	}
+	return nil
+}
+
+// ensureWire creates or updates the wire in zone, the zoneId is empty if the zone doesn't exist in dry run
+func (b *bootstrapper) ensureWire(zone *Zone, zoneId string, wire *Wire) error {
+	obj, exists, err := ocutil.IsWireExists(b.s, wire.Name)
+	if err != nil {
+		return err
+	}
+	wireId := ""
+	if !exists {
+		b.report.add(KindWire, wire.Name, ActionCreate, fmt.Sprintf("zone=%s bandwidth=%d vpc=%s", zone.Name, wire.Bandwidth, wire.VPC))
+		if !b.dryRun {
+			obj, err := ocutil.CreateWire(b.s, zoneId, wire.Name, wire.Bandwidth, wire.VPC)
+			if err != nil {
+				return err
+			}
+			wireId, _ = obj.GetString("id")
+		}
+	} else {
+		wireId, _ = obj.GetString("id")
+		if curZone, _ := obj.GetString("zone_id"); curZone != zoneId {
+			// moving wire between zones breaks the hosts and networks on it
+			return errors.Errorf("already exists in zone %s", curZoneName(obj))
+		}
+		params := jsonutils.NewDict()
+		var diffs []string
+		if bw, _ := obj.Int("bandwidth"); int(bw) != wire.Bandwidth {
+			params.Add(jsonutils.NewInt(int64(wire.Bandwidth)), "bandwidth")
+			diffs = append(diffs, fmt.Sprintf("bandwidth %d->%d", bw, wire.Bandwidth))
+		}
+		if err := b.update(&compute_modules.Wires, KindWire, wire.Name, wireId, params, diffs); err != nil {
+			return err
+		}
+	}
+	for i := range wire.Networks {
+		if err := b.ensureNetwork(wire, wireId, &wire.Networks[i]); err != nil {
+			return errors.Wrapf(err, "network %s", wire.Networks[i].Name)
+		}
+	}
+	return nil
+}
+
+func curZoneName(obj jsonutils.JSONObject) string {
+	if name, _ := obj.GetString("zone"); name != "" {
+		return name
+	}
+	id, _ := obj.GetString("zone_id")
+	return id
+}
+
+// ensureNetwork creates or updates the network on wire, the wireId is empty if the wire doesn't exist in dry run
+func (b *bootstrapper) ensureNetwork(wire *Wire, wireId string, network *Network) error {
+	obj, exists, err := ocutil.IsNetworkExists(b.s, network.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		b.report.add(KindNetwork, network.Name, ActionCreate, fmt.Sprintf("wire=%s %s-%s/%d", wire.Name, network.StartIP, network.EndIP, network.MaskLen))
+		if b.dryRun {
+			return nil
+		}
+		obj, err := ocutil.CreateNetwork(b.s, network.Name, network.Gateway, network.ServerType, wireId, network.MaskLen, network.StartIP, network.EndIP)
+		if err != nil {
+			return err
+		}
+		if network.Private {
+			id, _ := obj.GetString("id")
+			if _, err := ocutil.NetworkPrivate(b.s, id); err != nil {
+				return errors.Wrap(err, "make private")
+			}
+		}
+		return nil
+	}
+
+	id, _ := obj.GetString("id")
+	if curWire, _ := obj.GetString("wire_id"); curWire != wireId {
+		return errors.Errorf("already exists on other wire %s", curWire)
+	}
+	params := jsonutils.NewDict()
+	var diffs []string
+	for _, f := range []struct {
+		key   string
+		value string
+	}{
+		{"guest_ip_start", network.StartIP},
+		{"guest_ip_end", network.EndIP},
+		{"guest_ip_mask", fmt.Sprintf("%d", network.MaskLen)},
+		{"guest_gateway", network.Gateway},
+		{"server_type", network.ServerType},
+	} {
+		cur, _ := obj.GetString(f.key)
+		if cur == f.value || (f.key == "guest_gateway" && f.value == "") {
+			continue
+		}
+		params.Add(jsonutils.NewString(f.value), f.key)
+		diffs = append(diffs, fmt.Sprintf("%s %s->%s", f.key, cur, f.value))
+	}
+	isPublic := jsonutils.QueryBoolean(obj, "is_public", false)
+	if network.Private && isPublic {
+		diffs = append(diffs, "public->private")
+	}
+	if err := b.update(&compute_modules.Networks, KindNetwork, network.Name, id, params, diffs); err != nil {
+		return err
+	}
+	if network.Private && isPublic && !b.dryRun {
+		if _, err := ocutil.NetworkPrivate(b.s, id); err != nil {
+			return errors.Wrap(err, "make private")
+		}
+	}
+	return nil
+}
+
+func (b *bootstrapper) ensureSchedtag(tag *Schedtag) error {
+	obj, exists, err := ocutil.IsSchedtagExists(b.s, tag.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		b.report.add(KindSchedtag, tag.Name, ActionCreate, fmt.Sprintf("strategy=%s", tag.Strategy))
+		if !b.dryRun {
+			if _, err := ocutil.CreateSchedtag(b.s, tag.Name, tag.Strategy, tag.Description); err != nil {
+				return err
+			}
+		}
+	} else {
+		id, _ := obj.GetString("id")
+		params := jsonutils.NewDict()
+		var diffs []string
+		if cur, _ := obj.GetString("default_strategy"); cur != tag.Strategy {
+			params.Add(jsonutils.NewString(tag.Strategy), "default_strategy")
+			diffs = append(diffs, fmt.Sprintf("strategy %s->%s", cur, tag.Strategy))
+		}
+		if cur, _ := obj.GetString("description"); cur != tag.Description {
+			params.Add(jsonutils.NewString(tag.Description), "description")
+			diffs = append(diffs, "description")
+		}
+		if err := b.update(&compute_modules.Schedtags, KindSchedtag, tag.Name, id, params, diffs); err != nil {
+			return err
+		}
+	}
+	for _, dyn := range tag.Dynamic {
+		if err := b.ensureDynamicSchedtag(tag, dyn); err != nil {
+			return errors.Wrapf(err, "dynamic schedtag %s", dyn.Name)
+		}
+	}
+	return nil
+}
+
+func (b *bootstrapper) ensureDynamicSchedtag(tag *Schedtag, dyn DynamicSchedtag) error {
+	obj, exists, err := ocutil.IsDynamicSchedtagExists(b.s, dyn.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		b.report.add(KindDynamicSchedtag, dyn.Name, ActionCreate, fmt.Sprintf("schedtag=%s condition=%s", tag.Name, dyn.Condition))
+		if b.dryRun {
+			return nil
+		}
+		_, err := ocutil.CreateDynamicSchedtag(b.s, dyn.Name, tag.Name, dyn.Condition)
+		return err
+	}
+	id, _ := obj.GetString("id")
+	params := jsonutils.NewDict()
+	var diffs []string
+	if cur, _ := obj.GetString("condition"); cur != dyn.Condition {
+		params.Add(jsonutils.NewString(dyn.Condition), "condition")
+		diffs = append(diffs, fmt.Sprintf("condition %q->%q", cur, dyn.Condition))
+	}
+	return b.update(&compute_modules.Dynamicschedtags, KindDynamicSchedtag, dyn.Name, id, params, diffs)
+}
+
+type updater interface {
+	Update(s *mcclient.ClientSession, id string, params jsonutils.JSONObject) (jsonutils.JSONObject, error)
+}
+
+// update reports the diffs of the resource and applies the params unless in dry run
+func (b *bootstrapper) update(man updater, kind, name, id string, params *jsonutils.JSONDict, diffs []string) error {
+	if len(diffs) == 0 {
+		b.report.add(kind, name, ActionUnchanged, "")
+		return nil
+	}
+	b.report.add(kind, name, ActionUpdate, strings.Join(diffs, ", "))
+	if b.dryRun || params.Size() == 0 {
+		return nil
+	}
+	_, err := man.Update(b.s, id, params)
+	return err
+}
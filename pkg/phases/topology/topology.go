@@ -0,0 +1,206 @@
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	DefaultWireBandwidth = 1000
+	DefaultWireVPC       = "default"
+	DefaultServerType    = "guest"
+)
+
+var (
+	validServerTypes        = sets.NewString("guest", "baremetal", "pxe", "ipmi", "container", "eip")
+	validSchedtagStrategies = sets.NewString("", "require", "exclude", "prefer", "avoid")
+)
+
+// Topology describes the regions, zones, wires, networks and schedtags of onecloud
+type Topology struct {
+	// Region is the region of the zones, defaults to the region of the cluster
+	Region    string     `json:"region,omitempty"`
+	Zones     []Zone     `json:"zones,omitempty"`
+	Schedtags []Schedtag `json:"schedtags,omitempty"`
+}
+
+// Zone is an availability zone and its wires
+type Zone struct {
+	Name  string `json:"name"`
+	Wires []Wire `json:"wires,omitempty"`
+}
+
+// Wire is a layer 2 network in the zone and its IP pools
+type Wire struct {
+	Name      string    `json:"name"`
+	Bandwidth int       `json:"bandwidth,omitempty"`
+	VPC       string    `json:"vpc,omitempty"`
+	Networks  []Network `json:"networks,omitempty"`
+}
+
+// Network is an IP pool on the wire
+type Network struct {
+	Name       string `json:"name"`
+	StartIP    string `json:"startIP"`
+	EndIP      string `json:"endIP"`
+	MaskLen    int    `json:"maskLen"`
+	Gateway    string `json:"gateway,omitempty"`
+	ServerType string `json:"serverType,omitempty"`
+	// Private makes the network only visible in the owner project,
+	// the visibility of the other networks is left unchanged
+	Private bool `json:"private,omitempty"`
+}
+
+// Schedtag is a scheduler tag and the dynamic schedtags attaching it by condition
+type Schedtag struct {
+	Name        string            `json:"name"`
+	Strategy    string            `json:"strategy,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Dynamic     []DynamicSchedtag `json:"dynamic,omitempty"`
+}
+
+// DynamicSchedtag attaches the schedtag to the resources matching the condition
+type DynamicSchedtag struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+}
+
+// LoadTopology reads the topology from the yaml file, sets the defaults and validates it
+func LoadTopology(path string) (*Topology, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read topology %s", path)
+	}
+	t := new(Topology)
+	if err := yaml.Unmarshal(content, t); err != nil {
+		return nil, errors.Wrapf(err, "parse topology %s", path)
+	}
+	t.SetDefaults()
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetDefaults fills the empty fields with default values
+func (t *Topology) SetDefaults() {
+	for i := range t.Zones {
+		for j := range t.Zones[i].Wires {
+			wire := &t.Zones[i].Wires[j]
+			if wire.Bandwidth == 0 {
+				wire.Bandwidth = DefaultWireBandwidth
+			}
+			if wire.VPC == "" {
+				wire.VPC = DefaultWireVPC
+			}
+			for k := range wire.Networks {
+				if wire.Networks[k].ServerType == "" {
+					wire.Networks[k].ServerType = DefaultServerType
+				}
+			}
+		}
+	}
+}
+
+// Validate checks the names are unique and the networks are well formed
+func (t *Topology) Validate() error {
+	var errs []string
+	names := map[string]sets.String{}
+	checkName := func(kind, prefix, name string) {
+		if name == "" {
+			errs = append(errs, fmt.Sprintf("%s.name: required", prefix))
+			return
+		}
+		if names[kind] == nil {
+			names[kind] = sets.NewString()
+		}
+		if names[kind].Has(name) {
+			errs = append(errs, fmt.Sprintf("%s.name: duplicated %s %q", prefix, kind, name))
+		}
+		names[kind].Insert(name)
+	}
+	for i, zone := range t.Zones {
+		prefix := fmt.Sprintf("zones[%d]", i)
+		checkName("zone", prefix, zone.Name)
+		for j, wire := range zone.Wires {
+			wirePrefix := fmt.Sprintf("%s.wires[%d]", prefix, j)
+			checkName("wire", wirePrefix, wire.Name)
+			if wire.Bandwidth < 0 {
+				errs = append(errs, fmt.Sprintf("%s.bandwidth: must be positive", wirePrefix))
+			}
+			for k, network := range wire.Networks {
+				netPrefix := fmt.Sprintf("%s.networks[%d]", wirePrefix, k)
+				checkName("network", netPrefix, network.Name)
+				errs = append(errs, validateNetwork(netPrefix, &network)...)
+			}
+		}
+	}
+	for i, tag := range t.Schedtags {
+		prefix := fmt.Sprintf("schedtags[%d]", i)
+		checkName("schedtag", prefix, tag.Name)
+		if !validSchedtagStrategies.Has(tag.Strategy) {
+			errs = append(errs, fmt.Sprintf("%s.strategy: unknown strategy %q, must be one of %s", prefix, tag.Strategy, strings.Join(validSchedtagStrategies.List()[1:], ", ")))
+		}
+		for j, dyn := range tag.Dynamic {
+			dynPrefix := fmt.Sprintf("%s.dynamic[%d]", prefix, j)
+			checkName("dynamic schedtag", dynPrefix, dyn.Name)
+			if dyn.Condition == "" {
+				errs = append(errs, fmt.Sprintf("%s.condition: required", dynPrefix))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("invalid topology:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func validateNetwork(prefix string, network *Network) []string {
+	var errs []string
+	if network.MaskLen <= 0 || network.MaskLen > 32 {
+		errs = append(errs, fmt.Sprintf("%s.maskLen: must be in 1-32", prefix))
+		return errs
+	}
+	mask := net.CIDRMask(network.MaskLen, 32)
+	var subnet *net.IPNet
+	for _, f := range []struct {
+		field string
+		value string
+	}{
+		{"startIP", network.StartIP},
+		{"endIP", network.EndIP},
+		{"gateway", network.Gateway},
+	} {
+		if f.field == "gateway" && f.value == "" {
+			continue
+		}
+		ip := net.ParseIP(f.value).To4()
+		if ip == nil {
+			errs = append(errs, fmt.Sprintf("%s.%s: invalid IPv4 address %q", prefix, f.field, f.value))
+			continue
+		}
+		if subnet == nil {
+			subnet = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		} else if !subnet.Contains(ip) {
+			errs = append(errs, fmt.Sprintf("%s.%s: %s isn't in subnet %s", prefix, f.field, f.value, subnet))
+		}
+	}
+	if len(errs) == 0 && ipToUint(network.StartIP) > ipToUint(network.EndIP) {
+		errs = append(errs, fmt.Sprintf("%s: startIP %s is greater than endIP %s", prefix, network.StartIP, network.EndIP))
+	}
+	if !validServerTypes.Has(network.ServerType) {
+		errs = append(errs, fmt.Sprintf("%s.serverType: unknown server type %q, must be one of %s", prefix, network.ServerType, strings.Join(validServerTypes.List(), ", ")))
+	}
+	return errs
+}
+
+func ipToUint(s string) uint32 {
+	ip := net.ParseIP(s).To4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
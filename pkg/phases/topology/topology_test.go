@@ -0,0 +1,397 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/onecloud/pkg/mcclient"
+
+	"yunion.io/x/ocadm/pkg/apis/constants"
+)
+
+const testRegion = "region0"
+
+// fakeCloud is an in-memory keystone and region service serving the API used by Bootstrap
+type fakeCloud struct {
+	sync.Mutex
+	server *httptest.Server
+	// resources of plural keyword, indexed by id
+	resources map[string]map[string]*jsonutils.JSONDict
+	// writes counts the create, update and perform requests
+	writes int
+	nextId int
+}
+
+func newFakeCloud() *fakeCloud {
+	c := &fakeCloud{resources: make(map[string]map[string]*jsonutils.JSONDict)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", c.handleAuth)
+	mux.HandleFunc("/v3/", func(w http.ResponseWriter, r *http.Request) {
+		c.handleResource(w, r, strings.TrimPrefix(r.URL.Path, "/v3/"))
+	})
+	mux.HandleFunc("/compute/", func(w http.ResponseWriter, r *http.Request) {
+		c.handleResource(w, r, strings.TrimPrefix(r.URL.Path, "/compute/"))
+	})
+	c.server = httptest.NewServer(mux)
+	return c
+}
+
+func (c *fakeCloud) Close() {
+	c.server.Close()
+}
+
+func (c *fakeCloud) session(t *testing.T) *mcclient.ClientSession {
+	cli := mcclient.NewClient(c.server.URL+"/v3", 10, false, true, "", "")
+	token, err := cli.AuthenticateWithSource("sysadmin", "password", "Default", "system", "", mcclient.AuthSourceCli)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	return cli.NewSession(context.Background(), testRegion, "", constants.EndpointTypePublic, token, "")
+}
+
+func (c *fakeCloud) handleAuth(w http.ResponseWriter, r *http.Request) {
+	token := jsonutils.Marshal(map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"issued_at":  time.Now().UTC().Format(time.RFC3339),
+			"methods":    []string{"password"},
+			"user":       map[string]interface{}{"id": "sysadmin", "name": "sysadmin"},
+			"project":    map[string]interface{}{"id": "system", "name": "system"},
+			"catalog": []map[string]interface{}{
+				{
+					"id":   "compute",
+					"name": "region2",
+					"type": "compute_v2",
+					"endpoints": []map[string]interface{}{
+						{"id": "ep0", "interface": "public", "region_id": testRegion, "url": c.server.URL + "/compute"},
+					},
+				},
+			},
+		},
+	})
+	w.Header().Set("X-Subject-Token", "fake-token")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(token.String()))
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj jsonutils.JSONObject) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(obj.String()))
+}
+
+func notFound(w http.ResponseWriter, format string, args ...interface{}) {
+	writeJSON(w, http.StatusNotFound, jsonutils.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    http.StatusNotFound,
+			"class":   "ResourceNotFoundError",
+			"details": fmt.Sprintf(format, args...),
+		},
+	}))
+}
+
+var keywords = map[string]string{
+	"regions":          "region",
+	"zones":            "zone",
+	"wires":            "wire",
+	"networks":         "network",
+	"schedtags":        "schedtag",
+	"dynamicschedtags": "dynamicschedtag",
+}
+
+// find returns the resource of id or name
+func (c *fakeCloud) find(plural, idOrName string) *jsonutils.JSONDict {
+	for id, obj := range c.resources[plural] {
+		if name, _ := obj.GetString("name"); id == idOrName || name == idOrName {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (c *fakeCloud) add(plural string, obj *jsonutils.JSONDict) *jsonutils.JSONDict {
+	if !obj.Contains("id") {
+		c.nextId++
+		obj.Add(jsonutils.NewString(fmt.Sprintf("%s-%d", keywords[plural], c.nextId)), "id")
+	}
+	if c.resources[plural] == nil {
+		c.resources[plural] = make(map[string]*jsonutils.JSONDict)
+	}
+	id, _ := obj.GetString("id")
+	c.resources[plural][id] = obj
+	return obj
+}
+
+func (c *fakeCloud) handleResource(w http.ResponseWriter, r *http.Request, path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	var body jsonutils.JSONObject
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		content, _ := ioutil.ReadAll(r.Body)
+		body, _ = jsonutils.Parse(content)
+	}
+	params := func(keyword string) *jsonutils.JSONDict {
+		if body == nil {
+			return jsonutils.NewDict()
+		}
+		p, err := body.Get(keyword)
+		if err != nil {
+			return jsonutils.NewDict()
+		}
+		return p.(*jsonutils.JSONDict).Copy()
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 1:
+		ret := jsonutils.NewArray()
+		for _, obj := range c.resources[segs[0]] {
+			if name, _ := obj.GetString("name"); name == r.URL.Query().Get("name") {
+				ret.Add(obj)
+			}
+		}
+		resp := jsonutils.NewDict()
+		resp.Add(ret, segs[0])
+		resp.Add(jsonutils.NewInt(int64(ret.Length())), "total")
+		writeJSON(w, http.StatusOK, resp)
+	case r.Method == http.MethodGet && len(segs) == 2:
+		obj := c.find(segs[0], segs[1])
+		if obj == nil {
+			notFound(w, "%s %s not found", segs[0], segs[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, wrap(keywords[segs[0]], obj))
+	case r.Method == http.MethodPost && len(segs) == 1:
+		c.writes++
+		p := params(keywords[segs[0]])
+		if segs[0] == "networks" {
+			p.Set("is_public", jsonutils.JSONTrue)
+		}
+		writeJSON(w, http.StatusOK, wrap(keywords[segs[0]], c.add(segs[0], p)))
+	case r.Method == http.MethodPost && len(segs) == 3 && keywords[segs[2]] != "":
+		// create in context of zone or wire
+		c.writes++
+		parent := c.find(segs[0], segs[1])
+		if parent == nil {
+			notFound(w, "%s %s not found", segs[0], segs[1])
+			return
+		}
+		parentId, _ := parent.GetString("id")
+		p := params(keywords[segs[2]])
+		p.Add(jsonutils.NewString(parentId), keywords[segs[0]]+"_id")
+		if segs[2] == "networks" {
+			p.Set("is_public", jsonutils.JSONTrue)
+		}
+		writeJSON(w, http.StatusOK, wrap(keywords[segs[2]], c.add(segs[2], p)))
+	case r.Method == http.MethodPost && len(segs) == 3 && segs[0] == "networks" && segs[2] == "private":
+		c.writes++
+		obj := c.find(segs[0], segs[1])
+		if obj == nil {
+			notFound(w, "network %s not found", segs[1])
+			return
+		}
+		obj.Set("is_public", jsonutils.JSONFalse)
+		writeJSON(w, http.StatusOK, wrap("network", obj))
+	case r.Method == http.MethodPut && len(segs) == 2:
+		c.writes++
+		obj := c.find(segs[0], segs[1])
+		if obj == nil {
+			notFound(w, "%s %s not found", segs[0], segs[1])
+			return
+		}
+		obj.Update(params(keywords[segs[0]]))
+		writeJSON(w, http.StatusOK, wrap(keywords[segs[0]], obj))
+	default:
+		notFound(w, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func wrap(keyword string, obj jsonutils.JSONObject) jsonutils.JSONObject {
+	ret := jsonutils.NewDict()
+	ret.Add(obj, keyword)
+	return ret
+}
+
+const testTopology = `
+region: region0
+zones:
+- name: zone0
+  wires:
+  - name: bcast0
+    networks:
+    - name: guest0
+      startIP: 10.168.222.100
+      endIP: 10.168.222.200
+      maskLen: 24
+      gateway: 10.168.222.1
+    - name: admin0
+      startIP: 10.168.222.10
+      endIP: 10.168.222.20
+      maskLen: 24
+      private: true
+schedtags:
+- name: ssd
+  strategy: prefer
+  description: hosts with ssd storage
+  dynamic:
+  - name: ssd-hosts
+    condition: host.storages.contains(storage_type="ssd")
+`
+
+func loadTestTopology(t *testing.T, content string) *Topology {
+	dir, err := ioutil.TempDir("", "ocadm-topology")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "topology.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	topo, err := LoadTopology(path)
+	if err != nil {
+		t.Fatalf("LoadTopology() error: %v", err)
+	}
+	return topo
+}
+
+func TestValidate(t *testing.T) {
+	network := func(start, end string, maskLen int, gateway string) Network {
+		return Network{Name: "net", StartIP: start, EndIP: end, MaskLen: maskLen, Gateway: gateway, ServerType: DefaultServerType}
+	}
+	tests := []struct {
+		name    string
+		network Network
+		wantErr bool
+	}{
+		{name: "valid", network: network("192.168.1.10", "192.168.1.20", 24, "192.168.1.1")},
+		{name: "no gateway", network: network("192.168.1.10", "192.168.1.10", 24, "")},
+		{name: "invalid ip", network: network("192.168.1", "192.168.1.20", 24, ""), wantErr: true},
+		{name: "start greater than end", network: network("192.168.1.20", "192.168.1.10", 24, ""), wantErr: true},
+		{name: "end out of subnet", network: network("192.168.1.10", "192.168.2.20", 24, ""), wantErr: true},
+		{name: "gateway out of subnet", network: network("192.168.1.10", "192.168.1.20", 24, "192.168.0.1"), wantErr: true},
+		{name: "invalid mask", network: network("192.168.1.10", "192.168.1.20", 33, ""), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topo := &Topology{Zones: []Zone{{Name: "zone0", Wires: []Wire{{Name: "wire0", Networks: []Network{tt.network}}}}}}
+			if err := topo.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	topo := &Topology{
+		Zones:     []Zone{{Name: "zone0"}, {Name: "zone0"}},
+		Schedtags: []Schedtag{{Name: "ssd", Strategy: "always"}},
+	}
+	err := topo.Validate()
+	if err == nil {
+		t.Fatal("Validate() should fail on duplicated zone and unknown strategy")
+	}
+	for _, msg := range []string{"zones[1].name: duplicated zone", "schedtags[0].strategy: unknown strategy"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Validate() error %q doesn't contain %q", err, msg)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	cloud := newFakeCloud()
+	defer cloud.Close()
+	s := cloud.session(t)
+	topo := loadTestTopology(t, testTopology)
+
+	report, err := Bootstrap(s, topo, true)
+	if err != nil {
+		t.Fatalf("dry run Bootstrap() error: %v", err)
+	}
+	if cloud.writes != 0 {
+		t.Errorf("dry run made %d writes", cloud.writes)
+	}
+	if got := report.Count(ActionCreate); got != 7 {
+		t.Errorf("dry run reports %d creations, want 7:\n%s", got, printReport(report))
+	}
+
+	report, err = Bootstrap(s, topo, false)
+	if err != nil {
+		t.Fatalf("Bootstrap() error: %v", err)
+	}
+	if got := report.Count(ActionCreate); got != 7 {
+		t.Errorf("Bootstrap() reports %d creations, want 7:\n%s", got, printReport(report))
+	}
+	wire := cloud.find("wires", "bcast0")
+	zone := cloud.find("zones", "zone0")
+	if wire == nil || zone == nil {
+		t.Fatalf("zone or wire isn't created")
+	}
+	if zoneId, _ := zone.GetString("id"); !jsonEqual(wire, "zone_id", zoneId) || !jsonEqual(wire, "vpc", DefaultWireVPC) {
+		t.Errorf("unexpected wire %s", wire)
+	}
+	if admin := cloud.find("networks", "admin0"); admin == nil || jsonutils.QueryBoolean(admin, "is_public", true) {
+		t.Errorf("network admin0 isn't private: %v", admin)
+	}
+	if guest := cloud.find("networks", "guest0"); guest == nil || !jsonutils.QueryBoolean(guest, "is_public", false) {
+		t.Errorf("network guest0 isn't public: %v", guest)
+	}
+	if dyn := cloud.find("dynamicschedtags", "ssd-hosts"); dyn == nil || !jsonEqual(dyn, "schedtag", "ssd") {
+		t.Errorf("unexpected dynamic schedtag %v", dyn)
+	}
+
+	writes := cloud.writes
+	report, err = Bootstrap(s, topo, false)
+	if err != nil {
+		t.Fatalf("second Bootstrap() error: %v", err)
+	}
+	if cloud.writes != writes || report.Count(ActionUnchanged) != len(report.Changes) {
+		t.Errorf("second Bootstrap() isn't idempotent, %d writes:\n%s", cloud.writes-writes, printReport(report))
+	}
+
+	// drift the resources and reconcile them back
+	wire.Set("bandwidth", jsonutils.NewInt(100))
+	cloud.find("networks", "guest0").Set("guest_ip_end", jsonutils.NewString("10.168.222.150"))
+	cloud.find("networks", "admin0").Set("is_public", jsonutils.JSONTrue)
+	cloud.find("schedtags", "ssd").Set("default_strategy", jsonutils.NewString("avoid"))
+	report, err = Bootstrap(s, topo, false)
+	if err != nil {
+		t.Fatalf("Bootstrap() error: %v", err)
+	}
+	if got := report.Count(ActionUpdate); got != 4 {
+		t.Errorf("Bootstrap() reports %d updates, want 4:\n%s", got, printReport(report))
+	}
+	if !jsonEqual(wire, "bandwidth", "1000") || !jsonEqual(cloud.find("networks", "guest0"), "guest_ip_end", "10.168.222.200") ||
+		!jsonEqual(cloud.find("schedtags", "ssd"), "default_strategy", "prefer") ||
+		jsonutils.QueryBoolean(cloud.find("networks", "admin0"), "is_public", true) {
+		t.Errorf("drifted resources aren't reconciled:\n%s", printReport(report))
+	}
+
+	// a wire existing in another zone is reported instead of moved
+	moved := loadTestTopology(t, strings.Replace(testTopology, "name: zone0", "name: zone1", 1))
+	if _, err := Bootstrap(s, moved, false); err == nil || !strings.Contains(err.Error(), "already exists in zone") {
+		t.Errorf("Bootstrap() error = %v, want wire zone conflict", err)
+	}
+}
+
+func jsonEqual(obj jsonutils.JSONObject, key, value string) bool {
+	v, _ := obj.GetString(key)
+	return v == value
+}
+
+func printReport(r *Report) string {
+	buf := new(bytes.Buffer)
+	r.Print(buf)
+	return buf.String()
+}
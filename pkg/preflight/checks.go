@@ -16,6 +16,7 @@ import (
 	utilsexec "k8s.io/utils/exec"
 
 	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	ocimages "yunion.io/x/ocadm/pkg/images"
 	"yunion.io/x/ocadm/pkg/util/mysql"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -83,6 +84,7 @@ func (poc PortOpenCheck) Check() (warnings, errorList []error) {
 type ImagePullCheck struct {
 	runtime   utilruntime.ContainerRuntime
 	imageList []string
+	opts      ocimages.PullOptions
 }
 
 // Name returns the label for ImagePullCheck
@@ -92,20 +94,9 @@ func (ImagePullCheck) Name() string {
 
 // Check pulls images required by ocadm and kubeadm. This is a mutating check
 func (ipc ImagePullCheck) Check() (warnings, errorList []error) {
-	for _, image := range ipc.imageList {
-		ret, err := ipc.runtime.ImageExists(image)
-		if ret && err == nil {
-			klog.V(1).Infof("image exists: %s", image)
-			continue
-		}
-		if err != nil {
-			errorList = append(errorList, errors.Wrapf(err, "failed to check if image %s exists", image))
-		}
-		klog.V(1).Infof("pulling %s", image)
-		if err := ipc.runtime.PullImage(image); err != nil {
-			errorList = append(errorList, errors.Wrapf(err, "failed to pull image %s", image))
-		}
-	}
+	opts := ipc.opts
+	opts.SkipExisting = true
+	errorList = ocimages.NewPuller(ipc.runtime, opts, os.Stdout, "[preflight]").PullAll(ipc.imageList)
 	return warnings, errorList
 }
 
@@ -117,11 +108,7 @@ func RunInitNodeChecks(
 	isSecondaryControlPlane bool,
 	downloadCerts bool,
 ) error {
-	checks := []k8spreflight.Checker{
-		MysqlCheck{
-			MysqlConnection: &cfg.MysqlConnection,
-		},
-	}
+	checks := MysqlChecks(&cfg.MysqlConnection)
 	// Run onecloud preflight checks
 	if err := k8spreflight.RunChecks(checks, os.Stderr, ignorePreflightErrors); err != nil {
 		return err
@@ -138,14 +125,14 @@ func RunInitNodeChecks(
 	return nil
 }
 
-func RunPullImagesCheck(execer utilsexec.Interface, cfg *v1.InitConfiguration, kubeadmCfg *kubeadmapi.InitConfiguration, ignorePreflightErrors sets.String) error {
+func RunPullImagesCheck(execer utilsexec.Interface, cfg *v1.InitConfiguration, kubeadmCfg *kubeadmapi.InitConfiguration, pullOpts ocimages.PullOptions, ignorePreflightErrors sets.String) error {
 	containerRuntime, err := utilruntime.NewContainerRuntime(utilsexec.New(), kubeadmCfg.NodeRegistration.CRISocket)
 	if err != nil {
 		return err
 	}
 
 	checks := []k8spreflight.Checker{
-		ImagePullCheck{runtime: containerRuntime, imageList: images.GetControlPlaneImages(&kubeadmCfg.ClusterConfiguration)},
+		ImagePullCheck{runtime: containerRuntime, imageList: images.GetControlPlaneImages(&kubeadmCfg.ClusterConfiguration), opts: pullOpts},
 	}
 	return k8spreflight.RunChecks(checks, os.Stderr, ignorePreflightErrors)
 }
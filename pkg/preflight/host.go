@@ -0,0 +1,208 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	k8spreflight "k8s.io/kubernetes/cmd/kubeadm/app/preflight"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/onecloud"
+	"yunion.io/x/ocadm/pkg/util/sysinfo"
+)
+
+const (
+	// MinHostImagePathFreeBytes is the free space required by each host local image path
+	MinHostImagePathFreeBytes = 20 << 30
+	// RecommendedHostImagePathFreeBytes is the free space recommended for each host local image path
+	RecommendedHostImagePathFreeBytes = 100 << 30
+)
+
+var (
+	// hostOptionalKernelModules are used by guest networking, missing ones degrade performance or features
+	hostOptionalKernelModules = []string{"tun", "vhost_net", "bridge"}
+)
+
+// HostAgentChecks returns all checkers of running host agent on the node of root
+func HostAgentChecks(root sysinfo.Root, cfg *apis.HostConfiguration) []k8spreflight.Checker {
+	imagePaths := cfg.LocalImagePath
+	if len(imagePaths) == 0 {
+		imagePaths = []string{onecloud.DefaultHostLocalImagePath}
+	}
+	checks := []k8spreflight.Checker{
+		HostVirtualizationCheck{root: root, arch: runtime.GOARCH},
+		HostKVMDeviceCheck{root: root},
+		HostOpenvswitchCheck{root: root},
+		HostKernelModulesCheck{root: root, modules: hostOptionalKernelModules},
+		HostImagePathSpaceCheck{paths: imagePaths, freeBytes: getFreeBytes},
+	}
+	if cfg.EnableHugepage {
+		checks = append(checks, HostHugepageCheck{root: root})
+	}
+	return checks
+}
+
+// RunHostAgentChecks runs the checks before running host agent on this node
+func RunHostAgentChecks(cfg *apis.HostConfiguration, ignorePreflightErrors sets.String) error {
+	fmt.Println("[preflight] Running host agent pre-flight checks")
+	return k8spreflight.RunChecks(HostAgentChecks(sysinfo.HostRoot, cfg), os.Stderr, ignorePreflightErrors)
+}
+
+// HostVirtualizationCheck verifies the cpu supports hardware virtualization
+type HostVirtualizationCheck struct {
+	root sysinfo.Root
+	arch string
+}
+
+func (HostVirtualizationCheck) Name() string {
+	return "HostVirtualization"
+}
+
+func (c HostVirtualizationCheck) Check() (warnings, errorList []error) {
+	// only x86 exposes virtualization extensions in cpu flags, others rely on /dev/kvm
+	if c.arch != "amd64" && c.arch != "386" {
+		return nil, nil
+	}
+	flags, err := c.root.CPUFlags()
+	if err != nil {
+		return nil, []error{err}
+	}
+	if !flags.HasAny("vmx", "svm") {
+		errorList = append(errorList, errors.New("cpu doesn't support hardware virtualization (vmx or svm), enable it in BIOS or nested virtualization of hypervisor"))
+	}
+	return
+}
+
+// HostKVMDeviceCheck verifies /dev/kvm is present
+type HostKVMDeviceCheck struct {
+	root sysinfo.Root
+}
+
+func (HostKVMDeviceCheck) Name() string {
+	return "HostKVMDevice"
+}
+
+func (c HostKVMDeviceCheck) Check() (warnings, errorList []error) {
+	if !c.root.Exists("dev", "kvm") {
+		errorList = append(errorList, errors.New("/dev/kvm doesn't exist, kvm kernel module isn't loaded"))
+	}
+	return
+}
+
+// HostOpenvswitchCheck verifies openvswitch kernel module is loaded or could be loaded
+type HostOpenvswitchCheck struct {
+	root sysinfo.Root
+}
+
+func (HostOpenvswitchCheck) Name() string {
+	return "HostOpenvswitch"
+}
+
+func (c HostOpenvswitchCheck) Check() (warnings, errorList []error) {
+	ok, err := c.root.IsModuleAvailable("openvswitch")
+	if err != nil {
+		return nil, []error{err}
+	}
+	if !ok {
+		errorList = append(errorList, errors.New("openvswitch kernel module isn't available, install kernel with openvswitch support"))
+	}
+	return
+}
+
+// HostKernelModulesCheck verifies optional kernel modules are loaded or could be loaded
+type HostKernelModulesCheck struct {
+	root    sysinfo.Root
+	modules []string
+}
+
+func (HostKernelModulesCheck) Name() string {
+	return "HostKernelModules"
+}
+
+func (c HostKernelModulesCheck) Check() (warnings, errorList []error) {
+	for _, mod := range c.modules {
+		ok, err := c.root.IsModuleAvailable(mod)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if !ok {
+			warnings = append(warnings, errors.Errorf("kernel module %s isn't available", mod))
+		}
+	}
+	return
+}
+
+// HostHugepageCheck verifies 1G hugepage is supported when host agent enables hugepage
+type HostHugepageCheck struct {
+	root sysinfo.Root
+}
+
+func (HostHugepageCheck) Name() string {
+	return "HostHugepage"
+}
+
+func (c HostHugepageCheck) Check() (warnings, errorList []error) {
+	flags, err := c.root.CPUFlags()
+	if err != nil {
+		return nil, []error{err}
+	}
+	if !flags.Has("pdpe1gb") {
+		warnings = append(warnings, errors.New("cpu doesn't support 1G hugepage (pdpe1gb), hugepage won't be enabled"))
+	} else if !c.root.Exists("sys", "kernel", "mm", "hugepages", "hugepages-1048576kB") {
+		warnings = append(warnings, errors.New("kernel doesn't support 1G hugepage, hugepage won't be enabled"))
+	}
+	return
+}
+
+// HostImagePathSpaceCheck verifies the free space of host local image paths
+type HostImagePathSpaceCheck struct {
+	paths     []string
+	freeBytes func(path string) (uint64, error)
+}
+
+func (HostImagePathSpaceCheck) Name() string {
+	return "HostImagePathSpace"
+}
+
+func (c HostImagePathSpaceCheck) Check() (warnings, errorList []error) {
+	for _, p := range c.paths {
+		free, err := c.freeBytes(existingAncestor(p))
+		if err != nil {
+			errorList = append(errorList, errors.Wrapf(err, "get free space of %s", p))
+			continue
+		}
+		if free < MinHostImagePathFreeBytes {
+			errorList = append(errorList, errors.Errorf("local image path %s has %dGiB free space, at least %dGiB is required", p, free>>30, MinHostImagePathFreeBytes>>30))
+		} else if free < RecommendedHostImagePathFreeBytes {
+			warnings = append(warnings, errors.Errorf("local image path %s has %dGiB free space, %dGiB is recommended", p, free>>30, RecommendedHostImagePathFreeBytes>>30))
+		}
+	}
+	return
+}
+
+// existingAncestor returns the nearest existing directory of path, which will be created by host agent
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func getFreeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
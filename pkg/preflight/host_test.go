@@ -0,0 +1,49 @@
+package preflight
+
+import (
+	"testing"
+
+	k8spreflight "k8s.io/kubernetes/cmd/kubeadm/app/preflight"
+
+	"yunion.io/x/ocadm/pkg/util/sysinfo"
+)
+
+func TestHostAgentChecks(t *testing.T) {
+	kvmRoot := sysinfo.Root("testdata/host/kvm")
+	nokvmRoot := sysinfo.Root("testdata/host/nokvm")
+	freeBytes := func(free uint64) func(string) (uint64, error) {
+		return func(string) (uint64, error) { return free, nil }
+	}
+	tests := []struct {
+		name     string
+		check    k8spreflight.Checker
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"virtualization supported", HostVirtualizationCheck{root: kvmRoot, arch: "amd64"}, false, false},
+		{"virtualization not supported", HostVirtualizationCheck{root: nokvmRoot, arch: "amd64"}, true, false},
+		{"virtualization skipped on arm64", HostVirtualizationCheck{root: nokvmRoot, arch: "arm64"}, false, false},
+		{"kvm device", HostKVMDeviceCheck{root: kvmRoot}, false, false},
+		{"no kvm device", HostKVMDeviceCheck{root: nokvmRoot}, true, false},
+		{"openvswitch in modules.dep", HostOpenvswitchCheck{root: kvmRoot}, false, false},
+		{"no openvswitch", HostOpenvswitchCheck{root: nokvmRoot}, true, false},
+		{"kernel modules loaded or available", HostKernelModulesCheck{root: kvmRoot, modules: hostOptionalKernelModules}, false, false},
+		{"kernel modules missing", HostKernelModulesCheck{root: nokvmRoot, modules: hostOptionalKernelModules}, false, true},
+		{"hugepage", HostHugepageCheck{root: kvmRoot}, false, false},
+		{"no hugepage", HostHugepageCheck{root: nokvmRoot}, false, true},
+		{"enough image path space", HostImagePathSpaceCheck{paths: []string{"/opt/cloud/workspace/disks"}, freeBytes: freeBytes(200 << 30)}, false, false},
+		{"little image path space", HostImagePathSpaceCheck{paths: []string{"/opt/cloud/workspace/disks"}, freeBytes: freeBytes(50 << 30)}, false, true},
+		{"no image path space", HostImagePathSpaceCheck{paths: []string{"/opt/cloud/workspace/disks"}, freeBytes: freeBytes(1 << 30)}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := tt.check.Check()
+			if (len(errs) != 0) != tt.wantErr {
+				t.Errorf("%s.Check() errors = %v, wantErr %v", tt.check.Name(), errs, tt.wantErr)
+			}
+			if (len(warnings) != 0) != tt.wantWarn {
+				t.Errorf("%s.Check() warnings = %v, wantWarn %v", tt.check.Name(), warnings, tt.wantWarn)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package preflight
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	k8spreflight "k8s.io/kubernetes/cmd/kubeadm/app/preflight"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/mysql"
+	"yunion.io/x/ocadm/pkg/util/onecloud"
+)
+
+const (
+	// MinMysqlMaxConnections is the max_connections required by all onecloud services
+	MinMysqlMaxConnections = 300
+	// RecommendedMysqlMaxConnections leaves room for connection pools growth and maintenance
+	RecommendedMysqlMaxConnections = 1000
+
+	// MinMysqlDataDirFreeBytes is the free space required by mysql datadir
+	MinMysqlDataDirFreeBytes = 1 << 30
+	// RecommendedMysqlDataDirFreeBytes is the free space recommended for mysql datadir
+	RecommendedMysqlDataDirFreeBytes = 10 << 30
+)
+
+var (
+	mysqlSupportedCharsets = []string{"utf8", "utf8mb3", "utf8mb4"}
+)
+
+// MysqlChecks returns all checkers against the mysql server of info
+func MysqlChecks(info *apis.MysqlConnection) []k8spreflight.Checker {
+	return []k8spreflight.Checker{
+		MysqlCheck{MysqlConnection: info},
+		MysqlTLSCheck{MysqlConnection: info},
+		MysqlVersionCheck{MysqlConnection: info},
+		MysqlAuthPluginCheck{MysqlConnection: info},
+		MysqlCharsetCheck{MysqlConnection: info},
+		MysqlMaxConnectionsCheck{MysqlConnection: info},
+		MysqlLowerCaseTableNamesCheck{MysqlConnection: info},
+		MysqlDataDirSpaceCheck{MysqlConnection: info},
+	}
+}
+
+func withMysqlConnection(info *apis.MysqlConnection, f func(*mysql.Connection) (warnings, errorList []error)) (warnings, errorList []error) {
+	conn, err := mysql.NewConnection(info)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer conn.Close()
+	return f(conn)
+}
+
+// checkMysqlVariable fetches the global variable name and checks it by f, missing variable is skipped
+func checkMysqlVariable(info *apis.MysqlConnection, name string, f func(string) (warnings, errorList []error)) (warnings, errorList []error) {
+	return withMysqlConnection(info, func(conn *mysql.Connection) ([]error, []error) {
+		value, exists, err := conn.GetVariable(name)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if !exists {
+			return nil, nil
+		}
+		return f(value)
+	})
+}
+
+// MysqlTLSCheck verifies the CA and client certificate can be loaded and the connection is encrypted
+// if TLS is enabled, TLS modes can't be applied to services managed by onecloud-operator are rejected
+type MysqlTLSCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlTLSCheck) Name() string {
+	return "MysqlTLS"
+}
+
+func (c MysqlTLSCheck) Check() (warnings, errorList []error) {
+	if !c.TLSMode.IsEnabled() {
+		return nil, nil
+	}
+	if err := onecloud.CheckOperatorMysqlTLS(c.MysqlConnectionOptions); err != nil {
+		return nil, []error{err}
+	}
+	// only connections of ocadm are encrypted
+	warnings = []error{errors.Errorf("services managed by onecloud-operator connect mysql server %s without TLS", c.Server)}
+	if _, err := mysql.TLSConfig(c.MysqlConnection); err != nil {
+		return warnings, []error{err}
+	}
+	w, errorList := withMysqlConnection(c.MysqlConnection, func(conn *mysql.Connection) ([]error, []error) {
+		cipher, err := conn.GetSSLCipher()
+		if err != nil {
+			return nil, []error{err}
+		}
+		if cipher == "" {
+			// only the preferred mode falls back to plain connection
+			return []error{errors.Errorf("mysql server %s doesn't support TLS, connection isn't encrypted", c.Server)}, nil
+		}
+		return nil, nil
+	})
+	return append(warnings, w...), errorList
+}
+
+// MysqlVersionCheck verifies the server version is supported by onecloud
+type MysqlVersionCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlVersionCheck) Name() string {
+	return "MysqlVersion"
+}
+
+func (c MysqlVersionCheck) Check() (warnings, errorList []error) {
+	return withMysqlConnection(c.MysqlConnection, func(conn *mysql.Connection) ([]error, []error) {
+		version, err := conn.GetVersion()
+		if err != nil {
+			return nil, []error{err}
+		}
+		return checkMysqlVersion(version)
+	})
+}
+
+func checkMysqlVersion(version string) (warnings, errorList []error) {
+	v, err := mysql.ParseServerVersion(version)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if v.IsMariaDB() {
+		if !v.AtLeast(10, 0) {
+			errorList = append(errorList, errors.Errorf("%s is not supported, MariaDB 10.0 or later is required", v))
+		}
+		return
+	}
+	if !v.AtLeast(5, 6) {
+		errorList = append(errorList, errors.Errorf("%s is not supported, MySQL 5.6 or later is required", v))
+	} else if v.AtLeast(8, 0) {
+		warnings = append(warnings, errors.Errorf("%s is not fully tested, MySQL 5.7 or MariaDB 10.x is recommended", v))
+	}
+	return
+}
+
+// MysqlAuthPluginCheck verifies users created by onecloud get an auth plugin all services can use
+type MysqlAuthPluginCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlAuthPluginCheck) Name() string {
+	return "MysqlAuthPlugin"
+}
+
+func (c MysqlAuthPluginCheck) Check() (warnings, errorList []error) {
+	return checkMysqlVariable(c.MysqlConnection, "default_authentication_plugin", checkMysqlAuthPlugin)
+}
+
+func checkMysqlAuthPlugin(plugin string) (warnings, errorList []error) {
+	switch plugin {
+	case "mysql_native_password":
+	case "caching_sha2_password", "sha256_password":
+		errorList = append(errorList, errors.Errorf("mysql default_authentication_plugin is %s, onecloud services require mysql_native_password", plugin))
+	default:
+		warnings = append(warnings, errors.Errorf("mysql default_authentication_plugin %s is not tested, mysql_native_password is recommended", plugin))
+	}
+	return
+}
+
+// MysqlCharsetCheck verifies databases created by onecloud default to utf8 charset
+type MysqlCharsetCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlCharsetCheck) Name() string {
+	return "MysqlCharset"
+}
+
+func (c MysqlCharsetCheck) Check() (warnings, errorList []error) {
+	return checkMysqlVariable(c.MysqlConnection, "character_set_server", checkMysqlCharset)
+}
+
+func checkMysqlCharset(charset string) (warnings, errorList []error) {
+	for _, supported := range mysqlSupportedCharsets {
+		if charset == supported {
+			return
+		}
+	}
+	errorList = append(errorList, errors.Errorf("mysql character_set_server is %s, one of %v is required", charset, mysqlSupportedCharsets))
+	return
+}
+
+// MysqlMaxConnectionsCheck verifies the server accepts enough connections for all onecloud services
+type MysqlMaxConnectionsCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlMaxConnectionsCheck) Name() string {
+	return "MysqlMaxConnections"
+}
+
+func (c MysqlMaxConnectionsCheck) Check() (warnings, errorList []error) {
+	return checkMysqlVariable(c.MysqlConnection, "max_connections", checkMysqlMaxConnections)
+}
+
+func checkMysqlMaxConnections(value string) (warnings, errorList []error) {
+	maxConns, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "parse mysql max_connections %q", value)}
+	}
+	if maxConns < MinMysqlMaxConnections {
+		errorList = append(errorList, errors.Errorf("mysql max_connections %d is less than required %d", maxConns, MinMysqlMaxConnections))
+	} else if maxConns < RecommendedMysqlMaxConnections {
+		warnings = append(warnings, errors.Errorf("mysql max_connections %d is less than recommended %d", maxConns, RecommendedMysqlMaxConnections))
+	}
+	return
+}
+
+// MysqlLowerCaseTableNamesCheck verifies table names are stored and compared as onecloud services create them
+type MysqlLowerCaseTableNamesCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlLowerCaseTableNamesCheck) Name() string {
+	return "MysqlLowerCaseTableNames"
+}
+
+func (c MysqlLowerCaseTableNamesCheck) Check() (warnings, errorList []error) {
+	return checkMysqlVariable(c.MysqlConnection, "lower_case_table_names", checkMysqlLowerCaseTableNames)
+}
+
+func checkMysqlLowerCaseTableNames(value string) (warnings, errorList []error) {
+	switch value {
+	case "0":
+	case "1":
+		warnings = append(warnings, errors.New("mysql lower_case_table_names is 1, table names are case insensitive and may mismatch existing databases"))
+	default:
+		errorList = append(errorList, errors.Errorf("mysql lower_case_table_names is %s, 0 is required", value))
+	}
+	return
+}
+
+// MysqlDataDirSpaceCheck verifies the free space of datadir, only works when mysql runs on this node
+type MysqlDataDirSpaceCheck struct {
+	*apis.MysqlConnection
+}
+
+func (MysqlDataDirSpaceCheck) Name() string {
+	return "MysqlDataDirSpace"
+}
+
+func (c MysqlDataDirSpaceCheck) Check() (warnings, errorList []error) {
+	if !isLocalAddress(c.Server) {
+		return nil, nil
+	}
+	return checkMysqlVariable(c.MysqlConnection, "datadir", func(dataDir string) ([]error, []error) {
+		free, err := getFreeBytes(dataDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// mysql runs inside a container, datadir isn't visible from host
+				return nil, nil
+			}
+			return []error{errors.Wrapf(err, "statfs mysql datadir %s", dataDir)}, nil
+		}
+		return checkMysqlDataDirSpace(dataDir, free)
+	})
+}
+
+func checkMysqlDataDirSpace(dataDir string, free uint64) (warnings, errorList []error) {
+	if free < MinMysqlDataDirFreeBytes {
+		errorList = append(errorList, errors.Errorf("mysql datadir %s has %dMiB free space, at least %dMiB is required", dataDir, free>>20, MinMysqlDataDirFreeBytes>>20))
+	} else if free < RecommendedMysqlDataDirFreeBytes {
+		warnings = append(warnings, errors.Errorf("mysql datadir %s has %dMiB free space, %dMiB is recommended", dataDir, free>>20, RecommendedMysqlDataDirFreeBytes>>20))
+	}
+	return
+}
+
+func isLocalAddress(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
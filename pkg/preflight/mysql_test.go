@@ -0,0 +1,68 @@
+package preflight
+
+import (
+	"testing"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+func TestMysqlVariableChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    func(string) ([]error, []error)
+		value    string
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"mysql 5.7", checkMysqlVersion, "5.7.30-log", false, false},
+		{"mysql 5.5", checkMysqlVersion, "5.5.62", true, false},
+		{"mysql 8.0", checkMysqlVersion, "8.0.21", false, true},
+		{"mariadb 10.3", checkMysqlVersion, "10.3.27-MariaDB", false, false},
+		{"mariadb 10.3 replication prefix", checkMysqlVersion, "5.5.5-10.3.27-MariaDB-log", false, false},
+		{"mariadb 5.5", checkMysqlVersion, "5.5.68-MariaDB", true, false},
+		{"unknown version", checkMysqlVersion, "unknown", true, false},
+		{"native password", checkMysqlAuthPlugin, "mysql_native_password", false, false},
+		{"caching sha2 password", checkMysqlAuthPlugin, "caching_sha2_password", true, false},
+		{"utf8 charset", checkMysqlCharset, "utf8", false, false},
+		{"utf8mb4 charset", checkMysqlCharset, "utf8mb4", false, false},
+		{"latin1 charset", checkMysqlCharset, "latin1", true, false},
+		{"enough connections", checkMysqlMaxConnections, "2000", false, false},
+		{"few connections", checkMysqlMaxConnections, "500", false, true},
+		{"default connections", checkMysqlMaxConnections, "151", true, false},
+		{"case sensitive table names", checkMysqlLowerCaseTableNames, "0", false, false},
+		{"lower case table names", checkMysqlLowerCaseTableNames, "1", false, true},
+		{"case insensitive compare table names", checkMysqlLowerCaseTableNames, "2", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := tt.check(tt.value)
+			if (len(errs) != 0) != tt.wantErr {
+				t.Errorf("check(%q) errors = %v, wantErr %v", tt.value, errs, tt.wantErr)
+			}
+			if (len(warnings) != 0) != tt.wantWarn {
+				t.Errorf("check(%q) warnings = %v, wantWarn %v", tt.value, warnings, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestMysqlTLSCheckOperatorModes(t *testing.T) {
+	tests := []struct {
+		mode    apis.MysqlTLSMode
+		wantErr bool
+	}{
+		{apis.MysqlTLSDisabled, false},
+		{apis.MysqlTLSRequired, true},
+		{apis.MysqlTLSVerifyCA, true},
+		{apis.MysqlTLSVerifyIdentity, true},
+	}
+	for _, tt := range tests {
+		info := &apis.MysqlConnection{Server: "127.0.0.1", Port: 3306}
+		info.TLSMode = tt.mode
+		// the modes checked here are rejected or skipped before connecting
+		_, errs := MysqlTLSCheck{MysqlConnection: info}.Check()
+		if (len(errs) != 0) != tt.wantErr {
+			t.Errorf("MysqlTLSCheck of mode %s errors = %v, wantErr %v", tt.mode, errs, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package preflight
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/version"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	k8spreflight "k8s.io/kubernetes/cmd/kubeadm/app/preflight"
+	utilruntime "k8s.io/kubernetes/cmd/kubeadm/app/util/runtime"
+	utilsexec "k8s.io/utils/exec"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/registry"
+)
+
+// ImageResolveCheck ensures the images exist in local container runtime or remote registry, nothing is pulled
+type ImageResolveCheck struct {
+	runtime   utilruntime.ContainerRuntime
+	registry  *registry.Client
+	imageList []string
+}
+
+// Name returns the label for ImageResolveCheck
+func (ImageResolveCheck) Name() string {
+	return "ImageResolve"
+}
+
+func (c ImageResolveCheck) Check() (warnings, errorList []error) {
+	for _, image := range c.imageList {
+		if c.runtime != nil {
+			exists, err := c.runtime.ImageExists(image)
+			if err == nil && exists {
+				klog.V(1).Infof("image exists in container runtime: %s", image)
+				continue
+			}
+		}
+		desc, err := c.registry.Resolve(image)
+		if err != nil {
+			errorList = append(errorList, errors.Wrapf(err, "resolve image %s", image))
+			continue
+		}
+		klog.V(1).Infof("image %s resolved to %s", image, desc.Digest)
+	}
+	return warnings, errorList
+}
+
+// UpgradeVersionCheck ensures the version jump of onecloud cluster is an allowed upgrade path,
+// downgrade, major version change and skipping minor versions are refused.
+type UpgradeVersionCheck struct {
+	Current string
+	Target  string
+}
+
+// Name returns the label for UpgradeVersionCheck
+func (UpgradeVersionCheck) Name() string {
+	return "UpgradeVersion"
+}
+
+func (c UpgradeVersionCheck) Check() (warnings, errorList []error) {
+	if c.Current == c.Target {
+		return nil, nil
+	}
+	cur, err := version.ParseGeneric(c.Current)
+	if err != nil {
+		warnings = append(warnings, errors.Errorf("current version %q is not semantic, upgrade path is not checked", c.Current))
+		return
+	}
+	target, err := version.ParseGeneric(c.Target)
+	if err != nil {
+		warnings = append(warnings, errors.Errorf("target version %q is not semantic, upgrade path is not checked", c.Target))
+		return
+	}
+	if target.LessThan(cur) {
+		errorList = append(errorList, errors.Errorf("downgrade from %s to %s is not supported", c.Current, c.Target))
+		return
+	}
+	if target.Major() != cur.Major() {
+		errorList = append(errorList, errors.Errorf("upgrade across major version from %s to %s is not supported", c.Current, c.Target))
+		return
+	}
+	if target.Minor() > cur.Minor()+1 {
+		errorList = append(errorList, errors.Errorf("upgrade from %s to %s skips minor versions, please upgrade to v%d.%d first", c.Current, c.Target, cur.Major(), cur.Minor()+1))
+		return
+	}
+	return
+}
+
+// DeploymentsHealthCheck ensures all the deployments in namespace are fully rolled out and available
+type DeploymentsHealthCheck struct {
+	client    clientset.Interface
+	namespace string
+}
+
+// Name returns the label for DeploymentsHealthCheck
+func (DeploymentsHealthCheck) Name() string {
+	return "DeploymentsHealth"
+}
+
+func (c DeploymentsHealthCheck) Check() (warnings, errorList []error) {
+	dps, err := c.client.AppsV1().Deployments(c.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		errorList = append(errorList, errors.Wrapf(err, "list deployments in %s", c.namespace))
+		return
+	}
+	for _, dp := range dps.Items {
+		replicas := int32(1)
+		if dp.Spec.Replicas != nil {
+			replicas = *dp.Spec.Replicas
+		}
+		status := dp.Status
+		if status.ObservedGeneration < dp.Generation {
+			errorList = append(errorList, errors.Errorf("deployment %s is rolling out", dp.GetName()))
+			continue
+		}
+		if status.UpdatedReplicas < replicas || status.ReadyReplicas < replicas {
+			errorList = append(errorList, errors.Errorf("deployment %s is not healthy, %d/%d replicas ready, %d updated",
+				dp.GetName(), status.ReadyReplicas, replicas, status.UpdatedReplicas))
+		}
+	}
+	return
+}
+
+// UpgradeCheckConfig is the input of RunUpgradeChecks
+type UpgradeCheckConfig struct {
+	CRISocket       string
+	Namespace       string
+	CurrentVersion  string
+	TargetVersion   string
+	Images          []string
+	MysqlConnection *apis.MysqlConnection
+	// InsecureRegistries are allowed plain http and skipping tls verification when resolving images
+	InsecureRegistries []string
+}
+
+// RunUpgradeChecks runs the checks before updating onecloud cluster
+func RunUpgradeChecks(client clientset.Interface, cfg *UpgradeCheckConfig, ignorePreflightErrors sets.String, out io.Writer) error {
+	fmt.Fprintf(out, "[upgrade/preflight] Running pre-flight checks\n")
+	containerRuntime, err := utilruntime.NewContainerRuntime(utilsexec.New(), cfg.CRISocket)
+	if err != nil {
+		klog.Warningf("[upgrade/preflight] container runtime not available, images are only resolved from registry: %v", err)
+		containerRuntime = nil
+	}
+	checks := []k8spreflight.Checker{
+		UpgradeVersionCheck{Current: cfg.CurrentVersion, Target: cfg.TargetVersion},
+		DeploymentsHealthCheck{client: client, namespace: cfg.Namespace},
+		ImageResolveCheck{
+			runtime:   containerRuntime,
+			registry:  registry.NewClient(30*time.Second, cfg.InsecureRegistries...),
+			imageList: cfg.Images,
+		},
+	}
+	checks = append(checks, MysqlChecks(cfg.MysqlConnection)...)
+	return k8spreflight.RunChecks(checks, out, ignorePreflightErrors)
+}
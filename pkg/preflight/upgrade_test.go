@@ -0,0 +1,32 @@
+package preflight
+
+import "testing"
+
+func TestUpgradeVersionCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		target   string
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"same version", "v3.8.5", "v3.8.5", false, false},
+		{"patch upgrade", "v3.8.5", "v3.8.9", false, false},
+		{"minor upgrade", "v3.7.10", "v3.8.1", false, false},
+		{"skip minor", "v3.6.10", "v3.8.1", true, false},
+		{"downgrade", "v3.8.5", "v3.8.1", true, false},
+		{"major upgrade", "v2.13.1", "v3.0.0", true, false},
+		{"not semantic", "master-test", "v3.8.1", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := UpgradeVersionCheck{Current: tt.current, Target: tt.target}.Check()
+			if (len(errs) != 0) != tt.wantErr {
+				t.Errorf("UpgradeVersionCheck() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if (len(warnings) != 0) != tt.wantWarn {
+				t.Errorf("UpgradeVersionCheck() warnings = %v, wantWarn %v", warnings, tt.wantWarn)
+			}
+		})
+	}
+}
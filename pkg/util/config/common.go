@@ -1,12 +1,18 @@
 package config
 
 import (
+	"bytes"
+
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	configutil "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
 
+	"yunion.io/x/ocadm/pkg/apis/constants"
 	ocadmscheme "yunion.io/x/ocadm/pkg/apis/scheme"
 	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/apis/v1beta1"
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
 )
 
 var (
@@ -17,10 +23,88 @@ var (
 func MarshalOcadmConfigObject(obj runtime.Object) ([]byte, error) {
 	switch internalcfg := obj.(type) {
 	case *apis.InitConfiguration:
-		return MarshalInitConfigurationToBytes(internalcfg, apis.SchemeGroupVersion)
+		return MarshalInitConfigurationToBytes(internalcfg, v1beta1.SchemeGroupVersion)
 	case *apis.ClusterConfiguration:
-		return MarshalClusterConfigurationToBytes(internalcfg, apis.SchemeGroupVersion)
+		return MarshalClusterConfigurationToBytes(internalcfg, v1beta1.SchemeGroupVersion)
+	case *apis.JoinConfiguration:
+		return MarshalJoinConfigurationToBytes(internalcfg, v1beta1.SchemeGroupVersion)
 	default:
-		return kubeadmutil.MarshalToYamlForCodecs(obj, apis.SchemeGroupVersion, ocadmscheme.Codecs)
+		return kubeadmutil.MarshalToYamlForCodecs(obj, v1beta1.SchemeGroupVersion, ocadmscheme.Codecs)
+	}
+}
+
+// MigrateOldConfig migrates an old configuration from a byte slice into a new one (returned again as a byte slice).
+// The ocadm kinds are written in the preferred ocadm version, the kubeadm kinds are migrated by kubeadm.
+func MigrateOldConfig(oldConfig []byte) ([]byte, error) {
+	newConfig := [][]byte{}
+
+	gvkmap, kubeadmBytes, err := ocadmutil.SplitYAMLDocumentsOfGroup(oldConfig, apis.GroupName)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	gvks := []schema.GroupVersionKind{}
+	for gvk := range gvkmap {
+		gvks = append(gvks, gvk)
+	}
+
+	// Migrate InitConfiguration and ClusterConfiguration if there are any in the config
+	if ocadmutil.GroupVersionKindsHasInitConfiguration(gvks...) {
+		initCfg := &apis.InitConfiguration{}
+		if err := decodeOcadmDocument(gvkmap, constants.InitConfigurationKind, initCfg); err != nil {
+			return []byte{}, err
+		}
+		b, err := kubeadmutil.MarshalToYamlForCodecs(initCfg, v1beta1.SchemeGroupVersion, ocadmscheme.Codecs)
+		if err != nil {
+			return []byte{}, err
+		}
+		newConfig = append(newConfig, b)
+	}
+	if ocadmutil.GroupVersionKindsHasClusterConfiguration(gvks...) {
+		clusterCfg := &apis.ClusterConfiguration{}
+		if err := decodeOcadmDocument(gvkmap, constants.ClusterConfigurationKind, clusterCfg); err != nil {
+			return []byte{}, err
+		}
+		b, err := MarshalClusterConfigurationToBytes(clusterCfg, v1beta1.SchemeGroupVersion)
+		if err != nil {
+			return []byte{}, err
+		}
+		newConfig = append(newConfig, b)
+	}
+
+	// Migrate JoinConfiguration if there is any
+	if ocadmutil.GroupVersionKindsHasJoinConfiguration(gvks...) {
+		joinCfg := &apis.JoinConfiguration{}
+		if err := decodeOcadmDocument(gvkmap, constants.JoinConfigurationKind, joinCfg); err != nil {
+			return []byte{}, err
+		}
+		b, err := kubeadmutil.MarshalToYamlForCodecs(joinCfg, v1beta1.SchemeGroupVersion, ocadmscheme.Codecs)
+		if err != nil {
+			return []byte{}, err
+		}
+		newConfig = append(newConfig, b)
+	}
+
+	if len(kubeadmBytes) != 0 {
+		b, err := configutil.MigrateOldConfig(kubeadmBytes)
+		if err != nil {
+			return []byte{}, err
+		}
+		if len(b) != 0 {
+			newConfig = append(newConfig, b)
+		}
+	}
+
+	return bytes.Join(newConfig, []byte(constants.YAMLDocumentSeparator)), nil
+}
+
+// decodeOcadmDocument decodes the ocadm document of kind into obj
+func decodeOcadmDocument(gvkmap map[schema.GroupVersionKind][]byte, kind string, obj runtime.Object) error {
+	for gvk, content := range gvkmap {
+		if gvk.Kind != kind {
+			continue
+		}
+		return runtime.DecodeInto(ocadmscheme.Codecs.UniversalDecoder(), content, obj)
 	}
+	return nil
 }
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
+)
+
+func TestMigrateOldConfig(t *testing.T) {
+	// serialized by MarshalOcadmConfigObject of ocadm.yunion.io/v1, which only has the init configurations
+	oldCfg := []byte(`apiVersion: ocadm.yunion.io/v1
+kind: InitConfiguration
+---
+apiVersion: kubeadm.k8s.io/v1beta1
+bootstrapTokens:
+- groups:
+  - system:bootstrappers:kubeadm:default-node-token
+  token: abcdef.0123456789abcdef
+  ttl: 24h0m0s
+  usages:
+  - signing
+  - authentication
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: ""
+  bindPort: 6443
+nodeRegistration:
+  criSocket: /var/run/dockershim.sock
+---
+apiServer:
+  extraArgs:
+    default-not-ready-toleration-seconds: "10"
+    default-unreachable-toleration-seconds: "10"
+  timeoutForControlPlane: 4m0s
+apiVersion: kubeadm.k8s.io/v1beta1
+certificatesDir: /etc/kubernetes/pki
+clusterName: kubernetes
+controlPlaneEndpoint: ""
+controllerManager:
+  extraArgs:
+    node-monitor-grace-period: 16s
+    node-monitor-period: 2s
+dns:
+  type: CoreDNS
+etcd:
+  local:
+    dataDir: /var/lib/etcd
+    imageTag: 3.4.6
+imageRepository: k8s.gcr.io
+kind: ClusterConfiguration
+kubernetesVersion: v1.15.8
+networking:
+  dnsDomain: cluster.local
+  podSubnet: 10.40.0.0/16
+  serviceSubnet: 10.96.0.0/12
+scheduler: {}
+---
+apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: ""
+clientConnection:
+  acceptContentTypes: ""
+  burst: 0
+  contentType: ""
+  kubeconfig: ""
+  qps: 0
+clusterCIDR: ""
+configSyncPeriod: 0s
+conntrack:
+  maxPerCore: null
+  min: null
+  tcpCloseWaitTimeout: null
+  tcpEstablishedTimeout: null
+enableProfiling: false
+healthzBindAddress: ""
+hostnameOverride: ""
+iptables:
+  masqueradeAll: false
+  masqueradeBit: null
+  minSyncPeriod: 0s
+  syncPeriod: 0s
+ipvs:
+  excludeCIDRs: null
+  minSyncPeriod: 0s
+  scheduler: ""
+  strictARP: false
+  syncPeriod: 0s
+kind: KubeProxyConfiguration
+metricsBindAddress: ""
+mode: ipvs
+nodePortAddresses: null
+oomScoreAdj: null
+portRange: ""
+resourceContainer: ""
+udpIdleTimeout: 0s
+winkernel:
+  enableDSR: false
+  networkName: ""
+  sourceVip: ""
+---
+MysqlConnection:
+  Password: passwd
+  Port: 3306
+  Server: 10.168.222.10
+  Username: root
+OnecloudVersion: v3.0.0
+Region: region1
+apiVersion: ocadm.yunion.io/v1
+kind: ClusterConfiguration
+`)
+	newCfg, err := MigrateOldConfig(oldCfg)
+	if err != nil {
+		t.Fatalf("MigrateOldConfig() error = %v", err)
+	}
+	if strings.Contains(string(newCfg), "ocadm.yunion.io/v1\n") {
+		t.Errorf("MigrateOldConfig() still writes the old version:\n%s", newCfg)
+	}
+
+	gvkmap, kubeadmBytes, err := ocadmutil.SplitYAMLDocumentsOfGroup(newCfg, apiv1.GroupName)
+	if err != nil {
+		t.Fatalf("split migrated config: %v", err)
+	}
+	for gvk := range gvkmap {
+		if gvk.Version != "v1beta1" {
+			t.Errorf("document %v is not migrated", gvk)
+		}
+	}
+	if strings.Contains(string(kubeadmBytes), "kubeadm.k8s.io/v1beta1\n") {
+		t.Errorf("kubeadm documents are not migrated:\n%s", kubeadmBytes)
+	}
+
+	cfg, err := BytesToInitConfiguration(newCfg)
+	if err != nil {
+		t.Fatalf("BytesToInitConfiguration() of migrated config error = %v\n%s", err, newCfg)
+	}
+	if cfg.MysqlConnection.Server != "10.168.222.10" || cfg.MysqlConnection.Password != "passwd" {
+		t.Errorf("MysqlConnection = %#v", cfg.MysqlConnection)
+	}
+	if cfg.Region != "region1" || cfg.OnecloudVersion != "v3.0.0" {
+		t.Errorf("Region = %q, OnecloudVersion = %q", cfg.Region, cfg.OnecloudVersion)
+	}
+	if cfg.Calico.IPV4PoolBlockSize != apiv1.DefaultCalicoIPV4PoolBlockSize {
+		t.Errorf("Calico.IPV4PoolBlockSize = %d, want defaulted %d", cfg.Calico.IPV4PoolBlockSize, apiv1.DefaultCalicoIPV4PoolBlockSize)
+	}
+	if len(cfg.BootstrapTokens) != 1 || cfg.BootstrapTokens[0].Token.String() != "abcdef.0123456789abcdef" {
+		t.Errorf("BootstrapTokens = %#v", cfg.BootstrapTokens)
+	}
+	if cfg.Networking.PodSubnet != "10.40.0.0/16" || cfg.KubernetesVersion != "v1.15.8" {
+		t.Errorf("kubeadm ClusterConfiguration isn't kept: %#v", cfg.InitConfiguration.ClusterConfiguration)
+	}
+}
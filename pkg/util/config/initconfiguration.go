@@ -105,20 +105,39 @@ func DefaultedInitConfiguration(defaultcfg *apiv1.InitConfiguration) (*apiv1.Ini
 // and well-known ComponentConfig GroupVersionKinds are stored inside of the internal InitConfiguration struct.
 // The resulting InitConfiguration is then dynamically defaulted and validated prior to return.
 func BytesToInitConfiguration(b []byte) (*apiv1.InitConfiguration, error) {
-	kubeadmInitCfg, err := kubeadmconfig.BytesToInitConfiguration(b)
+	initCfg, err := bytesToStaticInitConfiguration(b)
 	if err != nil {
 		return nil, err
 	}
 
-	gvkmap, err := ocadmutil.SplitYAMLDocuments(b)
+	// Applies dynamic defaults to settings not provided with flags
+	if err := SetInitDynamicDefaults(initCfg); err != nil {
+		return nil, err
+	}
+	return initCfg, nil
+}
+
+// bytesToStaticInitConfiguration converts a byte slice to a defaulted InitConfiguration object without
+// detecting the onecloud settings of the local host.
+func bytesToStaticInitConfiguration(b []byte) (*apiv1.InitConfiguration, error) {
+	gvkmap, kubeadmBytes, err := ocadmutil.SplitYAMLDocumentsOfGroup(b, apiv1.GroupName)
 	if err != nil {
 		return nil, err
 	}
 
+	var kubeadmInitCfg *kubeadmapi.InitConfiguration
+	if len(kubeadmBytes) != 0 {
+		kubeadmInitCfg, err = kubeadmconfig.BytesToInitConfiguration(kubeadmBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return documentMapToInitConfiguration(gvkmap, kubeadmInitCfg, false)
 }
 
-// documentMapToInitConfiguration converts a map of GVKs and YAML documents to defaulted and validated configuration object.
+// documentMapToInitConfiguration converts a map of GVKs and YAML documents to defaulted configuration object,
+// the onecloud settings of the local host are not dynamically defaulted.
 func documentMapToInitConfiguration(gvkmap map[schema.GroupVersionKind][]byte, kubeadmInitCfg *kubeadmapi.InitConfiguration, allowDeprecated bool) (*apiv1.InitConfiguration, error) {
 	var initCfg *apiv1.InitConfiguration
 	var clusterCfg *apiv1.ClusterConfiguration
@@ -147,7 +166,7 @@ func documentMapToInitConfiguration(gvkmap map[schema.GroupVersionKind][]byte, k
 	}
 
 	// Enforce that InitConfiguration and/or ClusterConfiguration has to exist among the YAML documents
-	if initCfg == nil && clusterCfg == nil {
+	if initCfg == nil && clusterCfg == nil && kubeadmInitCfg == nil {
 		return nil, errors.New("no InitConfiguration or ClusterConfiguration kind was found in the YAML file")
 	}
 
@@ -164,17 +183,26 @@ func documentMapToInitConfiguration(gvkmap map[schema.GroupVersionKind][]byte, k
 		initCfg.ClusterConfiguration = *clusterCfg
 	}
 
-	if kubeadmInitCfg != nil {
-		initCfg.InitConfiguration = *kubeadmInitCfg
+	// If no kubeadm document was given, default the kubernetes settings the same way as flags do
+	if kubeadmInitCfg == nil {
+		defaultCfg, err := defaultedKubeadmInitConfiguration()
+		if err != nil {
+			return nil, err
+		}
+		kubeadmInitCfg = defaultCfg
 	}
+	initCfg.InitConfiguration = *kubeadmInitCfg
 
-	// Applies dynamic defaults to settings not provided with flags
-	if err := SetInitDynamicDefaults(initCfg); err != nil {
+	return initCfg, nil
+}
+
+func defaultedKubeadmInitConfiguration() (*kubeadmapi.InitConfiguration, error) {
+	cfg := &apiv1.InitConfiguration{}
+	ocadmscheme.Scheme.Default(cfg)
+	if err := kubeadmconfig.SetInitDynamicDefaults(&cfg.InitConfiguration); err != nil {
 		return nil, err
 	}
-
-	// TODO: Validates cfg (flags/configs + defaults + dynamic defaults)
-	return initCfg, nil
+	return &cfg.InitConfiguration, nil
 }
 
 func SetInitDynamicDefaults(cfg *apiv1.InitConfiguration) error {
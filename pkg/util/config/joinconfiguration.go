@@ -1,13 +1,25 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/klog"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeadmscheme "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/scheme"
 	kubeadmapiv1beta2 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta2"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	kubeadmconfig "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
 
+	"yunion.io/x/ocadm/pkg/apis/constants"
 	ocadmscheme "yunion.io/x/ocadm/pkg/apis/scheme"
 	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
 )
 
 // LoadOrDefaultJoinConfiguration takes a path to a config file and a versioned configuration that can serve as the default config
@@ -28,16 +40,64 @@ func LoadOrDefaultJoinConfiguration(cfgPath string, defaultversionedcfg *apiv1.J
 // LoadJoinConfigurationFromFile loads versioned JoinConfiguration from file, converts it to internal, defaults and validates it
 func LoadJoinConfigurationFromFile(cfgPath string) (*apiv1.JoinConfiguration, error) {
 	klog.V(1).Infof("loading configuration from %q", cfgPath)
-	kubeadmCfg, err := kubeadmconfig.LoadJoinConfigurationFromFile(cfgPath)
+
+	b, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read config from %q ", cfgPath)
+	}
+
+	gvkmap, kubeadmBytes, err := ocadmutil.SplitYAMLDocumentsOfGroup(b, apiv1.GroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	joinCfg := &apiv1.JoinConfiguration{}
+	found := false
+	for gvk, fileContent := range gvkmap {
+		if ocadmutil.GroupVersionKindsHasJoinConfiguration(gvk) {
+			// Decode the bytes into the internal struct. Under the hood, the bytes will be unmarshalled into the
+			// right external version, defaulted, and converted into the internal version.
+			if err := runtime.DecodeInto(ocadmscheme.Codecs.UniversalDecoder(), fileContent, joinCfg); err != nil {
+				return nil, err
+			}
+			found = true
+			continue
+		}
+
+		fmt.Printf("[oc-config] WARNING: Ignored YAML document with GroupVersionKind %v\n", gvk)
+	}
+	if !found {
+		ocadmscheme.Scheme.Default(joinCfg)
+	}
+
+	if len(kubeadmBytes) == 0 {
+		return nil, errors.Errorf("no kubeadm JoinConfiguration was found in %q", cfgPath)
+	}
+	kubeadmCfg, err := bytesToKubeadmJoinConfiguration(kubeadmBytes)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: load for file
-	joinCfg := new(apiv1.JoinConfiguration)
 	joinCfg.JoinConfiguration = *kubeadmCfg
 	return joinCfg, nil
 }
 
+// bytesToKubeadmJoinConfiguration loads the kubeadm documents through kubeadm, which only accepts a file path
+func bytesToKubeadmJoinConfiguration(b []byte) (*kubeadmapi.JoinConfiguration, error) {
+	f, err := ioutil.TempFile("", "ocadm-join-config")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return kubeadmconfig.LoadJoinConfigurationFromFile(f.Name())
+}
+
 func DefaultedJoinConfiguration(defaultcfg *apiv1.JoinConfiguration) (*apiv1.JoinConfiguration, error) {
 	internalcfg := &apiv1.JoinConfiguration{}
 	ocadmscheme.Scheme.Default(internalcfg)
@@ -53,3 +113,17 @@ func DefaultedJoinConfiguration(defaultcfg *apiv1.JoinConfiguration) (*apiv1.Joi
 	internalcfg.JoinConfiguration = *kubeadmInternalCfg
 	return internalcfg, nil
 }
+
+// MarshalJoinConfigurationToBytes marshals the internal JoinConfiguration object to bytes. It writes the embedded
+// kubeadm JoinConfiguration object out as a separate YAML document
+func MarshalJoinConfigurationToBytes(cfg *apiv1.JoinConfiguration, gv schema.GroupVersion) ([]byte, error) {
+	joinbytes, err := kubeadmutil.MarshalToYamlForCodecs(cfg, gv, ocadmscheme.Codecs)
+	if err != nil {
+		return []byte{}, err
+	}
+	kubeadmBytes, err := kubeadmconfig.MarshalKubeadmConfigObject(&cfg.JoinConfiguration)
+	if err != nil {
+		return []byte{}, err
+	}
+	return bytes.Join([][]byte{joinbytes, kubeadmBytes}, []byte(constants.YAMLDocumentSeparator)), nil
+}
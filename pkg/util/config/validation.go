@@ -0,0 +1,57 @@
+package config
+
+import (
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+
+	"yunion.io/x/ocadm/pkg/apis/v1/validation"
+	ocadmutil "yunion.io/x/ocadm/pkg/util"
+)
+
+// ValidateConfigFile loads the init and join configurations in cfgPath and validates them.
+// The onecloud settings of the local host are not detected, so that the file could be validated on any machine.
+func ValidateConfigFile(cfgPath string) error {
+	klog.V(1).Infof("validating configuration from %q", cfgPath)
+
+	b, err := ioutil.ReadFile(cfgPath)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read config from %q ", cfgPath)
+	}
+	gvkmap, err := ocadmutil.SplitYAMLDocuments(b)
+	if err != nil {
+		return err
+	}
+	gvks := []schema.GroupVersionKind{}
+	for gvk := range gvkmap {
+		gvks = append(gvks, gvk)
+	}
+
+	isInit := ocadmutil.GroupVersionKindsHasInitConfiguration(gvks...) || ocadmutil.GroupVersionKindsHasClusterConfiguration(gvks...)
+	isJoin := ocadmutil.GroupVersionKindsHasJoinConfiguration(gvks...)
+	if !isInit && !isJoin {
+		return errors.Errorf("no InitConfiguration, ClusterConfiguration or JoinConfiguration kind was found in %q", cfgPath)
+	}
+
+	if isInit {
+		initCfg, err := bytesToStaticInitConfiguration(b)
+		if err != nil {
+			return err
+		}
+		if err := validation.ValidateInitConfiguration(initCfg).ToAggregate(); err != nil {
+			return err
+		}
+	}
+	if isJoin {
+		joinCfg, err := LoadJoinConfigurationFromFile(cfgPath)
+		if err != nil {
+			return err
+		}
+		if err := validation.ValidateJoinConfiguration(joinCfg).ToAggregate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
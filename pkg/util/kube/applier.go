@@ -0,0 +1,343 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/kubernetes/pkg/kubectl/polymorphichelpers"
+
+	"yunion.io/x/log"
+)
+
+const (
+	// mappingTimeout is how long to wait for the kinds of just applied CRDs to be served
+	mappingTimeout = 30 * time.Second
+)
+
+// rolloutKinds are the kinds waited by WaitRollout
+var rolloutKinds = map[schema.GroupKind]bool{
+	{Group: "apps", Kind: "Deployment"}:  true,
+	{Group: "apps", Kind: "DaemonSet"}:   true,
+	{Group: "apps", Kind: "StatefulSet"}: true,
+}
+
+// sharedKinds are the kinds of objects shared by manifests, e.g. several addons declare the same Namespace,
+// they are applied without labels and never pruned
+var sharedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}: true,
+}
+
+// resettableRESTMapper is a RESTMapper whose discovery cache could be reset
+type resettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
+// ObjectReference identifies an object applied by Applier
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func NewObjectReference(obj *unstructured.Unstructured) ObjectReference {
+	return ObjectReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+func (r ObjectReference) GroupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(r.APIVersion, r.Kind)
+}
+
+func (r ObjectReference) String() string {
+	kind := strings.ToLower(r.Kind)
+	if len(r.Namespace) == 0 {
+		return fmt.Sprintf("%s/%s", kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, r.Namespace, r.Name)
+}
+
+// key identifies the object regardless of the api version it's accessed by
+func (r ObjectReference) key() string {
+	return fmt.Sprintf("%s/%s/%s", r.GroupVersionKind().GroupKind(), r.Namespace, r.Name)
+}
+
+// ParseManifest decodes the objects of multi-document yaml or json manifest, List kinds are flattened
+func ParseManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	ret := make([]*unstructured.Unstructured, 0)
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "decode manifest")
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, errors.Wrap(err, "decode manifest list")
+			}
+			for i := range list.Items {
+				ret = append(ret, &list.Items[i])
+			}
+			continue
+		}
+		if len(obj.GetKind()) == 0 || len(obj.GetName()) == 0 {
+			return nil, errors.Errorf("object %v in manifest must have kind and metadata.name", obj.Object)
+		}
+		ret = append(ret, obj)
+	}
+	return ret, nil
+}
+
+// Applier applies manifests to cluster through the dynamic client instead of the kubectl binary
+type Applier struct {
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	// serverSideApply is cleared once the apiserver rejects apply patches,
+	// then objects are created or merge patched
+	serverSideApply bool
+
+	FieldManager string
+}
+
+func NewApplier(dynamicClient dynamic.Interface, mapper meta.RESTMapper, fieldManager string) *Applier {
+	return &Applier{
+		dynamicClient:   dynamicClient,
+		mapper:          mapper,
+		serverSideApply: true,
+		FieldManager:    fieldManager,
+	}
+}
+
+func (c *Client) Applier(fieldManager string) (*Applier, error) {
+	dynamicClient, err := c.Factory.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := c.Factory.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient)
+	return NewApplier(dynamicClient, mapper, fieldManager), nil
+}
+
+// Apply applies the objects of manifest in order with objLabels set except the shared kinds,
+// it returns the references of applied objects
+func (a *Applier) Apply(manifest string, objLabels map[string]string) ([]ObjectReference, error) {
+	objs, err := ParseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]ObjectReference, 0, len(objs))
+	for _, obj := range objs {
+		if len(objLabels) != 0 && !sharedKinds[obj.GroupVersionKind().GroupKind()] {
+			newLabels := obj.GetLabels()
+			if newLabels == nil {
+				newLabels = make(map[string]string)
+			}
+			for k, v := range objLabels {
+				newLabels[k] = v
+			}
+			obj.SetLabels(newLabels)
+		}
+		if err := a.applyObject(obj); err != nil {
+			return nil, errors.Wrapf(err, "apply %s", NewObjectReference(obj))
+		}
+		refs = append(refs, NewObjectReference(obj))
+	}
+	return refs, nil
+}
+
+func (a *Applier) applyObject(obj *unstructured.Unstructured) error {
+	mapping, err := a.restMapping(obj.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if len(obj.GetNamespace()) == 0 {
+			obj.SetNamespace(metav1.NamespaceDefault)
+		}
+	} else {
+		obj.SetNamespace("")
+	}
+	ri := a.resource(mapping, obj.GetNamespace())
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if a.serverSideApply {
+		force := true
+		_, err := ri.Patch(obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			FieldManager: a.FieldManager,
+			Force:        &force,
+		})
+		if err == nil || !apierrors.IsUnsupportedMediaType(err) {
+			return err
+		}
+		log.Infof("Server-side apply isn't supported by apiserver, fall back to create or patch objects")
+		a.serverSideApply = false
+	}
+
+	if _, err := ri.Get(obj.GetName(), metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = ri.Create(obj, metav1.CreateOptions{FieldManager: a.FieldManager})
+		return err
+	}
+	_, err = ri.Patch(obj.GetName(), types.MergePatchType, data, metav1.PatchOptions{FieldManager: a.FieldManager})
+	return err
+}
+
+// Prune deletes the objects matching selector of kinds in refs which are not in keep,
+// objects of the shared kinds are never deleted
+func (a *Applier) Prune(selector map[string]string, refs []ObjectReference, keep []ObjectReference) error {
+	keepKeys := make(map[string]bool)
+	for _, ref := range keep {
+		keepKeys[ref.key()] = true
+	}
+	visited := make(map[schema.GroupKind]bool)
+	for _, ref := range refs {
+		gvk := ref.GroupVersionKind()
+		if visited[gvk.GroupKind()] || sharedKinds[gvk.GroupKind()] {
+			continue
+		}
+		visited[gvk.GroupKind()] = true
+		mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				// the kind isn't served anymore, so no objects left
+				continue
+			}
+			return err
+		}
+		list, err := a.dynamicClient.Resource(mapping.Resource).List(metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(selector).String(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "list %s", mapping.Resource)
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			objRef := NewObjectReference(obj)
+			objRef.APIVersion = ref.APIVersion
+			if keepKeys[objRef.key()] {
+				continue
+			}
+			if err := a.deleteObject(mapping, obj.GetNamespace(), obj.GetName()); err != nil {
+				return errors.Wrapf(err, "delete %s", objRef)
+			}
+			log.Infof("Pruned %s", objRef)
+		}
+	}
+	return nil
+}
+
+func (a *Applier) deleteObject(mapping *meta.RESTMapping, namespace, name string) error {
+	policy := metav1.DeletePropagationBackground
+	err := a.resource(mapping, namespace).Delete(name, &metav1.DeleteOptions{PropagationPolicy: &policy})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// WaitRollout waits the Deployments, DaemonSets and StatefulSets in refs are rolled out
+func (a *Applier) WaitRollout(refs []ObjectReference, timeout time.Duration) error {
+	for _, ref := range refs {
+		gvk := ref.GroupVersionKind()
+		if !rolloutKinds[gvk.GroupKind()] {
+			continue
+		}
+		mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+		statusViewer, err := polymorphichelpers.StatusViewerFn(mapping)
+		if err != nil {
+			return err
+		}
+		ri := a.resource(mapping, ref.Namespace)
+		var lastStatus string
+		err = wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+			obj, err := ri.Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			status, done, err := statusViewer.Status(obj, 0)
+			if err != nil {
+				return false, err
+			}
+			if status != lastStatus {
+				log.Infof("%s status: %s", ref, strings.TrimSpace(status))
+				lastStatus = status
+			}
+			return done, nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "wait for %s rollout", ref)
+		}
+	}
+	return nil
+}
+
+func (a *Applier) resource(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return a.dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return a.dynamicClient.Resource(mapping.Resource)
+}
+
+// restMapping returns the mapping of gvk, the kinds defined by just applied CRDs
+// are waited until served by resetting the discovery cache
+func (a *Applier) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	resetter, ok := a.mapper.(resettableRESTMapper)
+	if !ok {
+		return nil, err
+	}
+	lastErr := err
+	err = wait.PollImmediate(time.Second, mappingTimeout, func() (bool, error) {
+		resetter.Reset()
+		mapping, lastErr = a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if lastErr == nil {
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, lastErr
+	}
+	return mapping, nil
+}
@@ -0,0 +1,198 @@
+package kube
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var (
+	configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []ObjectReference
+		wantErr  bool
+	}{
+		{
+			name: "multiple documents",
+			manifest: `
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo
+---
+# comment only
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: foo
+`,
+			want: []ObjectReference{
+				{APIVersion: "v1", Kind: "Namespace", Name: "foo"},
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "foo", Name: "a"},
+			},
+		},
+		{
+			name: "list",
+			manifest: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: a
+`,
+			want: []ObjectReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "a"},
+			},
+		},
+		{
+			name: "missing name",
+			manifest: `
+apiVersion: v1
+kind: ConfigMap
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := ParseManifest(tt.manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := []ObjectReference{}
+			for _, obj := range objs {
+				got = append(got, NewObjectReference(obj))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseManifest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newFakeApplier(objects ...runtime.Object) (*Applier, *fake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	applier := NewApplier(client, mapper, "test")
+	// the fake client doesn't support apply patches
+	applier.serverSideApply = false
+	return applier, client
+}
+
+func newConfigMap(namespace, name string, objLabels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(objLabels)
+	return obj
+}
+
+func TestApplierApplyAndPrune(t *testing.T) {
+	selector := map[string]string{"addon": "test"}
+	// objects not owned by the addon are never pruned
+	applier, client := newFakeApplier(newConfigMap("default", "other", map[string]string{"addon": "other"}))
+
+	v1Refs, err := applier.Apply(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: foo
+data:
+  key: v1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`, map[string]string{"addon": "test", "version": "v1"})
+	if err != nil {
+		t.Fatalf("Apply() v1 error = %v", err)
+	}
+	wantRefs := []ObjectReference{
+		{APIVersion: "v1", Kind: "Namespace", Name: "foo"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "foo", Name: "a"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "b"},
+	}
+	if !reflect.DeepEqual(v1Refs, wantRefs) {
+		t.Fatalf("Apply() v1 = %v, want %v", v1Refs, wantRefs)
+	}
+
+	v2Refs, err := applier.Apply(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: foo
+data:
+  key: v2
+`, map[string]string{"addon": "test", "version": "v2"})
+	if err != nil {
+		t.Fatalf("Apply() v2 error = %v", err)
+	}
+	if err := applier.Prune(selector, append(v1Refs, v2Refs...), v2Refs); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	a, err := client.Resource(configMapsGVR).Namespace("foo").Get("a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get applied ConfigMap error = %v", err)
+	}
+	if data, _, _ := unstructured.NestedString(a.Object, "data", "key"); data != "v2" {
+		t.Errorf("ConfigMap data key = %q, want v2", data)
+	}
+	if version := a.GetLabels()["version"]; version != "v2" {
+		t.Errorf("ConfigMap version label = %q, want v2", version)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("default").Get("b", metav1.GetOptions{}); err == nil {
+		t.Errorf("ConfigMap b removed from manifest should be pruned")
+	}
+	ns, err := client.Resource(namespacesGVR).Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("Namespace foo removed from manifest shouldn't be pruned: %v", err)
+	} else if _, ok := ns.GetLabels()["addon"]; ok {
+		t.Errorf("Namespace foo shouldn't be labeled, got %v", ns.GetLabels())
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("default").Get("other", metav1.GetOptions{}); err != nil {
+		t.Errorf("ConfigMap of other addon shouldn't be pruned: %v", err)
+	}
+
+	if err := applier.Prune(selector, v2Refs, nil); err != nil {
+		t.Fatalf("Prune() all error = %v", err)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("foo").Get("a", metav1.GetOptions{}); err == nil {
+		t.Errorf("ConfigMap a should be pruned")
+	}
+	if _, err := client.Resource(namespacesGVR).Get("foo", metav1.GetOptions{}); err != nil {
+		t.Errorf("Namespace foo shouldn't be pruned with all the objects: %v", err)
+	}
+}
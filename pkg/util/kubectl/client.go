@@ -76,12 +76,12 @@ func (c *Client) removeKubeconfigFile() error {
 	return os.Remove(c.kubeconfigFile)
 }
 
-func (c *Client) kubectlManifestCmd(commandName, manifest string) error {
-	cmd := exec.Command("kubectl", c.buildKubectlArgs(commandName)...)
+func (c *Client) kubectlManifestCmd(commandName, manifest string, extraArgs ...string) error {
+	cmd := exec.Command("kubectl", append(c.buildKubectlArgs(commandName), extraArgs...)...)
 	cmd.Stdin = strings.NewReader(manifest)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("couldn't kubectl apply, output: %s, error: %v", string(output), err)
+		return fmt.Errorf("couldn't kubectl %s, output: %s, error: %v", commandName, string(output), err)
 	}
 	return nil
 }
@@ -188,7 +188,7 @@ func (c *Client) Exec(podName, container, namespace string, commands []string) *
 }
 
 func (c *Client) kubectlDelete(manifest string) error {
-	return c.kubectlManifestCmd("delete", manifest)
+	return c.kubectlManifestCmd("delete", manifest, "--ignore-not-found")
 }
 
 func (c *Client) kubectlApply(manifest string) error {
@@ -227,7 +227,7 @@ func (c *Client) waitForKubectlLabel(resource, resourceName, label string) error
 		klog.V(1).Infof("Waiting for kubectl label")
 		err := c.kubectlLabel(resource, resourceName, label)
 		if err != nil {
-			klog.Warning("Waiting for kubectl label error %s", err)
+			klog.Warningf("Waiting for kubectl label error %s", err)
 			return false, err
 		}
 		return true, nil
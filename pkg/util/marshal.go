@@ -1,17 +1,90 @@
 package util
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 
 	"yunion.io/x/ocadm/pkg/apis/constants"
 )
 
 var (
-	SplitYAMLDocuments       = kubeadmutil.SplitYAMLDocuments
 	GroupVersionKindsHasKind = kubeadmutil.GroupVersionKindsHasKind
 )
 
+// SplitYAMLDocuments reads the YAML bytes per-document, unmarshals the TypeMeta information from each document
+// and returns a map between the GroupVersionKind of the document and the document bytes.
+// Unlike kubeadm, the same kind is allowed in different groups, e.g. ocadm and kubeadm InitConfiguration.
+func SplitYAMLDocuments(yamlBytes []byte) (map[schema.GroupVersionKind][]byte, error) {
+	gvkmap := map[schema.GroupVersionKind][]byte{}
+	knownKinds := map[schema.GroupKind]bool{}
+	errs := []error{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewBuffer(yamlBytes)))
+	for {
+		typeMetaInfo := runtime.TypeMeta{}
+		// Read one YAML document at a time, until io.EOF is returned
+		b, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(b) == 0 {
+			break
+		}
+		if err := yaml.Unmarshal(b, &typeMetaInfo); err != nil {
+			return nil, err
+		}
+		if len(typeMetaInfo.APIVersion) == 0 || len(typeMetaInfo.Kind) == 0 {
+			errs = append(errs, errors.New("invalid configuration: kind and apiVersion is mandatory information that needs to be specified in all YAML documents"))
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(typeMetaInfo.APIVersion)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "unable to parse apiVersion"))
+			continue
+		}
+		gvk := gv.WithKind(typeMetaInfo.Kind)
+		if known := knownKinds[gvk.GroupKind()]; known {
+			errs = append(errs, errors.Errorf("invalid configuration: kind %q of group %q is specified twice in YAML file", gvk.Kind, gvk.Group))
+			continue
+		}
+		knownKinds[gvk.GroupKind()] = true
+		gvkmap[gvk] = b
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return nil, err
+	}
+	return gvkmap, nil
+}
+
+// SplitYAMLDocumentsOfGroup splits the documents of the given group out of yamlBytes,
+// the rest documents are joined back so that they could be loaded by kubeadm.
+func SplitYAMLDocumentsOfGroup(yamlBytes []byte, group string) (map[schema.GroupVersionKind][]byte, []byte, error) {
+	gvkmap, err := SplitYAMLDocuments(yamlBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupDocs := map[schema.GroupVersionKind][]byte{}
+	restDocs := [][]byte{}
+	for gvk, content := range gvkmap {
+		if gvk.Group == group {
+			groupDocs[gvk] = content
+			continue
+		}
+		restDocs = append(restDocs, content)
+	}
+	return groupDocs, bytes.Join(restDocs, []byte(constants.YAMLDocumentSeparator)), nil
+}
+
 // GroupVersionKindsHasClusterConfiguration returns whether the following gvk slice contains a ClusterConfiguration object
 func GroupVersionKindsHasClusterConfiguration(gvks ...schema.GroupVersionKind) bool {
 	return GroupVersionKindsHasKind(gvks, constants.ClusterConfigurationKind)
@@ -21,3 +94,8 @@ func GroupVersionKindsHasClusterConfiguration(gvks ...schema.GroupVersionKind) b
 func GroupVersionKindsHasInitConfiguration(gvks ...schema.GroupVersionKind) bool {
 	return GroupVersionKindsHasKind(gvks, constants.InitConfigurationKind)
 }
+
+// GroupVersionKindsHasJoinConfiguration returns whether the following gvk slice contains a JoinConfiguration object
+func GroupVersionKindsHasJoinConfiguration(gvks ...schema.GroupVersionKind) bool {
+	return GroupVersionKindsHasKind(gvks, constants.JoinConfigurationKind)
+}
@@ -0,0 +1,260 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// dumpInsertBatchSize is the max rows count of a single INSERT statement in dump
+	dumpInsertBatchSize = 100
+)
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func escapeValue(val []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('\'')
+	for _, c := range val {
+		switch c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\032':
+			buf.WriteString(`\Z`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+func (conn *Connection) useDatabase(ctx context.Context, db string) (*sql.Conn, error) {
+	c, err := conn.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get database connection")
+	}
+	if _, err := c.ExecContext(ctx, fmt.Sprintf("USE %s", quoteIdentifier(db))); err != nil {
+		c.Close()
+		return nil, errors.Wrapf(err, "use database %s", db)
+	}
+	return c, nil
+}
+
+// queryer is implemented by *sql.DB and *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ListTables returns all the base tables of database db
+func (conn *Connection) ListTables(db string) ([]string, error) {
+	return listTables(context.Background(), conn.db, db)
+}
+
+func listTables(ctx context.Context, q queryer, db string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'", db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list tables of %s", db)
+	}
+	defer rows.Close()
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// GetDatabaseStats returns the number of base tables and the size of data and indexes of database db
+func (conn *Connection) GetDatabaseStats(db string) (tables int, size int64, err error) {
+	q := "SELECT COUNT(*), COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'"
+	if err := conn.db.QueryRow(q, db).Scan(&tables, &size); err != nil {
+		return 0, 0, errors.Wrapf(err, "get stats of %s", db)
+	}
+	return tables, size, nil
+}
+
+// CountTableRows returns the exact number of rows of each base table in database db
+func (conn *Connection) CountTableRows(db string) (map[string]int64, error) {
+	tables, err := conn.ListTables(db)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var rows int64
+		q := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", quoteIdentifier(db), quoteIdentifier(table))
+		if err := conn.db.QueryRow(q).Scan(&rows); err != nil {
+			return nil, errors.Wrapf(err, "count rows of %s.%s", db, table)
+		}
+		ret[table] = rows
+	}
+	return ret, nil
+}
+
+// DumpDatabase writes the schema and rows of all tables in database db to w as SQL statements,
+// each statement ends with ";" at the end of line, so it can be loaded back by RestoreDatabase or mysql client.
+// The tables are read in a consistent snapshot like mysqldump --single-transaction, so the database could be dumped
+// while the services are running.
+func (conn *Connection) DumpDatabase(db string, w io.Writer) error {
+	ctx := context.Background()
+	c, err := conn.useDatabase(ctx, db)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			c.ExecContext(ctx, "ROLLBACK")
+		}
+		c.Close()
+	}()
+	for _, q := range []string{
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err := c.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "start consistent snapshot of %s", db)
+		}
+	}
+	tables, err := listTables(ctx, c, db)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- ocadm dump of database %s\n", db)
+	fmt.Fprintf(bw, "SET NAMES utf8mb4;\n")
+	fmt.Fprintf(bw, "SET FOREIGN_KEY_CHECKS=0;\n")
+	for _, table := range tables {
+		if err := dumpTable(ctx, c, table, bw); err != nil {
+			return errors.Wrapf(err, "dump table %s.%s", db, table)
+		}
+	}
+	fmt.Fprintf(bw, "SET FOREIGN_KEY_CHECKS=1;\n")
+	if _, err := c.ExecContext(ctx, "COMMIT"); err != nil {
+		return errors.Wrapf(err, "commit consistent snapshot of %s", db)
+	}
+	committed = true
+	return bw.Flush()
+}
+
+func dumpTable(ctx context.Context, c *sql.Conn, table string, w io.Writer) error {
+	var name, createStmt string
+	if err := c.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s", quoteIdentifier(table))).Scan(&name, &createStmt); err != nil {
+		return errors.Wrap(err, "show create table")
+	}
+	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n", quoteIdentifier(table))
+	fmt.Fprintf(w, "%s;\n", createStmt)
+
+	rows, err := c.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", quoteIdentifier(table)))
+	if err != nil {
+		return errors.Wrap(err, "select rows")
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	vals := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	batch := make([]string, 0, dumpInsertBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "INSERT INTO %s VALUES %s;\n", quoteIdentifier(table), strings.Join(batch, ","))
+		batch = batch[:0]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return errors.Wrap(err, "scan row")
+		}
+		fields := make([]string, len(vals))
+		for i, val := range vals {
+			if val == nil {
+				fields[i] = "NULL"
+			} else {
+				fields[i] = escapeValue(val)
+			}
+		}
+		batch = append(batch, "("+strings.Join(fields, ",")+")")
+		if len(batch) >= dumpInsertBatchSize {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+// RestoreDatabase creates database db if not exists and executes the SQL statements read from r,
+// which is usually generated by DumpDatabase.
+func (conn *Connection) RestoreDatabase(db string, r io.Reader) error {
+	if err := conn.CreateDatabase(db); err != nil {
+		return errors.Wrapf(err, "create database %s", db)
+	}
+	ctx := context.Background()
+	c, err := conn.useDatabase(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	br := bufio.NewReader(r)
+	var stmt strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "read statement")
+		}
+		trimed := strings.TrimSpace(line)
+		if stmt.Len() == 0 && (trimed == "" || strings.HasPrefix(trimed, "--")) {
+			// skip empty line and comments between statements
+		} else {
+			stmt.WriteString(line)
+			if strings.HasSuffix(trimed, ";") {
+				q := strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";")
+				if _, err := c.ExecContext(ctx, q); err != nil {
+					return errors.Wrapf(err, "execute statement in database %s", db)
+				}
+				stmt.Reset()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return errors.Errorf("incomplete statement at the end of %s dump", db)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fakeDriver is an in-memory database/sql driver understanding the statements used by DumpDatabase,
+// RestoreDatabase and CountTableRows, the INSERT values are parsed by the escaping rules of mysql
+type fakeDriver struct{}
+
+type fakeTable struct {
+	create  string
+	columns []string
+	rows    [][]driver.Value
+	// broken tables fail to be selected
+	broken bool
+}
+
+type fakeServer struct {
+	lock      sync.Mutex
+	databases map[string]map[string]*fakeTable
+	// statements are all the executed statements and queries
+	statements []string
+}
+
+var (
+	fakeServersLock sync.Mutex
+	fakeServers     = make(map[string]*fakeServer)
+
+	createTableColumnRegexp = regexp.MustCompile("(?m)^\\s*`([^`]+)`")
+)
+
+func init() {
+	sql.Register("ocadm-fake-mysql", fakeDriver{})
+}
+
+func newFakeConnection(t *testing.T, name string) (*Connection, *fakeServer) {
+	server := &fakeServer{databases: make(map[string]map[string]*fakeTable)}
+	fakeServersLock.Lock()
+	fakeServers[name] = server
+	fakeServersLock.Unlock()
+	db, err := sql.Open("ocadm-fake-mysql", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Connection{db: db}, server
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeServersLock.Lock()
+	defer fakeServersLock.Unlock()
+	server, ok := fakeServers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown fake server %s", name)
+	}
+	return &fakeConn{server: server}, nil
+}
+
+type fakeConn struct {
+	server *fakeServer
+	db     string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transaction isn't supported")
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.server.lock.Lock()
+	defer s.conn.server.lock.Unlock()
+	s.conn.server.statements = append(s.conn.server.statements, s.query)
+	return driver.RowsAffected(0), s.conn.exec(s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.server.lock.Lock()
+	defer s.conn.server.lock.Unlock()
+	s.conn.server.statements = append(s.conn.server.statements, s.query)
+	return s.conn.query(s.query, args)
+}
+
+func unquoteIdentifier(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.Replace(strings.TrimSuffix(strings.TrimPrefix(s, "`"), "`"), "``", "`", -1)
+}
+
+func (c *fakeConn) tables() (map[string]*fakeTable, error) {
+	tables, ok := c.server.databases[c.db]
+	if !ok {
+		return nil, errors.Errorf("no database selected or database %q doesn't exist", c.db)
+	}
+	return tables, nil
+}
+
+func (c *fakeConn) exec(query string) error {
+	switch {
+	case strings.HasPrefix(query, "SET "),
+		query == "START TRANSACTION WITH CONSISTENT SNAPSHOT",
+		query == "COMMIT",
+		query == "ROLLBACK":
+		return nil
+	case strings.HasPrefix(query, "USE "):
+		db := unquoteIdentifier(strings.TrimPrefix(query, "USE "))
+		if _, ok := c.server.databases[db]; !ok {
+			return errors.Errorf("unknown database %s", db)
+		}
+		c.db = db
+		return nil
+	case strings.HasPrefix(query, "CREATE DATABASE IF NOT EXISTS "):
+		db := unquoteIdentifier(strings.TrimPrefix(query, "CREATE DATABASE IF NOT EXISTS "))
+		if _, ok := c.server.databases[db]; !ok {
+			c.server.databases[db] = make(map[string]*fakeTable)
+		}
+		return nil
+	}
+	tables, err := c.tables()
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(query, "DROP TABLE IF EXISTS "):
+		delete(tables, unquoteIdentifier(strings.TrimPrefix(query, "DROP TABLE IF EXISTS ")))
+	case strings.HasPrefix(query, "CREATE TABLE "):
+		name := unquoteIdentifier(strings.Fields(query)[2])
+		table := &fakeTable{create: query}
+		for _, m := range createTableColumnRegexp.FindAllStringSubmatch(query, -1) {
+			table.columns = append(table.columns, m[1])
+		}
+		tables[name] = table
+	case strings.HasPrefix(query, "INSERT INTO "):
+		parts := strings.SplitN(strings.TrimPrefix(query, "INSERT INTO "), " VALUES ", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid insert statement %q", query)
+		}
+		table, ok := tables[unquoteIdentifier(parts[0])]
+		if !ok {
+			return errors.Errorf("table %s doesn't exist", parts[0])
+		}
+		rows, err := parseInsertValues(parts[1])
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if len(row) != len(table.columns) {
+				return errors.Errorf("row %v doesn't match columns %v", row, table.columns)
+			}
+		}
+		table.rows = append(table.rows, rows...)
+	default:
+		return errors.Errorf("unsupported statement %q", query)
+	}
+	return nil
+}
+
+func (c *fakeConn) query(query string, args []driver.Value) (driver.Rows, error) {
+	if strings.Contains(query, "INFORMATION_SCHEMA.TABLES") {
+		names := make([]string, 0)
+		for name := range c.server.databases[args[0].(string)] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		rows := &fakeRows{columns: []string{"TABLE_NAME"}}
+		for _, name := range names {
+			rows.values = append(rows.values, []driver.Value{[]byte(name)})
+		}
+		return rows, nil
+	}
+	if strings.HasPrefix(query, "SELECT COUNT(*) FROM ") {
+		ref := strings.SplitN(strings.TrimPrefix(query, "SELECT COUNT(*) FROM "), "`.`", 2)
+		table, ok := c.server.databases[unquoteIdentifier(ref[0]+"`")][unquoteIdentifier("`"+ref[1])]
+		if !ok {
+			return nil, errors.Errorf("table of %q doesn't exist", query)
+		}
+		return &fakeRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(len(table.rows))}}}, nil
+	}
+	tables, err := c.tables()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(query, "SHOW CREATE TABLE "):
+		name := unquoteIdentifier(strings.TrimPrefix(query, "SHOW CREATE TABLE "))
+		table, ok := tables[name]
+		if !ok {
+			return nil, errors.Errorf("table %s doesn't exist", name)
+		}
+		return &fakeRows{columns: []string{"Table", "Create Table"}, values: [][]driver.Value{{[]byte(name), []byte(table.create)}}}, nil
+	case strings.HasPrefix(query, "SELECT * FROM "):
+		name := unquoteIdentifier(strings.TrimPrefix(query, "SELECT * FROM "))
+		table, ok := tables[name]
+		if !ok {
+			return nil, errors.Errorf("table %s doesn't exist", name)
+		}
+		if table.broken {
+			return nil, errors.Errorf("table %s is broken", name)
+		}
+		return &fakeRows{columns: table.columns, values: table.rows}, nil
+	}
+	return nil, errors.Errorf("unsupported query %q", query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
+
+// parseInsertValues parses the tuples of INSERT statement, values are NULL or quoted strings
+func parseInsertValues(s string) ([][]driver.Value, error) {
+	rows := make([][]driver.Value, 0)
+	i := 0
+	expect := func(c byte) error {
+		if i >= len(s) || s[i] != c {
+			return errors.Errorf("expect %q at %d of %q", c, i, s)
+		}
+		i++
+		return nil
+	}
+	for {
+		if err := expect('('); err != nil {
+			return nil, err
+		}
+		row := make([]driver.Value, 0)
+		for {
+			if strings.HasPrefix(s[i:], "NULL") {
+				row = append(row, nil)
+				i += len("NULL")
+			} else {
+				if err := expect('\''); err != nil {
+					return nil, err
+				}
+				var val bytes.Buffer
+				for ; i < len(s) && s[i] != '\''; i++ {
+					if s[i] != '\\' {
+						val.WriteByte(s[i])
+						continue
+					}
+					i++
+					if i >= len(s) {
+						return nil, errors.Errorf("unterminated escape in %q", s)
+					}
+					escaped := map[byte]byte{'0': 0, 'n': '\n', 'r': '\r', 'Z': '\032'}
+					if c, ok := escaped[s[i]]; ok {
+						val.WriteByte(c)
+					} else {
+						val.WriteByte(s[i])
+					}
+				}
+				if err := expect('\''); err != nil {
+					return nil, err
+				}
+				row = append(row, append([]byte{}, val.Bytes()...))
+			}
+			if i < len(s) && s[i] == ',' {
+				i++
+				continue
+			}
+			break
+		}
+		if err := expect(')'); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+		if i == len(s) {
+			return rows, nil
+		}
+		if err := expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestDumpAndRestoreDatabase(t *testing.T) {
+	src, srcServer := newFakeConnection(t, "source")
+	defer src.Close()
+	dst, dstServer := newFakeConnection(t, "target")
+	defer dst.Close()
+
+	tricky := []string{
+		"plain",
+		"it's \"quoted\"",
+		`back\slash`,
+		"multi\nline;\r\nstatement;",
+		"nul\x00byte and \032",
+		"emoji 😀 and 中文",
+		"",
+	}
+	users := &fakeTable{
+		create:  "CREATE TABLE `user` (\n  `id` int(11) NOT NULL,\n  `name` varchar(255) DEFAULT NULL,\n  `note` text\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		columns: []string{"id", "name", "note"},
+	}
+	// more rows than dumpInsertBatchSize to be split into several INSERT statements
+	for i := 0; i < dumpInsertBatchSize*2+5; i++ {
+		var note driver.Value
+		if i%3 != 0 {
+			note = []byte(tricky[i%len(tricky)])
+		}
+		users.rows = append(users.rows, []driver.Value{[]byte(fmt.Sprintf("%d", i)), []byte(tricky[i%len(tricky)]), note})
+	}
+	srcServer.databases["keystone"] = map[string]*fakeTable{
+		"user":  users,
+		"empty": {create: "CREATE TABLE `empty` (\n  `id` int(11) NOT NULL\n)", columns: []string{"id"}},
+	}
+
+	dump := new(bytes.Buffer)
+	if err := src.DumpDatabase("keystone", dump); err != nil {
+		t.Fatalf("DumpDatabase() error = %v", err)
+	}
+	checkDumpInSnapshot(t, srcServer.statements)
+	if err := dst.RestoreDatabase("keystone", bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("RestoreDatabase() error = %v\n%s", err, dump.String())
+	}
+	if !reflect.DeepEqual(dstServer.databases["keystone"], srcServer.databases["keystone"]) {
+		t.Errorf("restored database differs from source, dump:\n%s", dump.String())
+	}
+
+	counts, err := dst.CountTableRows("keystone")
+	if err != nil {
+		t.Fatalf("CountTableRows() error = %v", err)
+	}
+	if want := map[string]int64{"user": int64(len(users.rows)), "empty": 0}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("CountTableRows() = %v, want %v", counts, want)
+	}
+
+	truncated := dump.Bytes()[:bytes.LastIndex(dump.Bytes(), []byte("INSERT"))+20]
+	if err := dst.RestoreDatabase("truncated", bytes.NewReader(truncated)); err == nil {
+		t.Errorf("RestoreDatabase() of truncated dump should fail")
+	}
+}
+
+// checkDumpInSnapshot checks the tables are listed and read in a consistent snapshot transaction
+func checkDumpInSnapshot(t *testing.T, statements []string) {
+	index := func(prefix string) int {
+		for i, stmt := range statements {
+			if strings.HasPrefix(stmt, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("%q isn't executed in %v", prefix, statements)
+		return -1
+	}
+	isolation := index("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+	start := index("START TRANSACTION WITH CONSISTENT SNAPSHOT")
+	list := index("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES")
+	read := index("SELECT * FROM")
+	commit := index("COMMIT")
+	if !(isolation < start && start < list && list < read && read < commit) {
+		t.Errorf("tables aren't dumped in a consistent snapshot: %v", statements)
+	}
+	if commit != len(statements)-1 {
+		t.Errorf("statements after commit: %v", statements[commit+1:])
+	}
+}
+
+func TestDumpDatabaseRollback(t *testing.T) {
+	conn, server := newFakeConnection(t, "rollback")
+	defer conn.Close()
+	server.databases["keystone"] = map[string]*fakeTable{
+		"user": {create: "CREATE TABLE `user` (\n  `id` int(11) NOT NULL\n)", columns: []string{"id"}, broken: true},
+	}
+	if err := conn.DumpDatabase("keystone", new(bytes.Buffer)); err == nil {
+		t.Fatalf("DumpDatabase() of broken table should fail")
+	}
+	if last := server.statements[len(server.statements)-1]; last != "ROLLBACK" {
+		t.Errorf("failed dump should rollback the snapshot transaction, last statement %q", last)
+	}
+}
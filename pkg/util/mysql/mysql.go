@@ -3,13 +3,14 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 
 	apis "yunion.io/x/ocadm/pkg/apis/v1"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 var (
@@ -22,6 +23,14 @@ type Connection struct {
 	Port     int
 	Username string
 	Password string
+
+	version *ServerVersion
+}
+
+// statement is a SQL statement with placeholders and its arguments
+type statement struct {
+	query string
+	args  []interface{}
 }
 
 func NewConnection(info *apis.MysqlConnection) (*Connection, error) {
@@ -29,7 +38,24 @@ func NewConnection(info *apis.MysqlConnection) (*Connection, error) {
 	port := info.Port
 	username := info.Username
 	password := info.Password
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/", username, password, host, port))
+	cfg := mysql.NewConfig()
+	cfg.User = username
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	// account management statements can't be prepared with placeholders,
+	// let the driver escape and interpolate the arguments instead
+	cfg.InterpolateParams = true
+	cfg.Timeout = info.ConnectTimeout
+	cfg.ReadTimeout = info.ReadTimeout
+	// info.Charset is only for the connections of services, ocadm keeps the utf8mb4 default
+	// of driver so dumps and restores never lose 4-byte characters
+	tlsName, err := tlsConfigName(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS config")
+	}
+	cfg.TLSConfig = tlsName
+	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, errors.Wrap(err, "Connect to database")
 	}
@@ -66,11 +92,13 @@ func (conn *Connection) IsDatabaseExists(db string) (bool, error) {
 
 func (conn *Connection) IsUserExists(username string, host string) (bool, error) {
 	var count int
-	q := fmt.Sprintf("SELECT COUNT(*) FROM mysql.user WHERE user = '%s'", username)
+	q := "SELECT COUNT(*) FROM mysql.user WHERE user = ?"
+	args := []interface{}{username}
 	if len(host) != 0 {
-		q = fmt.Sprintf("%s and host = '%s'", q, host)
+		q += " AND host = ?"
+		args = append(args, host)
 	}
-	if err := conn.db.QueryRow(q).Scan(&count); err != nil {
+	if err := conn.db.QueryRow(q, args...).Scan(&count); err != nil {
 		return false, errors.Wrapf(err, "check user %s@%s exists", username, host)
 	}
 	if count > 0 {
@@ -100,15 +128,55 @@ func (conn *Connection) DropUserByHost(username string, address string) error {
 	if !exists {
 		return nil
 	}
-	userIdx := fmt.Sprintf("'%s'", username)
 	if len(address) > 0 {
-		userIdx = fmt.Sprintf("%s@'%s'", userIdx, address)
+		_, err = conn.db.Exec("DROP USER ?@?", username, address)
+	} else {
+		_, err = conn.db.Exec("DROP USER ?", username)
 	}
-	q := fmt.Sprintf("DROP USER %s", userIdx)
-	_, err = conn.db.Exec(q)
 	return err
 }
 
+// ServerVersion returns the flavor and version of server, which is queried once and cached
+func (conn *Connection) ServerVersion() (ServerVersion, error) {
+	if conn.version != nil {
+		return *conn.version, nil
+	}
+	version, err := conn.GetVersion()
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	v, err := ParseServerVersion(version)
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	conn.version = &v
+	return v, nil
+}
+
+// grantStatements returns the statements creating user@address with password and granting all privileges on
+// database to it. The password of existing user is reset, servers without CREATE USER IF NOT EXISTS fall back
+// to GRANT ... IDENTIFIED BY, which is rejected since MySQL 8.
+func grantStatements(v ServerVersion, username, password, database, address string) []statement {
+	on := "*.*"
+	if database != "*" {
+		on = quoteIdentifier(database) + ".*"
+	}
+	if !v.SupportsCreateUserIfNotExists() {
+		return []statement{
+			{fmt.Sprintf("GRANT ALL ON %s TO ?@? IDENTIFIED BY ?", on), []interface{}{username, address, password}},
+		}
+	}
+	setPassword := statement{"ALTER USER ?@? " + v.identifiedBy(), []interface{}{username, address, password}}
+	if !v.SupportsAlterUser() {
+		setPassword = statement{"SET PASSWORD FOR ?@? = PASSWORD(?)", []interface{}{username, address, password}}
+	}
+	return []statement{
+		{"CREATE USER IF NOT EXISTS ?@? " + v.identifiedBy(), []interface{}{username, address, password}},
+		setPassword,
+		{fmt.Sprintf("GRANT ALL ON %s TO ?@?", on), []interface{}{username, address}},
+	}
+}
+
 func (conn *Connection) Grant(username string, password string, database string, address string) error {
 	if address == "" {
 		address = "%"
@@ -116,19 +184,25 @@ func (conn *Connection) Grant(username string, password string, database string,
 	if database == "" {
 		database = "*"
 	}
-	_, err := conn.db.Exec(fmt.Sprintf("GRANT ALL ON %s.* to '%s'@'%s' IDENTIFIED BY '%s'", database, username, address, password))
-	return err
+	v, err := conn.ServerVersion()
+	if err != nil {
+		return errors.Wrap(err, "get server version")
+	}
+	for _, stmt := range grantStatements(v, username, password, database, address) {
+		if _, err := conn.db.Exec(stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// CreateUser creates user of all hosts with password, or resets the password of existing user,
+// and grants all privileges on database to it
 func (conn *Connection) CreateUser(username string, password string, database string) error {
 	if database == "" {
 		database = "*"
 	}
-	addrs := AllHosts
-	if err := conn.DropUser(username); err != nil {
-		return errors.Wrapf(err, "Delete user %s", username)
-	}
-	for _, addr := range addrs {
+	for _, addr := range AllHosts {
 		if err := conn.Grant(username, password, database, addr); err != nil {
 			return errors.Wrapf(err, "Grant user %s@%s to database %s", username, addr, database)
 		}
@@ -137,37 +211,80 @@ func (conn *Connection) CreateUser(username string, password string, database st
 }
 
 func (conn *Connection) CreateDatabase(db string) error {
-	_, err := conn.db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", db))
+	_, err := conn.db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteIdentifier(db)))
 	return err
 }
 
 func (conn *Connection) DropDatabase(db string) error {
-	_, err := conn.db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", db))
+	_, err := conn.db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteIdentifier(db)))
 	return err
 }
 
 func (conn *Connection) IsGrantPrivUser(user string, host string) (bool, error) {
-	grant, err := conn.ShowGrants(user, host)
+	grants, err := conn.ShowGrants(user, host)
 	if err != nil {
 		return false, err
 	}
-	if strings.Contains(grant, "WITH GRANT OPTION") {
-		return true, nil
+	for _, grant := range grants {
+		if strings.Contains(grant, "WITH GRANT OPTION") {
+			return true, nil
+		}
 	}
 	return false, nil
 }
 
-func (conn *Connection) ShowGrants(user string, host string) (string, error) {
+// ShowGrants returns all the grant statements of user@host, MySQL 8 splits privileges into multiple statements
+func (conn *Connection) ShowGrants(user string, host string) ([]string, error) {
 	if host == "" {
 		host = "%"
 	}
-	q := fmt.Sprintf("SHOW GRANTS FOR '%s'@'%s'", user, host)
-	var ret string
-	if err := conn.db.QueryRow(q).Scan(&ret); err != nil {
-		return "", errors.Wrapf(err, "show grants for %s@%s", user, host)
+	rows, err := conn.db.Query("SHOW GRANTS FOR ?@?", user, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "show grants for %s@%s", user, host)
+	}
+	defer rows.Close()
+	grants := make([]string, 0)
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, errors.Wrapf(err, "show grants for %s@%s", user, host)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// GetVersion returns the server version string, e.g. 5.7.30-log or 10.3.27-MariaDB
+func (conn *Connection) GetVersion() (string, error) {
+	var version string
+	if err := conn.db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return "", errors.Wrap(err, "select version")
 	}
-	return ret, nil
+	return version, nil
+}
 
+// GetVariable returns the global value of server variable name, exists is false if server doesn't have it
+func (conn *Connection) GetVariable(name string) (value string, exists bool, err error) {
+	var varName string
+	if err := conn.db.QueryRow("SHOW GLOBAL VARIABLES LIKE ?", name).Scan(&varName, &value); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "show variable %s", name)
+	}
+	return value, true, nil
+}
+
+// GetSSLCipher returns the cipher of current session, empty if the connection isn't encrypted
+func (conn *Connection) GetSSLCipher() (string, error) {
+	var name, cipher string
+	if err := conn.db.QueryRow("SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "show status Ssl_cipher")
+	}
+	return cipher, nil
 }
 
 func (conn *Connection) Close() error {
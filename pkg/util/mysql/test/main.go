@@ -4,6 +4,7 @@ import (
 	"flag"
 	"log"
 
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
 	"yunion.io/x/ocadm/pkg/util/mysql"
 )
 
@@ -17,7 +18,12 @@ var (
 
 func main() {
 	flag.Parse()
-	conn, err := mysql.NewConnection(*host, *port, *user, *password)
+	conn, err := mysql.NewConnection(&apis.MysqlConnection{
+		Server:   *host,
+		Port:     *port,
+		Username: *user,
+		Password: *password,
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -25,6 +31,11 @@ func main() {
 		log.Fatalf("Not health: %v", err)
 	}
 	log.Printf("Health ok.")
+	version, err := conn.ServerVersion()
+	if err != nil {
+		log.Fatalf("Get server version: %v", err)
+	}
+	log.Printf("Server version: %s", version)
 	exists, err := conn.IsDatabaseExists(*db)
 	if err != nil {
 		log.Fatalf("Check exists error: %v", err)
@@ -40,6 +51,10 @@ func main() {
 	if err := conn.CreateUser(testUser, testPass, testDB); err != nil {
 		log.Fatalf("Create user: %v", err)
 	}
+	// create again to reset password of the existing user
+	if err := conn.CreateUser(testUser, testPass, testDB); err != nil {
+		log.Fatalf("Create existing user: %v", err)
+	}
 	if err := conn.DropDatabase(testDB); err != nil {
 		log.Fatalf("Drop database: %v", err)
 	}
@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+)
+
+// TLSConfig builds the client TLS config of the connection info, nil is returned if TLS is disabled
+// or it's only preferred, which is handled by the driver itself
+func TLSConfig(info *apis.MysqlConnection) (*tls.Config, error) {
+	mode := info.TLSMode
+	if !mode.IsEnabled() || mode == apis.MysqlTLSPreferred {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	if len(info.CertFile) != 0 || len(info.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(info.CertFile, info.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	var roots *x509.CertPool
+	if len(info.CAFile) != 0 {
+		pem, err := ioutil.ReadFile(info.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca file")
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in ca file %s", info.CAFile)
+		}
+	}
+	switch mode {
+	case apis.MysqlTLSRequired:
+		cfg.InsecureSkipVerify = true
+	case apis.MysqlTLSVerifyCA:
+		// verify the chain only, the server certificate may not contain the host name we connect to
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChain(roots)
+	case apis.MysqlTLSVerifyIdentity:
+		cfg.RootCAs = roots
+		cfg.ServerName = info.Server
+	default:
+		return nil, errors.Errorf("unsupported tls mode %q", mode)
+	}
+	return cfg, nil
+}
+
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server doesn't present any certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return errors.Wrap(err, "parse server certificate")
+			}
+			certs = append(certs, cert)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// tlsConfigName returns the value of driver tls parameter, custom config is registered to the driver by name
+func tlsConfigName(info *apis.MysqlConnection) (string, error) {
+	switch info.TLSMode {
+	case "", apis.MysqlTLSDisabled:
+		return "false", nil
+	case apis.MysqlTLSPreferred:
+		return "preferred", nil
+	}
+	cfg, err := TLSConfig(info)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("ocadm-%s-%d-%s", info.Server, info.Port, info.TLSMode)
+	if err := mysql.RegisterTLSConfig(name, cfg); err != nil {
+		return "", errors.Wrapf(err, "register tls config %s", name)
+	}
+	return name, nil
+}
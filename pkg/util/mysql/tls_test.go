@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	certutil "k8s.io/client-go/util/cert"
+	kubeadmpkiutil "k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
+
+	apis "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/util/pkiutil"
+)
+
+func newServerCert(t *testing.T, commonName string) (*x509.Certificate, *x509.Certificate) {
+	caCert, caKey, err := pkiutil.NewCertificateAuthority(&certutil.Config{CommonName: commonName + "-ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := pkiutil.NewCertAndKey(caCert, caKey, &certutil.Config{
+		CommonName: commonName,
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caCert, cert
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysql-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caCert, serverCert := newServerCert(t, "mysql")
+	otherCA, otherCert := newServerCert(t, "other")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, kubeadmpkiutil.EncodeCertPEM(caCert), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newInfo := func(mode apis.MysqlTLSMode, caFile string) *apis.MysqlConnection {
+		info := &apis.MysqlConnection{Server: "10.168.222.10", Port: 3306}
+		info.TLSMode = mode
+		info.CAFile = caFile
+		return info
+	}
+
+	for _, mode := range []apis.MysqlTLSMode{"", apis.MysqlTLSDisabled, apis.MysqlTLSPreferred} {
+		cfg, err := TLSConfig(newInfo(mode, ""))
+		if err != nil || cfg != nil {
+			t.Errorf("TLSConfig(%q) = %v, %v, want nil config", mode, cfg, err)
+		}
+	}
+
+	cfg, err := TLSConfig(newInfo(apis.MysqlTLSRequired, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.InsecureSkipVerify || cfg.VerifyPeerCertificate != nil {
+		t.Errorf("required mode shouldn't verify server certificate")
+	}
+
+	cfg, err = TLSConfig(newInfo(apis.MysqlTLSVerifyIdentity, caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.InsecureSkipVerify || cfg.RootCAs == nil || cfg.ServerName != "10.168.222.10" {
+		t.Errorf("verify-identity mode should verify server certificate and name, got %#v", cfg)
+	}
+
+	cfg, err = TLSConfig(newInfo(apis.MysqlTLSVerifyCA, caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{serverCert.Raw}, nil); err != nil {
+		t.Errorf("verify-ca mode should accept certificate signed by ca: %v", err)
+	}
+	if err := cfg.VerifyPeerCertificate([][]byte{otherCert.Raw, otherCA.Raw}, nil); err == nil {
+		t.Errorf("verify-ca mode should reject certificate signed by other ca")
+	}
+
+	if _, err := TLSConfig(newInfo(apis.MysqlTLSVerifyCA, filepath.Join(dir, "missing.pem"))); err == nil {
+		t.Errorf("TLSConfig with missing ca file should fail")
+	}
+}
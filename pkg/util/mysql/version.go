@@ -0,0 +1,85 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Flavor string
+
+const (
+	FlavorMySQL   Flavor = "MySQL"
+	FlavorMariaDB Flavor = "MariaDB"
+)
+
+var versionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// ServerVersion is the parsed result of 'SELECT VERSION()'
+type ServerVersion struct {
+	Flavor Flavor
+	Major  int
+	Minor  int
+	Patch  int
+}
+
+// ParseServerVersion parses the version string reported by server, e.g. 5.7.30-log or 10.3.27-MariaDB
+func ParseServerVersion(version string) (ServerVersion, error) {
+	// MariaDB 10.x may report version as 5.5.5-10.3.27-MariaDB through replication protocol
+	v := strings.TrimPrefix(version, "5.5.5-")
+	matches := versionRegexp.FindStringSubmatch(v)
+	if matches == nil {
+		return ServerVersion{}, errors.Errorf("unrecognized mysql version %q", version)
+	}
+	ret := ServerVersion{Flavor: FlavorMySQL}
+	if strings.Contains(strings.ToLower(v), "mariadb") {
+		ret.Flavor = FlavorMariaDB
+	}
+	ret.Major, _ = strconv.Atoi(matches[1])
+	ret.Minor, _ = strconv.Atoi(matches[2])
+	ret.Patch, _ = strconv.Atoi(matches[3])
+	return ret, nil
+}
+
+func (v ServerVersion) IsMariaDB() bool {
+	return v.Flavor == FlavorMariaDB
+}
+
+func (v ServerVersion) AtLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%s %d.%d.%d", v.Flavor, v.Major, v.Minor, v.Patch)
+}
+
+// SupportsCreateUserIfNotExists is true since MySQL 5.7 and MariaDB 10.1
+func (v ServerVersion) SupportsCreateUserIfNotExists() bool {
+	if v.IsMariaDB() {
+		return v.AtLeast(10, 1)
+	}
+	return v.AtLeast(5, 7)
+}
+
+// SupportsAlterUser is true since MySQL 5.7 and MariaDB 10.2, older servers change password by SET PASSWORD
+func (v ServerVersion) SupportsAlterUser() bool {
+	if v.IsMariaDB() {
+		return v.AtLeast(10, 2)
+	}
+	return v.AtLeast(5, 7)
+}
+
+// identifiedBy returns the password clause of CREATE USER and ALTER USER. MySQL 8 defaults to
+// caching_sha2_password, which isn't supported by all onecloud services, so native password is used explicitly.
+func (v ServerVersion) identifiedBy() string {
+	if !v.IsMariaDB() && v.AtLeast(8, 0) {
+		return "IDENTIFIED WITH mysql_native_password BY ?"
+	}
+	return "IDENTIFIED BY ?"
+}
@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    ServerVersion
+		wantErr bool
+	}{
+		{version: "5.6.51", want: ServerVersion{FlavorMySQL, 5, 6, 51}},
+		{version: "5.7.30-log", want: ServerVersion{FlavorMySQL, 5, 7, 30}},
+		{version: "8.0.21", want: ServerVersion{FlavorMySQL, 8, 0, 21}},
+		{version: "10.3.27-MariaDB", want: ServerVersion{FlavorMariaDB, 10, 3, 27}},
+		{version: "5.5.5-10.3.27-MariaDB-log", want: ServerVersion{FlavorMariaDB, 10, 3, 27}},
+		{version: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseServerVersion(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseServerVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseServerVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestGrantStatements(t *testing.T) {
+	args := []interface{}{"keystone", "%", "pass'word"}
+	grantArgs := []interface{}{"keystone", "%"}
+	tests := []struct {
+		name     string
+		version  string
+		database string
+		want     []statement
+	}{
+		{
+			name:     "mysql 5.6",
+			version:  "5.6.51",
+			database: "keystone",
+			want: []statement{
+				{"GRANT ALL ON `keystone`.* TO ?@? IDENTIFIED BY ?", args},
+			},
+		},
+		{
+			name:     "mysql 5.7",
+			version:  "5.7.30-log",
+			database: "keystone",
+			want: []statement{
+				{"CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", args},
+				{"ALTER USER ?@? IDENTIFIED BY ?", args},
+				{"GRANT ALL ON `keystone`.* TO ?@?", grantArgs},
+			},
+		},
+		{
+			name:     "mysql 8.0",
+			version:  "8.0.21",
+			database: "*",
+			want: []statement{
+				{"CREATE USER IF NOT EXISTS ?@? IDENTIFIED WITH mysql_native_password BY ?", args},
+				{"ALTER USER ?@? IDENTIFIED WITH mysql_native_password BY ?", args},
+				{"GRANT ALL ON *.* TO ?@?", grantArgs},
+			},
+		},
+		{
+			name:     "mariadb 10.1",
+			version:  "10.1.48-MariaDB",
+			database: "key`stone",
+			want: []statement{
+				{"CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", args},
+				{"SET PASSWORD FOR ?@? = PASSWORD(?)", args},
+				{"GRANT ALL ON `key``stone`.* TO ?@?", grantArgs},
+			},
+		},
+		{
+			name:     "mariadb 10.3",
+			version:  "10.3.27-MariaDB",
+			database: "keystone",
+			want: []statement{
+				{"CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", args},
+				{"ALTER USER ?@? IDENTIFIED BY ?", args},
+				{"GRANT ALL ON `keystone`.* TO ?@?", grantArgs},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := ParseServerVersion(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := grantStatements(v, "keystone", "pass'word", tt.database, "%")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("grantStatements() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
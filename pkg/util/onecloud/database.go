@@ -0,0 +1,54 @@
+package onecloud
+
+import (
+	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
+)
+
+// ServiceDBConfig is the database config used by an onecloud service
+type ServiceDBConfig struct {
+	Service string
+	onecloud.DBConfig
+}
+
+// GetServiceDBConfigs returns the databases recorded in OnecloudClusterConfig,
+// services without database configured are skipped.
+func GetServiceDBConfigs(cfg *onecloud.OnecloudClusterConfig) []ServiceDBConfig {
+	dbs := []ServiceDBConfig{
+		{"keystone", cfg.Keystone.DB},
+		{"region", cfg.RegionServer.DB},
+		{"glance", cfg.Glance.DB},
+		{"logger", cfg.Logger.DB},
+		{"yunionconf", cfg.Yunionconf.DB},
+		{"yunionagent", cfg.Yunionagent.DB},
+		{"kubeserver", cfg.KubeServer.DB},
+		{"ansibleserver", cfg.AnsibleServer.DB},
+		{"monitor", cfg.Monitor.DB},
+		{"cloudnet", cfg.Cloudnet.DB},
+		{"cloudproxy", cfg.Cloudproxy.DB},
+		{"cloudevent", cfg.Cloudevent.DB},
+		{"notify", cfg.Notify.DB},
+		{"devtool", cfg.Devtool.DB},
+		{"meter", cfg.Meter.DB},
+		{"itsm", cfg.Itsm.DB},
+		{"cloudid", cfg.CloudId.DB},
+		{"suggestion", cfg.Suggestion.DB},
+	}
+	if cfg.Itsm.SecondDatabase != "" {
+		dbs = append(dbs, ServiceDBConfig{
+			Service: "itsm",
+			DBConfig: onecloud.DBConfig{
+				Database: cfg.Itsm.SecondDatabase,
+				Username: cfg.Itsm.DB.Username,
+				Password: cfg.Itsm.DB.Password,
+			},
+		})
+	}
+	ret := make([]ServiceDBConfig, 0, len(dbs))
+	for _, db := range dbs {
+		if db.Database == "" {
+			continue
+		}
+		ret = append(ret, db)
+	}
+	return ret
+}
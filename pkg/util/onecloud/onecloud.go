@@ -21,11 +21,15 @@ import (
 	compute_modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
 	identity_modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
 	"yunion.io/x/onecloud/pkg/util/httputils"
+
+	"yunion.io/x/ocadm/pkg/util/sysinfo"
 )
 
 const (
 	NotFoundMsg  = "NotFoundError"
 	HostConfFile = "/etc/yunion/host.conf"
+
+	DefaultHostLocalImagePath = "/opt/cloud/workspace/disks"
 )
 
 func IsNotFoundError(err error) bool {
@@ -237,7 +241,7 @@ func CreateNetwork(
 }
 
 func NetworkPrivate(s *mcclient.ClientSession, name string) (jsonutils.JSONObject, error) {
-	return compute_modules.Networks.PerformAction(s, "private", name, nil)
+	return compute_modules.Networks.PerformAction(s, name, "private", nil)
 }
 
 func CreateRegion(s *mcclient.ClientSession, region, zone string) (jsonutils.JSONObject, error) {
@@ -375,7 +379,11 @@ func GetMemTotal() (int, error) {
 
 // 1G pdpe1gb
 func HasHugepageCpuFlag() bool {
-	return exec.Command("grep", "pdpe1gb", "/proc/cpuinfo").Run == nil
+	flags, err := sysinfo.HostRoot.CPUFlags()
+	if err != nil {
+		return false
+	}
+	return flags.Has("pdpe1gb")
 }
 
 func GenerateDefaultHostConfig(cfg *HostCfg, isControlPlane bool) error {
@@ -414,7 +422,7 @@ func GenerateDefaultHostConfig(cfg *HostCfg, isControlPlane bool) error {
 	o.ServersPath = "/opt/cloud/workspace/servers"
 	o.OvmfPath = "/opt/cloud/contrib/OVMF.fd"
 	if len(o.LocalImagePath) == 0 {
-		o.LocalImagePath = []string{"/opt/cloud/workspace/disks"}
+		o.LocalImagePath = []string{DefaultHostLocalImagePath}
 	}
 	o.ImageCachePath = "/opt/cloud/workspace/disks/image_cache"
 	o.AgentTempPath = "/opt/cloud/workspace/disks/agent_tmp"
@@ -1,17 +1,28 @@
 package onecloud
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"yunion.io/x/log"
 	"yunion.io/x/onecloud-operator/pkg/apis/constants"
 	onecloud "yunion.io/x/onecloud-operator/pkg/apis/onecloud/v1alpha1"
 	"yunion.io/x/onecloud-operator/pkg/client/clientset/versioned"
+
+	ocadmconstants "yunion.io/x/ocadm/pkg/apis/constants"
+	apiv1 "yunion.io/x/ocadm/pkg/apis/v1"
+	"yunion.io/x/ocadm/pkg/apis/v1beta1"
 )
 
+// ComponentsConfigMapName returns the name of ConfigMap storing the config of components managed by ocadm
+func ComponentsConfigMapName(oc *onecloud.OnecloudCluster) string {
+	return fmt.Sprintf("%s-%s", oc.GetName(), "cluster-components-config")
+}
+
 func SetOCUseCE(oc *onecloud.OnecloudCluster) *onecloud.OnecloudCluster {
 	if oc.Annotations == nil {
 		oc.Annotations = make(map[string]string)
@@ -28,6 +39,59 @@ func SetOCUseEE(oc *onecloud.OnecloudCluster) *onecloud.OnecloudCluster {
 	return oc
 }
 
+// CheckOperatorMysqlTLS returns error if opts requires TLS, the spec.mysql of onecloud-operator has no TLS
+// options, so the services it manages always connect mysql server without encryption
+func CheckOperatorMysqlTLS(opts apiv1.MysqlConnectionOptions) error {
+	if opts.TLSMode.IsEnabled() && opts.TLSMode != apiv1.MysqlTLSPreferred {
+		return errors.Errorf("TLS mode %s of mysql isn't supported by onecloud-operator, services can only connect without encryption, use %s or %s instead",
+			opts.TLSMode, apiv1.MysqlTLSDisabled, apiv1.MysqlTLSPreferred)
+	}
+	return nil
+}
+
+// SetMysqlOptionsAnnotation stores the mysql connection options into annotations, the annotation is
+// removed if no option is set
+func SetMysqlOptionsAnnotation(anno map[string]string, opts apiv1.MysqlConnectionOptions) error {
+	out := v1beta1.MysqlConnectionOptions{}
+	v1beta1.Convert_v1_MysqlConnectionOptions_To_v1beta1_MysqlConnectionOptions(&opts, &out, nil)
+	if out == (v1beta1.MysqlConnectionOptions{}) {
+		delete(anno, ocadmconstants.MysqlOptionsAnnotation)
+		return nil
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return errors.Wrap(err, "marshal mysql options")
+	}
+	anno[ocadmconstants.MysqlOptionsAnnotation] = string(data)
+	return nil
+}
+
+func SetOCMysqlOptions(oc *onecloud.OnecloudCluster, opts apiv1.MysqlConnectionOptions) error {
+	if oc.Annotations == nil {
+		oc.Annotations = make(map[string]string)
+	}
+	return SetMysqlOptionsAnnotation(oc.Annotations, opts)
+}
+
+// GetOCMysqlConnection returns the mysql connection of spec.mysql with options from annotation
+func GetOCMysqlConnection(oc *onecloud.OnecloudCluster) (*apiv1.MysqlConnection, error) {
+	conn := &apiv1.MysqlConnection{
+		Server:   oc.Spec.Mysql.Host,
+		Port:     int(oc.Spec.Mysql.Port),
+		Username: oc.Spec.Mysql.Username,
+		Password: oc.Spec.Mysql.Password,
+	}
+	if data, ok := oc.Annotations[ocadmconstants.MysqlOptionsAnnotation]; ok {
+		in := v1beta1.MysqlConnectionOptions{}
+		if err := json.Unmarshal([]byte(data), &in); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal annotation %s", ocadmconstants.MysqlOptionsAnnotation)
+		}
+		v1beta1.Convert_v1beta1_MysqlConnectionOptions_To_v1_MysqlConnectionOptions(&in, &conn.MysqlConnectionOptions, nil)
+	}
+	apiv1.SetDefaults_MysqlConnection(conn)
+	return conn, nil
+}
+
 func isDeploymentImageUpdated(
 	globalRepo string,
 	globalVersion string,
@@ -25,6 +25,8 @@ type Waiter interface {
 	apiclient.Waiter
 
 	WaitForServicePods(serviceName string) error
+	WaitForDeploymentReady(namespace string, name string) error
+	WaitForDaemonSetReady(namespace string, name string) error
 	WaitForKeystone() error
 	WaitForRegion() error
 	WaitForScheduler() error
@@ -98,6 +100,48 @@ func (w *OCWaiter) WaitForPodsWithLabel(kvLabel string) error {
 	})
 }
 
+// WaitForDeploymentReady waits until all the desired replicas of deployment are ready
+func (w *OCWaiter) WaitForDeploymentReady(namespace string, name string) error {
+	return w.waitForWorkloadReady(func() (int32, int32, error) {
+		dp, err := w.kubeClient.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "get deployment %s/%s", namespace, name)
+		}
+		desired := int32(1)
+		if dp.Spec.Replicas != nil {
+			desired = *dp.Spec.Replicas
+		}
+		return dp.Status.ReadyReplicas, desired, nil
+	})
+}
+
+// WaitForDaemonSetReady waits until the pods of daemonset are ready on all the scheduled nodes
+func (w *OCWaiter) WaitForDaemonSetReady(namespace string, name string) error {
+	return w.waitForWorkloadReady(func() (int32, int32, error) {
+		ds, err := w.kubeClient.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "get daemonset %s/%s", namespace, name)
+		}
+		return ds.Status.NumberReady, ds.Status.DesiredNumberScheduled, nil
+	})
+}
+
+func (w *OCWaiter) waitForWorkloadReady(getReplicas func() (int32, int32, error)) error {
+	var ready, desired int32
+	err := wait.PollImmediate(constants.APICallRetryInterval, w.timeout, func() (bool, error) {
+		var err error
+		ready, desired, err = getReplicas()
+		if err != nil {
+			return false, err
+		}
+		return ready >= desired, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("%d/%d ready after %s", ready, desired, w.timeout)
+	}
+	return err
+}
+
 func (w *OCWaiter) WaitForKeystone() error {
 	start := time.Now()
 	return wait.PollImmediate(constants.APICallRetryInterval, w.timeout, func() (bool, error) {
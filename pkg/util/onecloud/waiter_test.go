@@ -0,0 +1,89 @@
+package onecloud
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestWaitForWorkloadReady(t *testing.T) {
+	objects := []runtime.Object{
+		&appv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-keystone", Namespace: "onecloud"},
+			Spec:       appv1.DeploymentSpec{Replicas: int32Ptr(2)},
+			Status:     appv1.DeploymentStatus{ReadyReplicas: 2},
+		},
+		&appv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-region", Namespace: "onecloud"},
+			Status:     appv1.DeploymentStatus{ReadyReplicas: 0},
+		},
+		&appv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-host", Namespace: "onecloud"},
+			Status:     appv1.DaemonSetStatus{NumberReady: 3, DesiredNumberScheduled: 3},
+		},
+		&appv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-lbagent", Namespace: "onecloud"},
+			Status:     appv1.DaemonSetStatus{NumberReady: 1, DesiredNumberScheduled: 2},
+		},
+	}
+	w := NewOCWaiter(fake.NewSimpleClientset(objects...), nil, 100*time.Millisecond, ioutil.Discard)
+	tests := []struct {
+		name    string
+		wait    func(namespace string, name string) error
+		object  string
+		wantErr string
+	}{
+		{
+			name:   "ready deployment",
+			wait:   w.WaitForDeploymentReady,
+			object: "default-keystone",
+		},
+		{
+			name:    "unready deployment of default replicas",
+			wait:    w.WaitForDeploymentReady,
+			object:  "default-region",
+			wantErr: "0/1 ready",
+		},
+		{
+			name:    "missing deployment",
+			wait:    w.WaitForDeploymentReady,
+			object:  "default-glance",
+			wantErr: "get deployment onecloud/default-glance",
+		},
+		{
+			name:   "ready daemonset",
+			wait:   w.WaitForDaemonSetReady,
+			object: "default-host",
+		},
+		{
+			name:    "unready daemonset",
+			wait:    w.WaitForDaemonSetReady,
+			object:  "default-lbagent",
+			wantErr: "1/2 ready",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.wait("onecloud", tt.object)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("wait %s error = %v", tt.object, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("wait %s error = %v, want %q", tt.object, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -27,9 +27,14 @@ const (
 )
 
 var (
-	NewPrivateKey       = pkiutil.NewPrivateKey
-	TryLoadCertFromDisk = pkiutil.TryLoadCertFromDisk
-	TryLoadKeyFromDisk  = pkiutil.TryLoadKeyFromDisk
+	NewPrivateKey             = pkiutil.NewPrivateKey
+	NewCertificateAuthority   = pkiutil.NewCertificateAuthority
+	TryLoadCertFromDisk       = pkiutil.TryLoadCertFromDisk
+	TryLoadKeyFromDisk        = pkiutil.TryLoadKeyFromDisk
+	TryLoadCertAndKeyFromDisk = pkiutil.TryLoadCertAndKeyFromDisk
+	WriteCertAndKey           = pkiutil.WriteCertAndKey
+	CertOrKeyExist            = pkiutil.CertOrKeyExist
+	PathsForCertAndKey        = pkiutil.PathsForCertAndKey
 )
 
 // NewCertAndKey creates new certificate and key by passing the certificate authority certificate and key
@@ -60,6 +65,12 @@ func NewSignedCert(cfg *certutil.Config, key crypto.Signer, caCert *x509.Certifi
 		return nil, errors.New("must specify at least one ExtKeyUsage")
 	}
 
+	// the certificate can't outlive its CA
+	notAfter := time.Now().Add(duration365d * 10).UTC()
+	if caCert.NotAfter.Before(notAfter) {
+		notAfter = caCert.NotAfter
+	}
+
 	certTmpl := x509.Certificate{
 		Subject: pkix.Name{
 			CommonName:   cfg.CommonName,
@@ -69,7 +80,7 @@ func NewSignedCert(cfg *certutil.Config, key crypto.Signer, caCert *x509.Certifi
 		IPAddresses:  cfg.AltNames.IPs,
 		SerialNumber: serial,
 		NotBefore:    caCert.NotBefore,
-		NotAfter:     time.Now().Add(duration365d * 10).UTC(),
+		NotAfter:     notAfter,
 		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:  cfg.Usages,
 	}
@@ -80,6 +91,19 @@ func NewSignedCert(cfg *certutil.Config, key crypto.Signer, caCert *x509.Certifi
 	return x509.ParseCertificate(certDERBytes)
 }
 
+// CertToConfig returns the config to sign a new certificate with the same subject, SANs and usages of cert
+func CertToConfig(cert *x509.Certificate) *certutil.Config {
+	return &certutil.Config{
+		CommonName:   cert.Subject.CommonName,
+		Organization: cert.Subject.Organization,
+		AltNames: certutil.AltNames{
+			IPs:      cert.IPAddresses,
+			DNSNames: cert.DNSNames,
+		},
+		Usages: cert.ExtKeyUsage,
+	}
+}
+
 // GetServiceAltNames builds an AltNames object to be used when generating service certificate
 func GetServiceAltNames(cfg *apis.InitConfiguration, serviceName string, certName string) (*certutil.AltNames, error) {
 	// advertise address
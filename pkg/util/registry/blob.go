@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GetManifest fetches the manifest of reference in repository path, the reference is a tag or digest
+func (c *Client) GetManifest(registry, path, reference string) ([]byte, *ManifestDescriptor, error) {
+	resp, err := c.Do(registry, http.MethodGet, fmt.Sprintf("/v2/%s/manifests/%s", path, reference), manifestMediaTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil, errors.Wrapf(ErrManifestNotFound, "%s/%s:%s", registry, path, reference)
+	default:
+		return nil, nil, unexpectedStatus(resp, "get manifest %s/%s:%s", registry, path, reference)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read manifest")
+	}
+	return body, &ManifestDescriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      int64(len(body)),
+	}, nil
+}
+
+// GetBlob opens the blob of digest in repository path, the caller should close the reader
+func (c *Client) GetBlob(registry, path, digest string) (io.ReadCloser, error) {
+	resp, err := c.Do(registry, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", path, digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, unexpectedStatus(resp, "get blob %s of %s/%s", digest, registry, path)
+	}
+	return resp.Body, nil
+}
+
+// BlobExists checks whether the blob of digest is already in repository path
+func (c *Client) BlobExists(registry, path, digest string) (bool, error) {
+	resp, err := c.Do(registry, http.MethodHead, fmt.Sprintf("/v2/%s/blobs/%s", path, digest), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, unexpectedStatus(resp, "check blob %s of %s/%s", digest, registry, path)
+	}
+}
+
+// PushBlob uploads blob of digest to repository path with a monolithic upload
+func (c *Client) PushBlob(registry, path, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := c.Send(registry, &Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/v2/%s/blobs/uploads/", path),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		defer resp.Body.Close()
+		return unexpectedStatus(resp, "start upload to %s/%s", registry, path)
+	}
+	resp.Body.Close()
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return errors.Wrap(err, "parse upload location")
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.Send(registry, &Request{
+		Method:        http.MethodPut,
+		Path:          location.String(),
+		Header:        http.Header{"Content-Type": []string{"application/octet-stream"}},
+		Body:          open,
+		ContentLength: size,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return unexpectedStatus(resp, "upload blob %s to %s/%s", digest, registry, path)
+	}
+	return nil
+}
+
+// PutManifest uploads manifest as reference in repository path
+func (c *Client) PutManifest(registry, path, reference, mediaType string, manifest []byte) error {
+	resp, err := c.Send(registry, &Request{
+		Method: http.MethodPut,
+		Path:   fmt.Sprintf("/v2/%s/manifests/%s", path, reference),
+		Header: http.Header{"Content-Type": []string{mediaType}},
+		Body: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(manifest)), nil
+		},
+		ContentLength: int64(len(manifest)),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp, "put manifest %s/%s:%s", registry, path, reference)
+	}
+	return nil
+}
+
+func unexpectedStatus(resp *http.Response, format string, args ...interface{}) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("%s: unexpected status %s: %s", fmt.Sprintf(format, args...), resp.Status, strings.TrimSpace(string(body)))
+}
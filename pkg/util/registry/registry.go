@@ -0,0 +1,324 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestMediaTypes = []string{
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+}
+
+// ErrManifestNotFound is returned when the tag or digest of image not exists in registry
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// Reference is the location of an image in registry
+type Reference struct {
+	// Registry is the host of registry, e.g. registry.cn-beijing.aliyuncs.com
+	Registry string
+	// Path is the repository path in registry, e.g. yunionio/region
+	Path string
+	// Reference is the tag or digest of image
+	Reference string
+}
+
+// ParseReference parses docker image name to Reference
+func ParseReference(img string) (*Reference, error) {
+	named, err := reference.ParseNormalizedNamed(img)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse image %q", img)
+	}
+	named = reference.TagNameOnly(named)
+	ref := &Reference{
+		Registry: reference.Domain(named),
+		Path:     reference.Path(named),
+	}
+	if ref.Registry == dockerHubDomain {
+		ref.Registry = dockerHubRegistry
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref.Reference = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		ref.Reference = tagged.Tag()
+	}
+	return ref, nil
+}
+
+func (r Reference) String() string {
+	sep := ":"
+	if strings.Contains(r.Reference, ":") {
+		sep = "@"
+	}
+	return fmt.Sprintf("%s/%s%s%s", r.Registry, r.Path, sep, r.Reference)
+}
+
+// Client talks to docker registry HTTP API v2, anonymous bearer token is requested when registry asks for
+type Client struct {
+	client *http.Client
+	// insecureClient skips tls verification, it's only used for insecureRegistries
+	insecureClient *http.Client
+	// insecureRegistries are allowed falling back to plain http and skipping tls verification
+	insecureRegistries sets.String
+	Username           string
+	Password           string
+}
+
+// NewClient returns registry client, only the registries in insecureRegistries, e.g. 192.168.0.1:5000,
+// are allowed falling back to plain http and skipping tls verification
+func NewClient(timeout time.Duration, insecureRegistries ...string) *Client {
+	newHTTPClient := func(tlsConfig *tls.Config) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSHandshakeTimeout: 10 * time.Second,
+				TLSClientConfig:     tlsConfig,
+			},
+			Timeout: timeout,
+		}
+	}
+	return &Client{
+		client:             newHTTPClient(nil),
+		insecureClient:     newHTTPClient(&tls.Config{InsecureSkipVerify: true}),
+		insecureRegistries: sets.NewString(insecureRegistries...),
+	}
+}
+
+// IsInsecure returns true if registry is allowed plain http and skipping tls verification
+func (c *Client) IsInsecure(registry string) bool {
+	return c.insecureRegistries.Has(registry)
+}
+
+// httpClient returns the client requesting u, the insecure one is only used for insecure registries
+func (c *Client) httpClient(u string) *http.Client {
+	parsed, err := url.Parse(u)
+	if err == nil && c.IsInsecure(parsed.Host) {
+		return c.insecureClient
+	}
+	return c.client
+}
+
+// ManifestDescriptor describes the manifest resolved from registry
+type ManifestDescriptor struct {
+	MediaType string
+	Digest    string
+	Size      int64
+}
+
+// Resolve checks the image exists in registry and returns the descriptor of its manifest
+func (c *Client) Resolve(img string) (*ManifestDescriptor, error) {
+	ref, err := ParseReference(img)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(ref.Registry, http.MethodHead, fmt.Sprintf("/v2/%s/manifests/%s", ref.Path, ref.Reference), manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errors.Wrapf(ErrManifestNotFound, "%s", img)
+	default:
+		return nil, errors.Errorf("resolve %s: unexpected status %s", img, resp.Status)
+	}
+	return &ManifestDescriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Size:      resp.ContentLength,
+	}, nil
+}
+
+// Request is a request sent to registry
+type Request struct {
+	Method  string
+	Path    string
+	Accepts []string
+	Header  http.Header
+	// Body opens the request body, it may be called more than once since the request is retried for authorization
+	Body          func() (io.ReadCloser, error)
+	ContentLength int64
+}
+
+// Do sends request to registry, the bearer token challenge is handled
+func (c *Client) Do(registry string, method string, path string, accepts []string) (*http.Response, error) {
+	return c.Send(registry, &Request{Method: method, Path: path, Accepts: accepts})
+}
+
+// Send sends request to registry, the bearer token challenge is handled.
+// The Path of request could also be an absolute url returned by registry, e.g. the upload location.
+func (c *Client) Send(registry string, req *Request) (*http.Response, error) {
+	schemes := []string{"https"}
+	if c.IsInsecure(registry) {
+		schemes = append(schemes, "http")
+	}
+	var lastErr error
+	for _, scheme := range schemes {
+		u := req.Path
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			u = fmt.Sprintf("%s://%s%s", scheme, registry, req.Path)
+		}
+		resp, err := c.do(req, u, "")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		auth, err := c.authorize(challenge)
+		if err != nil {
+			return nil, errors.Wrapf(err, "authorize to %s", registry)
+		}
+		return c.do(req, u, auth)
+	}
+	return nil, errors.Wrapf(lastErr, "request %s%s", registry, req.Path)
+}
+
+func (c *Client) do(r *Request, u string, auth string) (*http.Response, error) {
+	var body io.ReadCloser
+	if r.Body != nil {
+		var err error
+		body, err = r.Body()
+		if err != nil {
+			return nil, errors.Wrap(err, "open request body")
+		}
+	}
+	req, err := http.NewRequest(r.Method, u, body)
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = r.ContentLength
+	}
+	for key, vals := range r.Header {
+		for _, val := range vals {
+			req.Header.Add(key, val)
+		}
+	}
+	for _, accept := range r.Accepts {
+		req.Header.Add("Accept", accept)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.httpClient(u).Do(req)
+}
+
+// authorize returns the Authorization header value for the WWW-Authenticate challenge
+func (c *Client) authorize(challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		req.SetBasicAuth(c.Username, c.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", errors.Errorf("unsupported auth challenge %q", challenge)
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return "", errors.Errorf("realm not found in challenge %q", challenge)
+	}
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if val, ok := params[key]; ok {
+			query.Set(key, val)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.httpClient(realm).Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "request token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", errors.Errorf("request token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "decode token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge parses WWW-Authenticate header like:
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for len(rest) > 0 {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				val, rest = rest, ""
+			} else {
+				val, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = val
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientInsecureRegistries(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:0123")
+		w.WriteHeader(http.StatusOK)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	selfSigned := httptest.NewTLSServer(handler)
+	defer selfSigned.Close()
+	plainHost := strings.TrimPrefix(plain.URL, "http://")
+	selfSignedHost := strings.TrimPrefix(selfSigned.URL, "https://")
+
+	tests := []struct {
+		name     string
+		insecure []string
+		host     string
+		wantErr  bool
+	}{
+		{"plain http refused", nil, plainHost, true},
+		{"self signed refused", nil, selfSignedHost, true},
+		{"other registry insecure", []string{selfSignedHost}, plainHost, true},
+		{"plain http allowed", []string{plainHost}, plainHost, false},
+		{"self signed allowed", []string{selfSignedHost}, selfSignedHost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(5*time.Second, tt.insecure...)
+			desc, err := client.Resolve(tt.host + "/yunionio/region:v3.8.5")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && desc.Digest != "sha256:0123" {
+				t.Errorf("Resolve() digest = %s, want sha256:0123", desc.Digest)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	DefaultPort    = 22
+	DefaultUser    = "root"
+	DefaultTimeout = 30 * time.Second
+)
+
+// DefaultKnownHostsFile returns the known_hosts file of current user
+func DefaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "/root"
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// knownHostsLock serializes the keys trusted on first use appended to known_hosts
+var knownHostsLock sync.Mutex
+
+// Config describes how to login a remote host
+type Config struct {
+	Host           string
+	Port           int
+	User           string
+	Password       string
+	PrivateKeyFile string
+	// Sudo runs the commands through sudo when login user is not root
+	Sudo    bool
+	Timeout time.Duration
+
+	// HostKeyFingerprint is the SHA256 fingerprint of host key, e.g. SHA256:xxx,
+	// the host key is verified by it instead of KnownHostsFile if set
+	HostKeyFingerprint string
+	// KnownHostsFile verifies the host key, defaults to ~/.ssh/known_hosts
+	KnownHostsFile string
+	// TrustOnFirstUse appends the key of host not in KnownHostsFile instead of failing,
+	// a host key mismatching the known one is always rejected
+	TrustOnFirstUse bool
+}
+
+// Client runs shell commands on remote host
+type Client struct {
+	config Config
+	client *ssh.Client
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.Port == 0 {
+		config.Port = DefaultPort
+	}
+	if config.User == "" {
+		config.User = DefaultUser
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.KnownHostsFile == "" {
+		config.KnownHostsFile = DefaultKnownHostsFile()
+	}
+	hostKeyCallback, err := HostKeyCallback(config)
+	if err != nil {
+		return nil, err
+	}
+	auths := make([]ssh.AuthMethod, 0)
+	if config.PrivateKeyFile != "" {
+		key, err := ioutil.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read private key %s", config.PrivateKeyFile)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse private key %s", config.PrivateKeyFile)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if config.Password != "" {
+		auths = append(auths, ssh.Password(config.Password))
+	}
+	if len(auths) == 0 {
+		return nil, errors.Errorf("no password or private key provided to login %s", config.Host)
+	}
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	cli, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         config.Timeout,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "ssh to %s@%s", config.User, addr)
+	}
+	return &Client{
+		config: config,
+		client: cli,
+	}, nil
+}
+
+// HostKeyCallback returns the callback verifying host key by config.HostKeyFingerprint or config.KnownHostsFile
+func HostKeyCallback(config Config) (ssh.HostKeyCallback, error) {
+	if config.HostKeyFingerprint != "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != config.HostKeyFingerprint {
+				return errors.Errorf("host key fingerprint %s of %s mismatches %s", fp, hostname, config.HostKeyFingerprint)
+			}
+			return nil
+		}, nil
+	}
+	filename := config.KnownHostsFile
+	if _, err := os.Stat(filename); err != nil {
+		if !os.IsNotExist(err) || !config.TrustOnFirstUse {
+			return nil, errors.Wrapf(err, "known hosts file %s", filename)
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return nil, errors.Wrapf(err, "create directory of %s", filename)
+		}
+		if err := ioutil.WriteFile(filename, nil, 0600); err != nil {
+			return nil, errors.Wrapf(err, "create %s", filename)
+		}
+	}
+	known, err := knownhosts.New(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load known hosts file %s", filename)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+		fp := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) != 0 {
+			return errors.Errorf("host key %s of %s mismatches the one in %s, the host may be impersonated", fp, hostname, filename)
+		}
+		if !config.TrustOnFirstUse {
+			return errors.Errorf("host key %s of %s isn't in %s, add it or set the fingerprint to trust it", fp, hostname, filename)
+		}
+		return appendKnownHost(filename, hostname, key)
+	}, nil
+}
+
+func appendKnownHost(filename string, hostname string, key ssh.PublicKey) error {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", filename)
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{hostname}, key)); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "append host key of %s to %s", hostname, filename)
+	}
+	return f.Close()
+}
+
+// Run executes cmd in a new session and returns the combined output,
+// error is returned when the command exits with non-zero status
+func (c *Client) Run(cmd string) (string, error) {
+	return c.run(cmd, nil)
+}
+
+// WriteFile writes content to path through the stdin of session, so the content
+// isn't exposed in the command line. A new file is created with mode 0600.
+func (c *Client) WriteFile(path string, content []byte) error {
+	_, err := c.run(fmt.Sprintf("umask 077 && cat > %s", Quote(path)), bytes.NewReader(content))
+	return err
+}
+
+func (c *Client) run(cmd string, stdin io.Reader) (string, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return "", errors.Wrapf(err, "new session to %s", c.config.Host)
+	}
+	defer session.Close()
+
+	if c.config.Sudo && c.config.User != "root" {
+		cmd = fmt.Sprintf("sudo -n sh -c %s", Quote(cmd))
+	}
+	session.Stdin = stdin
+	// stdout and stderr are copied by separate goroutines, CombinedOutput serializes the writes
+	out, err := session.CombinedOutput(cmd)
+	if err != nil {
+		// command is not included in error, it may contain passwords
+		return string(out), errors.Wrapf(err, "run command on %s: %s", c.config.Host, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// Quote quotes s as a single shell word
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// QuoteArgs joins args as a shell command line, the args containing characters other than
+// letters, digits and "-_./:=,@" are quoted
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.IndexFunc(arg, needQuote) < 0 {
+			quoted[i] = arg
+		} else {
+			quoted[i] = Quote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func needQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_./:=,@", r)
+}
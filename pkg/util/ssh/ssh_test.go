@@ -0,0 +1,137 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("new public key: %v", err)
+	}
+	return pub
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocadm-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostKey := newHostKey(t)
+	otherKey := newHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	hostname := "10.0.0.1:22"
+	knownHosts := filepath.Join(dir, "ssh", "known_hosts")
+
+	tests := []struct {
+		name    string
+		config  Config
+		key     ssh.PublicKey
+		wantErr bool
+	}{
+		{
+			name:    "missing known hosts file",
+			config:  Config{KnownHostsFile: knownHosts},
+			key:     hostKey,
+			wantErr: true,
+		},
+		{
+			name:   "trust on first use",
+			config: Config{KnownHostsFile: knownHosts, TrustOnFirstUse: true},
+			key:    hostKey,
+		},
+		{
+			name:   "known host",
+			config: Config{KnownHostsFile: knownHosts},
+			key:    hostKey,
+		},
+		{
+			name:    "mismatched key rejected on first use",
+			config:  Config{KnownHostsFile: knownHosts, TrustOnFirstUse: true},
+			key:     otherKey,
+			wantErr: true,
+		},
+		{
+			name:   "fingerprint",
+			config: Config{HostKeyFingerprint: ssh.FingerprintSHA256(otherKey)},
+			key:    otherKey,
+		},
+		{
+			name:    "mismatched fingerprint",
+			config:  Config{HostKeyFingerprint: ssh.FingerprintSHA256(hostKey)},
+			key:     otherKey,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback, err := HostKeyCallback(tt.config)
+			if err == nil {
+				err = callback(hostname, addr, tt.key)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify host key error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	unknown := Config{KnownHostsFile: knownHosts}
+	callback, err := HostKeyCallback(unknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback("10.0.0.2:22", &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 22}, hostKey); err == nil {
+		t.Errorf("unknown host should be rejected without trust on first use")
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "plain",
+			args: []string{"ocadm", "join", "10.0.0.1:6443", "--host-networks", "eth0/br0/10.0.0.10", "--node-labels=a=b,c@d"},
+			want: "ocadm join 10.0.0.1:6443 --host-networks eth0/br0/10.0.0.10 --node-labels=a=b,c@d",
+		},
+		{
+			name: "empty",
+			args: []string{"--mysql-password", ""},
+			want: "--mysql-password ''",
+		},
+		{
+			name: "single quote",
+			args: []string{"--mysql-password", "it's"},
+			want: `--mysql-password 'it'\''s'`,
+		},
+		{
+			name: "shell characters",
+			args: []string{"a b", "$HOME", "x;y", "c\r", "50%", "^x", "*", "~"},
+			want: `'a b' '$HOME' 'x;y' '` + "c\r" + `' '50%' '^x' '*' '~'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteArgs(tt.args); got != tt.want {
+				t.Errorf("QuoteArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
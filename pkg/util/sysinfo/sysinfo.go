@@ -0,0 +1,99 @@
+package sysinfo
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Root is a filesystem root where /proc, /sys and /dev are read from,
+// it's "/" on a real host and a fixture directory in tests
+type Root string
+
+const HostRoot Root = "/"
+
+func (r Root) Path(elem ...string) string {
+	return filepath.Join(append([]string{string(r)}, elem...)...)
+}
+
+func (r Root) Exists(elem ...string) bool {
+	_, err := os.Stat(r.Path(elem...))
+	return err == nil
+}
+
+// CPUFlags returns the union of cpu flags of all processors in /proc/cpuinfo,
+// 'Features' is read as well for arm64
+func (r Root) CPUFlags() (sets.String, error) {
+	f, err := os.Open(r.Path("proc", "cpuinfo"))
+	if err != nil {
+		return nil, errors.Wrap(err, "open cpuinfo")
+	}
+	defer f.Close()
+	flags := sets.NewString()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "flags", "Features":
+			flags.Insert(strings.Fields(parts[1])...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read cpuinfo")
+	}
+	return flags, nil
+}
+
+// KernelRelease returns the running kernel release, the same as 'uname -r'
+func (r Root) KernelRelease() (string, error) {
+	content, err := ioutil.ReadFile(r.Path("proc", "sys", "kernel", "osrelease"))
+	if err != nil {
+		return "", errors.Wrap(err, "read kernel release")
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// IsModuleLoaded returns true if kernel module is loaded or built into kernel
+func (r Root) IsModuleLoaded(name string) bool {
+	return r.Exists("sys", "module", name)
+}
+
+// IsModuleAvailable returns true if kernel module is loaded, built in or could be loaded by modprobe
+func (r Root) IsModuleAvailable(name string) (bool, error) {
+	if r.IsModuleLoaded(name) {
+		return true, nil
+	}
+	release, err := r.KernelRelease()
+	if err != nil {
+		return false, err
+	}
+	content, err := ioutil.ReadFile(r.Path("lib", "modules", release, "modules.dep"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "read modules.dep")
+	}
+	// module file name uses '_' and '-' interchangeably
+	names := sets.NewString(name, strings.Replace(name, "_", "-", -1))
+	for _, line := range strings.Split(string(content), "\n") {
+		modPath := strings.SplitN(line, ":", 2)[0]
+		if len(modPath) == 0 {
+			continue
+		}
+		base := filepath.Base(modPath)
+		base = base[:strings.Index(base+".", ".")]
+		if names.Has(base) {
+			return true, nil
+		}
+	}
+	return false, nil
+}